@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
@@ -49,6 +50,8 @@ var rootCmd = &cobra.Command{
 			HTTPBindAddr:        viper.GetString("http-bind-addr"),
 			TLSCertPath:         viper.GetString("tls-cert"),
 			TLSKeyPath:          viper.GetString("tls-key"),
+			TLSMinVersion:       viper.GetString("tls-min-version"),
+			TLSCipherSuites:     viper.GetString("tls-cipher-suites"),
 			LogLevel:            viper.GetUint64("log-level"),
 			LogFile:             viper.GetString("log-file"),
 			ZcashConfPath:       viper.GetString("zcash-conf-path"),
@@ -63,6 +66,33 @@ var rootCmd = &cobra.Command{
 			PingEnable:          viper.GetBool("ping-very-insecure"),
 			Darkside:            viper.GetBool("darkside-very-insecure"),
 			DarksideTimeout:     viper.GetUint64("darkside-timeout"),
+			DarksideMaxCreate:   viper.GetInt("darkside-max-blocks-create"),
+			DarksideMaxSession:  viper.GetInt("darkside-max-blocks-session"),
+			DarksideSessions:    viper.GetInt("darkside-max-sessions"),
+			DarksideOnTimeout:   viper.GetString("darkside-on-timeout"),
+			DarksideApplyMode:   viper.GetString("darkside-apply-mode"),
+			DarksideMaxIncoming: viper.GetInt("darkside-max-incoming-txs"),
+			DarksideIncoming:    viper.GetString("darkside-incoming-policy"),
+			DarksideMaxBlockTxs: viper.GetInt("darkside-max-block-txs"),
+			LatencyRetention:    viper.GetUint64("latency-log-retention"),
+			TxNotFoundRetries:   viper.GetInt("tx-not-found-retries"),
+			RejectDuringIBD:     viper.GetBool("reject-during-ibd"),
+			LogSampleRate:       viper.GetInt("log-sample-rate"),
+			MempoolHeightHint:   viper.GetBool("mempool-height-hint"),
+			DailyQuota:          viper.GetInt("daily-quota"),
+			RateLimit:           viper.GetFloat64("rate-limit"),
+			RateLimitBurst:      viper.GetInt("rate-limit-burst"),
+			MempoolMaxExclude:   viper.GetInt("mempool-max-exclude"),
+			MempoolWorkers:      viper.GetInt("mempool-workers"),
+			MaxLatestBlocks:     viper.GetInt("max-latest-blocks"),
+			MaxExportBlocks:     viper.GetInt("max-export-blocks"),
+			RangeCacheMode:      viper.GetString("range-cache-mode"),
+			ZcashdBlocksDir:     viper.GetString("zcashd-blocks-dir"),
+			ImportBlocksFile:    viper.GetString("import-blocks"),
+			ChainInfoCacheMs:    viper.GetUint64("chaininfo-cache-ms"),
+			HealthMaxAgeMs:      viper.GetUint64("health-max-age-ms"),
+			HealthMaxLag:        viper.GetInt("health-max-lag"),
+			OrphanedTxMode:      viper.GetString("orphaned-tx-mode"),
 		}
 
 		common.Log.Debugf("Options: %#v\n", opts)
@@ -97,6 +127,17 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+// importBlocks adds to the cache the blocks in the named file, which is in
+// the export format (see common.ImportBlocks), and returns how many.
+func importBlocks(cache *common.BlockCache, name string) (int, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return common.ImportBlocks(cache, file)
+}
+
 func fileExists(filename string) bool {
 	info, err := os.Stat(filename)
 	if os.IsNotExist(err) {
@@ -124,12 +165,15 @@ func startServer(opts *common.Options) error {
 	promRegistry.MustRegister(common.Metrics.TotalErrors)
 	promRegistry.MustRegister(common.Metrics.TotalBlocksServedConter)
 	promRegistry.MustRegister(common.Metrics.SendTransactionsCounter)
+	promRegistry.MustRegister(common.Metrics.DedupedSendsCounter)
+	promRegistry.MustRegister(common.Metrics.PingCounter)
 	promRegistry.MustRegister(common.Metrics.TotalSaplingParamsCounter)
 	promRegistry.MustRegister(common.Metrics.TotalSproutParamsCounter)
 	promRegistry.MustRegister(common.Metrics.MempoolClientsGauge)
 	promRegistry.MustRegister(common.Metrics.ZecPriceGauge)
 	promRegistry.MustRegister(common.Metrics.ZecPriceHistoryWebAPICounter)
 	promRegistry.MustRegister(common.Metrics.ZecPriceHistoryErrors)
+	promRegistry.MustRegister(common.Metrics.RequestLatencyHistogram)
 
 	logger.SetLevel(logrus.Level(opts.LogLevel))
 
@@ -143,6 +187,9 @@ func startServer(opts *common.Options) error {
 
 	// gRPC initialization
 	var server *grpc.Server
+	quota := frontend.NewDailyQuota(opts.DailyQuota)
+	rateLimit := frontend.NewRateLimit(opts.RateLimit, opts.RateLimitBurst)
+	maintenance := frontend.NewMaintenance(60 * time.Second)
 
 	if opts.NoTLSVeryInsecure {
 		common.Log.Warningln("Starting insecure no-TLS (plaintext) server")
@@ -150,22 +197,30 @@ func startServer(opts *common.Options) error {
 		server = grpc.NewServer(
 			grpc.StreamInterceptor(
 				grpc_middleware.ChainStreamServer(
+					maintenance.StreamInterceptor,
+					rateLimit.StreamInterceptor,
+					quota.StreamInterceptor,
+					logging.StreamLogInterceptor,
+					common.Metrics.StreamLatencyInterceptor,
 					grpc_prometheus.StreamServerInterceptor),
 			),
 			grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
+				maintenance.UnaryInterceptor,
+				rateLimit.UnaryInterceptor,
+				quota.UnaryInterceptor,
 				logging.LogInterceptor,
+				common.Metrics.UnaryLatencyInterceptor,
 				grpc_prometheus.UnaryServerInterceptor),
 			))
 	} else {
-		var transportCreds credentials.TransportCredentials
+		var tlsCert tls.Certificate
 		if opts.GenCertVeryInsecure {
 			common.Log.Warning("Certificate and key not provided, generating self signed values")
 			fmt.Println("Starting insecure self-certificate server")
-			tlsCert := common.GenerateCerts()
-			transportCreds = credentials.NewServerTLSFromCert(tlsCert)
+			tlsCert = *common.GenerateCerts()
 		} else {
 			var err error
-			transportCreds, err = credentials.NewServerTLSFromFile(opts.TLSCertPath, opts.TLSKeyPath)
+			tlsCert, err = tls.LoadX509KeyPair(opts.TLSCertPath, opts.TLSKeyPath)
 			if err != nil {
 				common.Log.WithFields(logrus.Fields{
 					"cert_file": opts.TLSCertPath,
@@ -174,13 +229,36 @@ func startServer(opts *common.Options) error {
 				}).Fatal("couldn't load TLS credentials")
 			}
 		}
+		var cipherSuites []string
+		if opts.TLSCipherSuites != "" {
+			cipherSuites = strings.Split(opts.TLSCipherSuites, ",")
+		}
+		tlsConfig, err := common.NewTLSConfig(tlsCert, opts.TLSMinVersion, cipherSuites)
+		if err != nil {
+			os.Stderr.WriteString(fmt.Sprintf("\n  ** Bad TLS configuration: %s\n\n", err))
+			common.Log.WithFields(logrus.Fields{
+				"min_version":   opts.TLSMinVersion,
+				"cipher_suites": opts.TLSCipherSuites,
+				"error":         err,
+			}).Fatal("bad TLS configuration")
+		}
+		transportCreds := credentials.NewTLS(tlsConfig)
 		server = grpc.NewServer(
 			grpc.Creds(transportCreds),
 			grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
+				maintenance.StreamInterceptor,
+				rateLimit.StreamInterceptor,
+				quota.StreamInterceptor,
+				logging.StreamLogInterceptor,
+				common.Metrics.StreamLatencyInterceptor,
 				grpc_prometheus.StreamServerInterceptor),
 			),
 			grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
+				maintenance.UnaryInterceptor,
+				rateLimit.UnaryInterceptor,
+				quota.UnaryInterceptor,
 				logging.LogInterceptor,
+				common.Metrics.UnaryLatencyInterceptor,
 				grpc_prometheus.UnaryServerInterceptor),
 			))
 	}
@@ -216,6 +294,7 @@ func startServer(opts *common.Options) error {
 		}
 		// Indirect function for test mocking (so unit tests can talk to stub functions).
 		common.RawRequest = rpcClient.RawRequest
+		common.ChainInfoCacheTTL = time.Duration(opts.ChainInfoCacheMs) * time.Millisecond
 
 		// Ensure that we can communicate with zcashd
 		common.FirstRPC()
@@ -257,24 +336,113 @@ func startServer(opts *common.Options) error {
 	}
 	cache := common.NewBlockCache(dbPath, chainName, saplingHeight, opts.Redownload)
 	if !opts.Darkside {
-		go common.BlockIngestor(cache, 0 /*loop forever*/)
+		go func() {
+			if opts.ImportBlocksFile != "" {
+				n, err := importBlocks(cache, opts.ImportBlocksFile)
+				if err != nil {
+					common.Log.WithFields(logrus.Fields{
+						"error":    err,
+						"file":     opts.ImportBlocksFile,
+						"imported": n,
+					}).Warn("couldn't import blocks, continuing over RPC")
+				} else {
+					common.Log.Info("Imported ", n, " blocks from ", opts.ImportBlocksFile)
+				}
+			}
+			if opts.ZcashdBlocksDir != "" {
+				n, err := common.WarmCacheFromBlockFiles(cache, opts.ZcashdBlocksDir, chainName)
+				if err != nil {
+					common.Log.WithFields(logrus.Fields{
+						"error": err,
+						"dir":   opts.ZcashdBlocksDir,
+						"added": n,
+					}).Warn("couldn't read zcashd block files, continuing over RPC")
+				} else {
+					common.Log.Info("Added ", n, " blocks from zcashd block files")
+				}
+			}
+			common.BlockIngestor(cache, 0 /*loop forever*/)
+		}()
 	} else {
 		// Darkside wants to control starting the block ingestor.
-		common.DarksideInit(cache, int(opts.DarksideTimeout))
+		common.DarksideMaxBlocksCreate = opts.DarksideMaxCreate
+		common.DarksideMaxBlocksSession = opts.DarksideMaxSession
+		common.DarksideMaxSessions = opts.DarksideSessions
+		var stop func()
+		switch opts.DarksideOnTimeout {
+		case "fatal":
+		case "graceful":
+			stop = server.GracefulStop
+		default:
+			common.Log.WithFields(logrus.Fields{
+				"darkside_on_timeout": opts.DarksideOnTimeout,
+			}).Fatal("bad --darkside-on-timeout, must be fatal or graceful")
+		}
+		switch opts.DarksideApplyMode {
+		case "serialize":
+		case "reject":
+			common.DarksideRejectConcurrentApply = true
+		default:
+			common.Log.WithFields(logrus.Fields{
+				"darkside_apply_mode": opts.DarksideApplyMode,
+			}).Fatal("bad --darkside-apply-mode, must be serialize or reject")
+		}
+		common.DarksideMaxIncomingTransactions = opts.DarksideMaxIncoming
+		switch opts.DarksideIncoming {
+		case "reject":
+		case "evict":
+			common.DarksideEvictIncoming = true
+		default:
+			common.Log.WithFields(logrus.Fields{
+				"darkside_incoming_policy": opts.DarksideIncoming,
+			}).Fatal("bad --darkside-incoming-policy, must be reject or evict")
+		}
+		if opts.DarksideMaxBlockTxs < 1 || opts.DarksideMaxBlockTxs > 65535 {
+			common.Log.WithFields(logrus.Fields{
+				"darkside_max_block_txs": opts.DarksideMaxBlockTxs,
+			}).Fatal("bad --darkside-max-block-txs, must be from 1 to 65535")
+		}
+		common.DarksideMaxBlockTransactions = opts.DarksideMaxBlockTxs
+		common.DarksideInit(cache, int(opts.DarksideTimeout), stop)
 	}
 
 	// Compact transaction service initialization
-	{
-		service, err := frontend.NewLwdStreamer(cache, chainName, opts.PingEnable)
-		if err != nil {
-			common.Log.WithFields(logrus.Fields{
-				"error": err,
-			}).Fatal("couldn't create backend")
-		}
-		walletrpc.RegisterCompactTxStreamerServer(server, service)
+	rangeCacheMode, err := common.ParseRangeCacheMode(opts.RangeCacheMode)
+	if err != nil {
+		common.Log.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("bad --range-cache-mode")
+	}
+	orphanedTxMode, err := common.ParseOrphanedTxMode(opts.OrphanedTxMode)
+	if err != nil {
+		common.Log.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("bad --orphaned-tx-mode")
 	}
+	lwdService, err := frontend.NewLwdStreamerWithOptions(cache,
+		frontend.WithChainName(chainName),
+		frontend.WithPing(opts.PingEnable),
+		frontend.WithLatencyRetention(time.Duration(opts.LatencyRetention)*time.Second),
+		frontend.WithTransactionRetry(opts.TxNotFoundRetries, 500*time.Millisecond),
+		frontend.WithRejectDuringIBD(opts.RejectDuringIBD),
+		frontend.WithLogSampling(opts.LogSampleRate),
+		frontend.WithMempoolHeightHint(opts.MempoolHeightHint),
+		frontend.WithMaxExclude(opts.MempoolMaxExclude),
+		frontend.WithMempoolWorkers(opts.MempoolWorkers),
+		frontend.WithMaxLatestBlocks(opts.MaxLatestBlocks),
+		frontend.WithMaxExportBlocks(opts.MaxExportBlocks),
+		frontend.WithRangeCacheMode(rangeCacheMode),
+		frontend.WithHealthMaxAge(time.Duration(opts.HealthMaxAgeMs)*time.Millisecond),
+		frontend.WithHealthMaxLag(opts.HealthMaxLag),
+		frontend.WithOrphanedTxMode(orphanedTxMode))
+	if err != nil {
+		common.Log.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("couldn't create backend")
+	}
+	walletrpc.RegisterCompactTxStreamerServer(server, lwdService)
 	if opts.Darkside {
-		service, err := frontend.NewDarksideStreamer(cache)
+		service, err := frontend.NewDarksideStreamer(cache, lwdService)
 		if err != nil {
 			common.Log.WithFields(logrus.Fields{
 				"error": err,
@@ -299,6 +467,17 @@ func startServer(opts *common.Options) error {
 		}).Fatal("couldn't create listener")
 	}
 
+	// SIGUSR1 turns maintenance mode on and off.
+	maintenanceSignals := make(chan os.Signal, 1)
+	signal.Notify(maintenanceSignals, syscall.SIGUSR1)
+	go func() {
+		for range maintenanceSignals {
+			common.Log.WithFields(logrus.Fields{
+				"maintenance": maintenance.Toggle(),
+			}).Info("caught SIGUSR1, toggled maintenance mode")
+		}
+	}()
+
 	// Signal handler for graceful stops
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
@@ -340,6 +519,8 @@ func init() {
 	rootCmd.Flags().Bool("grpc-logging-insecure", false, "enable grpc logging to stderr")
 	rootCmd.Flags().String("tls-cert", "./cert.pem", "the path to a TLS certificate")
 	rootCmd.Flags().String("tls-key", "./cert.key", "the path to a TLS key file")
+	rootCmd.Flags().String("tls-min-version", "1.2", "the minimum TLS version clients may use, 1.2 or 1.3")
+	rootCmd.Flags().String("tls-cipher-suites", "", "comma-separated TLS 1.2 cipher suites (IANA names) to allow; empty means Go's defaults")
 	rootCmd.Flags().Int("log-level", int(logrus.InfoLevel), "log level (logrus 1-7)")
 	rootCmd.Flags().String("log-file", "./server.log", "log file to write to")
 	rootCmd.Flags().String("zcash-conf-path", "./zcash.conf", "conf file to pull RPC creds from")
@@ -354,6 +535,33 @@ func init() {
 	rootCmd.Flags().Bool("ping-very-insecure", false, "allow Ping GRPC for testing")
 	rootCmd.Flags().Bool("darkside-very-insecure", false, "run with GRPC-controllable mock zcashd for integration testing (shuts down after 30 minutes)")
 	rootCmd.Flags().Int("darkside-timeout", 30, "override 30 minute default darkside timeout")
+	rootCmd.Flags().Int("latency-log-retention", 30, "seconds between a peer's bulk block requests within which their latency is logged")
+	rootCmd.Flags().Int("tx-not-found-retries", 0, "times GetTransaction retries (every 500ms) a transaction zcashd doesn't know of yet")
+	rootCmd.Flags().Bool("reject-during-ibd", false, "fail block requests (Unavailable) while zcashd is in initial block download")
+	rootCmd.Flags().Int("daily-quota", 0, "maximum requests per client IP address per (UTC) day; 0 means no limit")
+	rootCmd.Flags().Float64("rate-limit", 0, "maximum sustained requests per second per client IP address; 0 means no limit")
+	rootCmd.Flags().Int("rate-limit-burst", 10, "maximum requests a client IP address may make at once, beyond its rate-limit")
+	rootCmd.Flags().Int("mempool-max-exclude", 10000, "maximum number of txids in a GetMempoolTx exclude list")
+	rootCmd.Flags().Int("mempool-workers", 0, "number of goroutines that parse new mempool transactions (0 means the number of CPUs)")
+	rootCmd.Flags().Int("max-latest-blocks", 100, "maximum number of block IDs a GetLatestBlocks request may ask for")
+	rootCmd.Flags().Int("max-export-blocks", 10000, "maximum number of blocks an ExportBlocks request may span")
+	rootCmd.Flags().String("range-cache-mode", "passthrough", "whether GetBlockRange adds blocks it fetches from zcashd to the cache: passthrough or populate")
+	rootCmd.Flags().Bool("mempool-height-hint", false, "set GetMempoolTx transactions' height to the next block's height (default zero)")
+	rootCmd.Flags().String("zcashd-blocks-dir", "", "zcashd's blocks directory; if set, blk*.dat files there are read to fill the cache quickly at startup")
+	rootCmd.Flags().String("import-blocks", "", "a file of compact blocks in the export format (see ExportBlocks); if set, they're added to the cache at startup, before the block ingestor starts")
+	rootCmd.Flags().Int("chaininfo-cache-ms", 1000, "milliseconds for which zcashd's getblockchaininfo reply is reused (GetLatestBlock, GetLightdInfo, and the IBD and pruning checks); 0 disables")
+	rootCmd.Flags().Int("health-max-age-ms", 30000, "milliseconds for which GetServerHealth relies on zcashd's last getblockchaininfo reply before asking it again")
+	rootCmd.Flags().Int("health-max-lag", 10, "blocks the cache may be behind zcashd's tip while GetServerHealth reports healthy")
+	rootCmd.Flags().String("orphaned-tx-mode", "ignore", "what GetTransaction does when zcashd reports a transaction in a block that isn't on its best chain at that height: ignore, unconfirmed (report it as not mined) or reresolve (look for it in the best chain's blocks near that height first)")
+	rootCmd.Flags().Int("log-sample-rate", 1, "log only one of this many successful GetBlockRange and GetFullBlockRange requests")
+	rootCmd.Flags().Int("darkside-max-blocks-create", 10000, "maximum blocks a single darkside StageBlocksCreate may generate")
+	rootCmd.Flags().Int("darkside-max-blocks-session", 100000, "maximum blocks darkside StageBlocksCreate may generate between Resets")
+	rootCmd.Flags().String("darkside-on-timeout", "fatal", "at the darkside timeout, end the process (fatal) or stop the gRPC server (graceful)")
+	rootCmd.Flags().String("darkside-apply-mode", "serialize", "a darkside ApplyStaged that overlaps another on the same session waits for it (serialize) or fails with Aborted (reject)")
+	rootCmd.Flags().Int("darkside-max-incoming-txs", 0, "maximum transactions darkside holds as sent by the wallet (0 means no limit)")
+	rootCmd.Flags().String("darkside-incoming-policy", "reject", "a transaction sent beyond darkside-max-incoming-txs is rejected (reject) or displaces the oldest (evict)")
+	rootCmd.Flags().Int("darkside-max-block-txs", 65535, "maximum transactions, including the coinbase, in a block after darkside ApplyStaged adds the staged ones (at most 65535)")
+	rootCmd.Flags().Int("darkside-max-sessions", 16, "maximum concurrent named darkside sessions (see darkside-session request metadata); named sessions are staging-only, the wallet API always serves the default session")
 
 	viper.BindPFlag("grpc-bind-addr", rootCmd.Flags().Lookup("grpc-bind-addr"))
 	viper.SetDefault("grpc-bind-addr", "127.0.0.1:9067")
@@ -365,6 +573,10 @@ func init() {
 	viper.SetDefault("tls-cert", "./cert.pem")
 	viper.BindPFlag("tls-key", rootCmd.Flags().Lookup("tls-key"))
 	viper.SetDefault("tls-key", "./cert.key")
+	viper.BindPFlag("tls-min-version", rootCmd.Flags().Lookup("tls-min-version"))
+	viper.SetDefault("tls-min-version", "1.2")
+	viper.BindPFlag("tls-cipher-suites", rootCmd.Flags().Lookup("tls-cipher-suites"))
+	viper.SetDefault("tls-cipher-suites", "")
 	viper.BindPFlag("log-level", rootCmd.Flags().Lookup("log-level"))
 	viper.SetDefault("log-level", int(logrus.InfoLevel))
 	viper.BindPFlag("log-file", rootCmd.Flags().Lookup("log-file"))
@@ -389,6 +601,60 @@ func init() {
 	viper.SetDefault("darkside-very-insecure", false)
 	viper.BindPFlag("darkside-timeout", rootCmd.Flags().Lookup("darkside-timeout"))
 	viper.SetDefault("darkside-timeout", 30)
+	viper.BindPFlag("latency-log-retention", rootCmd.Flags().Lookup("latency-log-retention"))
+	viper.SetDefault("latency-log-retention", 30)
+	viper.BindPFlag("tx-not-found-retries", rootCmd.Flags().Lookup("tx-not-found-retries"))
+	viper.SetDefault("tx-not-found-retries", 0)
+	viper.BindPFlag("reject-during-ibd", rootCmd.Flags().Lookup("reject-during-ibd"))
+	viper.SetDefault("reject-during-ibd", false)
+	viper.BindPFlag("log-sample-rate", rootCmd.Flags().Lookup("log-sample-rate"))
+	viper.SetDefault("log-sample-rate", 1)
+	viper.BindPFlag("mempool-height-hint", rootCmd.Flags().Lookup("mempool-height-hint"))
+	viper.SetDefault("mempool-height-hint", false)
+	viper.BindPFlag("mempool-max-exclude", rootCmd.Flags().Lookup("mempool-max-exclude"))
+	viper.SetDefault("mempool-max-exclude", 10000)
+	viper.BindPFlag("mempool-workers", rootCmd.Flags().Lookup("mempool-workers"))
+	viper.SetDefault("mempool-workers", 0)
+	viper.BindPFlag("max-latest-blocks", rootCmd.Flags().Lookup("max-latest-blocks"))
+	viper.SetDefault("max-latest-blocks", 100)
+	viper.BindPFlag("max-export-blocks", rootCmd.Flags().Lookup("max-export-blocks"))
+	viper.SetDefault("max-export-blocks", 10000)
+	viper.BindPFlag("range-cache-mode", rootCmd.Flags().Lookup("range-cache-mode"))
+	viper.SetDefault("range-cache-mode", "passthrough")
+	viper.BindPFlag("daily-quota", rootCmd.Flags().Lookup("daily-quota"))
+	viper.SetDefault("daily-quota", 0)
+	viper.BindPFlag("rate-limit", rootCmd.Flags().Lookup("rate-limit"))
+	viper.SetDefault("rate-limit", 0)
+	viper.BindPFlag("rate-limit-burst", rootCmd.Flags().Lookup("rate-limit-burst"))
+	viper.SetDefault("rate-limit-burst", 10)
+	viper.BindPFlag("zcashd-blocks-dir", rootCmd.Flags().Lookup("zcashd-blocks-dir"))
+	viper.SetDefault("zcashd-blocks-dir", "")
+	viper.BindPFlag("import-blocks", rootCmd.Flags().Lookup("import-blocks"))
+	viper.SetDefault("import-blocks", "")
+	viper.BindPFlag("darkside-max-blocks-create", rootCmd.Flags().Lookup("darkside-max-blocks-create"))
+	viper.SetDefault("darkside-max-blocks-create", 10000)
+	viper.BindPFlag("darkside-max-blocks-session", rootCmd.Flags().Lookup("darkside-max-blocks-session"))
+	viper.SetDefault("darkside-max-blocks-session", 100000)
+	viper.BindPFlag("darkside-max-sessions", rootCmd.Flags().Lookup("darkside-max-sessions"))
+	viper.SetDefault("darkside-max-sessions", 16)
+	viper.BindPFlag("darkside-on-timeout", rootCmd.Flags().Lookup("darkside-on-timeout"))
+	viper.SetDefault("darkside-on-timeout", "fatal")
+	viper.BindPFlag("darkside-apply-mode", rootCmd.Flags().Lookup("darkside-apply-mode"))
+	viper.SetDefault("darkside-apply-mode", "serialize")
+	viper.BindPFlag("darkside-max-incoming-txs", rootCmd.Flags().Lookup("darkside-max-incoming-txs"))
+	viper.SetDefault("darkside-max-incoming-txs", 0)
+	viper.BindPFlag("darkside-incoming-policy", rootCmd.Flags().Lookup("darkside-incoming-policy"))
+	viper.SetDefault("darkside-incoming-policy", "reject")
+	viper.BindPFlag("darkside-max-block-txs", rootCmd.Flags().Lookup("darkside-max-block-txs"))
+	viper.SetDefault("darkside-max-block-txs", 65535)
+	viper.BindPFlag("chaininfo-cache-ms", rootCmd.Flags().Lookup("chaininfo-cache-ms"))
+	viper.SetDefault("chaininfo-cache-ms", 1000)
+	viper.BindPFlag("health-max-age-ms", rootCmd.Flags().Lookup("health-max-age-ms"))
+	viper.SetDefault("health-max-age-ms", 30000)
+	viper.BindPFlag("health-max-lag", rootCmd.Flags().Lookup("health-max-lag"))
+	viper.SetDefault("health-max-lag", 10)
+	viper.BindPFlag("orphaned-tx-mode", rootCmd.Flags().Lookup("orphaned-tx-mode"))
+	viper.SetDefault("orphaned-tx-mode", "ignore")
 
 	logger.SetFormatter(&logrus.TextFormatter{
 		//DisableColors:          true,
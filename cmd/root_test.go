@@ -4,7 +4,15 @@
 package cmd
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/adityapk00/lightwalletd/common"
+	"github.com/adityapk00/lightwalletd/walletrpc"
+	"github.com/sirupsen/logrus"
 )
 
 func TestFileExists(t *testing.T) {
@@ -20,3 +28,47 @@ func TestFileExists(t *testing.T) {
 		t.Fatal("fileExists failed")
 	}
 }
+
+func TestImportBlocks(t *testing.T) {
+	common.Log = logrus.NewEntry(logrus.New())
+	common.Log.Logger.SetOutput(ioutil.Discard)
+	dir, err := ioutil.TempDir("", "lwd-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cache := common.NewBlockCache(filepath.Join(dir, "db"), "unittestnet", 1000, true)
+	defer cache.Close()
+
+	if _, err := importBlocks(cache, filepath.Join(dir, "nonexistent")); err == nil {
+		t.Fatal("importBlocks of a nonexistent file succeeded")
+	}
+
+	// Three blocks, each linking to the one before.
+	var export []byte
+	prevhash := make([]byte, 32)
+	for height := 1000; height < 1003; height++ {
+		hash := bytes.Repeat([]byte{byte(height)}, 32)
+		record, err := common.MarshalExportRecord(&walletrpc.CompactBlock{
+			Height:   uint64(height),
+			Hash:     hash,
+			PrevHash: prevhash,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		export = append(export, record...)
+		prevhash = hash
+	}
+	name := filepath.Join(dir, "blocks.export")
+	if err := ioutil.WriteFile(name, export, 0644); err != nil {
+		t.Fatal(err)
+	}
+	n, err := importBlocks(cache, name)
+	if err != nil {
+		t.Fatal("importBlocks failed:", err)
+	}
+	if n != 3 || cache.GetLatestHeight() != 1002 {
+		t.Fatal("importBlocks unexpected result", n, cache.GetLatestHeight())
+	}
+}
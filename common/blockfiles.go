@@ -0,0 +1,162 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/adityapk00/lightwalletd/parser"
+	"github.com/adityapk00/lightwalletd/walletrpc"
+	"github.com/sirupsen/logrus"
+)
+
+// blockFileMagic is the network's message start, which precedes each block
+// (and its 4-byte length) in zcashd's blk?????.dat files.
+var blockFileMagic = map[string][4]byte{
+	"main":    {0x24, 0xe9, 0x27, 0x64},
+	"test":    {0xfa, 0x1a, 0xf9, 0xbf},
+	"regtest": {0xaa, 0xe8, 0x3f, 0x5f},
+}
+
+// blockFileWindow bounds how far ahead of the cache's next height a block
+// read from the block files is held while waiting for its predecessors
+// (zcashd stores blocks in the order it receives them, which is only
+// roughly by height); blocks further ahead are dropped.
+const blockFileWindow = 10000
+
+// blockFileMaxSize is larger than any valid block.
+const blockFileMaxSize = 8 * 1000 * 1000
+
+// WarmCacheFromBlockFiles adds to the cache the blocks, read from the block
+// files (blk*.dat) in zcashd's blocks directory, that extend the cache's
+// chain, which is much faster than fetching them over RPC. Each block is
+// parsed, and must link to the one before it; where the files hold more
+// than one block that could come next (a fork), zcashd's getblock decides.
+// (zcashd also supplies the txids of v5 transactions.)
+// It returns the number of blocks added; the BlockIngestor, started
+// afterwards, carries on from there (and corrects any stale tip).
+func WarmCacheFromBlockFiles(c *BlockCache, dir string, chainName string) (int, error) {
+	magic, ok := blockFileMagic[chainName]
+	if !ok {
+		return 0, errors.New("no block file format for chain " + chainName)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "blk*.dat"))
+	if err != nil {
+		return 0, err
+	}
+	if len(files) == 0 {
+		return 0, errors.New("no blk*.dat files in " + dir)
+	}
+	sort.Strings(files)
+
+	// Blocks that can't be added yet, by height.
+	pending := make(map[int][]*walletrpc.CompactBlock)
+	added := 0
+	addPending := func() error {
+		for {
+			height := c.GetNextHeight()
+			candidates := pending[height]
+			delete(pending, height)
+			var next *walletrpc.CompactBlock
+			for _, block := range candidates {
+				if c.HashMismatch(block.PrevHash) {
+					continue
+				}
+				if next != nil {
+					// A fork; ask zcashd which block is on its best chain.
+					next, err = getBlockFromRPC(height)
+					if err != nil {
+						return err
+					}
+					if next == nil || c.HashMismatch(next.PrevHash) {
+						return errors.New(fmt.Sprint("can't resolve fork at height ", height))
+					}
+					break
+				}
+				next = block
+			}
+			if next == nil {
+				return nil
+			}
+			if err := c.Add(height, next); err != nil {
+				return err
+			}
+			added++
+		}
+	}
+	for _, file := range files {
+		err := readBlockFile(file, magic, func(block *parser.Block) error {
+			height := block.GetHeight()
+			if height < c.GetNextHeight() || height >= c.GetNextHeight()+blockFileWindow {
+				return nil
+			}
+			if err := setV5TxIDs(block); err != nil {
+				return err
+			}
+			pending[height] = append(pending[height], block.ToCompact())
+			return addPending()
+		})
+		if err != nil {
+			return added, err
+		}
+		Log.WithFields(logrus.Fields{
+			"file":   filepath.Base(file),
+			"height": c.GetLatestHeight(),
+		}).Info("Read block file")
+	}
+	return added, nil
+}
+
+// readBlockFile calls f with each block in the given blk?????.dat file.
+func readBlockFile(name string, magic [4]byte, f func(*parser.Block) error) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if bytes.Equal(header[:4], []byte{0, 0, 0, 0}) {
+			// The unused (preallocated) end of the file.
+			return nil
+		}
+		if !bytes.Equal(header[:4], magic[:]) {
+			return errors.New("bad block file magic in " + name)
+		}
+		size := binary.LittleEndian.Uint32(header[4:])
+		if size > blockFileMaxSize {
+			return errors.New(fmt.Sprint("block too large (", size, " bytes) in ", name))
+		}
+		blockData := make([]byte, size)
+		if _, err := io.ReadFull(r, blockData); err != nil {
+			return err
+		}
+		block := parser.NewBlock()
+		rest, err := block.ParseFromSlice(blockData)
+		if err != nil {
+			return err
+		}
+		if len(rest) != 0 {
+			return errors.New("block file record has extra data in " + name)
+		}
+		if err := f(block); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeBlockFile writes the given blocks as zcashd does, followed by some
+// of the zeros that pad a preallocated file.
+func writeBlockFile(t *testing.T, name string, blocks [][]byte) {
+	var b bytes.Buffer
+	magic := blockFileMagic["test"]
+	for _, block := range blocks {
+		b.Write(magic[:])
+		binary.Write(&b, binary.LittleEndian, uint32(len(block)))
+		b.Write(block)
+	}
+	b.Write(make([]byte, 100))
+	if err := ioutil.WriteFile(name, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWarmCacheFromBlockFiles(t *testing.T) {
+	loadCompacts(t)
+	var compactTests []struct {
+		Full string `json:"full"`
+	}
+	blockJSON, err := ioutil.ReadFile("../testdata/compact_blocks.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(blockJSON, &compactTests); err != nil {
+		t.Fatal(err)
+	}
+	var blocks [][]byte
+	for _, test := range compactTests {
+		blockData, _ := hex.DecodeString(test.Full)
+		blocks = append(blocks, blockData)
+	}
+
+	dir, err := ioutil.TempDir("", "blockfiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Out of order, and across files, as zcashd may store them.
+	writeBlockFile(t, filepath.Join(dir, "blk00000.dat"), [][]byte{blocks[1], blocks[0], blocks[3]})
+	writeBlockFile(t, filepath.Join(dir, "blk00001.dat"), [][]byte{blocks[2], blocks[5], blocks[4]})
+
+	os.RemoveAll(unitTestPath)
+	c := NewBlockCache(unitTestPath, unitTestChain, 289460, true)
+	defer os.RemoveAll(unitTestPath)
+	defer c.Close()
+	// The first block is already cached, so its copy in the files is skipped.
+	if err := c.Add(289460, compacts[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := WarmCacheFromBlockFiles(c, dir, "test")
+	if err != nil {
+		t.Fatal("WarmCacheFromBlockFiles failed:", err)
+	}
+	if n != 5 || c.GetLatestHeight() != 289465 {
+		t.Fatal("unexpected blocks added", n, "latest height", c.GetLatestHeight())
+	}
+	for i, compact := range compacts {
+		b := c.Get(289460 + i)
+		if b == nil || !bytes.Equal(b.Hash, compact.Hash) {
+			t.Fatal("unexpected cached block at height", 289460+i)
+		}
+	}
+
+	// The wrong network's files are rejected.
+	if _, err := WarmCacheFromBlockFiles(c, dir, "main"); err == nil {
+		t.Fatal("WarmCacheFromBlockFiles accepted the wrong magic")
+	}
+}
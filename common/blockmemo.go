@@ -0,0 +1,75 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/adityapk00/lightwalletd/walletrpc"
+)
+
+// blockMemoSize is the number of unmarshalled compact blocks the BlockCache
+// keeps in memory, so popular heights (usually those near the tip) aren't
+// read from disk and unmarshalled on every request.
+const blockMemoSize = 200
+
+// blockMemo is a least-recently-used set of compact blocks, by height.
+type blockMemo struct {
+	mutex  sync.Mutex
+	size   int
+	lru    *list.List // of *walletrpc.CompactBlock, front is most recently used
+	blocks map[int]*list.Element
+}
+
+func newBlockMemo(size int) *blockMemo {
+	return &blockMemo{
+		size:   size,
+		lru:    list.New(),
+		blocks: make(map[int]*list.Element),
+	}
+}
+
+func (m *blockMemo) get(height int) *walletrpc.CompactBlock {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	e, ok := m.blocks[height]
+	if !ok {
+		return nil
+	}
+	m.lru.MoveToFront(e)
+	return e.Value.(*walletrpc.CompactBlock)
+}
+
+func (m *blockMemo) add(height int, block *walletrpc.CompactBlock) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.size == 0 {
+		return
+	}
+	if e, ok := m.blocks[height]; ok {
+		e.Value = block
+		m.lru.MoveToFront(e)
+		return
+	}
+	m.blocks[height] = m.lru.PushFront(block)
+	if m.lru.Len() > m.size {
+		oldest := m.lru.Back()
+		m.lru.Remove(oldest)
+		delete(m.blocks, int(oldest.Value.(*walletrpc.CompactBlock).Height))
+	}
+}
+
+// removeFrom forgets the blocks at the given height and above (they've
+// been reorged away or removed from the cache).
+func (m *blockMemo) removeFrom(height int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for h, e := range m.blocks {
+		if h >= height {
+			m.lru.Remove(e)
+			delete(m.blocks, h)
+		}
+	}
+}
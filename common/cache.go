@@ -28,6 +28,13 @@ type BlockCache struct {
 	nextBlock               int     // height of the first block not in the cache
 	latestHash              []byte  // hash of the most recent (highest height) block, for detecting reorgs.
 	mutex                   sync.RWMutex
+
+	// tipChanged is closed (and replaced) each time a block is added or
+	// blocks are removed (by Reorg).
+	tipChanged chan struct{}
+
+	// recently-requested blocks, already unmarshalled
+	memo *blockMemo
 }
 
 // GetNextHeight returns the height of the lowest unobtained block.
@@ -44,6 +51,15 @@ func (c *BlockCache) GetFirstHeight() int {
 	return c.firstBlock
 }
 
+// TipChanged returns a channel that is closed the next time a block is
+// added to the cache or the cache is rolled back by Reorg. Get the channel
+// before checking the height to avoid missing an update.
+func (c *BlockCache) TipChanged() <-chan struct{} {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.tipChanged
+}
+
 // GetLatestHash returns the hash (block ID) of the most recent (highest) known block.
 func (c *BlockCache) GetLatestHash() []byte {
 	c.mutex.RLock()
@@ -78,6 +94,7 @@ func (c *BlockCache) setDbFiles(height int) {
 		c.Sync()
 		c.starts = c.starts[:index+1]
 		c.nextBlock = height
+		c.memo.removeFrom(height)
 		c.setLatestHash()
 	}
 }
@@ -185,6 +202,7 @@ func (c *BlockCache) setLatestHash() {
 // Reset is used only for darkside testing.
 func (c *BlockCache) Reset(startHeight int) {
 	c.setDbFiles(c.firstBlock) // empty the cache
+	c.memo.removeFrom(0)
 	c.firstBlock = startHeight
 	c.nextBlock = startHeight
 }
@@ -193,6 +211,8 @@ func (c *BlockCache) Reset(startHeight int) {
 // (No locking here, we assume this is single-threaded.)
 func NewBlockCache(dbPath string, chainName string, startHeight int, redownload bool) *BlockCache {
 	c := &BlockCache{}
+	c.tipChanged = make(chan struct{})
+	c.memo = newBlockMemo(blockMemoSize)
 	c.firstBlock = startHeight
 	c.nextBlock = startHeight
 	c.lengthsName, c.blocksName = dbFileNames(dbPath, chainName)
@@ -261,10 +281,27 @@ func dbFileNames(dbPath string, chainName string) (string, string) {
 // Add adds the given block to the cache at the given height, returning true
 // if a reorg was detected.
 func (c *BlockCache) Add(height int, block *walletrpc.CompactBlock) error {
-	// Invariant: m[firstBlock..nextBlock) are valid.
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	return c.add(height, block)
+}
+
+// AddIfNext adds the given block if it's the one the cache needs next: at
+// the next height, and following the latest block. It reports whether the
+// block was added. Unlike Add, it can be called while something else (the
+// BlockIngestor) may be adding blocks.
+func (c *BlockCache) AddIfNext(height int, block *walletrpc.CompactBlock) (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if height != c.nextBlock || (c.latestHash != nil && !bytes.Equal(c.latestHash, block.PrevHash)) {
+		return false, nil
+	}
+	return true, c.add(height, block)
+}
 
+// Caller should hold c.mutex.Lock().
+func (c *BlockCache) add(height int, block *walletrpc.CompactBlock) error {
+	// Invariant: m[firstBlock..nextBlock) are valid.
 	if height > c.nextBlock {
 		// Cache has been reset (for example, checksum error)
 		return nil
@@ -320,6 +357,8 @@ func (c *BlockCache) Add(height int, block *walletrpc.CompactBlock) error {
 	}
 	copy(c.latestHash, block.Hash)
 	c.nextBlock++
+	close(c.tipChanged)
+	c.tipChanged = make(chan struct{})
 	// Invariant: m[firstBlock..nextBlock) are valid.
 	return nil
 }
@@ -340,6 +379,7 @@ func (c *BlockCache) Reorg(height int) {
 	}
 	// Remove the end of the cache.
 	c.nextBlock = height
+	c.memo.removeFrom(height)
 	newCacheLen := height - c.firstBlock
 	c.starts = c.starts[:newCacheLen+1]
 
@@ -350,10 +390,13 @@ func (c *BlockCache) Reorg(height int) {
 		Log.Fatal("truncate failed: ", err)
 	}
 	c.setLatestHash()
+	close(c.tipChanged)
+	c.tipChanged = make(chan struct{})
 }
 
 // Get returns the compact block at the requested height if it's
-// in the cache, else nil.
+// in the cache, else nil. Recently requested blocks are shared
+// between callers, so the caller must not modify the block.
 func (c *BlockCache) Get(height int) *walletrpc.CompactBlock {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
@@ -361,6 +404,9 @@ func (c *BlockCache) Get(height int) *walletrpc.CompactBlock {
 	if height < c.firstBlock || height >= c.nextBlock {
 		return nil
 	}
+	if block := c.memo.get(height); block != nil {
+		return block
+	}
 	block := c.readBlock(height)
 	if block == nil {
 		go func() {
@@ -371,6 +417,7 @@ func (c *BlockCache) Get(height int) *walletrpc.CompactBlock {
 		}()
 		return nil
 	}
+	c.memo.add(height, block)
 	return block
 }
 
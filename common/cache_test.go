@@ -4,14 +4,17 @@
 package common
 
 import (
+	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"testing"
 
 	"github.com/adityapk00/lightwalletd/parser"
 	"github.com/adityapk00/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
 )
 
 var compacts []*walletrpc.CompactBlock
@@ -22,7 +25,11 @@ const (
 	unitTestChain = "unittestnet"
 )
 
-func TestCache(t *testing.T) {
+// loadCompacts derives the compact blocks from the test data (once).
+func loadCompacts(t testing.TB) {
+	if len(compacts) > 0 {
+		return
+	}
 	type compactTest struct {
 		BlockHeight int    `json:"block"`
 		BlockHash   string `json:"hash"`
@@ -55,6 +62,10 @@ func TestCache(t *testing.T) {
 		}
 		compacts = append(compacts, block.ToCompact())
 	}
+}
+
+func TestCache(t *testing.T) {
+	loadCompacts(t)
 
 	// Pretend Sapling starts at 289460.
 	os.RemoveAll(unitTestPath)
@@ -100,7 +111,14 @@ func TestCache(t *testing.T) {
 func reorgCache(t *testing.T) {
 	// Simulate a reorg by adding a block whose height is lower than the latest;
 	// we're replacing the second block, so there should be only two blocks.
+	// Waiters are notified of the rollback.
+	tipChanged := cache.TipChanged()
 	cache.Reorg(289461)
+	select {
+	case <-tipChanged:
+	default:
+		t.Fatal("missing tip change notification for reorg")
+	}
 	err := cache.Add(289461, compacts[1])
 	if err != nil {
 		t.Fatal(err)
@@ -123,11 +141,22 @@ func reorgCache(t *testing.T) {
 		t.Fatal("unexpected block contents")
 	}
 
-	// Make sure we can go forward from here
+	// Make sure we can go forward from here, and that waiters are notified
+	tipChanged = cache.TipChanged()
+	select {
+	case <-tipChanged:
+		t.Fatal("unexpected tip change notification")
+	default:
+	}
 	err = cache.Add(289462, compacts[2])
 	if err != nil {
 		t.Fatal(err)
 	}
+	select {
+	case <-tipChanged:
+	default:
+		t.Fatal("missing tip change notification")
+	}
 	if cache.firstBlock != 289460 {
 		t.Fatal("unexpected firstBlock height")
 	}
@@ -182,3 +211,60 @@ func fillCache(t *testing.T) {
 		}
 	}
 }
+
+func TestCacheMemo(t *testing.T) {
+	loadCompacts(t)
+	os.RemoveAll(unitTestPath)
+	c := NewBlockCache(unitTestPath, unitTestChain, 289460, true)
+	defer os.RemoveAll(unitTestPath)
+	defer c.Close()
+	for i := 0; i < 3; i++ {
+		if err := c.Add(289460+i, compacts[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The second Get is served from memory.
+	b1 := c.Get(289461)
+	if b1 == nil || c.Get(289461) != b1 {
+		t.Fatal("repeated Get did not return the remembered block")
+	}
+
+	// A reorg must not leave the old block behind.
+	c.Reorg(289461)
+	if c.Get(289461) != nil {
+		t.Fatal("Get returned a block that was reorged away")
+	}
+	replacement := proto.Clone(compacts[1]).(*walletrpc.CompactBlock)
+	replacement.Hash = make([]byte, 32)
+	if err := c.Add(289461, replacement); err != nil {
+		t.Fatal(err)
+	}
+	if b := c.Get(289461); b == nil || !bytes.Equal(b.Hash, replacement.Hash) {
+		t.Fatal("Get returned a stale block after a reorg")
+	}
+}
+
+func BenchmarkCacheGet(b *testing.B) {
+	loadCompacts(b)
+	for _, size := range []int{0, blockMemoSize} {
+		b.Run(fmt.Sprintf("memo=%d", size), func(b *testing.B) {
+			os.RemoveAll(unitTestPath)
+			c := NewBlockCache(unitTestPath, unitTestChain, 289460, true)
+			defer os.RemoveAll(unitTestPath)
+			defer c.Close()
+			c.memo = newBlockMemo(size)
+			for i, compact := range compacts {
+				if err := c.Add(289460+i, compact); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if c.Get(289460+i%len(compacts)) == nil {
+					b.Fatal("Get failed")
+				}
+			}
+		})
+	}
+}
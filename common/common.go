@@ -5,16 +5,21 @@
 package common
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/adityapk00/lightwalletd/parser"
 	"github.com/adityapk00/lightwalletd/walletrpc"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // 'make build' will overwrite this string with the output of git-describe (tag)
@@ -27,25 +32,54 @@ var (
 )
 
 type Options struct {
-	GRPCBindAddr        string `json:"grpc_bind_address,omitempty"`
-	GRPCLogging         bool   `json:"grpc_logging_insecure,omitempty"`
-	HTTPBindAddr        string `json:"http_bind_address,omitempty"`
-	TLSCertPath         string `json:"tls_cert_path,omitempty"`
-	TLSKeyPath          string `json:"tls_cert_key,omitempty"`
-	LogLevel            uint64 `json:"log_level,omitempty"`
-	LogFile             string `json:"log_file,omitempty"`
-	ZcashConfPath       string `json:"zcash_conf,omitempty"`
-	RPCUser             string `json:"rpcuser"`
-	RPCPassword         string `json:"rpcpassword"`
-	RPCHost             string `json:"rpchost"`
-	RPCPort             string `json:"rpcport"`
-	NoTLSVeryInsecure   bool   `json:"no_tls_very_insecure,omitempty"`
-	GenCertVeryInsecure bool   `json:"gen_cert_very_insecure,omitempty"`
-	Redownload          bool   `json:"redownload"`
-	DataDir             string `json:"data_dir"`
-	PingEnable          bool   `json:"ping_enable"`
-	Darkside            bool   `json:"darkside"`
-	DarksideTimeout     uint64 `json:"darkside_timeout"`
+	GRPCBindAddr        string  `json:"grpc_bind_address,omitempty"`
+	GRPCLogging         bool    `json:"grpc_logging_insecure,omitempty"`
+	HTTPBindAddr        string  `json:"http_bind_address,omitempty"`
+	TLSCertPath         string  `json:"tls_cert_path,omitempty"`
+	TLSKeyPath          string  `json:"tls_cert_key,omitempty"`
+	TLSMinVersion       string  `json:"tls_min_version,omitempty"`
+	TLSCipherSuites     string  `json:"tls_cipher_suites,omitempty"`
+	LogLevel            uint64  `json:"log_level,omitempty"`
+	LogFile             string  `json:"log_file,omitempty"`
+	ZcashConfPath       string  `json:"zcash_conf,omitempty"`
+	RPCUser             string  `json:"rpcuser"`
+	RPCPassword         string  `json:"rpcpassword"`
+	RPCHost             string  `json:"rpchost"`
+	RPCPort             string  `json:"rpcport"`
+	NoTLSVeryInsecure   bool    `json:"no_tls_very_insecure,omitempty"`
+	GenCertVeryInsecure bool    `json:"gen_cert_very_insecure,omitempty"`
+	Redownload          bool    `json:"redownload"`
+	DataDir             string  `json:"data_dir"`
+	PingEnable          bool    `json:"ping_enable"`
+	Darkside            bool    `json:"darkside"`
+	DarksideTimeout     uint64  `json:"darkside_timeout"`
+	DarksideMaxCreate   int     `json:"darkside_max_blocks_create"`
+	DarksideMaxSession  int     `json:"darkside_max_blocks_session"`
+	DarksideSessions    int     `json:"darkside_max_sessions"`
+	DarksideOnTimeout   string  `json:"darkside_on_timeout"`
+	DarksideApplyMode   string  `json:"darkside_apply_mode"`
+	DarksideMaxIncoming int     `json:"darkside_max_incoming_txs"`
+	DarksideIncoming    string  `json:"darkside_incoming_policy"`
+	DarksideMaxBlockTxs int     `json:"darkside_max_block_txs"`
+	LatencyRetention    uint64  `json:"latency_log_retention"`
+	TxNotFoundRetries   int     `json:"tx_not_found_retries"`
+	RejectDuringIBD     bool    `json:"reject_during_ibd"`
+	LogSampleRate       int     `json:"log_sample_rate"`
+	MempoolHeightHint   bool    `json:"mempool_height_hint"`
+	DailyQuota          int     `json:"daily_quota"`
+	RateLimit           float64 `json:"rate_limit"`
+	RateLimitBurst      int     `json:"rate_limit_burst"`
+	MempoolMaxExclude   int     `json:"mempool_max_exclude"`
+	MempoolWorkers      int     `json:"mempool_workers"`
+	MaxLatestBlocks     int     `json:"max_latest_blocks"`
+	MaxExportBlocks     int     `json:"max_export_blocks"`
+	RangeCacheMode      string  `json:"range_cache_mode"`
+	ZcashdBlocksDir     string  `json:"zcashd_blocks_dir,omitempty"`
+	ImportBlocksFile    string  `json:"import_blocks_file,omitempty"`
+	ChainInfoCacheMs    uint64  `json:"chaininfo_cache_ms"`
+	HealthMaxAgeMs      uint64  `json:"health_max_age_ms"`
+	HealthMaxLag        int     `json:"health_max_lag"`
+	OrphanedTxMode      string  `json:"orphaned_tx_mode"`
 }
 
 // RawRequest points to the function to send a an RPC request to zcashd;
@@ -53,6 +87,22 @@ type Options struct {
 // in unit tests it points to a function to mock RPCs to zcashd.
 var RawRequest func(method string, params []json.RawMessage) (json.RawMessage, error)
 
+// BackendUnavailableError is a failure to reach zcashd at all, rather than
+// an error reply from it. gRPC handlers that return one (unwrapped) give the
+// client Unavailable.
+type BackendUnavailableError struct {
+	Err error
+}
+
+func (e *BackendUnavailableError) Error() string {
+	return "zcashd unreachable: " + e.Err.Error()
+}
+
+// GRPCStatus lets status.FromError() (and so gRPC) see the error's code.
+func (e *BackendUnavailableError) GRPCStatus() *status.Status {
+	return status.New(codes.Unavailable, e.Error())
+}
+
 // Sleep allows a request to time.Sleep() to be mocked for testing;
 // in production, it points to the standard library time.Sleep();
 // in unit tests it points to a mock function.
@@ -64,6 +114,12 @@ var Log *logrus.Entry
 // Metrics as a global object to simplify things
 var Metrics *PrometheusMetrics
 
+// Consensus branch IDs, the keys of the getblockchaininfo upgrades map.
+const (
+	saplingBranchID = "76b809bb"
+	nu5BranchID     = "c2d6d0b4" // activates the Orchard pool
+)
+
 // The following are JSON zcashd rpc requests and replies.
 type (
 	// zcashd rpc "getblockchaininfo"
@@ -77,12 +133,17 @@ type (
 		Chaintip  string // example: "e9ff75a6" (canopy)
 	}
 	ZcashdRpcReplyGetblockchaininfo struct {
-		Chain           string
-		Upgrades        map[string]Upgradeinfo
-		Blocks          int
-		BestBlockHash   string
-		Consensus       ConsensusInfo
-		EstimatedHeight int
+		Chain                        string
+		Upgrades                     map[string]Upgradeinfo
+		Blocks                       int
+		BestBlockHash                string
+		Consensus                    ConsensusInfo
+		EstimatedHeight              int
+		VerificationProgress         float64
+		InitialBlockDownloadComplete *bool `json:"initial_block_download_complete"`
+		MedianTime                   int64 // median time of the past 11 blocks
+		Pruned                       bool
+		PruneHeight                  int // lowest block zcashd has, if pruned
 	}
 
 	// zcashd rpc "getinfo"
@@ -98,6 +159,18 @@ type (
 		End       uint64   `json:"end"`
 	}
 
+	// zcashd rpc "getaddressdeltas"
+	ZcashdRpcRequestGetaddressdeltas struct {
+		Addresses []string `json:"addresses"`
+		Start     uint64   `json:"start"`
+		End       uint64   `json:"end"`
+	}
+	ZcashdRpcReplyGetaddressdeltas []struct {
+		// unneeded fields can be omitted
+		Txid   string
+		Height int
+	}
+
 	// zcashd rpc "z_gettreestate"
 	ZcashdRpcReplyGettreestate struct {
 		Height  int
@@ -105,16 +178,34 @@ type (
 		Time    uint32
 		Sapling struct {
 			Commitments struct {
+				FinalRoot  string
+				FinalState string
+			}
+			SkipHash string
+		}
+		Orchard struct { // absent before Orchard activation
+			Commitments struct {
+				FinalRoot  string
 				FinalState string
 			}
 			SkipHash string
 		}
 	}
 
+	// zcashd rpc "getblock" (verbosity 1)
+	ZcashdRpcReplyGetblock struct {
+		Hash          string
+		Height        int
+		Confirmations int      // -1 if the block isn't on the best chain
+		Tx            []string // txids
+	}
+
 	// zcashd rpc "getrawtransaction"
 	ZcashdRpcReplyGetrawtransaction struct {
-		Hex    string
-		Height int
+		Hex           string
+		Height        int
+		Confirmations int
+		Blockhash     string // empty if the transaction is in the mempool
 	}
 
 	// zcashd rpc "getaddressbalance"
@@ -128,6 +219,7 @@ type (
 	// zcashd rpc "getaddressutxos"
 	ZcashdRpcRequestGetaddressutxos struct {
 		Addresses []string `json:"addresses"`
+		ChainInfo bool     `json:"chainInfo,omitempty"`
 	}
 	ZcashdRpcReplyGetaddressutxos []struct {
 		Address     string
@@ -137,8 +229,64 @@ type (
 		Satoshis    uint64
 		Height      int
 	}
+	// the reply when chainInfo is requested: the utxos as of the given block
+	ZcashdRpcReplyGetaddressutxosChainInfo struct {
+		Utxos  ZcashdRpcReplyGetaddressutxos
+		Hash   string
+		Height int
+	}
 )
 
+// ChainInfoCacheTTL is how long GetBlockchainInfo reuses zcashd's
+// getblockchaininfo reply. Zero (the default, and what darkside uses, since
+// its chain changes at the test's command) means every call asks zcashd.
+var ChainInfoCacheTTL time.Duration
+
+// chainInfoCache is GetBlockchainInfo's most recent reply; the mutex is held
+// while asking zcashd, so concurrent callers wait for and share one reply.
+var chainInfoCache struct {
+	mutex sync.Mutex
+	reply *ZcashdRpcReplyGetblockchaininfo
+	time  time.Time
+}
+
+// GetBlockchainInfo returns zcashd's getblockchaininfo reply, which callers
+// within ChainInfoCacheTTL of each other share (so they mustn't modify it).
+func GetBlockchainInfo() (*ZcashdRpcReplyGetblockchaininfo, error) {
+	chainInfoCache.mutex.Lock()
+	defer chainInfoCache.mutex.Unlock()
+	if chainInfoCache.reply != nil && time.Since(chainInfoCache.time) < ChainInfoCacheTTL {
+		return chainInfoCache.reply, nil
+	}
+	result, rpcErr := RawRequest("getblockchaininfo", []json.RawMessage{})
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	var reply ZcashdRpcReplyGetblockchaininfo
+	if err := json.Unmarshal(result, &reply); err != nil {
+		return nil, err
+	}
+	chainInfoCache.reply = &reply
+	chainInfoCache.time = time.Now()
+	return &reply, nil
+}
+
+// LastBlockchainInfo returns GetBlockchainInfo's most recent reply (which
+// mustn't be modified) and when zcashd gave it, or nil if there hasn't been
+// one; unlike GetBlockchainInfo, it never asks zcashd.
+func LastBlockchainInfo() (*ZcashdRpcReplyGetblockchaininfo, time.Time) {
+	chainInfoCache.mutex.Lock()
+	defer chainInfoCache.mutex.Unlock()
+	return chainInfoCache.reply, chainInfoCache.time
+}
+
+// InitialBlockDownload returns true if zcashd reports that it's still
+// doing its initial block download (so it doesn't yet have all blocks).
+// Versions of zcashd that don't report this are assumed to be synced.
+func (info *ZcashdRpcReplyGetblockchaininfo) InitialBlockDownload() bool {
+	return info.InitialBlockDownloadComplete != nil && !*info.InitialBlockDownloadComplete
+}
+
 // FirstRPC tests that we can successfully reach zcashd through the RPC
 // interface. The specific RPC used here is not important.
 func FirstRPC() {
@@ -181,20 +329,31 @@ func GetLightdInfo() (*walletrpc.LightdInfo, error) {
 		return nil, rpcErr
 	}
 
-	result, rpcErr = RawRequest("getblockchaininfo", []json.RawMessage{})
-	if rpcErr != nil {
-		return nil, rpcErr
-	}
-	var getblockchaininfoReply ZcashdRpcReplyGetblockchaininfo
-	err = json.Unmarshal(result, &getblockchaininfoReply)
+	getblockchaininfoReply, err := GetBlockchainInfo()
 	if err != nil {
-		return nil, rpcErr
+		return nil, err
 	}
 	// If the sapling consensus branch doesn't exist, it must be regtest
 	var saplingHeight int
-	if saplingJSON, ok := getblockchaininfoReply.Upgrades["76b809bb"]; ok { // Sapling ID
+	if saplingJSON, ok := getblockchaininfoReply.Upgrades[saplingBranchID]; ok {
 		saplingHeight = saplingJSON.ActivationHeight
 	}
+	// The node doesn't list NU5 if it isn't scheduled on this chain.
+	var orchardHeight int
+	if orchardJSON, ok := getblockchaininfoReply.Upgrades[nu5BranchID]; ok {
+		orchardHeight = orchardJSON.ActivationHeight
+	}
+
+	// Darkside reports -1 before it has any blocks.
+	var blockHeight int
+	if getblockchaininfoReply.Blocks > 0 {
+		blockHeight = getblockchaininfoReply.Blocks
+	}
+
+	var pruneHeight int
+	if getblockchaininfoReply.Pruned {
+		pruneHeight = getblockchaininfoReply.PruneHeight
+	}
 
 	vendor := "Zecwallet LightWalletD"
 	if DarksideEnabled {
@@ -207,7 +366,7 @@ func GetLightdInfo() (*walletrpc.LightdInfo, error) {
 		ChainName:               getblockchaininfoReply.Chain,
 		SaplingActivationHeight: uint64(saplingHeight),
 		ConsensusBranchId:       getblockchaininfoReply.Consensus.Chaintip,
-		BlockHeight:             uint64(getblockchaininfoReply.Blocks),
+		BlockHeight:             uint64(blockHeight),
 		GitCommit:               GitCommit,
 		Branch:                  Branch,
 		BuildDate:               BuildDate,
@@ -215,6 +374,10 @@ func GetLightdInfo() (*walletrpc.LightdInfo, error) {
 		EstimatedHeight:         uint64(getblockchaininfoReply.EstimatedHeight),
 		ZcashdBuild:             getinfoReply.Build,
 		ZcashdSubversion:        getinfoReply.Subversion,
+		OrchardActivationHeight: uint64(orchardHeight),
+		VerificationProgress:    getblockchaininfoReply.VerificationProgress,
+		InitialBlockDownload:    getblockchaininfoReply.InitialBlockDownload(),
+		PruneHeight:             uint64(pruneHeight),
 	}, nil
 }
 
@@ -228,19 +391,24 @@ func getBestBlockHash() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	hashbytes, err := hex.DecodeString(hash)
-	if err != nil {
+	return parser.DisplayHexToInternal(hash)
+}
+
+func getBlockFromRPC(height int) (*walletrpc.CompactBlock, error) {
+	block, _, err := getFullBlockFromRPC(height)
+	if block == nil {
 		return nil, err
 	}
-
-	return parser.Reverse(hashbytes), nil
+	return block.ToCompact(), nil
 }
 
-func getBlockFromRPC(height int) (*walletrpc.CompactBlock, error) {
+// getFullBlockFromRPC returns the parsed and serialized block at the given
+// height, or nil (and no error) if zcashd doesn't have that block yet.
+func getFullBlockFromRPC(height int) (*parser.Block, []byte, error) {
 	params := make([]json.RawMessage, 2)
 	heightJSON, err := json.Marshal(strconv.Itoa(height))
 	if err != nil {
-		return nil, errors.Wrap(err, "error marshaling height")
+		return nil, nil, errors.Wrap(err, "error marshaling height")
 	}
 	params[0] = heightJSON
 	params[1] = json.RawMessage("0") // non-verbose (raw hex)
@@ -250,36 +418,84 @@ func getBlockFromRPC(height int) (*walletrpc.CompactBlock, error) {
 	if rpcErr != nil {
 		// Check to see if we are requesting a height the zcashd doesn't have yet
 		if (strings.Split(rpcErr.Error(), ":"))[0] == "-8" {
-			return nil, nil
+			return nil, nil, nil
 		}
-		return nil, errors.Wrap(rpcErr, "error requesting block")
+		return nil, nil, errors.Wrap(rpcErr, "error requesting block")
 	}
 
 	var blockDataHex string
 	err = json.Unmarshal(result, &blockDataHex)
 	if err != nil {
-		return nil, errors.Wrap(err, "error reading JSON response")
+		return nil, nil, errors.Wrap(err, "error reading JSON response")
 	}
 
 	blockData, err := hex.DecodeString(blockDataHex)
 	if err != nil {
-		return nil, errors.Wrap(err, "error decoding getblock output")
+		return nil, nil, errors.Wrap(err, "error decoding getblock output")
 	}
 
 	block := parser.NewBlock()
 	rest, err := block.ParseFromSlice(blockData)
 	if err != nil {
-		return nil, errors.Wrap(err, "error parsing block")
+		return nil, nil, errors.Wrap(err, "error parsing block")
 	}
 	if len(rest) != 0 {
-		return nil, errors.New("received overlong message")
+		return nil, nil, errors.New("received overlong message")
 	}
 
 	if block.GetHeight() != height {
-		return nil, errors.New("received unexpected height block")
+		return nil, nil, errors.New("received unexpected height block")
+	}
+	if err := setV5TxIDs(block); err != nil {
+		return nil, nil, err
 	}
 
-	return block.ToCompact(), nil
+	return block, blockData, nil
+}
+
+// setV5TxIDs gives the block's v5 transactions their txids, which the
+// parser doesn't compute (they're ZIP 244 digests, not SHA256d), from
+// zcashd's verbose getblock reply. Blocks without v5 transactions don't
+// need the extra request.
+func setV5TxIDs(block *parser.Block) error {
+	txs := block.Transactions()
+	hasV5 := false
+	for _, tx := range txs {
+		if tx.Version() >= 5 {
+			hasV5 = true
+			break
+		}
+	}
+	if !hasV5 {
+		return nil
+	}
+	hashJSON, err := json.Marshal(hex.EncodeToString(block.GetDisplayHash()))
+	if err != nil {
+		return errors.Wrap(err, "error marshaling block hash")
+	}
+	result, rpcErr := RawRequest("getblock", []json.RawMessage{hashJSON, json.RawMessage("1")})
+	if rpcErr != nil {
+		return errors.Wrap(rpcErr, "error requesting block txids")
+	}
+	var reply ZcashdRpcReplyGetblock
+	if err := json.Unmarshal(result, &reply); err != nil {
+		return errors.Wrap(err, "error reading JSON response")
+	}
+	if len(reply.Tx) != len(txs) {
+		return errors.Errorf("getblock returned %d txids for a block of %d transactions",
+			len(reply.Tx), len(txs))
+	}
+	for i, tx := range txs {
+		if tx.Version() < 5 {
+			continue
+		}
+		txid, err := hex.DecodeString(reply.Tx[i])
+		if err != nil || len(txid) != 32 {
+			return errors.Errorf("getblock returned a bad txid %q", reply.Tx[i])
+		}
+		tx.SetTxID(txid)
+	}
+	return nil
 }
 
 var (
@@ -410,10 +626,11 @@ func BlockIngestor(c *BlockCache, rep int) {
 			c.Reorg(height - 1)
 			continue
 		}
-		// We have a valid block to add.
+		// We have a valid block to add (unless GetBlockRange, populating
+		// the cache, just added it).
 		wait = true
 		reorgCount = 0
-		if err := c.Add(height, block); err != nil {
+		if _, err := c.AddIfNext(height, block); err != nil {
 			Log.Fatal("Cache add failed:", err)
 		}
 		// Don't log these too often.
@@ -447,8 +664,190 @@ func GetBlock(cache *BlockCache, height int) (*walletrpc.CompactBlock, error) {
 	return block, nil
 }
 
+// GetBlockByHash returns the compact block with the given hash (little-endian,
+// as in CompactBlock.Hash), from the cache if it's there, else made from the
+// block zcashd returns. It returns nil (and no error) if zcashd doesn't know
+// the hash.
+func GetBlockByHash(cache *BlockCache, hash []byte) (*walletrpc.CompactBlock, error) {
+	hashJSON, err := json.Marshal(parser.InternalToDisplayHex(hash))
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling hash")
+	}
+	params := []json.RawMessage{hashJSON, json.RawMessage("0")}
+	result, rpcErr := RawRequest("getblock", params)
+	if rpcErr != nil {
+		// zcashd's "Block not found"
+		if (strings.Split(rpcErr.Error(), ":"))[0] == "-5" {
+			return nil, nil
+		}
+		return nil, errors.Wrap(rpcErr, "error requesting block")
+	}
+	var blockDataHex string
+	if err := json.Unmarshal(result, &blockDataHex); err != nil {
+		return nil, errors.Wrap(err, "error reading JSON response")
+	}
+	blockData, err := hex.DecodeString(blockDataHex)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding getblock output")
+	}
+	block := parser.NewBlock()
+	rest, err := block.ParseFromSlice(blockData)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing block")
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("received overlong message")
+	}
+	if !bytes.Equal(block.GetEncodableHash(), hash) {
+		return nil, errors.New("received unexpected hash block")
+	}
+	// The cache has only best-chain blocks; this one may not be.
+	if cBlock := cache.Get(block.GetHeight()); cBlock != nil && bytes.Equal(cBlock.Hash, hash) {
+		return cBlock, nil
+	}
+	if err := setV5TxIDs(block); err != nil {
+		return nil, err
+	}
+	return block.ToCompact(), nil
+}
+
+// GetFullBlock returns the serialized block at the requested height, as
+// zcashd provides it, and the block's hash (little-endian). The block
+// has been parsed, so the hash is computed from its header.
+func GetFullBlock(height int) ([]byte, []byte, error) {
+	block, blockData, err := getFullBlockFromRPC(height)
+	if err != nil {
+		return nil, nil, err
+	}
+	if block == nil {
+		// Block height is too large
+		return nil, nil, errors.New("block requested is newer than latest block")
+	}
+	return blockData, block.GetEncodableHash(), nil
+}
+
+// GetBlockWithOptions returns the compact block at the requested height,
+// built with the given options (see parser.CompactOptions). These blocks
+// aren't cached, so it always asks zcashd.
+func GetBlockWithOptions(height int, options parser.CompactOptions) (*walletrpc.CompactBlock, error) {
+	block, _, err := getFullBlockFromRPC(height)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		// Block height is too large
+		return nil, errors.New("block requested is newer than latest block")
+	}
+	return block.ToCompactWithOptions(options), nil
+}
+
+// GetBlockCoinbase returns the details of the coinbase transaction of the
+// block at the requested height, which it asks zcashd for (the cache has
+// only compact blocks).
+func GetBlockCoinbase(height int) (*walletrpc.CoinbaseInfo, error) {
+	block, _, err := getFullBlockFromRPC(height)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		// Block height is too large
+		return nil, errors.New("block requested is newer than latest block")
+	}
+	info, err := block.CoinbaseInfo()
+	if err != nil {
+		return nil, err
+	}
+	if info.Height != uint64(height) {
+		return nil, errors.Errorf("coinbase of block at height %d encodes height %d", height, info.Height)
+	}
+	return info, nil
+}
+
+// RangeCacheMode is whether GetBlockRange adds the blocks it has to fetch
+// from zcashd (because they aren't yet cached) to the cache.
+type RangeCacheMode int
+
+const (
+	// RangeCachePassthrough leaves the cache to the BlockIngestor.
+	RangeCachePassthrough RangeCacheMode = iota
+	// RangeCachePopulate adds each fetched block that extends the cache
+	// (the next height, following the latest block), so later requests
+	// are served from the cache. Blocks beyond that, or requested in
+	// descending order, can't be added (the cache is contiguous).
+	RangeCachePopulate
+)
+
+// ParseRangeCacheMode returns the mode with the given name, "passthrough"
+// or "populate".
+func ParseRangeCacheMode(name string) (RangeCacheMode, error) {
+	switch name {
+	case "passthrough":
+		return RangeCachePassthrough, nil
+	case "populate":
+		return RangeCachePopulate, nil
+	}
+	return 0, errors.New("unknown range cache mode " + name + " (must be passthrough or populate)")
+}
+
+// OrphanedTxMode is what GetTransaction does when zcashd reports a
+// transaction as mined in a block that isn't the one zcashd now has at the
+// reported height (the block was reorged out, and the height is stale).
+type OrphanedTxMode int
+
+const (
+	// OrphanedTxIgnore returns zcashd's reply without checking it.
+	OrphanedTxIgnore OrphanedTxMode = iota
+	// OrphanedTxUnconfirmed reports such a transaction as not mined.
+	OrphanedTxUnconfirmed
+	// OrphanedTxReresolve looks for the transaction in the blocks on
+	// zcashd's best chain around the stale height (a reorg usually mines it
+	// again close by), and reports the block it's found in, or else
+	// reports it as not mined.
+	OrphanedTxReresolve
+)
+
+// ParseOrphanedTxMode returns the mode with the given name, "ignore",
+// "unconfirmed" or "reresolve".
+func ParseOrphanedTxMode(name string) (OrphanedTxMode, error) {
+	switch name {
+	case "ignore":
+		return OrphanedTxIgnore, nil
+	case "unconfirmed":
+		return OrphanedTxUnconfirmed, nil
+	case "reresolve":
+		return OrphanedTxReresolve, nil
+	}
+	return 0, errors.New("unknown orphaned transaction mode " + name + " (must be ignore, unconfirmed or reresolve)")
+}
+
 // GetBlockRange returns a sequence of consecutive blocks in the given range.
-func GetBlockRange(cache *BlockCache, blockOut chan<- *walletrpc.CompactBlock, errOut chan<- error, start, end int) {
+// Both ends are inclusive, so start == end sends exactly one block; if start
+// is greater than end, the blocks are sent in descending order. Once ctx is
+// done, no more blocks are fetched and nothing more is sent (not even an
+// error); the receiver is assumed to have given up.
+func GetBlockRange(ctx context.Context, cache *BlockCache, mode RangeCacheMode, blockOut chan<- *walletrpc.CompactBlock, errOut chan<- error, start, end int) {
+	getBlockRange(ctx, func(height int) (*walletrpc.CompactBlock, error) {
+		block, err := GetBlock(cache, height)
+		if err != nil || mode != RangeCachePopulate {
+			return block, err
+		}
+		// (This does nothing if the block came from the cache.)
+		if _, err := cache.AddIfNext(height, block); err != nil {
+			return nil, err
+		}
+		return block, nil
+	}, blockOut, errOut, start, end)
+}
+
+// GetBlockRangeWithOptions is like GetBlockRange, but the blocks are built
+// with the given options (see GetBlockWithOptions).
+func GetBlockRangeWithOptions(ctx context.Context, options parser.CompactOptions, blockOut chan<- *walletrpc.CompactBlock, errOut chan<- error, start, end int) {
+	getBlockRange(ctx, func(height int) (*walletrpc.CompactBlock, error) {
+		return GetBlockWithOptions(height, options)
+	}, blockOut, errOut, start, end)
+}
+
+func getBlockRange(ctx context.Context, getBlock func(int) (*walletrpc.CompactBlock, error), blockOut chan<- *walletrpc.CompactBlock, errOut chan<- error, start, end int) {
 	// Go over [start, end] inclusive
 	low := start
 	high := end
@@ -462,16 +861,29 @@ func GetBlockRange(cache *BlockCache, blockOut chan<- *walletrpc.CompactBlock, e
 			// reverse the order
 			j = high - (i - low)
 		}
-		block, err := GetBlock(cache, j)
+		if ctx.Err() != nil {
+			return
+		}
+		block, err := getBlock(j)
 		if err != nil {
-			errOut <- err
+			select {
+			case errOut <- err:
+			case <-ctx.Done():
+			}
 			return
 		}
-		blockOut <- block
+		select {
+		case blockOut <- block:
+		case <-ctx.Done():
+			return
+		}
+	}
+	select {
+	case errOut <- nil:
+	case <-ctx.Done():
 	}
-	errOut <- nil
 }
 
 func displayHash(hash []byte) string {
-	return hex.EncodeToString(parser.Reverse(hash))
+	return parser.InternalToDisplayHex(hash)
 }
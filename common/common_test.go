@@ -5,17 +5,25 @@ package common
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/adityapk00/lightwalletd/parser"
 	"github.com/adityapk00/lightwalletd/walletrpc"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 )
 
 // ------------------------------------------ Setup
@@ -107,6 +115,126 @@ func getLightdInfoStub(method string, params []json.RawMessage) (json.RawMessage
 	return nil, nil
 }
 
+func TestGetLightdInfoActivationHeights(t *testing.T) {
+	testT = t
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getinfo":
+			return json.Marshal(&ZcashdRpcReplyGetinfo{})
+		case "getblockchaininfo":
+			return json.Marshal(&ZcashdRpcReplyGetblockchaininfo{
+				Chain: "main",
+				Upgrades: map[string]Upgradeinfo{
+					"5ba81b19": {ActivationHeight: 347500},  // Overwinter
+					"76b809bb": {ActivationHeight: 419200},  // Sapling
+					"c2d6d0b4": {ActivationHeight: 1687104}, // NU5
+				},
+			})
+		}
+		testT.Fatal("unexpected method", method)
+		return nil, nil
+	}
+	info, err := GetLightdInfo()
+	if err != nil {
+		t.Fatal("GetLightdInfo failed", err)
+	}
+	if info.SaplingActivationHeight != 419200 {
+		t.Error("unexpected saplingActivationHeight", info.SaplingActivationHeight)
+	}
+	if info.OrchardActivationHeight != 1687104 {
+		t.Error("unexpected orchardActivationHeight", info.OrchardActivationHeight)
+	}
+}
+
+func TestGetBlockchainInfoCache(t *testing.T) {
+	testT = t
+	var calls int32
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method == "getinfo" {
+			return json.Marshal(&ZcashdRpcReplyGetinfo{})
+		}
+		n := atomic.AddInt32(&calls, 1)
+		return json.Marshal(&ZcashdRpcReplyGetblockchaininfo{Blocks: int(n)})
+	}
+	defer func() { ChainInfoCacheTTL = 0 }()
+
+	// Without a TTL, every call asks zcashd.
+	for i := 1; i <= 2; i++ {
+		info, err := GetBlockchainInfo()
+		if err != nil {
+			t.Fatal("GetBlockchainInfo failed", err)
+		}
+		if info.Blocks != i {
+			t.Fatal("GetBlockchainInfo unexpected reply", info.Blocks, "expected", i)
+		}
+	}
+
+	// Concurrent callers within the TTL share one reply.
+	ChainInfoCacheTTL = time.Hour
+	chainInfoCache.reply = nil
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := GetLightdInfo(); err != nil {
+				testT.Error("GetLightdInfo failed", err)
+			}
+			if _, err := GetBlockchainInfo(); err != nil {
+				testT.Error("GetBlockchainInfo failed", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 3 {
+		t.Fatal("unexpected number of getblockchaininfo calls", calls)
+	}
+	info, err := GetLightdInfo()
+	if err != nil {
+		t.Fatal("GetLightdInfo failed", err)
+	}
+	if info.BlockHeight != 3 {
+		t.Fatal("GetLightdInfo unexpected height", info.BlockHeight)
+	}
+
+	// Once the reply is older than the TTL, zcashd is asked again.
+	ChainInfoCacheTTL = time.Millisecond
+	time.Sleep(2 * time.Millisecond)
+	if info, err := GetBlockchainInfo(); err != nil || info.Blocks != 4 {
+		t.Fatal("GetBlockchainInfo didn't refresh an expired reply", info, err)
+	}
+}
+
+func TestGetLightdInfoInitialBlockDownload(t *testing.T) {
+	testT = t
+	var complete *bool
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method == "getinfo" {
+			return json.Marshal(&ZcashdRpcReplyGetinfo{})
+		}
+		return json.Marshal(&ZcashdRpcReplyGetblockchaininfo{
+			VerificationProgress:         0.25,
+			InitialBlockDownloadComplete: complete,
+		})
+	}
+	// Older zcashd doesn't report it; assume it's synced.
+	info, err := GetLightdInfo()
+	if err != nil {
+		t.Fatal("GetLightdInfo failed", err)
+	}
+	if info.InitialBlockDownload || info.VerificationProgress != 0.25 {
+		t.Error("unexpected IBD status", info.InitialBlockDownload, info.VerificationProgress)
+	}
+	complete = new(bool)
+	info, err = GetLightdInfo()
+	if err != nil {
+		t.Fatal("GetLightdInfo failed", err)
+	}
+	if !info.InitialBlockDownload {
+		t.Error("expected initial block download")
+	}
+}
+
 func TestGetLightdInfo(t *testing.T) {
 	testT = t
 	RawRequest = getLightdInfoStub
@@ -269,10 +397,16 @@ func getblockStub(method string, params []json.RawMessage) (json.RawMessage, err
 
 func TestBlockIngestor(t *testing.T) {
 	testT = t
-	RawRequest = getblockStub
 	Sleep = sleepStub
 	os.RemoveAll(unitTestPath)
 	testcache := NewBlockCache(unitTestPath, unitTestChain, 380640, false)
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method == "getbestblockhash" {
+			// The cache's latest block is the best (no 1-block reorg).
+			return json.Marshal(parser.InternalToDisplayHex(testcache.GetLatestHash()))
+		}
+		return getblockStub(method, params)
+	}
 	BlockIngestor(testcache, 11)
 	if step != 11 {
 		t.Error("unexpected final step", step)
@@ -290,7 +424,7 @@ func TestGetBlockRange(t *testing.T) {
 	testcache := NewBlockCache(unitTestPath, unitTestChain, 380640, true)
 	blockChan := make(chan *walletrpc.CompactBlock)
 	errChan := make(chan error)
-	go GetBlockRange(testcache, blockChan, errChan, 380640, 380642)
+	go GetBlockRange(context.Background(), testcache, RangeCachePassthrough, blockChan, errChan, 380640, 380642)
 
 	// read in block 380640
 	select {
@@ -329,6 +463,99 @@ func TestGetBlockRange(t *testing.T) {
 	os.RemoveAll(unitTestPath)
 }
 
+func TestGetBlockRangeCancel(t *testing.T) {
+	testT = t
+	var fetches int32
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		var height string
+		json.Unmarshal(params[0], &height)
+		h, _ := strconv.Atoi(height)
+		atomic.AddInt32(&fetches, 1)
+		return blocks[h-380640], nil
+	}
+	os.RemoveAll(unitTestPath)
+	testcache := NewBlockCache(unitTestPath, unitTestChain, 380640, true)
+	defer os.RemoveAll(unitTestPath)
+	blockChan := make(chan *walletrpc.CompactBlock)
+	errChan := make(chan error)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		GetBlockRange(ctx, testcache, RangeCachePassthrough, blockChan, errChan, 380640, 380643)
+		close(done)
+	}()
+
+	// Read one block, then give up on the rest.
+	select {
+	case err := <-errChan:
+		t.Fatal("unexpected error:", err)
+	case <-blockChan:
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetBlockRange didn't return after cancellation")
+	}
+	// The second block may have been fetched before the cancellation was
+	// noticed, but no more.
+	if n := atomic.LoadInt32(&fetches); n > 2 {
+		t.Fatal("GetBlockRange kept fetching after cancellation:", n)
+	}
+}
+
+func TestGetBlockRangePopulate(t *testing.T) {
+	testT = t
+	var fetches int
+	RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		var height string
+		json.Unmarshal(params[0], &height)
+		h, _ := strconv.Atoi(height)
+		fetches++
+		return blocks[h-380640], nil
+	}
+	getRange := func(c *BlockCache, mode RangeCacheMode) {
+		blockChan := make(chan *walletrpc.CompactBlock)
+		errChan := make(chan error)
+		go GetBlockRange(context.Background(), c, mode, blockChan, errChan, 380640, 380643)
+		for {
+			select {
+			case err := <-errChan:
+				if err != nil {
+					t.Fatal("GetBlockRange failed:", err)
+				}
+				return
+			case <-blockChan:
+			}
+		}
+	}
+	defer os.RemoveAll(unitTestPath)
+	for _, mode := range []RangeCacheMode{RangeCachePassthrough, RangeCachePopulate} {
+		os.RemoveAll(unitTestPath)
+		testcache := NewBlockCache(unitTestPath, unitTestChain, 380640, true)
+		fetches = 0
+		getRange(testcache, mode)
+		if fetches != 4 {
+			t.Fatal("unexpected fetches", fetches)
+		}
+		getRange(testcache, mode)
+		if mode == RangeCachePassthrough {
+			if fetches != 8 || testcache.GetLatestHeight() != -1 {
+				t.Fatal("passthrough mode changed the cache", fetches, testcache.GetLatestHeight())
+			}
+		} else {
+			// The second request is served from the cache.
+			if fetches != 4 || testcache.GetLatestHeight() != 380643 {
+				t.Fatal("populate mode didn't fill the cache", fetches, testcache.GetLatestHeight())
+			}
+		}
+		testcache.Close()
+	}
+	if _, err := ParseRangeCacheMode("sometimes"); err == nil {
+		t.Fatal("ParseRangeCacheMode accepted a bad mode")
+	}
+}
+
 // There are four test blocks, 0..3
 func getblockStubReverse(method string, params []json.RawMessage) (json.RawMessage, error) {
 	var height string
@@ -371,7 +598,7 @@ func TestGetBlockRangeReverse(t *testing.T) {
 	errChan := make(chan error)
 
 	// Request the blocks in reverse order by specifying start greater than end
-	go GetBlockRange(testcache, blockChan, errChan, 380642, 380640)
+	go GetBlockRange(context.Background(), testcache, RangeCachePassthrough, blockChan, errChan, 380642, 380640)
 
 	// read in block 380642
 	select {
@@ -414,3 +641,111 @@ func TestGenerateCerts(t *testing.T) {
 		t.Fatal("GenerateCerts returned nil")
 	}
 }
+
+func TestDarksideShutdown(t *testing.T) {
+	savedRawRequest, savedUnit := RawRequest, darksideTimeoutUnit
+	defer func() {
+		RawRequest, darksideTimeoutUnit = savedRawRequest, savedUnit
+		DarksideEnabled = false
+		logger.ExitFunc = nil
+	}()
+	var fatal int32
+	logger.ExitFunc = func(int) { atomic.StoreInt32(&fatal, 1) }
+	darksideTimeoutUnit = time.Millisecond
+
+	// Without a shutdown, the timer ends the process.
+	DarksideInit(nil, 10, nil)
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt32(&fatal) == 0 {
+		t.Fatal("darkside timer didn't fire")
+	}
+
+	atomic.StoreInt32(&fatal, 0)
+	DarksideInit(nil, 10, nil)
+	DarksideShutdown()
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt32(&fatal) != 0 {
+		t.Fatal("darkside timer fired after DarksideShutdown")
+	}
+	// Shutting down again is harmless.
+	DarksideShutdown()
+}
+
+func TestDarksideTimeoutGraceful(t *testing.T) {
+	savedRawRequest, savedUnit := RawRequest, darksideTimeoutUnit
+	defer func() {
+		RawRequest, darksideTimeoutUnit = savedRawRequest, savedUnit
+		DarksideEnabled = false
+		logger.ExitFunc = nil
+	}()
+	var fatal int32
+	logger.ExitFunc = func(int) { atomic.StoreInt32(&fatal, 1) }
+	darksideTimeoutUnit = time.Millisecond
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	DarksideInit(nil, 10, server.GracefulStop)
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatal("gRPC server failed:", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("darkside timer didn't stop the gRPC server")
+	}
+	if atomic.LoadInt32(&fatal) != 0 {
+		t.Fatal("darkside timer ended the process")
+	}
+}
+
+func TestLatencyInterceptors(t *testing.T) {
+	m := GetPrometheusMetrics()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(m.RequestLatencyHistogram)
+
+	unaryInfo := &grpc.UnaryServerInfo{FullMethod: "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetTransaction"}
+	for i := 0; i < 2; i++ {
+		_, err := m.UnaryLatencyInterceptor(context.Background(), nil, unaryInfo,
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, errors.New("failed")
+			})
+		if err == nil || err.Error() != "failed" {
+			t.Fatal("UnaryLatencyInterceptor unexpected error:", err)
+		}
+	}
+	streamInfo := &grpc.StreamServerInfo{FullMethod: "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetBlockRange"}
+	if err := m.StreamLatencyInterceptor(nil, nil, streamInfo,
+		func(srv interface{}, ss grpc.ServerStream) error {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}); err != nil {
+		t.Fatal("StreamLatencyInterceptor failed:", err)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 1 {
+		t.Fatal("unexpected metric families", len(families))
+	}
+	counts := make(map[string]uint64)
+	for _, metric := range families[0].GetMetric() {
+		h := metric.GetHistogram()
+		counts[metric.GetLabel()[0].GetValue()] = h.GetSampleCount()
+		if metric.GetLabel()[0].GetValue() == "GetBlockRange" && h.GetSampleSum() < 0.01 {
+			t.Fatal("GetBlockRange latency too small", h.GetSampleSum())
+		}
+	}
+	if len(counts) != 2 || counts["GetTransaction"] != 2 || counts["GetBlockRange"] != 1 {
+		t.Fatal("unexpected latency sample counts", counts)
+	}
+}
@@ -4,17 +4,24 @@ import (
 	"bufio"
 	"bytes"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/adityapk00/lightwalletd/parser"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type darksideState struct {
@@ -38,17 +45,131 @@ type darksideState struct {
 	// applied in arrival order.
 	stagedBlocks [][]byte // full blocks, binary
 
+	// Prevhashes that ApplyStaged() must not relink (see
+	// DarksideStageBlockWithPrevhash()): stagedPrevhash is keyed by index
+	// into stagedBlocks, activePrevhash by height.
+	stagedPrevhash map[int][]byte
+	activePrevhash map[int][]byte
+
 	// These are full transactions as received from the wallet by SendTransaction().
 	// They are conceptually in the mempool. They are not yet available to be fetched
 	// by GetTransaction(). They can be fetched by darkside GetIncomingTransaction().
 	incomingTransactions [][]byte
 
+	// Index (counting from Reset) of incomingTransactions[0]; the number
+	// of incoming transactions removed by ClearIncomingTransactions().
+	incomingBase int
+
 	// These transactions come from StageTransactions(); they will be merged into
 	// activeBlocks by ApplyStaged() (and this list then cleared).
 	stagedTransactions []stagedTx
+
+	// Number of blocks generated by StageBlocksCreate() since Reset.
+	blocksCreated int
+
+	// Header nBits and Equihash solution given to blocks generated by
+	// StageBlocksCreate(); nil means zeros (see DarksideSetProofOfWork()).
+	nBits    []byte
+	solution []byte
+
+	// Reported as the NU5 (Orchard) activation height; zero if none.
+	orchardHeight int
+
+	// Header time of blocks created by StageBlocksCreate(), and the
+	// getblockchaininfo mediantime (see DarksideSetChainTime()).
+	blockTime  uint32
+	medianTime int64
+
+	// Consensus branch IDs by height range, sorted by height (see
+	// DarksideSetBranchIDs()); below the first, branchID applies.
+	branchIDs []DarksideBranchID
+
+	// Tree states that z_gettreestate returns, by height (see
+	// DarksideAddTreeState()).
+	treeStates map[int]DarksideTreeState
+
+	// If set, ApplyStaged() fails if two staged blocks have the same height
+	// (rather than the later one silently replacing the earlier one).
+	strictHeights bool
+
+	// If backendDown is set, the mock zcashd can't be reached (see
+	// DarksideSetBackendDown()) by requests for the methods in downMethods,
+	// or all methods if that's empty.
+	backendDown bool
+	downMethods map[string]bool
+
+	// Nonzero while an ApplyStaged() is running, when
+	// DarksideRejectConcurrentApply is set.
+	applying int32
+}
+
+// DarksideDefaultSession is the session of darkside requests that don't name
+// one in their metadata. It's the only session whose blocks and transactions
+// the mock zcashd presents, so it alone feeds the block cache and ingestor,
+// lightwalletd's production API, and SendTransaction.
+const DarksideDefaultSession = ""
+
+// DarksideMaxSessions limits the number of named (non-default) darkside
+// sessions that may exist at once; EndSession frees one.
+var DarksideMaxSessions = 16
+
+// DarksideRejectConcurrentApply makes ApplyStaged fail with Aborted if
+// another ApplyStaged on the same session is still running, rather than
+// waiting for it to finish (see DarksideApplyStaged).
+var DarksideRejectConcurrentApply = false
+
+// DarksideMaxIncomingTransactions limits the number of incoming transactions
+// (see DarksideGetIncomingTransactions) each session holds; zero means no
+// limit. A transaction sent beyond the limit is rejected, unless
+// DarksideEvictIncoming is set.
+var DarksideMaxIncomingTransactions = 0
+
+// DarksideEvictIncoming makes a transaction sent beyond
+// DarksideMaxIncomingTransactions displace the oldest incoming transaction,
+// as if that one had been cleared by ClearIncomingTransactions.
+var DarksideEvictIncoming = false
+
+// DarksideMaxBlockTransactions limits the number of transactions (including
+// the coinbase) that a block may have once ApplyStaged has added the staged
+// transactions to it; it must be from 1 to 65535, the most that ApplyStaged
+// can encode.
+var DarksideMaxBlockTransactions = 65535
+
+var (
+	sessionsMutex sync.Mutex
+	sessions      = map[string]*darksideState{DarksideDefaultSession: {}}
+)
+
+// darksideSession returns the state of the given darkside session, creating
+// it if necessary. Each session has its own staged and active blocks, so
+// parallel test suites don't disturb each other's staging.
+func darksideSession(session string) (*darksideState, error) {
+	sessionsMutex.Lock()
+	defer sessionsMutex.Unlock()
+	if state, ok := sessions[session]; ok {
+		return state, nil
+	}
+	if len(sessions)-1 >= DarksideMaxSessions {
+		return nil, errors.New(fmt.Sprint("too many darkside sessions (maximum ",
+			DarksideMaxSessions, "), end one first"))
+	}
+	state := &darksideState{}
+	sessions[session] = state
+	return state, nil
 }
 
-var state darksideState
+// DarksideEndSession discards the given session's state. The default
+// session always exists, so it can't be ended (but it can be Reset).
+func DarksideEndSession(session string) error {
+	if session == DarksideDefaultSession {
+		return errors.New("the default darkside session can't be ended")
+	}
+	Log.Info("EndSession(session=", session, ")")
+	sessionsMutex.Lock()
+	defer sessionsMutex.Unlock()
+	delete(sessions, session)
+	return nil
+}
 
 type stagedTx struct {
 	height int
@@ -59,41 +180,106 @@ type stagedTx struct {
 // the command line.
 var DarksideEnabled bool
 
+// DarksideMaxBlocksCreate and DarksideMaxBlocksSession limit the number of
+// blocks StageBlocksCreate may generate in a single call and in total since
+// the last Reset, so that a large count can't exhaust the server's memory.
+var (
+	DarksideMaxBlocksCreate  = 10000
+	DarksideMaxBlocksSession = 100000
+)
+
+// darksideTimeoutUnit is the unit of DarksideInit's timeout (a variable
+// only so that tests can shorten it).
+var darksideTimeoutUnit = time.Minute
+
+// darksideTimerStop, when closed, cancels the shutdown timer that
+// DarksideInit starts; protected by sessionsMutex.
+var darksideTimerStop chan struct{}
+
 // DarksideInit should be called once at startup in darksidewalletd mode.
-func DarksideInit(c *BlockCache, timeout int) {
+// After timeout minutes, it ends the process, or if stop isn't nil, logs a
+// warning and calls stop (which should stop the gRPC server gracefully).
+func DarksideInit(c *BlockCache, timeout int, stop func()) {
 	Log.Info("Darkside mode running")
 	DarksideEnabled = true
-	state.cache = c
+	DarksideShutdown()
+	sessionsMutex.Lock()
+	defer sessionsMutex.Unlock()
+	sessions[DarksideDefaultSession].cache = c
 	RawRequest = darksideRawRequest
+	cancel := make(chan struct{})
+	darksideTimerStop = cancel
+	timer := time.NewTimer(time.Duration(timeout) * darksideTimeoutUnit)
 	go func() {
-		time.Sleep(time.Duration(timeout) * time.Minute)
-		Log.Fatal("Shutting down darksidewalletd to prevent accidental deployment in production.")
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			if stop == nil {
+				Log.Fatal("Shutting down darksidewalletd to prevent accidental deployment in production.")
+			} else {
+				Log.Warn("Stopping the darksidewalletd gRPC server to prevent accidental deployment in production.")
+				stop()
+			}
+		case <-cancel:
+		}
 	}()
 }
 
+// DarksideShutdown cancels the timer that would otherwise end the process
+// (see DarksideInit), for example when tests finish early.
+func DarksideShutdown() {
+	sessionsMutex.Lock()
+	defer sessionsMutex.Unlock()
+	if darksideTimerStop != nil {
+		close(darksideTimerStop)
+		darksideTimerStop = nil
+	}
+}
+
 // DarksideReset allows the wallet test code to specify values
-// that are returned by GetLightdInfo().
-func DarksideReset(sa int, bi, cn string) error {
-	Log.Info("Reset(saplingActivation=", sa, ")")
-	stopIngestor()
-	state = darksideState{
+// that are returned by GetLightdInfo(), and whether staging two blocks
+// at the same height is an error (see DarksideApplyStaged). Only resetting
+// the default session resets the block cache.
+func DarksideReset(session string, sa, oa int, bi, cn string, strictHeights bool) error {
+	Log.Info("Reset(session=", session, ", saplingActivation=", sa, ", orchardActivation=", oa, ", strictHeights=", strictHeights, ")")
+	old, err := darksideSession(session)
+	if err != nil {
+		return err
+	}
+	if session == DarksideDefaultSession {
+		stopIngestor()
+	}
+	state := &darksideState{
 		resetted:             true,
 		startHeight:          sa,
+		orchardHeight:        oa,
+		blockTime:            1,
+		strictHeights:        strictHeights,
 		latestHeight:         -1,
 		branchID:             bi,
 		chainName:            cn,
-		cache:                state.cache,
+		cache:                old.cache,
 		activeBlocks:         make([][]byte, 0),
 		stagedBlocks:         make([][]byte, 0),
+		stagedPrevhash:       make(map[int][]byte),
+		activePrevhash:       make(map[int][]byte),
 		incomingTransactions: make([][]byte, 0),
 		stagedTransactions:   make([]stagedTx, 0),
+		treeStates:           make(map[int]DarksideTreeState),
+	}
+	sessionsMutex.Lock()
+	sessions[session] = state
+	sessionsMutex.Unlock()
+	if state.cache != nil {
+		state.cache.Reset(sa)
 	}
-	state.cache.Reset(sa)
 	return nil
 }
 
-// DarksideAddBlock adds a single block to the active blocks list.
-func addBlockActive(blockBytes []byte) error {
+// DarksideAddBlock adds a single block to the active blocks list. If
+// prevhash isn't nil, setPrevhash() gives the block that prevhash rather
+// than linking it to the block before it.
+func (state *darksideState) addBlockActive(blockBytes []byte, prevhash []byte) error {
 	block := parser.NewBlock()
 	rest, err := block.ParseFromSlice(blockBytes)
 	if err != nil {
@@ -115,13 +301,22 @@ func addBlockActive(blockBytes []byte) error {
 	// Drop the block that will be overwritten, and its children, then add block.
 	state.activeBlocks = state.activeBlocks[:blockHeight-state.startHeight]
 	state.activeBlocks = append(state.activeBlocks, blockBytes)
+	for height := range state.activePrevhash {
+		if height >= blockHeight {
+			delete(state.activePrevhash, height)
+		}
+	}
+	if prevhash != nil {
+		state.activePrevhash[blockHeight] = prevhash
+	}
 	return nil
 }
 
-// Set missing prev hashes of the blocks in the active chain
-func setPrevhash() {
+// Set missing prev hashes of the blocks in the active chain, except where
+// the prevhash was given explicitly (deliberately breaking the chain).
+func (state *darksideState) setPrevhash() {
 	var prevhash []byte
-	for _, blockBytes := range state.activeBlocks {
+	for i, blockBytes := range state.activeBlocks {
 		// Set this block's prevhash.
 		block := parser.NewBlock()
 		rest, err := block.ParseFromSlice(blockBytes)
@@ -131,7 +326,9 @@ func setPrevhash() {
 		if len(rest) != 0 {
 			Log.Fatal(errors.New("block is too long"))
 		}
-		if prevhash != nil {
+		if explicit, ok := state.activePrevhash[state.startHeight+i]; ok {
+			copy(blockBytes[4:4+32], explicit)
+		} else if prevhash != nil {
 			copy(blockBytes[4:4+32], prevhash)
 		}
 		prevhash = block.GetEncodableHash()
@@ -141,10 +338,73 @@ func setPrevhash() {
 	}
 }
 
+// checkStagedHeights returns an error if any two of the given blocks
+// have the same height.
+func checkStagedHeights(blocks [][]byte) error {
+	heights := make(map[int]bool)
+	for _, blockBytes := range blocks {
+		block := parser.NewBlock()
+		if _, err := block.ParseFromSlice(blockBytes); err != nil {
+			return err
+		}
+		height := block.GetHeight()
+		if heights[height] {
+			return errors.New(fmt.Sprint("more than one block staged at height ", height))
+		}
+		heights[height] = true
+	}
+	return nil
+}
+
+// blockTxCountOffset returns where a darkside block's transaction count
+// starts: just after its header, whose length depends on that of its
+// Equihash solution (see DarksideSetProofOfWork).
+func blockTxCountOffset(block []byte) (int, error) {
+	rest, err := parser.NewBlockHeader().ParseFromSlice(block)
+	if err != nil {
+		return 0, err
+	}
+	if len(rest) == 0 || (rest[0] == 253 && len(rest) < 3) {
+		return 0, errors.New("block has no transaction count")
+	}
+	return len(block) - len(rest), nil
+}
+
+// blockTxCount returns the number of transactions in a darkside block, as
+// its CompactSize count (which ApplyStaged keeps below 64k) gives it.
+func blockTxCount(block []byte) (int, error) {
+	n, err := blockTxCountOffset(block)
+	if err != nil {
+		return 0, err
+	}
+	if block[n] == 253 {
+		return int(binary.LittleEndian.Uint16(block[n+1:])), nil
+	}
+	return int(block[n]), nil
+}
+
 // DarksideApplyStaged moves the staging area to the active block list.
 // If this returns an error, the state could be weird; perhaps it may
 // be better to simply crash.
-func DarksideApplyStaged(height int) error {
+//
+// Each staging call, and each ApplyStaged, is atomic with respect to the
+// others on its session: ApplyStaged applies everything staged on the
+// session before it began (by whichever client staged it), and nothing
+// staged after. By default, concurrent ApplyStaged calls are serialized;
+// with DarksideRejectConcurrentApply, one that would have to wait fails
+// instead. Clients that stage and apply concurrently should each use their
+// own session.
+func DarksideApplyStaged(session string, height int) error {
+	state, err := darksideSession(session)
+	if err != nil {
+		return err
+	}
+	if DarksideRejectConcurrentApply {
+		if !atomic.CompareAndSwapInt32(&state.applying, 0, 1) {
+			return status.Error(codes.Aborted, "ApplyStaged is already in progress on this darkside session")
+		}
+		defer atomic.StoreInt32(&state.applying, 0)
+	}
 	state.mutex.Lock()
 	defer state.mutex.Unlock()
 	if !state.resetted {
@@ -157,9 +417,16 @@ func DarksideApplyStaged(height int) error {
 	}
 	// Move the staged blocks into active list
 	stagedBlocks := state.stagedBlocks
+	stagedPrevhash := state.stagedPrevhash
 	state.stagedBlocks = nil
-	for _, blockBytes := range stagedBlocks {
-		if err := addBlockActive(blockBytes); err != nil {
+	state.stagedPrevhash = make(map[int][]byte)
+	if state.strictHeights {
+		if err := checkStagedHeights(stagedBlocks); err != nil {
+			return err
+		}
+	}
+	for i, blockBytes := range stagedBlocks {
+		if err := state.addBlockActive(blockBytes, stagedPrevhash[i]); err != nil {
 			return err
 		}
 	}
@@ -169,9 +436,11 @@ func DarksideApplyStaged(height int) error {
 
 	// Add staged transactions into blocks. Note we're not trying to
 	// recover to the initial state; maybe it's better to just crash
-	// on errors.
+	// on errors. But check them all first, so that no block is left
+	// with only some of its transactions.
 	stagedTransactions := state.stagedTransactions
 	state.stagedTransactions = nil
+	txCounts := make(map[int]int)
 	for _, tx := range stagedTransactions {
 		if tx.height < state.startHeight {
 			return errors.New("transaction height too low")
@@ -179,43 +448,62 @@ func DarksideApplyStaged(height int) error {
 		if tx.height >= state.startHeight+len(state.activeBlocks) {
 			return errors.New("transaction height too high")
 		}
+		if _, ok := txCounts[tx.height]; !ok {
+			count, err := blockTxCount(state.activeBlocks[tx.height-state.startHeight])
+			if err != nil {
+				return errors.New(fmt.Sprint("block at height ", tx.height, ": ", err))
+			}
+			txCounts[tx.height] = count
+		}
+		txCounts[tx.height]++
+		if txCounts[tx.height] > DarksideMaxBlockTransactions {
+			return errors.New(fmt.Sprint("too many transactions staged for the block at height ",
+				tx.height, " (maximum ", DarksideMaxBlockTransactions, " including the coinbase)"))
+		}
+	}
+	for _, tx := range stagedTransactions {
 		block := state.activeBlocks[tx.height-state.startHeight]
-		// The next one or 3 bytes encode the number of transactions to follow,
-		// little endian.
-		nTxFirstByte := block[1487]
+		// After the header (checked above), one or 3 bytes encode the
+		// number of transactions to follow, little endian.
+		n, _ := blockTxCountOffset(block)
+		nTxFirstByte := block[n]
 		switch {
 		case nTxFirstByte < 252:
-			block[1487]++
+			block[n]++
 		case nTxFirstByte == 252:
 			// incrementing to 253, requires "253" followed by 2-byte length,
 			// extend the block by two bytes, shift existing transaction bytes
 			block = append(block, 0, 0)
-			copy(block[1490:], block[1488:len(block)-2])
-			block[1487] = 253
-			block[1488] = 253
-			block[1489] = 0
+			copy(block[n+3:], block[n+1:len(block)-2])
+			block[n] = 253
+			block[n+1] = 253
+			block[n+2] = 0
 		case nTxFirstByte == 253:
-			block[1488]++
-			if block[1488] == 0 {
+			block[n+1]++
+			if block[n+1] == 0 {
 				// wrapped around
-				block[1489]++
+				block[n+2]++
 			}
 		default:
-			// no need to worry about more than 64k transactions
-			Log.Fatal("unexpected compact transaction count ", nTxFirstByte,
-				", can't support more than 64k transactions in a block")
+			// DarksideMaxBlockTransactions keeps the count below 64k.
+			return errors.New(fmt.Sprint("unexpected transaction count encoding ", nTxFirstByte,
+				" in the block at height ", tx.height))
 		}
 		block[68]++ // hack HashFinalSaplingRoot to mod the block hash
 		block = append(block, tx.bytes...)
 		state.activeBlocks[tx.height-state.startHeight] = block
 	}
-	setPrevhash()
+	state.setPrevhash()
 	state.latestHeight = height
 	Log.Info("active blocks from ", state.startHeight,
 		" to ", state.startHeight+len(state.activeBlocks)-1,
 		", latest presented height ", state.latestHeight)
 
-	// The block ingestor can only run if there are blocks
+	// The block ingestor can only run if there are blocks, and only
+	// follows the default session.
+	if state.cache == nil {
+		return nil
+	}
 	if len(state.activeBlocks) > 0 {
 		startIngestor(state.cache)
 	} else {
@@ -226,12 +514,123 @@ func DarksideApplyStaged(height int) error {
 
 // DarksideGetIncomingTransactions returns all transactions we're
 // received via SendTransaction().
-func DarksideGetIncomingTransactions() [][]byte {
-	return state.incomingTransactions
+func DarksideGetIncomingTransactions(session string) ([][]byte, error) {
+	state, err := darksideSession(session)
+	if err != nil {
+		return nil, err
+	}
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+	return state.incomingTransactions, nil
+}
+
+// DarksideGetIncomingTransactionsSince returns the incoming transactions
+// received at or after the given index (counting from Reset), and the index
+// that the next transaction to arrive will have, for use as the next cursor.
+func DarksideGetIncomingTransactionsSince(session string, since int) ([][]byte, int, error) {
+	state, err := darksideSession(session)
+	if err != nil {
+		return nil, 0, err
+	}
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+	cursor := state.incomingBase + len(state.incomingTransactions)
+	start := since - state.incomingBase
+	if start < 0 {
+		start = 0
+	}
+	if start > len(state.incomingTransactions) {
+		start = len(state.incomingTransactions)
+	}
+	return state.incomingTransactions[start:], cursor, nil
+}
+
+// bestBlockHash returns the (big-endian hex) hash of the block at the latest
+// presented height, or "" if there isn't one. The caller must hold
+// state.mutex.
+func (state *darksideState) bestBlockHash() (string, error) {
+	index := state.latestHeight - state.startHeight
+	if index < 0 || index >= len(state.activeBlocks) {
+		return "", nil
+	}
+	block := parser.NewBlock()
+	if _, err := block.ParseFromSlice(state.activeBlocks[index]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(block.GetDisplayHash()), nil
+}
+
+// getBlockByHash returns the presented block with the given hash
+// (big-endian hex). The caller must hold state.mutex.
+func (state *darksideState) getBlockByHash(hashHex string) ([]byte, error) {
+	for i, blockBytes := range state.activeBlocks {
+		if state.startHeight+i > state.latestHeight {
+			break
+		}
+		block := parser.NewBlock()
+		if _, err := block.ParseFromSlice(blockBytes); err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(hex.EncodeToString(block.GetDisplayHash()), hashHex) {
+			return blockBytes, nil
+		}
+	}
+	return nil, errors.New("-5: Block not found")
+}
+
+// getblockReply returns what the getblock rpc does for the given block:
+// its hex with verbosity 0, else its hash, height and txids. (A v5
+// transaction's txid here is its SHA256d hash, as the parser has it.)
+func getblockReply(blockBytes []byte, verbosity int) (json.RawMessage, error) {
+	if verbosity == 0 {
+		return json.Marshal(hex.EncodeToString(blockBytes))
+	}
+	block := parser.NewBlock()
+	if _, err := block.ParseFromSlice(blockBytes); err != nil {
+		return nil, err
+	}
+	reply := struct {
+		Hash   string   `json:"hash"`
+		Height int      `json:"height"`
+		Tx     []string `json:"tx"`
+	}{
+		Hash:   hex.EncodeToString(block.GetDisplayHash()),
+		Height: block.GetHeight(),
+		Tx:     make([]string, 0, len(block.Transactions())),
+	}
+	for _, tx := range block.Transactions() {
+		reply.Tx = append(reply.Tx, hex.EncodeToString(tx.GetDisplayHash()))
+	}
+	return json.Marshal(reply)
+}
+
+// DarksideGetIncomingTransactionCount returns the number of incoming
+// transactions (since Reset or ClearIncomingTransactions) and, if
+// includeTxids is set, their txids (little-endian), in arrival order.
+func DarksideGetIncomingTransactionCount(session string, includeTxids bool) (int, [][]byte, error) {
+	state, err := darksideSession(session)
+	if err != nil {
+		return 0, nil, err
+	}
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+	if !includeTxids {
+		return len(state.incomingTransactions), nil, nil
+	}
+	txids := make([][]byte, len(state.incomingTransactions))
+	for i, txBytes := range state.incomingTransactions {
+		tx := parser.NewTransaction()
+		if _, err := tx.ParseFromSlice(txBytes); err != nil {
+			return 0, nil, err
+		}
+		txids[i] = tx.GetEncodableHash()
+	}
+	return len(txids), txids, nil
 }
 
-// Add the serialized block to the staging list, but do some sanity checks first.
-func darksideStageBlock(caller string, b []byte) error {
+// Add the serialized block to the staging list, but do some sanity checks
+// first. The caller must hold state.mutex.
+func (state *darksideState) stageBlock(caller string, b []byte) error {
 	block := parser.NewBlock()
 	rest, err := block.ParseFromSlice(b)
 	if err != nil {
@@ -252,7 +651,11 @@ func darksideStageBlock(caller string, b []byte) error {
 
 // DarksideStageBlocks opens and reads blocks from the given URL and
 // adds them to the staging area.
-func DarksideStageBlocks(url string) error {
+func DarksideStageBlocks(session, url string) error {
+	state, err := darksideSession(session)
+	if err != nil {
+		return err
+	}
 	if !state.resetted {
 		return errors.New("please call Reset first")
 	}
@@ -277,7 +680,10 @@ func DarksideStageBlocks(url string) error {
 		if err != nil {
 			return err
 		}
-		if err = darksideStageBlock("DarksideStageBlocks", blockBytes); err != nil {
+		state.mutex.Lock()
+		err = state.stageBlock("DarksideStageBlocks", blockBytes)
+		state.mutex.Unlock()
+		if err != nil {
 			return err
 		}
 	}
@@ -285,7 +691,11 @@ func DarksideStageBlocks(url string) error {
 }
 
 // DarksideStageBlockStream adds the block to the staging area
-func DarksideStageBlockStream(blockHex string) error {
+func DarksideStageBlockStream(session, blockHex string) error {
+	state, err := darksideSession(session)
+	if err != nil {
+		return err
+	}
 	if !state.resetted {
 		return errors.New("please call Reset first")
 	}
@@ -294,18 +704,68 @@ func DarksideStageBlockStream(blockHex string) error {
 	if err != nil {
 		return err
 	}
-	if err = darksideStageBlock("DarksideStageBlockStream", blockBytes); err != nil {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	if err = state.stageBlock("DarksideStageBlockStream", blockBytes); err != nil {
+		return err
+	}
+	return nil
+}
+
+// DarksideStageBlockWithPrevhash adds the block to the staging area, like
+// DarksideStageBlockStream(), except that ApplyStaged() won't link it to the
+// block before it: its prevhash is set to the given one (32 bytes, in header
+// byte order), or if that's empty, left as the block has it. This lets tests
+// present a chain with a broken link. (The next block still links to this
+// one as usual.)
+func DarksideStageBlockWithPrevhash(session, blockHex string, prevhash []byte) error {
+	state, err := darksideSession(session)
+	if err != nil {
+		return err
+	}
+	if !state.resetted {
+		return errors.New("please call Reset first")
+	}
+	Log.Info("StageBlockWithPrevhash()")
+	if len(prevhash) != 0 && len(prevhash) != 32 {
+		return errors.New("prevhash must be 32 bytes")
+	}
+	blockBytes, err := hex.DecodeString(blockHex)
+	if err != nil {
+		return err
+	}
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	if err = state.stageBlock("DarksideStageBlockWithPrevhash", blockBytes); err != nil {
 		return err
 	}
+	if len(prevhash) == 0 {
+		prevhash = blockBytes[4 : 4+32]
+	}
+	state.stagedPrevhash[len(state.stagedBlocks)-1] = append([]byte{}, prevhash...)
 	return nil
 }
 
 // DarksideStageBlocksCreate creates empty blocks and adds them to the staging area.
-func DarksideStageBlocksCreate(height int32, nonce int32, count int32) error {
+func DarksideStageBlocksCreate(session string, height int32, nonce int32, count int32) error {
+	state, err := darksideSession(session)
+	if err != nil {
+		return err
+	}
 	if !state.resetted {
 		return errors.New("please call Reset first")
 	}
 	Log.Info("StageBlocksCreate(height=", height, ", nonce=", nonce, ", count=", count, ")")
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	if int(count) > DarksideMaxBlocksCreate {
+		return errors.New(fmt.Sprint("block count ", count,
+			" exceeds the maximum of ", DarksideMaxBlocksCreate, " per call"))
+	}
+	if state.blocksCreated+int(count) > DarksideMaxBlocksSession {
+		return errors.New(fmt.Sprint("block count ", count, " would exceed the maximum of ",
+			DarksideMaxBlocksSession, " created blocks since Reset (", state.blocksCreated, " so far)"))
+	}
 	for i := 0; i < int(count); i++ {
 
 		fakeCoinbase := "0400008085202f890100000000000000000000000000000000000000000000000000" +
@@ -328,17 +788,25 @@ func DarksideStageBlocksCreate(height int32, nonce int32, count int32) error {
 		}
 
 		hashOfTxnsAndHeight := sha256.Sum256([]byte(string(nonce) + "#" + string(height)))
+		nBits := state.nBits
+		if nBits == nil {
+			nBits = make([]byte, 4)
+		}
+		solution := state.solution
+		if solution == nil {
+			solution = make([]byte, 1344)
+		}
 		blockHeader := &parser.BlockHeader{
 			RawBlockHeader: &parser.RawBlockHeader{
 				Version:              4,                      // start: 0
 				HashPrevBlock:        make([]byte, 32),       // start: 4
 				HashMerkleRoot:       hashOfTxnsAndHeight[:], // start: 36
 				HashFinalSaplingRoot: make([]byte, 32),       // start: 68
-				Time:                 1,                      // start: 100
-				NBitsBytes:           make([]byte, 4),        // start: 104
+				Time:                 state.blockTime,        // start: 100
+				NBitsBytes:           nBits,                  // start: 104
 				Nonce:                make([]byte, 32),       // start: 108
-				Solution:             make([]byte, 1344),     // starts: 140, 143
-			}, // length: 1487
+				Solution:             solution,               // starts: 140, 143
+			}, // length: 1487 (with the default solution)
 		}
 
 		headerBytes, err := blockHeader.MarshalBinary()
@@ -349,30 +817,353 @@ func DarksideStageBlocksCreate(height int32, nonce int32, count int32) error {
 		blockBytes = append(blockBytes, headerBytes...)
 		blockBytes = append(blockBytes, byte(1))
 		blockBytes = append(blockBytes, fakeCoinbaseBytes...)
-		if err = darksideStageBlock("DarksideStageBlockCreate", blockBytes); err != nil {
+		if err = state.stageBlock("DarksideStageBlockCreate", blockBytes); err != nil {
 			// This should never fail since we created the block ourselves.
 			return err
 		}
+		state.blocksCreated++
 		height++
 	}
 	return nil
 }
 
+// DarksideSetProofOfWork sets the nBits and Equihash solution that
+// subsequently-created blocks (see DarksideStageBlocksCreate) carry in
+// their headers; these needn't be valid, which lets wallets that check
+// proof-of-work be tested against known values. An empty nBits or solution
+// reverts to the default (all zeros; a solution is normally 1344 bytes, but
+// may be any length). Reset restores both defaults.
+func DarksideSetProofOfWork(session string, nBits, solution []byte) error {
+	state, err := darksideSession(session)
+	if err != nil {
+		return err
+	}
+	if !state.resetted {
+		return errors.New("please call Reset first")
+	}
+	if len(nBits) != 0 && len(nBits) != 4 {
+		return errors.New(fmt.Sprint("nBits must be 4 bytes, not ", len(nBits)))
+	}
+	Log.Info("SetProofOfWork(nBits=", hex.EncodeToString(nBits), ", solution length=", len(solution), ")")
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.nBits = nil
+	if len(nBits) > 0 {
+		state.nBits = append([]byte{}, nBits...)
+	}
+	state.solution = nil
+	if len(solution) > 0 {
+		state.solution = append([]byte{}, solution...)
+	}
+	return nil
+}
+
+// DarksideSetChainTime sets the header time (Unix epoch seconds) of blocks
+// subsequently created by DarksideStageBlocksCreate, and the mediantime that
+// getblockchaininfo reports, so wallets' time-dependent behavior can be
+// tested deterministically. Reset restores the defaults (1 and 0).
+func DarksideSetChainTime(session string, blockTime uint32, medianTime int64) error {
+	state, err := darksideSession(session)
+	if err != nil {
+		return err
+	}
+	if !state.resetted {
+		return errors.New("please call Reset first")
+	}
+	if medianTime < 0 {
+		return errors.New("mediantime must not be negative")
+	}
+	Log.Info("SetChainTime(time=", blockTime, ", mediantime=", medianTime, ")")
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.blockTime = blockTime
+	state.medianTime = medianTime
+	return nil
+}
+
+// DarksideBranchID is the consensus branch ID (8 hex digits) of blocks from
+// Height up to the next DarksideBranchID's height.
+type DarksideBranchID struct {
+	Height   int
+	BranchID string
+}
+
+// DarksideSetBranchIDs replaces the session's consensus branch IDs by height
+// range, which the mock zcashd's getblockchaininfo and getrawtransaction
+// report; heights below the first range have the branch ID given to Reset,
+// which clears the ranges.
+func DarksideSetBranchIDs(session string, branchIDs []DarksideBranchID) error {
+	state, err := darksideSession(session)
+	if err != nil {
+		return err
+	}
+	if !state.resetted {
+		return errors.New("please call Reset first")
+	}
+	sorted := append([]DarksideBranchID{}, branchIDs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Height < sorted[j].Height })
+	for i, b := range sorted {
+		if id, err := hex.DecodeString(b.BranchID); err != nil || len(id) != 4 {
+			return errors.New(fmt.Sprint("branch ID ", b.BranchID, " must be 8 hex digits"))
+		}
+		if i > 0 && b.Height == sorted[i-1].Height {
+			return errors.New(fmt.Sprint("more than one branch ID at height ", b.Height))
+		}
+	}
+	Log.Info("SetBranchIDs(", sorted, ")")
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.branchIDs = sorted
+	return nil
+}
+
+// branchIDAt returns the consensus branch ID of the block at the given
+// height. The caller must hold state.mutex.
+func (state *darksideState) branchIDAt(height int) string {
+	branchID := state.branchID
+	for _, b := range state.branchIDs {
+		if b.Height > height {
+			break
+		}
+		branchID = b.BranchID
+	}
+	return branchID
+}
+
+// DarksideTreeState is a note commitment tree state as z_gettreestate
+// reports it: Hash (big-endian hex) is that of the block at Height, Tree is
+// the serialized Sapling tree (hex) as of the end of that block, and the
+// anchors are the roots of the Sapling and Orchard trees.
+type DarksideTreeState struct {
+	Height        int
+	Hash          string
+	Time          uint32
+	Tree          string
+	SaplingAnchor string
+	OrchardAnchor string
+	SkipHash      string // if Tree is empty, the block to ask for instead
+	OrchardTree   string // empty before Orchard activation
+}
+
+// DarksideAddTreeState adds (or replaces) the tree state that the mock
+// zcashd's z_gettreestate returns for its height or hash. The mock zcashd
+// can't compute tree states, so tests supply them; Reset removes them. A
+// state without a tree has a skip hash, as zcashd gives for a block that
+// left the tree as it was.
+func DarksideAddTreeState(session string, treeState DarksideTreeState) error {
+	state, err := darksideSession(session)
+	if err != nil {
+		return err
+	}
+	if !state.resetted {
+		return errors.New("please call Reset first")
+	}
+	if hash, err := hex.DecodeString(treeState.Hash); err != nil || len(hash) != 32 {
+		return errors.New("tree state hash must be 64 hex digits")
+	}
+	if treeState.Tree == "" {
+		if hash, err := hex.DecodeString(treeState.SkipHash); err != nil || len(hash) != 32 {
+			return errors.New("tree state without a tree must have a 64 hex digit skip hash")
+		}
+	} else if _, err := hex.DecodeString(treeState.Tree); err != nil {
+		return errors.New("tree state tree must be hex")
+	}
+	if _, err := hex.DecodeString(treeState.OrchardTree); err != nil {
+		return errors.New("tree state orchard tree must be hex")
+	}
+	Log.Info("AddTreeState(height=", treeState.Height, ")")
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	treeState.Hash = strings.ToLower(treeState.Hash)
+	state.treeStates[treeState.Height] = treeState
+	return nil
+}
+
+// DarksideClearTreeStates removes all the tree states that
+// DarksideAddTreeState added.
+func DarksideClearTreeStates(session string) error {
+	state, err := darksideSession(session)
+	if err != nil {
+		return err
+	}
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.treeStates = make(map[int]DarksideTreeState)
+	return nil
+}
+
+// getTreeState is the mock zcashd's z_gettreestate, for the tree states
+// that have been added. The caller must hold state.mutex.
+func (state *darksideState) getTreeState(params []json.RawMessage) (json.RawMessage, error) {
+	var arg string
+	if err := json.Unmarshal(params[0], &arg); err != nil {
+		return nil, errors.New("failed to parse z_gettreestate request")
+	}
+	var treeState DarksideTreeState
+	found := false
+	if len(arg) == 64 {
+		// a block hash (big-endian hex)
+		for _, t := range state.treeStates {
+			if t.Hash == strings.ToLower(arg) {
+				treeState, found = t, true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New("-5: block not found")
+		}
+	} else {
+		height, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, errors.New("error parsing height as integer")
+		}
+		if treeState, found = state.treeStates[height]; !found {
+			return nil, errors.New("-8: Invalid block height parameter")
+		}
+	}
+	reply := &ZcashdRpcReplyGettreestate{
+		Height: treeState.Height,
+		Hash:   treeState.Hash,
+		Time:   treeState.Time,
+	}
+	reply.Sapling.Commitments.FinalState = treeState.Tree
+	reply.Sapling.Commitments.FinalRoot = treeState.SaplingAnchor
+	reply.Sapling.SkipHash = treeState.SkipHash
+	reply.Orchard.Commitments.FinalRoot = treeState.OrchardAnchor
+	reply.Orchard.Commitments.FinalState = treeState.OrchardTree
+	return json.Marshal(reply)
+}
+
+// DarksideSetBackendDown makes the mock zcashd unreachable, as if it weren't
+// running, for the given rpc methods (such as "getblock"), or all of them if
+// none are given; or, if down is false, reachable again. Requests then fail
+// with a BackendUnavailableError rather than a JSON-RPC error. Since only the
+// default session is presented by the mock zcashd, only its setting matters.
+// Reset makes it reachable.
+func DarksideSetBackendDown(session string, down bool, methods []string) error {
+	state, err := darksideSession(session)
+	if err != nil {
+		return err
+	}
+	if !state.resetted {
+		return errors.New("please call Reset first")
+	}
+	Log.Info("SetBackendDown(down=", down, ", methods=", methods, ")")
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.backendDown = down
+	state.downMethods = make(map[string]bool)
+	for _, method := range methods {
+		state.downMethods[method] = true
+	}
+	return nil
+}
+
+// unreachable returns the error a request for the given method gets if
+// the mock zcashd is down (see DarksideSetBackendDown()), else nil.
+func (state *darksideState) unreachable(method string) error {
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+	if !state.backendDown || (len(state.downMethods) > 0 && !state.downMethods[method]) {
+		return nil
+	}
+	return &BackendUnavailableError{Err: &net.OpError{
+		Op:  "dial",
+		Net: "tcp",
+		Err: syscall.ECONNREFUSED,
+	}}
+}
+
+// DarksideGetBlockHash returns the height and display-order hash of the
+// active block at the given height or, if staged is set, of the staged
+// block with the given index.
+func DarksideGetBlockHash(session string, height int, staged bool, index int) (int, []byte, error) {
+	state, err := darksideSession(session)
+	if err != nil {
+		return 0, nil, err
+	}
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+	var blockBytes []byte
+	if staged {
+		if index < 0 || index >= len(state.stagedBlocks) {
+			return 0, nil, errors.New(fmt.Sprint("no staged block at index ", index,
+				" (", len(state.stagedBlocks), " staged)"))
+		}
+		blockBytes = state.stagedBlocks[index]
+	} else {
+		if height < state.startHeight || height-state.startHeight >= len(state.activeBlocks) {
+			return 0, nil, errors.New(fmt.Sprint("no active block at height ", height))
+		}
+		blockBytes = state.activeBlocks[height-state.startHeight]
+	}
+	block := parser.NewBlock()
+	if _, err := block.ParseFromSlice(blockBytes); err != nil {
+		return 0, nil, err
+	}
+	return block.GetHeight(), block.GetDisplayHash(), nil
+}
+
 // DarksideClearIncomingTransactions empties the incoming transaction list.
-func DarksideClearIncomingTransactions() {
+func DarksideClearIncomingTransactions(session string) error {
+	state, err := darksideSession(session)
+	if err != nil {
+		return err
+	}
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.incomingBase += len(state.incomingTransactions)
 	state.incomingTransactions = make([][]byte, 0)
+	return nil
+}
+
+// addIncoming adds the transaction to the incoming list, subject to
+// DarksideMaxIncomingTransactions. The caller must hold state.mutex.
+func (state *darksideState) addIncoming(txBytes []byte) error {
+	max := DarksideMaxIncomingTransactions
+	if max > 0 && len(state.incomingTransactions) >= max {
+		if !DarksideEvictIncoming {
+			// (zcashd's code for a transaction the mempool won't take)
+			return errors.New(fmt.Sprint("-26: darkside incoming transaction limit (", max, ") reached"))
+		}
+		evict := len(state.incomingTransactions) - max + 1
+		state.incomingBase += evict
+		state.incomingTransactions = state.incomingTransactions[evict:]
+	}
+	state.incomingTransactions = append(state.incomingTransactions, txBytes)
+	return nil
 }
 
 func darksideRawRequest(method string, params []json.RawMessage) (json.RawMessage, error) {
+	sessionsMutex.Lock()
+	state := sessions[DarksideDefaultSession]
+	sessionsMutex.Unlock()
+	if err := state.unreachable(method); err != nil {
+		return nil, err
+	}
 	switch method {
 	case "getblockchaininfo":
+		state.mutex.RLock()
+		defer state.mutex.RUnlock()
+		bestBlockHash, err := state.bestBlockHash()
+		if err != nil {
+			return nil, err
+		}
 		blockchaininfo := &ZcashdRpcReplyGetblockchaininfo{
 			Chain: state.chainName,
 			Upgrades: map[string]Upgradeinfo{
-				"76b809bb": {ActivationHeight: state.startHeight},
+				saplingBranchID: {ActivationHeight: state.startHeight},
+			},
+			Blocks:        state.latestHeight,
+			BestBlockHash: bestBlockHash,
+			Consensus: ConsensusInfo{
+				Nextblock: state.branchIDAt(state.latestHeight + 1),
+				Chaintip:  state.branchIDAt(state.latestHeight),
 			},
-			Blocks:    state.latestHeight,
-			Consensus: ConsensusInfo{state.branchID, state.branchID},
+			MedianTime: state.medianTime,
+		}
+		if state.orchardHeight > 0 {
+			blockchaininfo.Upgrades[nu5BranchID] = Upgradeinfo{ActivationHeight: state.orchardHeight}
 		}
 		return json.Marshal(blockchaininfo)
 
@@ -387,12 +1178,27 @@ func darksideRawRequest(method string, params []json.RawMessage) (json.RawMessag
 			return nil, errors.New("failed to parse getblock request")
 		}
 
+		verbosity := 1
+		if len(params) > 1 {
+			if err := json.Unmarshal(params[1], &verbosity); err != nil {
+				return nil, errors.New("failed to parse getblock verbosity")
+			}
+		}
+
+		state.mutex.RLock()
+		defer state.mutex.RUnlock()
+		if len(heightStr) == 64 {
+			// a block hash (big-endian hex)
+			blockBytes, err := state.getBlockByHash(heightStr)
+			if err != nil {
+				return nil, err
+			}
+			return getblockReply(blockBytes, verbosity)
+		}
 		height, err := strconv.Atoi(heightStr)
 		if err != nil {
 			return nil, errors.New("error parsing height as integer")
 		}
-		state.mutex.RLock()
-		defer state.mutex.RUnlock()
 		const notFoundErr = "-8:"
 		if len(state.activeBlocks) == 0 {
 			return nil, errors.New(notFoundErr)
@@ -408,14 +1214,47 @@ func darksideRawRequest(method string, params []json.RawMessage) (json.RawMessag
 		if index >= len(state.activeBlocks) {
 			return nil, errors.New(notFoundErr)
 		}
-		return json.Marshal(hex.EncodeToString(state.activeBlocks[index]))
+		return getblockReply(state.activeBlocks[index], verbosity)
+
+	case "getbestblockhash":
+		state.mutex.RLock()
+		defer state.mutex.RUnlock()
+		bestBlockHash, err := state.bestBlockHash()
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(bestBlockHash)
+
+	case "getblockhash":
+		var height int
+		if err := json.Unmarshal(params[0], &height); err != nil {
+			return nil, errors.New("failed to parse getblockhash request")
+		}
+		state.mutex.RLock()
+		defer state.mutex.RUnlock()
+		index := height - state.startHeight
+		if height > state.latestHeight || index < 0 || index >= len(state.activeBlocks) {
+			return nil, errors.New("-8: Block height out of range")
+		}
+		block := parser.NewBlock()
+		if _, err := block.ParseFromSlice(state.activeBlocks[index]); err != nil {
+			return nil, err
+		}
+		return json.Marshal(hex.EncodeToString(block.GetDisplayHash()))
+
+	case "z_gettreestate":
+		state.mutex.RLock()
+		defer state.mutex.RUnlock()
+		return state.getTreeState(params)
 
 	case "getaddresstxids":
 		// Not required for minimal reorg testing.
 		return nil, errors.New("not implemented yet")
 
 	case "getrawtransaction":
-		return darksideGetRawTransaction(params)
+		state.mutex.RLock()
+		defer state.mutex.RUnlock()
+		return state.getRawTransaction(params)
 
 	case "sendrawtransaction":
 		var rawtx string
@@ -436,7 +1275,12 @@ func darksideRawRequest(method string, params []json.RawMessage) (json.RawMessag
 		if len(rest) != 0 {
 			return nil, errors.New("transaction serialization is too long")
 		}
-		state.incomingTransactions = append(state.incomingTransactions, txBytes)
+		state.mutex.Lock()
+		err = state.addIncoming(txBytes)
+		state.mutex.Unlock()
+		if err != nil {
+			return nil, err
+		}
 
 		return []byte(hex.EncodeToString(tx.GetDisplayHash())), nil
 
@@ -464,7 +1308,9 @@ func darksideRawRequest(method string, params []json.RawMessage) (json.RawMessag
 	}
 }
 
-func darksideGetRawTransaction(params []json.RawMessage) (json.RawMessage, error) {
+// getRawTransaction is the mock zcashd's getrawtransaction. The caller must
+// hold state.mutex.
+func (state *darksideState) getRawTransaction(params []json.RawMessage) (json.RawMessage, error) {
 	if !state.resetted {
 		return nil, errors.New("please call Reset first")
 	}
@@ -477,16 +1323,23 @@ func darksideGetRawTransaction(params []json.RawMessage) (json.RawMessage, error
 	if err != nil {
 		return nil, errors.New("-9: " + err.Error())
 	}
-	marshalReply := func(tx *parser.Transaction, height int) []byte {
+	marshalReply := func(tx *parser.Transaction, height int, blockhash string) []byte {
 		switch string(params[1]) {
 		case "0":
 			txJSON, _ := json.Marshal(hex.EncodeToString(tx.Bytes()))
 			return txJSON
 		case "1":
+			// A transaction that isn't mined is valid in the next block.
+			branchHeight := height
+			if blockhash == "" {
+				branchHeight = state.latestHeight + 1
+			}
 			reply := struct {
-				Hex    string
-				Height int
-			}{hex.EncodeToString(tx.Bytes()), height}
+				Hex               string
+				Height            int
+				Blockhash         string `json:",omitempty"`
+				ConsensusBranchID string `json:"consensusbranchid"`
+			}{hex.EncodeToString(tx.Bytes()), height, blockhash, state.branchIDAt(branchHeight)}
 			txVerboseJSON, _ := json.Marshal(reply)
 			return txVerboseJSON
 		default:
@@ -504,7 +1357,8 @@ func darksideGetRawTransaction(params []json.RawMessage) (json.RawMessage, error
 			_, _ = block.ParseFromSlice(b)
 			for _, tx := range block.Transactions() {
 				if bytes.Equal(tx.GetDisplayHash(), txid) {
-					return marshalReply(tx, block.GetHeight())
+					return marshalReply(tx, block.GetHeight(),
+						hex.EncodeToString(block.GetDisplayHash()))
 				}
 			}
 		}
@@ -523,14 +1377,18 @@ func darksideGetRawTransaction(params []json.RawMessage) (json.RawMessage, error
 		tx := parser.NewTransaction()
 		_, _ = tx.ParseFromSlice(stx.bytes)
 		if bytes.Equal(tx.GetDisplayHash(), txid) {
-			return marshalReply(tx, 0), nil
+			return marshalReply(tx, 0, ""), nil
 		}
 	}
 	return nil, errors.New("-5: No information available about transaction")
 }
 
 // DarksideStageTransaction adds the given transaction to the staging area.
-func DarksideStageTransaction(height int, txBytes []byte) error {
+func DarksideStageTransaction(session string, height int, txBytes []byte) error {
+	state, err := darksideSession(session)
+	if err != nil {
+		return err
+	}
 	if !state.resetted {
 		return errors.New("please call Reset first")
 	}
@@ -543,6 +1401,8 @@ func DarksideStageTransaction(height int, txBytes []byte) error {
 	if len(rest) != 0 {
 		return errors.New("transaction serialization is too long")
 	}
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
 	state.stagedTransactions = append(state.stagedTransactions,
 		stagedTx{
 			height: height,
@@ -553,7 +1413,11 @@ func DarksideStageTransaction(height int, txBytes []byte) error {
 
 // DarksideStageTransactionsURL reads a list of transactions (hex-encoded, one
 // per line) from the given URL, and associates them with the given height.
-func DarksideStageTransactionsURL(height int, url string) error {
+func DarksideStageTransactionsURL(session string, height int, url string) error {
+	state, err := darksideSession(session)
+	if err != nil {
+		return err
+	}
 	if !state.resetted {
 		return errors.New("please call Reset first")
 	}
@@ -578,7 +1442,7 @@ func DarksideStageTransactionsURL(height int, url string) error {
 		if err != nil {
 			return err
 		}
-		if err = DarksideStageTransaction(height, transactionBytes); err != nil {
+		if err = DarksideStageTransaction(session, height, transactionBytes); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,77 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/adityapk00/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
+)
+
+// Exported blocks (see the ExportBlocks rpc) are a sequence of records, one
+// per block in ascending height order, each the 4-byte little-endian length
+// of the serialized compact block followed by the serialization. This is how
+// the cache stores blocks on disk (with the lengths kept separately), and
+// protobuf serialization is stable, so exports can be imported by later
+// versions.
+
+// MarshalExportRecord returns the given block's record in the export format.
+func MarshalExportRecord(block *walletrpc.CompactBlock) ([]byte, error) {
+	data, err := proto.Marshal(block)
+	if err != nil {
+		return nil, err
+	}
+	record := make([]byte, 4, 4+len(data))
+	binary.LittleEndian.PutUint32(record, uint32(len(data)))
+	return append(record, data...), nil
+}
+
+// ImportBlocks adds to the cache the blocks read, in the export format, from
+// r. Blocks below the cache's next height are skipped (they may overlap what
+// the cache already has); the rest must follow on from the cache's chain,
+// each linking to the one before it. It returns the number of blocks added.
+func ImportBlocks(c *BlockCache, r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+	added := 0
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			if err == io.EOF {
+				return added, nil
+			}
+			return added, err
+		}
+		size := binary.LittleEndian.Uint32(header[:])
+		if size > blockFileMaxSize {
+			return added, errors.New(fmt.Sprint("export record too large (", size, " bytes)"))
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return added, err
+		}
+		block := &walletrpc.CompactBlock{}
+		if err := proto.Unmarshal(data, block); err != nil {
+			return added, err
+		}
+		height := int(block.Height)
+		if height < c.GetNextHeight() {
+			continue
+		}
+		if height > c.GetNextHeight() {
+			return added, errors.New(fmt.Sprint("export is missing blocks before height ", height))
+		}
+		if c.HashMismatch(block.PrevHash) {
+			return added, errors.New(fmt.Sprint("exported block at height ", height, " doesn't link to the cache's chain"))
+		}
+		if err := c.Add(height, block); err != nil {
+			return added, err
+		}
+		added++
+	}
+}
@@ -2,52 +2,93 @@ package logging
 
 import (
 	"context"
+	"net"
 	"time"
 
+	"github.com/adityapk00/lightwalletd/common"
 	"github.com/sirupsen/logrus"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
+// LogToStderr additionally logs each call to stderr (the standard logger).
 var LogToStderr bool
 
 func LoggingInterceptor() grpc.ServerOption {
 	return grpc.UnaryInterceptor(LogInterceptor)
 }
 
-func loggerFromContext(ctx context.Context) *logrus.Entry {
-	// TODO: anonymize the addresses. cryptopan?
-	if peerInfo, ok := peer.FromContext(ctx); ok {
-		return log.WithFields(logrus.Fields{"peer_addr": peerInfo.Addr})
+// PeerIPFromContext returns the client's IP address, preferring the
+// x-real-ip header set by a reverse proxy.
+func PeerIPFromContext(ctx context.Context) string {
+	if xRealIP, ok := metadata.FromIncomingContext(ctx); ok {
+		realIP := xRealIP.Get("x-real-ip")
+		if len(realIP) > 0 {
+			return realIP[0]
+		}
 	}
-	return log.WithFields(logrus.Fields{"peer_addr": "unknown"})
-}
 
-func LogInterceptor(
-	ctx context.Context,
-	req interface{},
-	info *grpc.UnaryServerInfo,
-	handler grpc.UnaryHandler,
-) (interface{}, error) {
-	reqLog := loggerFromContext(ctx)
-	start := time.Now()
+	if peerInfo, ok := peer.FromContext(ctx); ok && peerInfo.Addr != nil {
+		ip, _, err := net.SplitHostPort(peerInfo.Addr.String())
+		if err == nil {
+			return ip
+		}
+	}
 
-	resp, err := handler(ctx, req)
+	return "unknown"
+}
 
+// logCall writes an access log entry for a completed call.
+func logCall(ctx context.Context, method string, start time.Time, err error) {
+	fields := logrus.Fields{
+		"method":    method,
+		"peer_addr": PeerIPFromContext(ctx),
+		"duration":  time.Since(start),
+		"code":      status.Code(err).String(),
+	}
+	if err != nil {
+		fields["error"] = err
+	}
+	entries := []*logrus.Entry{common.Log.WithFields(fields)}
 	if LogToStderr {
-		entry := reqLog.WithFields(logrus.Fields{
-			"method":   info.FullMethod,
-			"duration": time.Since(start),
-			"error":    err,
-		})
-
+		entries = append(entries, log.WithFields(fields))
+	}
+	for _, entry := range entries {
 		if err != nil {
 			entry.Error("call failed")
 		} else {
 			entry.Info("method called")
 		}
 	}
+}
 
+// LogInterceptor logs each unary call: its method, the client's IP address,
+// how long it took, and its gRPC status code.
+func LogInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logCall(ctx, info.FullMethod, start, err)
 	return resp, err
 }
+
+// StreamLogInterceptor logs each streaming call, as LogInterceptor does
+// unary ones, once the call has finished.
+func StreamLogInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	logCall(ss.Context(), info.FullMethod, start, err)
+	return err
+}
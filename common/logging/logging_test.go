@@ -4,9 +4,14 @@
 package logging
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"net"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"errors"
@@ -14,7 +19,10 @@ import (
 	"github.com/adityapk00/lightwalletd/common"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
 var step int
@@ -60,3 +68,74 @@ func TestLogInterceptor(t *testing.T) {
 	os.Remove("test-log")
 	step = 0
 }
+
+func TestSampler(t *testing.T) {
+	var nilSampler *Sampler
+	if !nilSampler.Sample() || !NewSampler(1).Sample() || !NewSampler(0).Sample() {
+		t.Fatal("expected every event to be sampled")
+	}
+
+	s := NewSampler(10)
+	var wg sync.WaitGroup
+	var sampled int64
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				if s.Sample() {
+					atomic.AddInt64(&sampled, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if sampled != 1000 {
+		t.Fatal("expected 1 in 10 of 10000 events to be sampled, got", sampled)
+	}
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *testServerStream) Context() context.Context { return ss.ctx }
+
+func TestStreamLogInterceptor(t *testing.T) {
+	var output bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&output)
+	common.Log = logger.WithFields(logrus.Fields{
+		"app": "test",
+	})
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 9067},
+	})
+	info := &grpc.StreamServerInfo{FullMethod: "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetBlockRange"}
+	err := StreamLogInterceptor(nil, &testServerStream{ctx: ctx}, info,
+		func(srv interface{}, ss grpc.ServerStream) error {
+			return status.Error(codes.OutOfRange, "test error")
+		})
+	if status.Code(err) != codes.OutOfRange {
+		t.Fatal("unexpected error", err)
+	}
+	for _, want := range []string{"call failed", "GetBlockRange", "peer_addr=10.0.0.1", "code=OutOfRange"} {
+		if !strings.Contains(output.String(), want) {
+			t.Fatal("log entry", output.String(), "doesn't contain", want)
+		}
+	}
+
+	// A reverse proxy's x-real-ip header is preferred to the peer address.
+	output.Reset()
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-real-ip", "192.0.2.7"))
+	if err := StreamLogInterceptor(nil, &testServerStream{ctx: ctx}, info,
+		func(srv interface{}, ss grpc.ServerStream) error { return nil }); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	for _, want := range []string{"method called", "peer_addr=192.0.2.7", "code=OK"} {
+		if !strings.Contains(output.String(), want) {
+			t.Fatal("log entry", output.String(), "doesn't contain", want)
+		}
+	}
+}
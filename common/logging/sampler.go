@@ -0,0 +1,32 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package logging
+
+import "sync/atomic"
+
+// Sampler selects one of every n events, so that only a sample of very
+// frequent requests is logged. It's safe for concurrent use, and a nil
+// Sampler selects every event.
+type Sampler struct {
+	count uint64 // first, for 64-bit alignment
+	n     uint64
+}
+
+// NewSampler returns a Sampler that selects one of every n events (every
+// event if n is less than 2).
+func NewSampler(n int) *Sampler {
+	if n < 1 {
+		n = 1
+	}
+	return &Sampler{n: uint64(n)}
+}
+
+// Sample returns true if this event should be logged; the first event, and
+// each nth one after it, are.
+func (s *Sampler) Sample() bool {
+	if s == nil || s.n <= 1 {
+		return true
+	}
+	return (atomic.AddUint64(&s.count, 1)-1)%s.n == 0
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+
+package common
+
+import "strings"
+
+// Network holds the per-chain parameters that lightwalletd needs,
+// keyed by the chain name that zcashd reports ("main", "test", "regtest").
+type Network struct {
+	Name string
+	// Leading characters of the Base58Check-encoded transparent
+	// addresses (P2PKH, P2SH) that are valid on this network.
+	TaddrPrefixes []string
+}
+
+var networks = map[string]*Network{
+	"main":    {Name: "main", TaddrPrefixes: []string{"t1", "t3"}},
+	"test":    {Name: "test", TaddrPrefixes: []string{"tm", "t2"}},
+	"regtest": {Name: "regtest", TaddrPrefixes: []string{"tm", "t2"}},
+}
+
+// GetNetwork returns the parameters for the given chain name. An unknown
+// chain (darkside, unit tests) gets a permissive network that accepts the
+// address prefixes of all the known networks.
+func GetNetwork(chainName string) *Network {
+	if n, ok := networks[chainName]; ok {
+		return n
+	}
+	return &Network{
+		Name:          chainName,
+		TaddrPrefixes: []string{"t1", "t3", "tm", "t2"},
+	}
+}
+
+// IsTaddrPrefix indicates whether the (encoded) transparent address
+// begins with one of this network's prefixes.
+func (n *Network) IsTaddrPrefix(taddr string) bool {
+	for _, prefix := range n.TaddrPrefixes {
+		if strings.HasPrefix(taddr, prefix) {
+			return true
+		}
+	}
+	return false
+}
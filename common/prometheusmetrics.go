@@ -1,12 +1,22 @@
 package common
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"context"
+	"path"
+	"time"
 
-// PrometheusMetrics is a list of collected Prometheus Counters and Guages that will be exported
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+)
+
+// PrometheusMetrics is a list of collected Prometheus Counters, Guages and
+// Histograms that will be exported
 type PrometheusMetrics struct {
 	LatestBlockCounter           prometheus.Counter
 	TotalBlocksServedConter      prometheus.Counter
 	SendTransactionsCounter      prometheus.Counter
+	DedupedSendsCounter          prometheus.Counter
+	PingCounter                  prometheus.Counter
 	TotalErrors                  prometheus.Counter
 	TotalSaplingParamsCounter    prometheus.Counter
 	TotalSproutParamsCounter     prometheus.Counter
@@ -14,6 +24,7 @@ type PrometheusMetrics struct {
 	ZecPriceGauge                prometheus.Gauge
 	ZecPriceHistoryWebAPICounter prometheus.Counter
 	ZecPriceHistoryErrors        prometheus.Counter
+	RequestLatencyHistogram      *prometheus.HistogramVec
 }
 
 func GetPrometheusMetrics() *PrometheusMetrics {
@@ -38,6 +49,16 @@ func GetPrometheusMetrics() *PrometheusMetrics {
 		Help: "Total number of transactions broadcasted by lightwalletd",
 	})
 
+	m.DedupedSendsCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "lightwalletd_send_transactions_deduped",
+		Help: "Number of SendTransaction resubmissions answered without calling zcashd",
+	})
+
+	m.PingCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "lightwalletd_ping_requests",
+		Help: "Number of Ping calls, including those refused because Ping isn't enabled",
+	})
+
 	m.TotalErrors = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "lightwalletd_total_errors",
 		Help: "Total number of errors seen by lightwalletd",
@@ -73,5 +94,47 @@ func GetPrometheusMetrics() *PrometheusMetrics {
 		Help: "Counter for number of errors seen in the history price API",
 	})
 
+	// From 1ms to about 30s; a streaming call (such as GetBlockRange) is
+	// timed until its last reply is sent.
+	m.RequestLatencyHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "lightwalletd_grpc_request_duration_seconds",
+		Help:    "Time taken to handle gRPC requests, by method",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+	}, []string{"method"})
+
 	return m
 }
+
+// methodName returns the method part ("GetBlockRange") of a gRPC full
+// method name ("/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetBlockRange").
+func methodName(fullMethod string) string {
+	return path.Base(fullMethod)
+}
+
+// UnaryLatencyInterceptor records the time taken by each unary gRPC request
+// in RequestLatencyHistogram.
+func (m *PrometheusMetrics) UnaryLatencyInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	m.RequestLatencyHistogram.WithLabelValues(methodName(info.FullMethod)).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// StreamLatencyInterceptor records the time taken by each streaming gRPC
+// request in RequestLatencyHistogram.
+func (m *PrometheusMetrics) StreamLatencyInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	m.RequestLatencyHistogram.WithLabelValues(methodName(info.FullMethod)).Observe(time.Since(start).Seconds())
+	return err
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"crypto/tls"
+	"errors"
+	"strings"
+)
+
+// tlsVersions are the TLS versions that may be the server's minimum.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsCipherSuites are the (TLS 1.2) cipher suites that may be allowed, by
+// IANA name: those with forward secrecy and authenticated encryption.
+var tlsCipherSuites = map[string]uint16{
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256":       tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384":       tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256": tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256":   tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+}
+
+// NewTLSConfig returns the server's TLS configuration: the given certificate,
+// the minimum TLS version ("1.2" or "1.3"; empty means "1.2"), and, if any
+// are given, the only TLS 1.2 cipher suites allowed (by IANA name). Older
+// versions and weaker cipher suites are refused.
+func NewTLSConfig(cert tls.Certificate, minVersion string, cipherSuites []string) (*tls.Config, error) {
+	if minVersion == "" {
+		minVersion = "1.2"
+	}
+	version, ok := tlsVersions[minVersion]
+	if !ok {
+		if minVersion == "1.0" || minVersion == "1.1" {
+			return nil, errors.New("TLS version " + minVersion + " is insecure; the minimum must be 1.2 or 1.3")
+		}
+		return nil, errors.New("unknown TLS version " + minVersion + "; the minimum must be 1.2 or 1.3")
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   version,
+	}
+	if len(cipherSuites) == 0 {
+		return config, nil
+	}
+	if version == tls.VersionTLS13 {
+		// Go doesn't allow TLS 1.3 cipher suites to be configured (all
+		// of them are secure), so this would have no effect.
+		return nil, errors.New("cipher suites can't be configured when the minimum TLS version is 1.3")
+	}
+	for _, name := range cipherSuites {
+		suite, ok := tlsCipherSuites[strings.TrimSpace(name)]
+		if !ok {
+			return nil, errors.New("unknown or insecure TLS cipher suite " + name)
+		}
+		config.CipherSuites = append(config.CipherSuites, suite)
+	}
+	return config, nil
+}
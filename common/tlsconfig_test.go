@@ -0,0 +1,74 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package common
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+// tlsHandshake serves one connection with the given configuration, and
+// returns the error (if any) of a client that allows only TLS 1.2.
+func tlsHandshake(t *testing.T, config *tls.Config) error {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conn.(*tls.Conn).Handshake()
+		conn.Close()
+	}()
+	conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS12,
+	})
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	cert := *GenerateCerts()
+
+	config, err := NewTLSConfig(cert, "", []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"})
+	if err != nil {
+		t.Fatal("NewTLSConfig failed:", err)
+	}
+	if config.MinVersion != tls.VersionTLS12 || len(config.CipherSuites) != 1 {
+		t.Fatal("unexpected TLS config", config.MinVersion, config.CipherSuites)
+	}
+	if err := tlsHandshake(t, config); err != nil {
+		t.Fatal("TLS 1.2 client rejected:", err)
+	}
+
+	config, err = NewTLSConfig(cert, "1.3", nil)
+	if err != nil {
+		t.Fatal("NewTLSConfig failed:", err)
+	}
+	if err := tlsHandshake(t, config); err == nil {
+		t.Fatal("TLS 1.2 client accepted with minimum version 1.3")
+	}
+
+	for _, tt := range []struct {
+		minVersion   string
+		cipherSuites []string
+	}{
+		{"1.0", nil},
+		{"1.1", nil},
+		{"2.0", nil},
+		{"1.2", []string{"TLS_RSA_WITH_AES_128_CBC_SHA"}},
+		{"1.3", []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}},
+	} {
+		if _, err := NewTLSConfig(cert, tt.minVersion, tt.cipherSuites); err == nil {
+			t.Fatal("NewTLSConfig accepted", tt.minVersion, tt.cipherSuites)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package frontend
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/adityapk00/lightwalletd/common/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// dailyQuotaMaxEntries bounds the number of peers the daily quota tracks;
+// once that many have made requests today, further peers aren't limited
+// until the counts reset.
+const dailyQuotaMaxEntries = 100000
+
+// DailyQuota limits the number of requests (unary calls and streams) each
+// peer IP address may make per UTC day. Use its interceptors when creating
+// the gRPC server.
+type DailyQuota struct {
+	limit int
+	now   func() time.Time // a variable only so that tests can change it
+
+	mutex   sync.Mutex
+	resetAt time.Time // the next UTC midnight
+	counts  map[string]int
+}
+
+// NewDailyQuota returns a quota of limit requests per peer per day; zero
+// means no limit.
+func NewDailyQuota(limit int) *DailyQuota {
+	return &DailyQuota{
+		limit:  limit,
+		now:    time.Now,
+		counts: make(map[string]int),
+	}
+}
+
+// nextUTCMidnight returns the first UTC midnight after t.
+func nextUTCMidnight(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC)
+}
+
+// take counts a request from the given peer, returning an error if that
+// exceeds the peer's quota.
+func (q *DailyQuota) take(peerip string) error {
+	if q.limit <= 0 {
+		return nil
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	now := q.now()
+	if !now.Before(q.resetAt) {
+		q.counts = make(map[string]int)
+		q.resetAt = nextUTCMidnight(now)
+	}
+	count, ok := q.counts[peerip]
+	if !ok && len(q.counts) >= dailyQuotaMaxEntries {
+		// Full; don't track this peer.
+		return nil
+	}
+	if count >= q.limit {
+		return status.Errorf(codes.ResourceExhausted,
+			"quota exceeded, resets at %s", q.resetAt.Format(time.RFC3339))
+	}
+	q.counts[peerip] = count + 1
+	return nil
+}
+
+// UnaryInterceptor rejects unary calls from peers over their quota.
+func (q *DailyQuota) UnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if err := q.take(logging.PeerIPFromContext(ctx)); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor rejects streams from peers over their quota.
+func (q *DailyQuota) StreamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if err := q.take(logging.PeerIPFromContext(ss.Context())); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,1913 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package frontend
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityapk00/lightwalletd/common"
+	"github.com/adityapk00/lightwalletd/parser"
+	"github.com/adityapk00/lightwalletd/walletrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// darksideSetup switches the mock zcashd into darkside mode with an empty
+// chain starting at startHeight; call the returned function (deferred) to
+// stop the block ingestor that ApplyStaged starts.
+func darksideSetup(t *testing.T, startHeight int) (walletrpc.CompactTxStreamerServer, walletrpc.DarksideStreamerServer, func()) {
+	testT = t
+	lwd, cache := testsetup()
+	// The ingestor polls the mock zcashd; don't make the tests wait.
+	common.Sleep = func(d time.Duration) { time.Sleep(10 * time.Millisecond) }
+	common.DarksideInit(cache, 30, nil)
+	dlwd, err := NewDarksideStreamer(cache, lwd)
+	if err != nil {
+		t.Fatal("NewDarksideStreamer failed:", err)
+	}
+	_, err = dlwd.Reset(context.Background(), &walletrpc.DarksideMetaState{
+		SaplingActivation: int32(startHeight),
+		BranchID:          "2bb40e60",
+		ChainName:         "main",
+	})
+	if err != nil {
+		t.Fatal("darkside Reset failed:", err)
+	}
+	return lwd, dlwd, func() {
+		// Reset stops the ingestor.
+		dlwd.Reset(context.Background(), &walletrpc.DarksideMetaState{
+			SaplingActivation: int32(startHeight),
+			BranchID:          "2bb40e60",
+			ChainName:         "main",
+		})
+		common.DarksideShutdown()
+		common.DarksideEnabled = false
+	}
+}
+
+// darksideDisplayHash computes the display hash of the block that the
+// mock zcashd is presenting at the given height.
+func darksideDisplayHash(t *testing.T, height int) string {
+	heightJSON, _ := json.Marshal(strconv.Itoa(height))
+	result, err := common.RawRequest("getblock", []json.RawMessage{heightJSON, json.RawMessage("0")})
+	if err != nil {
+		t.Fatal("darkside getblock failed:", err)
+	}
+	var blockHex string
+	if err := json.Unmarshal(result, &blockHex); err != nil {
+		t.Fatal(err)
+	}
+	blockBytes, err := hex.DecodeString(blockHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := parser.NewBlock()
+	if _, err := block.ParseFromSlice(blockBytes); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(block.GetDisplayHash())
+}
+
+// testServerStream captures the headers and trailers a unary handler sets.
+type testServerStream struct {
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (ts *testServerStream) Method() string { return "test" }
+func (ts *testServerStream) SetHeader(md metadata.MD) error {
+	ts.header = metadata.Join(ts.header, md)
+	return nil
+}
+func (ts *testServerStream) SendHeader(md metadata.MD) error { return ts.SetHeader(md) }
+func (ts *testServerStream) SetTrailer(md metadata.MD) error {
+	ts.trailer = metadata.Join(ts.trailer, md)
+	return nil
+}
+
+func TestDarksideGetBlockHashHeader(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 5}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1004}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+
+	for _, height := range []int{1000, 1003} {
+		stream := &testServerStream{}
+		ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+		block, err := lwd.GetBlock(ctx, &walletrpc.BlockID{Height: uint64(height)})
+		if err != nil {
+			t.Fatal("GetBlock failed:", err)
+		}
+		if int(block.Height) != height {
+			t.Fatal("GetBlock unexpected height", block.Height)
+		}
+		hashes := stream.header.Get(BlockHashHeader)
+		if len(hashes) != 1 {
+			t.Fatal("GetBlock unexpected block hash header", hashes)
+		}
+		if hashes[0] != darksideDisplayHash(t, height) {
+			t.Fatal("GetBlock block hash header mismatch", hashes[0])
+		}
+	}
+}
+
+func TestDarksideGetLatestBlock(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 4}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1002}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+	blockID, err := lwd.GetLatestBlock(context.Background(), &walletrpc.ChainSpec{})
+	if err != nil {
+		t.Fatal("GetLatestBlock failed:", err)
+	}
+	if blockID.Height != 1002 {
+		t.Fatal("GetLatestBlock unexpected height", blockID.Height)
+	}
+	if parser.InternalToDisplayHex(blockID.Hash) != darksideDisplayHash(t, 1002) {
+		t.Fatal("GetLatestBlock unexpected hash", hex.EncodeToString(blockID.Hash))
+	}
+}
+
+func TestDarksideSetBackendDown(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 4}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1003}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+	getTransaction := func() error {
+		_, err := lwd.GetTransaction(context.Background(), &walletrpc.TxFilter{Hash: make([]byte, 32)})
+		return err
+	}
+
+	// Only getblockchaininfo is down.
+	if _, err := dlwd.SetBackendDown(context.Background(),
+		&walletrpc.DarksideBackendDown{Down: true, Methods: []string{"getblockchaininfo"}}); err != nil {
+		t.Fatal("SetBackendDown failed:", err)
+	}
+	if _, err := lwd.GetLatestBlock(context.Background(), &walletrpc.ChainSpec{}); status.Code(err) != codes.Unavailable {
+		t.Fatal("GetLatestBlock unexpected error", err)
+	}
+	if err := getTransaction(); err == nil || status.Code(err) == codes.Unavailable {
+		t.Fatal("GetTransaction unexpected error", err)
+	}
+
+	// Everything is down.
+	if _, err := dlwd.SetBackendDown(context.Background(),
+		&walletrpc.DarksideBackendDown{Down: true}); err != nil {
+		t.Fatal("SetBackendDown failed:", err)
+	}
+	if err := getTransaction(); status.Code(err) != codes.Unavailable {
+		t.Fatal("GetTransaction unexpected error", err)
+	}
+
+	if _, err := dlwd.SetBackendDown(context.Background(),
+		&walletrpc.DarksideBackendDown{}); err != nil {
+		t.Fatal("SetBackendDown failed:", err)
+	}
+	blockID, err := lwd.GetLatestBlock(context.Background(), &walletrpc.ChainSpec{})
+	if err != nil {
+		t.Fatal("GetLatestBlock failed after the backend came back:", err)
+	}
+	if blockID.Height != 1003 {
+		t.Fatal("GetLatestBlock unexpected height", blockID.Height)
+	}
+}
+
+func TestDarksideGetBlockByHash(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 4}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1003}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+
+	hash, err := parser.DisplayHexToInternal(darksideDisplayHash(t, 1002))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := lwd.GetBlock(context.Background(), &walletrpc.BlockID{Hash: hash})
+	if err != nil {
+		t.Fatal("GetBlock by hash failed:", err)
+	}
+	if block.Height != 1002 || !bytes.Equal(block.Hash, hash) {
+		t.Fatal("GetBlock by hash returned the wrong block", block.Height)
+	}
+
+	unknown := make([]byte, 32)
+	unknown[0] = 1
+	_, err = lwd.GetBlock(context.Background(), &walletrpc.BlockID{Hash: unknown})
+	if status.Code(err) != codes.NotFound {
+		t.Fatal("GetBlock unknown hash unexpected error", err)
+	}
+}
+
+func TestDarksideStageBlockWithPrevhash(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 4}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1003}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+	// waitForTip waits until the cache's tip satisfies the condition.
+	cache := lwd.(*lwdStreamer).cache
+	waitForTip := func(cond func(int) bool) {
+		for start := time.Now(); !cond(cache.GetLatestHeight()); time.Sleep(10 * time.Millisecond) {
+			if time.Since(start) > 10*time.Second {
+				t.Fatal("ingestor didn't reach the expected tip, at", cache.GetLatestHeight())
+			}
+		}
+	}
+	waitForTip(func(tip int) bool { return tip == 1003 })
+	heightJSON, _ := json.Marshal("1003")
+	result, err := common.RawRequest("getblock", []json.RawMessage{heightJSON, json.RawMessage("0")})
+	if err != nil {
+		t.Fatal("darkside getblock failed:", err)
+	}
+	var blockHex string
+	if err := json.Unmarshal(result, &blockHex); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace block 1003 with one whose prevhash is wrong, and add a
+	// block on top of it.
+	badPrevhash := make([]byte, 32)
+	badPrevhash[0] = 0xba
+	if _, err := dlwd.StageBlockWithPrevhash(context.Background(),
+		&walletrpc.DarksideBlockPrevhash{Block: blockHex, PrevHash: []byte{1, 2, 3}}); err == nil {
+		t.Fatal("StageBlockWithPrevhash accepted a short prevhash")
+	}
+	if _, err := dlwd.StageBlockWithPrevhash(context.Background(),
+		&walletrpc.DarksideBlockPrevhash{Block: blockHex, PrevHash: badPrevhash}); err != nil {
+		t.Fatal("StageBlockWithPrevhash failed:", err)
+	}
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1004, Count: 1}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1004}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+
+	// lightwalletd's ingestor refuses the broken link: it backs up to
+	// block 1002 and never caches the broken block (or any above it), so
+	// once the original block 1003 is rolled back, GetBlock serves these
+	// from the mock zcashd, with the broken prevhash intact.
+	waitForTip(func(tip int) bool { return tip < 1003 })
+	// Give the ingestor time to (wrongly) add it again.
+	time.Sleep(100 * time.Millisecond)
+	blocks := make(map[int]*walletrpc.CompactBlock)
+	for height := 1003; height <= 1004; height++ {
+		block, err := lwd.GetBlock(context.Background(), &walletrpc.BlockID{Height: uint64(height)})
+		if err != nil {
+			t.Fatal("GetBlock failed:", err)
+		}
+		blocks[height] = block
+	}
+	if latest := cache.GetLatestHeight(); latest >= 1003 {
+		t.Fatal("ingestor cached the block after the broken link, tip", latest)
+	}
+	if !bytes.Equal(blocks[1003].PrevHash, badPrevhash) {
+		t.Fatal("broken prevhash was relinked:", hex.EncodeToString(blocks[1003].PrevHash))
+	}
+	// Blocks staged normally are still linked.
+	if !bytes.Equal(blocks[1004].PrevHash, blocks[1003].Hash) {
+		t.Fatal("block after the broken link isn't linked to it")
+	}
+}
+
+func TestDarksideGetLatestBlockLongPoll(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 3}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1002}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+	// Wait for the ingestor to reach the tip.
+	tip, err := lwd.GetLatestBlockLongPoll(context.Background(),
+		&walletrpc.LatestBlockWait{Height: 1001, TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal("GetLatestBlockLongPoll failed:", err)
+	}
+	if tip.Height != 1002 {
+		t.Fatal("GetLatestBlockLongPoll unexpected height", tip.Height)
+	}
+
+	// Nothing new arrives; the call times out and returns the same tip.
+	tip, err = lwd.GetLatestBlockLongPoll(context.Background(),
+		&walletrpc.LatestBlockWait{Height: 1002, TimeoutSeconds: 1})
+	if err != nil {
+		t.Fatal("GetLatestBlockLongPoll failed:", err)
+	}
+	if tip.Height != 1002 {
+		t.Fatal("GetLatestBlockLongPoll unexpected height after timeout", tip.Height)
+	}
+
+	// A waiting call is released when new blocks are staged.
+	done := make(chan *walletrpc.BlockID)
+	go func() {
+		tip, err := lwd.GetLatestBlockLongPoll(context.Background(),
+			&walletrpc.LatestBlockWait{Height: 1002, TimeoutSeconds: 30})
+		if err != nil {
+			t.Error("GetLatestBlockLongPoll failed:", err)
+		}
+		done <- tip
+	}()
+	select {
+	case <-done:
+		t.Fatal("GetLatestBlockLongPoll returned before the tip advanced")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1003, Count: 2}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1004}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+	select {
+	case tip := <-done:
+		if tip == nil || tip.Height <= 1002 {
+			t.Fatal("GetLatestBlockLongPoll unexpected tip", tip)
+		}
+		if hex.EncodeToString(parser.Reverse(tip.Hash)) != darksideDisplayHash(t, int(tip.Height)) {
+			t.Fatal("GetLatestBlockLongPoll hash mismatch")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("GetLatestBlockLongPoll was not released by new blocks")
+	}
+}
+
+type testsubscribenewblocks struct {
+	walletrpc.CompactTxStreamer_SubscribeNewBlocksServer
+	ctx context.Context
+	ids chan *walletrpc.BlockID
+}
+
+func (tg *testsubscribenewblocks) Context() context.Context {
+	return tg.ctx
+}
+
+func (tg *testsubscribenewblocks) Send(id *walletrpc.BlockID) error {
+	tg.ids <- id
+	return nil
+}
+
+func TestDarksideSubscribeNewBlocks(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	resp := &testsubscribenewblocks{ctx: ctx, ids: make(chan *walletrpc.BlockID, 100)}
+	done := make(chan error)
+	go func() {
+		done <- lwd.SubscribeNewBlocks(&walletrpc.Empty{}, resp)
+	}()
+	// waitFor returns once the tip with the given height and (presented)
+	// hash is sent, checking that no tip is sent twice in a row.
+	waitFor := func(height uint64, hash string) {
+		var last *walletrpc.BlockID
+		for {
+			select {
+			case id := <-resp.ids:
+				if last != nil && id.Height == last.Height && bytes.Equal(id.Hash, last.Hash) {
+					t.Fatal("SubscribeNewBlocks sent the same tip twice", id.Height)
+				}
+				last = id
+				if id.Height == height && hex.EncodeToString(parser.Reverse(id.Hash)) == hash {
+					return
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("SubscribeNewBlocks didn't send the tip at height", height)
+			}
+		}
+	}
+	select {
+	case id := <-resp.ids:
+		t.Fatal("SubscribeNewBlocks sent a tip before there were blocks", id)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 3}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1002}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+	waitFor(1002, darksideDisplayHash(t, 1002))
+
+	// Replace the tip (a reorg to a chain of the same length); the new tip
+	// is sent.
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1002, Nonce: 1, Count: 1}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1002}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+	waitFor(1002, darksideDisplayHash(t, 1002))
+
+	// The stream ends when the client goes away.
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal("SubscribeNewBlocks failed:", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("SubscribeNewBlocks didn't return after the client went away")
+	}
+}
+
+func TestDarksideStageBlocksCreateLimits(t *testing.T) {
+	_, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+	savedCreate, savedSession := common.DarksideMaxBlocksCreate, common.DarksideMaxBlocksSession
+	defer func() {
+		common.DarksideMaxBlocksCreate, common.DarksideMaxBlocksSession = savedCreate, savedSession
+	}()
+	common.DarksideMaxBlocksCreate = 5
+	common.DarksideMaxBlocksSession = 8
+
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 6}); err == nil {
+		t.Fatal("StageBlocksCreate should have failed on the per-call limit")
+	}
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 5}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1005, Count: 4}); err == nil {
+		t.Fatal("StageBlocksCreate should have failed on the session limit")
+	}
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1005, Count: 3}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+
+	// Reset starts a new session.
+	if _, err := dlwd.Reset(context.Background(), &walletrpc.DarksideMetaState{
+		SaplingActivation: 1000,
+		BranchID:          "2bb40e60",
+		ChainName:         "main",
+	}); err != nil {
+		t.Fatal("darkside Reset failed:", err)
+	}
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 5}); err != nil {
+		t.Fatal("StageBlocksCreate after Reset failed:", err)
+	}
+}
+
+func TestDarksideLightdInfoActivationHeights(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+
+	info, err := lwd.GetLightdInfo(context.Background(), &walletrpc.Empty{})
+	if err != nil {
+		t.Fatal("GetLightdInfo failed:", err)
+	}
+	if info.SaplingActivationHeight != 1000 || info.OrchardActivationHeight != 0 {
+		t.Fatal("unexpected activation heights", info.SaplingActivationHeight, info.OrchardActivationHeight)
+	}
+
+	if _, err := dlwd.Reset(context.Background(), &walletrpc.DarksideMetaState{
+		SaplingActivation: 1000,
+		OrchardActivation: 999,
+		BranchID:          "2bb40e60",
+		ChainName:         "main",
+	}); err == nil {
+		t.Fatal("Reset should have failed, Orchard before Sapling")
+	}
+	if _, err := dlwd.Reset(context.Background(), &walletrpc.DarksideMetaState{
+		SaplingActivation: 1000,
+		OrchardActivation: 1500,
+		BranchID:          "2bb40e60",
+		ChainName:         "main",
+	}); err != nil {
+		t.Fatal("darkside Reset failed:", err)
+	}
+	info, err = lwd.GetLightdInfo(context.Background(), &walletrpc.Empty{})
+	if err != nil {
+		t.Fatal("GetLightdInfo failed:", err)
+	}
+	if info.SaplingActivationHeight != 1000 || info.OrchardActivationHeight != 1500 {
+		t.Fatal("unexpected activation heights", info.SaplingActivationHeight, info.OrchardActivationHeight)
+	}
+}
+
+func TestDarksideLightdInfoCacheRange(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+
+	info, err := lwd.GetLightdInfo(context.Background(), &walletrpc.Empty{})
+	if err != nil {
+		t.Fatal("GetLightdInfo failed:", err)
+	}
+	// No blocks yet.
+	if info.BlockHeight != 0 || info.CacheFirstHeight != 0 || info.CacheLastHeight != 0 {
+		t.Fatal("unexpected heights after Reset", info.BlockHeight, info.CacheFirstHeight, info.CacheLastHeight)
+	}
+
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 6}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1005}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+	// Wait for the ingestor to catch up.
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		info, err = lwd.GetLightdInfo(context.Background(), &walletrpc.Empty{})
+		if err != nil {
+			t.Fatal("GetLightdInfo failed:", err)
+		}
+		if info.CacheLastHeight == 1005 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("cache didn't reach 1005", info.CacheFirstHeight, info.CacheLastHeight)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if info.BlockHeight != 1005 || info.CacheFirstHeight != 1000 {
+		t.Fatal("unexpected heights", info.BlockHeight, info.CacheFirstHeight)
+	}
+
+	// Rewound, the cache still has blocks above the tip, which don't count.
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1002}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+	info, err = lwd.GetLightdInfo(context.Background(), &walletrpc.Empty{})
+	if err != nil {
+		t.Fatal("GetLightdInfo failed:", err)
+	}
+	if info.BlockHeight != 1002 || info.CacheFirstHeight != 1000 || info.CacheLastHeight != 1002 {
+		t.Fatal("unexpected heights after rewinding", info.BlockHeight, info.CacheFirstHeight, info.CacheLastHeight)
+	}
+}
+
+func TestDarksideStrictStagedHeights(t *testing.T) {
+	_, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+
+	// Blocks with different nonces (so different hashes) at the same height.
+	stageDuplicates := func() {
+		for _, nonce := range []int32{1, 2} {
+			if _, err := dlwd.StageBlocksCreate(context.Background(),
+				&walletrpc.DarksideEmptyBlocks{Height: 1000, Nonce: nonce, Count: 2}); err != nil {
+				t.Fatal("StageBlocksCreate failed:", err)
+			}
+		}
+	}
+
+	// By default, the later block replaces the earlier one.
+	stageDuplicates()
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1001}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+
+	if _, err := dlwd.Reset(context.Background(), &walletrpc.DarksideMetaState{
+		SaplingActivation:   1000,
+		BranchID:            "2bb40e60",
+		ChainName:           "main",
+		StrictStagedHeights: true,
+	}); err != nil {
+		t.Fatal("darkside Reset failed:", err)
+	}
+	stageDuplicates()
+	_, err := dlwd.ApplyStaged(context.Background(), &walletrpc.DarksideHeight{Height: 1001})
+	if err == nil || !strings.Contains(err.Error(), "more than one block staged at height 1000") {
+		t.Fatal("ApplyStaged unexpected error:", err)
+	}
+
+	// Replacing an active block (a reorg) is still allowed.
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Nonce: 1, Count: 2}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1001}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1001, Nonce: 2, Count: 1}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1001}); err != nil {
+		t.Fatal("ApplyStaged reorg failed:", err)
+	}
+}
+
+func TestDarksideSetChainTime(t *testing.T) {
+	_, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+
+	medianTime := func() int64 {
+		result, err := common.RawRequest("getblockchaininfo", []json.RawMessage{})
+		if err != nil {
+			t.Fatal("darkside getblockchaininfo failed:", err)
+		}
+		var info common.ZcashdRpcReplyGetblockchaininfo
+		if err := json.Unmarshal(result, &info); err != nil {
+			t.Fatal(err)
+		}
+		return info.MedianTime
+	}
+	if medianTime() != 0 {
+		t.Fatal("unexpected default mediantime")
+	}
+	if _, err := dlwd.SetChainTime(context.Background(),
+		&walletrpc.DarksideChainTime{Time: 1600000600, MedianTime: 1600000000}); err != nil {
+		t.Fatal("SetChainTime failed:", err)
+	}
+	if mt := medianTime(); mt != 1600000000 {
+		t.Fatal("unexpected mediantime", mt)
+	}
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 1}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1000}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+	heightJSON, _ := json.Marshal("1000")
+	result, err := common.RawRequest("getblock", []json.RawMessage{heightJSON, json.RawMessage("0")})
+	if err != nil {
+		t.Fatal("darkside getblock failed:", err)
+	}
+	var blockHex string
+	json.Unmarshal(result, &blockHex)
+	blockBytes, _ := hex.DecodeString(blockHex)
+	hdr := parser.NewBlockHeader()
+	if _, err := hdr.ParseFromSlice(blockBytes); err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Time != 1600000600 {
+		t.Fatal("unexpected block time", hdr.Time)
+	}
+}
+
+func TestDarksideSetProofOfWork(t *testing.T) {
+	_, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+
+	header := func(height int) *parser.BlockHeader {
+		heightJSON, _ := json.Marshal(strconv.Itoa(height))
+		result, err := common.RawRequest("getblock", []json.RawMessage{heightJSON, json.RawMessage("0")})
+		if err != nil {
+			t.Fatal("darkside getblock failed:", err)
+		}
+		var blockHex string
+		json.Unmarshal(result, &blockHex)
+		blockBytes, _ := hex.DecodeString(blockHex)
+		hdr := parser.NewBlockHeader()
+		if _, err := hdr.ParseFromSlice(blockBytes); err != nil {
+			t.Fatal(err)
+		}
+		return hdr
+	}
+
+	if _, err := dlwd.SetProofOfWork(context.Background(),
+		&walletrpc.DarksideProofOfWork{NBits: []byte{1, 2, 3}}); err == nil {
+		t.Fatal("SetProofOfWork should have failed on a 3-byte nBits")
+	}
+	nBits := []byte{0x1f, 0x07, 0xff, 0xff}
+	solution := bytes.Repeat([]byte{0xab}, 1344)
+	if _, err := dlwd.SetProofOfWork(context.Background(),
+		&walletrpc.DarksideProofOfWork{NBits: nBits, Solution: solution}); err != nil {
+		t.Fatal("SetProofOfWork failed:", err)
+	}
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 2}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	// Back to the defaults for the next block.
+	if _, err := dlwd.SetProofOfWork(context.Background(),
+		&walletrpc.DarksideProofOfWork{}); err != nil {
+		t.Fatal("SetProofOfWork failed:", err)
+	}
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1002, Count: 1}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1002}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+	for _, height := range []int{1000, 1001} {
+		hdr := header(height)
+		if !bytes.Equal(hdr.NBitsBytes, nBits) {
+			t.Fatal("unexpected nBits", hex.EncodeToString(hdr.NBitsBytes), "at height", height)
+		}
+		if !bytes.Equal(hdr.Solution, solution) {
+			t.Fatal("unexpected solution at height", height)
+		}
+	}
+	hdr := header(1002)
+	if !bytes.Equal(hdr.NBitsBytes, make([]byte, 4)) || !bytes.Equal(hdr.Solution, make([]byte, 1344)) {
+		t.Fatal("default proof-of-work not restored")
+	}
+
+	// Solutions of other lengths move the transaction count; staged
+	// transactions are still added after it (including when the count
+	// grows to 3 bytes).
+	for _, tt := range []struct {
+		height      int
+		solutionLen int
+		txCount     int
+	}{
+		{1003, 100, 1},
+		{1004, 2000, 260},
+	} {
+		solution := bytes.Repeat([]byte{0xcd}, tt.solutionLen)
+		if _, err := dlwd.SetProofOfWork(context.Background(),
+			&walletrpc.DarksideProofOfWork{Solution: solution}); err != nil {
+			t.Fatal("SetProofOfWork failed:", err)
+		}
+		if _, err := dlwd.StageBlocksCreate(context.Background(),
+			&walletrpc.DarksideEmptyBlocks{Height: int32(tt.height), Count: 1}); err != nil {
+			t.Fatal("StageBlocksCreate failed:", err)
+		}
+		for i := 0; i < tt.txCount; i++ {
+			if err := common.DarksideStageTransaction(common.DarksideDefaultSession,
+				tt.height, rawTxData[0]); err != nil {
+				t.Fatal("DarksideStageTransaction failed:", err)
+			}
+		}
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1004}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+	for height, want := range map[int]struct{ solutionLen, txCount int }{1003: {100, 1}, 1004: {2000, 260}} {
+		heightJSON, _ := json.Marshal(strconv.Itoa(height))
+		result, err := common.RawRequest("getblock", []json.RawMessage{heightJSON, json.RawMessage("0")})
+		if err != nil {
+			t.Fatal("darkside getblock failed:", err)
+		}
+		var blockHex string
+		json.Unmarshal(result, &blockHex)
+		blockBytes, _ := hex.DecodeString(blockHex)
+		block := parser.NewBlock()
+		rest, err := block.ParseFromSlice(blockBytes)
+		if err != nil || len(rest) != 0 {
+			t.Fatal("block at height", height, "doesn't parse:", err, len(rest))
+		}
+		if !bytes.Equal(header(height).Solution, bytes.Repeat([]byte{0xcd}, want.solutionLen)) {
+			t.Fatal("solution corrupted at height", height)
+		}
+		// (and the coinbase)
+		if len(block.Transactions()) != want.txCount+1 {
+			t.Fatal("unexpected transaction count", len(block.Transactions()), "at height", height)
+		}
+	}
+}
+
+func TestDarksideGetTransactionBlockHash(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 3}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1002}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+
+	// Find the (coinbase) transaction in block 1001.
+	heightJSON, _ := json.Marshal("1001")
+	result, err := common.RawRequest("getblock", []json.RawMessage{heightJSON, json.RawMessage("0")})
+	if err != nil {
+		t.Fatal("darkside getblock failed:", err)
+	}
+	var blockHex string
+	json.Unmarshal(result, &blockHex)
+	blockBytes, _ := hex.DecodeString(blockHex)
+	block := parser.NewBlock()
+	if _, err := block.ParseFromSlice(blockBytes); err != nil {
+		t.Fatal(err)
+	}
+	txid := block.Transactions()[0].GetEncodableHash()
+
+	rawtx, err := lwd.GetTransaction(context.Background(), &walletrpc.TxFilter{Hash: txid})
+	if err != nil {
+		t.Fatal("GetTransaction failed:", err)
+	}
+	if rawtx.Height != 1001 {
+		t.Fatal("GetTransaction unexpected height", rawtx.Height)
+	}
+	if hex.EncodeToString(rawtx.BlockHash) != darksideDisplayHash(t, 1001) {
+		t.Fatal("GetTransaction unexpected block hash", hex.EncodeToString(rawtx.BlockHash))
+	}
+}
+
+func TestDarksideGetIncomingTransactionsSince(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+	ds := dlwd.(*DarksideStreamer)
+
+	send := func(i int) {
+		if _, err := lwd.SendTransaction(context.Background(),
+			&walletrpc.RawTransaction{Data: rawTxData[i]}); err != nil {
+			t.Fatal("SendTransaction failed:", err)
+		}
+	}
+	since := func(cursor uint64, expected ...int) uint64 {
+		reply, err := ds.GetIncomingTransactionsSince(context.Background(),
+			&walletrpc.DarksideIncomingCursor{Since: cursor})
+		if err != nil {
+			t.Fatal("GetIncomingTransactionsSince failed:", err)
+		}
+		if len(reply.Transactions) != len(expected) {
+			t.Fatal("GetIncomingTransactionsSince unexpected count", len(reply.Transactions))
+		}
+		for i, e := range expected {
+			if !bytes.Equal(reply.Transactions[i].Data, rawTxData[e]) {
+				t.Fatal("GetIncomingTransactionsSince unexpected transaction", i)
+			}
+		}
+		return reply.Cursor
+	}
+
+	send(0)
+	send(1)
+	cursor := since(0, 0, 1)
+	if cursor != 2 {
+		t.Fatal("unexpected cursor", cursor)
+	}
+	send(0)
+	cursor = since(cursor, 0)
+
+	// Clearing doesn't invalidate the cursor.
+	if _, err := dlwd.ClearIncomingTransactions(context.Background(), &walletrpc.Empty{}); err != nil {
+		t.Fatal("ClearIncomingTransactions failed:", err)
+	}
+	cursor = since(cursor)
+	send(1)
+	cursor = since(cursor, 1)
+	if cursor != 4 {
+		t.Fatal("unexpected cursor", cursor)
+	}
+}
+
+func TestDarksideGetIncomingTransactionCount(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+
+	count := func(includeTxids bool) *walletrpc.DarksideIncomingCount {
+		reply, err := dlwd.GetIncomingTransactionCount(context.Background(),
+			&walletrpc.DarksideIncomingCountArg{IncludeTxids: includeTxids})
+		if err != nil {
+			t.Fatal("GetIncomingTransactionCount failed:", err)
+		}
+		return reply
+	}
+	if reply := count(true); reply.Count != 0 || len(reply.Txids) != 0 {
+		t.Fatal("unexpected incoming transactions", reply)
+	}
+	var txids [][]byte
+	for _, i := range []int{0, 1, 0} {
+		if _, err := lwd.SendTransaction(context.Background(),
+			&walletrpc.RawTransaction{Data: rawTxData[i]}); err != nil {
+			t.Fatal("SendTransaction failed:", err)
+		}
+		tx := parser.NewTransaction()
+		if _, err := tx.ParseFromSlice(rawTxData[i]); err != nil {
+			t.Fatal(err)
+		}
+		txids = append(txids, tx.GetEncodableHash())
+	}
+	if reply := count(false); reply.Count != 3 || reply.Txids != nil {
+		t.Fatal("unexpected incoming transaction count", reply.Count, len(reply.Txids))
+	}
+	reply := count(true)
+	if reply.Count != 3 || len(reply.Txids) != 3 {
+		t.Fatal("unexpected incoming transaction count", reply.Count, len(reply.Txids))
+	}
+	for i, txid := range txids {
+		if !bytes.Equal(reply.Txids[i], txid) {
+			t.Fatal("unexpected incoming txid", i)
+		}
+	}
+
+	if _, err := dlwd.ClearIncomingTransactions(context.Background(), &walletrpc.Empty{}); err != nil {
+		t.Fatal("ClearIncomingTransactions failed:", err)
+	}
+	if reply := count(false); reply.Count != 0 {
+		t.Fatal("unexpected incoming transaction count after clearing", reply.Count)
+	}
+}
+
+func TestDarksideMaxIncomingTransactions(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+	ds := dlwd.(*DarksideStreamer)
+	defer func() {
+		common.DarksideMaxIncomingTransactions = 0
+		common.DarksideEvictIncoming = false
+	}()
+	common.DarksideMaxIncomingTransactions = 2
+
+	send := func(i int) *walletrpc.SendResponse {
+		resp, err := lwd.SendTransaction(context.Background(),
+			&walletrpc.RawTransaction{Data: rawTxData[i]})
+		if err != nil {
+			t.Fatal("SendTransaction failed:", err)
+		}
+		return resp
+	}
+	incoming := func(expected ...int) uint64 {
+		reply, err := ds.GetIncomingTransactionsSince(context.Background(),
+			&walletrpc.DarksideIncomingCursor{})
+		if err != nil {
+			t.Fatal("GetIncomingTransactionsSince failed:", err)
+		}
+		if len(reply.Transactions) != len(expected) {
+			t.Fatal("unexpected incoming transaction count", len(reply.Transactions))
+		}
+		for i, e := range expected {
+			if !bytes.Equal(reply.Transactions[i].Data, rawTxData[e]) {
+				t.Fatal("unexpected incoming transaction", i)
+			}
+		}
+		return reply.Cursor
+	}
+
+	// Rejected once full.
+	send(0)
+	send(1)
+	if resp := send(0); resp.ErrorCode != -26 {
+		t.Fatal("SendTransaction beyond the limit unexpected reply", resp)
+	}
+	incoming(0, 1)
+
+	// Evicting the oldest.
+	common.DarksideEvictIncoming = true
+	if resp := send(0); resp.ErrorCode != 0 {
+		t.Fatal("SendTransaction with eviction unexpected reply", resp)
+	}
+	if cursor := incoming(1, 0); cursor != 3 {
+		t.Fatal("unexpected cursor", cursor)
+	}
+}
+
+func TestDarksideMaxBlockTransactions(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+	defer func() { common.DarksideMaxBlockTransactions = 65535 }()
+	// Above 253, where the transaction count takes three bytes.
+	common.DarksideMaxBlockTransactions = 300
+
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 3}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	stage := func(height, count int) {
+		for i := 0; i < count; i++ {
+			if err := common.DarksideStageTransaction(common.DarksideDefaultSession,
+				height, rawTxData[i%len(rawTxData)]); err != nil {
+				t.Fatal("DarksideStageTransaction failed:", err)
+			}
+		}
+	}
+	// With the coinbase, exactly the maximum.
+	stage(1001, 299)
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1002}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+	block, err := lwd.GetBlock(context.Background(), &walletrpc.BlockID{Height: 1001})
+	if err != nil {
+		t.Fatal("GetBlock failed:", err)
+	}
+	if len(block.Vtx) != 299 || block.Vtx[298].Index != 299 {
+		t.Fatal("GetBlock unexpected number of transactions", len(block.Vtx))
+	}
+
+	// One over; nothing is added to the block.
+	stage(1002, 300)
+	_, err = dlwd.ApplyStaged(context.Background(), &walletrpc.DarksideHeight{Height: 1002})
+	if err == nil || !strings.Contains(err.Error(), "height 1002") {
+		t.Fatal("ApplyStaged unexpected error", err)
+	}
+	result, err := common.RawRequest("getblock", []json.RawMessage{[]byte(`"1002"`), []byte("0")})
+	if err != nil {
+		t.Fatal("darkside getblock failed:", err)
+	}
+	var blockHex string
+	json.Unmarshal(result, &blockHex)
+	blockBytes, _ := hex.DecodeString(blockHex)
+	parsed := parser.NewBlock()
+	if _, err := parsed.ParseFromSlice(blockBytes); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.GetTxCount() != 1 {
+		t.Fatal("ApplyStaged added transactions despite the error", parsed.GetTxCount())
+	}
+}
+
+func TestDarksideSessions(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+	savedMax := common.DarksideMaxSessions
+	defer func() { common.DarksideMaxSessions = savedMax }()
+	common.DarksideMaxSessions = 2
+
+	sessionContext := func(session string) context.Context {
+		return metadata.NewIncomingContext(context.Background(),
+			metadata.Pairs(DarksideSessionHeader, session))
+	}
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Nonce: 0, Count: 3}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1002}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+
+	// Wait for the ingestor to reach the default session's tip.
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		blockID, err := lwd.GetLatestBlock(context.Background(), &walletrpc.ChainSpec{})
+		if err == nil && blockID.Height == 1002 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("ingestor didn't reach height 1002")
+		}
+	}
+	want, err := lwd.GetBlock(context.Background(), &walletrpc.BlockID{Height: 1001})
+	if err != nil {
+		t.Fatal("GetBlock failed:", err)
+	}
+
+	// Each session stages and applies blocks at its own heights; with shared
+	// state, one session's Reset would make the other's heights invalid.
+	// Meanwhile the wallet API, even when a request names a session, keeps
+	// serving the default session's chain.
+	done := make(chan struct{})
+	var walletWg sync.WaitGroup
+	for _, session := range []string{"", "a"} {
+		walletWg.Add(1)
+		go func(session string) {
+			defer walletWg.Done()
+			ctx := context.Background()
+			if session != "" {
+				ctx = sessionContext(session)
+			}
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				blockID, err := lwd.GetLatestBlock(ctx, &walletrpc.ChainSpec{})
+				if err != nil {
+					t.Error("GetLatestBlock failed:", err)
+					return
+				}
+				if blockID.Height != 1002 {
+					t.Error("GetLatestBlock height", blockID.Height, "expected 1002")
+					return
+				}
+				block, err := lwd.GetBlock(ctx, &walletrpc.BlockID{Height: 1001})
+				if err != nil {
+					t.Error("GetBlock failed:", err)
+					return
+				}
+				if !bytes.Equal(block.Hash, want.Hash) {
+					t.Error("GetBlock hash changed during named session activity")
+					return
+				}
+			}
+		}(session)
+	}
+	var wg sync.WaitGroup
+	for i, session := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(session string, start int32) {
+			defer wg.Done()
+			ctx := sessionContext(session)
+			for j := 0; j < 20; j++ {
+				if _, err := dlwd.Reset(ctx, &walletrpc.DarksideMetaState{
+					SaplingActivation: start,
+					BranchID:          "2bb40e60",
+					ChainName:         "main",
+				}); err != nil {
+					t.Error("session", session, "Reset failed:", err)
+					return
+				}
+				if _, err := dlwd.StageBlocksCreate(ctx,
+					&walletrpc.DarksideEmptyBlocks{Height: start, Nonce: int32(j), Count: 5}); err != nil {
+					t.Error("session", session, "StageBlocksCreate failed:", err)
+					return
+				}
+				if _, err := dlwd.StageBlocksCreate(ctx,
+					&walletrpc.DarksideEmptyBlocks{Height: start - 1, Nonce: 0, Count: 1}); err == nil {
+					t.Error("session", session, "StageBlocksCreate below its activation height succeeded")
+					return
+				}
+				if _, err := dlwd.ApplyStaged(ctx,
+					&walletrpc.DarksideHeight{Height: start + 4}); err != nil {
+					t.Error("session", session, "ApplyStaged failed:", err)
+					return
+				}
+			}
+		}(session, int32(2000+1000*i))
+	}
+	wg.Wait()
+	close(done)
+	walletWg.Wait()
+
+	// The default session, which the mock zcashd presents, is undisturbed.
+	result, err := common.RawRequest("getblockchaininfo", []json.RawMessage{})
+	if err != nil {
+		t.Fatal("getblockchaininfo failed:", err)
+	}
+	var info common.ZcashdRpcReplyGetblockchaininfo
+	if err := json.Unmarshal(result, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Blocks != 1002 {
+		t.Fatal("default session latest height", info.Blocks, "expected 1002")
+	}
+
+	// Both named slots are taken.
+	reset := func(session string) error {
+		_, err := dlwd.Reset(sessionContext(session), &walletrpc.DarksideMetaState{
+			SaplingActivation: 1000,
+			BranchID:          "2bb40e60",
+			ChainName:         "main",
+		})
+		return err
+	}
+	if err := reset("c"); err == nil || !strings.Contains(err.Error(), "too many darkside sessions") {
+		t.Fatal("Reset of a third session unexpected error:", err)
+	}
+	if _, err := dlwd.EndSession(sessionContext("a"), &walletrpc.Empty{}); err != nil {
+		t.Fatal("EndSession failed:", err)
+	}
+	if err := reset("c"); err != nil {
+		t.Fatal("Reset after EndSession failed:", err)
+	}
+	if _, err := dlwd.EndSession(context.Background(), &walletrpc.Empty{}); err == nil {
+		t.Fatal("EndSession of the default session succeeded")
+	}
+	for _, session := range []string{"b", "c"} {
+		if _, err := dlwd.EndSession(sessionContext(session), &walletrpc.Empty{}); err != nil {
+			t.Fatal("EndSession failed:", err)
+		}
+	}
+}
+
+func TestDarksideGetBlockRangeMinTransactions(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 4}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	// Block 1001 gets one shielded transaction, 1002 gets two.
+	for i, height := range []int{1001, 1002} {
+		if err := common.DarksideStageTransaction(common.DarksideDefaultSession,
+			height, rawTxData[i]); err != nil {
+			t.Fatal("DarksideStageTransaction failed:", err)
+		}
+	}
+	if err := common.DarksideStageTransaction(common.DarksideDefaultSession,
+		1002, rawTxData[0]); err != nil {
+		t.Fatal("DarksideStageTransaction failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1003}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+
+	for _, tt := range []struct {
+		minTransactions uint32
+		full            []bool // by height, from 1000
+	}{
+		{0, []bool{true, true, true, true}},
+		{1, []bool{false, true, true, false}},
+		{2, []bool{false, false, true, false}},
+		{3, []bool{false, false, false, false}},
+	} {
+		blockrange := &walletrpc.BlockRange{
+			Start:           &walletrpc.BlockID{Height: 1000},
+			End:             &walletrpc.BlockID{Height: 1003},
+			MinTransactions: tt.minTransactions,
+		}
+		resp := &testgetbrangeRecord{}
+		if err := lwd.GetBlockRange(blockrange, resp); err != nil {
+			t.Fatal("GetBlockRange failed:", err)
+		}
+		// Every height is present, either in full or as a marker.
+		if len(resp.blocks) != 4 {
+			t.Fatal("GetBlockRange unexpected number of blocks", len(resp.blocks))
+		}
+		for i, block := range resp.blocks {
+			if block.Height != uint64(1000+i) || len(block.Hash) != 32 {
+				t.Fatal("GetBlockRange unexpected block", block.Height)
+			}
+			if block.Filtered == tt.full[i] {
+				t.Fatal("minTransactions", tt.minTransactions, "height", block.Height,
+					"unexpected filtered", block.Filtered)
+			}
+			if block.Filtered && len(block.Vtx) != 0 {
+				t.Fatal("filtered block has transactions")
+			}
+		}
+	}
+}
+
+// darksideOrchardTx returns a (syntactically valid, but otherwise
+// meaningless) v5 transaction with the given number of Orchard actions and
+// nothing else; action i's nullifier is 32 bytes of i+1.
+func darksideOrchardTx(nActions int) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(5|1<<31)) // header
+	binary.Write(&b, binary.LittleEndian, uint32(0x26A7270A))
+	binary.Write(&b, binary.LittleEndian, uint32(0xc2d6d0b4)) // NU5
+	binary.Write(&b, binary.LittleEndian, uint32(0))          // nLockTime
+	binary.Write(&b, binary.LittleEndian, uint32(0))          // nExpiryHeight
+	b.Write([]byte{0, 0})                                     // transparent
+	b.Write([]byte{0, 0})                                     // Sapling
+	b.WriteByte(byte(nActions))
+	for i := 0; i < nActions; i++ {
+		b.Write(bytes.Repeat([]byte{0xee}, 32)) // cv
+		b.Write(bytes.Repeat([]byte{byte(i + 1)}, 32))
+		b.Write(bytes.Repeat([]byte{0xee}, 32*3+580+80)) // rk, cmx, epk, ciphertexts
+	}
+	b.WriteByte(3)                                      // flagsOrchard
+	binary.Write(&b, binary.LittleEndian, int64(-5000)) // valueBalanceOrchard
+	b.Write(bytes.Repeat([]byte{0xaa}, 32))             // anchorOrchard
+	b.Write([]byte{0xfd, 0x00, 0x01})                   // sizeProofsOrchard
+	b.Write(bytes.Repeat([]byte{0xbb}, 256))
+	b.Write(bytes.Repeat([]byte{0xcc}, 64*nActions)) // vSpendAuthSigsOrchard
+	b.Write(bytes.Repeat([]byte{0xdd}, 64))          // bindingSigOrchard
+	return b.Bytes()
+}
+
+func TestDarksideGetBlockRangeSpendsOnly(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 4}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	// Block 1001 gets a Sapling spender, 1002 an Orchard one and another
+	// Sapling one.
+	for _, staged := range []struct {
+		height int
+		tx     []byte
+	}{
+		{1001, rawTxData[0]},
+		{1002, darksideOrchardTx(2)},
+		{1002, rawTxData[1]},
+	} {
+		if err := common.DarksideStageTransaction(common.DarksideDefaultSession,
+			staged.height, staged.tx); err != nil {
+			t.Fatal("DarksideStageTransaction failed:", err)
+		}
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1003}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+
+	blockrange := &walletrpc.BlockRange{
+		Start:      &walletrpc.BlockID{Height: 1000},
+		End:        &walletrpc.BlockID{Height: 1003},
+		SpendsOnly: true,
+	}
+	resp := &testgetbrangeRecord{}
+	if err := lwd.GetBlockRange(blockrange, resp); err != nil {
+		t.Fatal("GetBlockRange failed:", err)
+	}
+	if len(resp.blocks) != 4 {
+		t.Fatal("GetBlockRange unexpected number of blocks", len(resp.blocks))
+	}
+	// The number of transactions, and of Sapling spends and Orchard
+	// actions in each, by height from 1000.
+	type txCounts struct{ index, spends, actions int }
+	expected := [][]txCounts{
+		nil,
+		{{1, 3, 0}},
+		{{1, 0, 2}, {2, 3, 0}},
+		nil,
+	}
+	for i, block := range resp.blocks {
+		if block.Height != uint64(1000+i) || len(block.Hash) != 32 || len(block.PrevHash) != 32 {
+			t.Fatal("GetBlockRange unexpected block", block.Height)
+		}
+		if len(block.Vtx) != len(expected[i]) {
+			t.Fatal("height", block.Height, "unexpected number of transactions", len(block.Vtx))
+		}
+		for j, tx := range block.Vtx {
+			want := expected[i][j]
+			if tx.Index != uint64(want.index) || len(tx.Hash) != 32 ||
+				len(tx.Spends) != want.spends || len(tx.Actions) != want.actions {
+				t.Fatal("height", block.Height, "unexpected transaction", tx)
+			}
+			if len(tx.Outputs) != 0 || tx.Fee != 0 || len(tx.Vout) != 0 {
+				t.Fatal("height", block.Height, "transaction has more than its spends", tx)
+			}
+			for _, spend := range tx.Spends {
+				if len(spend.Nf) != 32 {
+					t.Fatal("unexpected Sapling spend", spend)
+				}
+			}
+			for k, action := range tx.Actions {
+				if !bytes.Equal(action.Nullifier, bytes.Repeat([]byte{byte(k + 1)}, 32)) ||
+					action.Cmx != nil || action.EphemeralKey != nil || action.Ciphertext != nil {
+					t.Fatal("unexpected Orchard action", action)
+				}
+			}
+		}
+	}
+
+	// The blocks in the cache still have their outputs and actions.
+	block, err := lwd.GetBlock(context.Background(), &walletrpc.BlockID{Height: 1002})
+	if err != nil {
+		t.Fatal("GetBlock failed:", err)
+	}
+	if len(block.Vtx) != 2 || block.Vtx[0].Actions[0].Cmx == nil {
+		t.Fatal("GetBlockRange modified the cached block")
+	}
+
+	// minTransactions counts the spending transactions.
+	blockrange.MinTransactions = 2
+	resp = &testgetbrangeRecord{}
+	if err := lwd.GetBlockRange(blockrange, resp); err != nil {
+		t.Fatal("GetBlockRange failed:", err)
+	}
+	for i, block := range resp.blocks {
+		if block.Filtered != (i != 2) {
+			t.Fatal("height", block.Height, "unexpected filtered", block.Filtered)
+		}
+	}
+
+	blockrange.MetadataOnly = true
+	if err := lwd.GetBlockRange(blockrange, &testgetbrangeRecord{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatal("GetBlockRange metadataOnly and spendsOnly unexpected error", err)
+	}
+}
+
+func TestDarksideGetBlockNullifiersOrchard(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 3}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	// Block 1001 gets an Orchard spender and a Sapling one.
+	for _, tx := range [][]byte{darksideOrchardTx(2), rawTxData[1]} {
+		if err := common.DarksideStageTransaction(common.DarksideDefaultSession,
+			1001, tx); err != nil {
+			t.Fatal("DarksideStageTransaction failed:", err)
+		}
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1002}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+
+	resp := &testgetnullifiers{}
+	if err := lwd.GetBlockNullifiers(&walletrpc.BlockRange{
+		Start: &walletrpc.BlockID{Height: 1000},
+		End:   &walletrpc.BlockID{Height: 1002},
+	}, resp); err != nil {
+		t.Fatal("GetBlockNullifiers failed:", err)
+	}
+	if len(resp.blocks) != 3 {
+		t.Fatal("GetBlockNullifiers unexpected number of blocks", len(resp.blocks))
+	}
+	for i, bn := range resp.blocks {
+		if bn.Height != uint64(1000+i) {
+			t.Fatal("GetBlockNullifiers unexpected block", bn.Height)
+		}
+		if i != 1 {
+			if len(bn.SaplingNullifiers) != 0 || len(bn.OrchardNullifiers) != 0 {
+				t.Fatal("height", bn.Height, "unexpected nullifiers")
+			}
+			continue
+		}
+		if len(bn.SaplingNullifiers) != 3 {
+			t.Fatal("unexpected number of Sapling nullifiers", len(bn.SaplingNullifiers))
+		}
+		if len(bn.OrchardNullifiers) != 2 {
+			t.Fatal("unexpected number of Orchard nullifiers", len(bn.OrchardNullifiers))
+		}
+		for k, nf := range bn.OrchardNullifiers {
+			if !bytes.Equal(nf, bytes.Repeat([]byte{byte(k + 1)}, 32)) {
+				t.Fatal("unexpected Orchard nullifier", nf)
+			}
+		}
+	}
+}
+
+func TestDarksideGetBlockHash(t *testing.T) {
+	_, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+	ds := dlwd.(*DarksideStreamer)
+
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 3}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	staged, err := ds.GetBlockHash(context.Background(),
+		&walletrpc.DarksideBlockSelector{Staged: true, Index: 0})
+	if err != nil {
+		t.Fatal("GetBlockHash of a staged block failed:", err)
+	}
+	if staged.Height != 1000 {
+		t.Fatal("GetBlockHash unexpected staged height", staged.Height)
+	}
+	if _, err := ds.GetBlockHash(context.Background(),
+		&walletrpc.DarksideBlockSelector{Staged: true, Index: 3}); err == nil {
+		t.Fatal("GetBlockHash of a nonexistent staged block succeeded")
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1002}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+
+	for height := 1000; height <= 1002; height++ {
+		active, err := ds.GetBlockHash(context.Background(),
+			&walletrpc.DarksideBlockSelector{Height: int32(height)})
+		if err != nil {
+			t.Fatal("GetBlockHash failed:", err)
+		}
+		// The hash is the double SHA-256 of the (1487-byte) header,
+		// displayed in reverse byte order.
+		heightJSON, _ := json.Marshal(strconv.Itoa(height))
+		result, err := common.RawRequest("getblock", []json.RawMessage{heightJSON, json.RawMessage("0")})
+		if err != nil {
+			t.Fatal("darkside getblock failed:", err)
+		}
+		var blockHex string
+		json.Unmarshal(result, &blockHex)
+		blockBytes, _ := hex.DecodeString(blockHex)
+		digest := sha256.Sum256(blockBytes[:1487])
+		digest = sha256.Sum256(digest[:])
+		if active.Height != int32(height) || active.Hash != hex.EncodeToString(parser.Reverse(digest[:])) {
+			t.Fatal("GetBlockHash unexpected reply", active)
+		}
+		// The first block's prevhash isn't changed by ApplyStaged.
+		if height == 1000 && active.Hash != staged.Hash {
+			t.Fatal("active and staged hashes of block 1000 differ")
+		}
+	}
+	if _, err := ds.GetBlockHash(context.Background(),
+		&walletrpc.DarksideBlockSelector{Height: 1003}); err == nil {
+		t.Fatal("GetBlockHash of a nonexistent active block succeeded")
+	}
+}
+
+func TestDarksideConcurrentApplyStaged(t *testing.T) {
+	_, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+
+	// Concurrent stage and apply sequences on the same session; run with
+	// -race. Each ApplyStaged applies whatever has been staged so far.
+	stageAndApply := func(nonce int32) error {
+		if _, err := dlwd.StageBlocksCreate(context.Background(),
+			&walletrpc.DarksideEmptyBlocks{Height: 1000, Nonce: nonce, Count: 5}); err != nil {
+			return err
+		}
+		if err := common.DarksideStageTransaction(common.DarksideDefaultSession,
+			1002, rawTxData[0]); err != nil {
+			return err
+		}
+		_, err := dlwd.ApplyStaged(context.Background(), &walletrpc.DarksideHeight{Height: 1004})
+		return err
+	}
+	checkActive := func() {
+		var prevHash []byte
+		for height := 1000; height <= 1004; height++ {
+			heightJSON, _ := json.Marshal(strconv.Itoa(height))
+			result, err := common.RawRequest("getblock", []json.RawMessage{heightJSON, json.RawMessage("0")})
+			if err != nil {
+				t.Fatal("darkside getblock failed:", err)
+			}
+			var blockHex string
+			json.Unmarshal(result, &blockHex)
+			blockBytes, _ := hex.DecodeString(blockHex)
+			block := parser.NewBlock()
+			rest, err := block.ParseFromSlice(blockBytes)
+			if err != nil || len(rest) != 0 {
+				t.Fatal("active block at height", height, "doesn't parse:", err)
+			}
+			if block.GetHeight() != height {
+				t.Fatal("active block at height", height, "has height", block.GetHeight())
+			}
+			if prevHash != nil && !bytes.Equal(block.GetPrevHash(), prevHash) {
+				t.Fatal("active block at height", height, "doesn't link to its parent")
+			}
+			prevHash = block.GetEncodableHash()
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(nonce int32) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if err := stageAndApply(nonce); err != nil {
+					t.Error("stage and apply failed:", err)
+					return
+				}
+			}
+		}(int32(i))
+	}
+	wg.Wait()
+	checkActive()
+
+	// In reject mode, an ApplyStaged that overlaps another fails with
+	// Aborted (and leaves its staged blocks for a later apply).
+	common.DarksideRejectConcurrentApply = true
+	defer func() { common.DarksideRejectConcurrentApply = false }()
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(nonce int32) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				err := stageAndApply(nonce)
+				if err != nil && status.Code(err) != codes.Aborted {
+					t.Error("stage and apply unexpected error:", err)
+					return
+				}
+			}
+		}(int32(i))
+	}
+	wg.Wait()
+	if _, err := dlwd.ApplyStaged(context.Background(), &walletrpc.DarksideHeight{Height: 1004}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+	checkActive()
+}
+
+func TestDarksideSetBranchIDs(t *testing.T) {
+	_, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+	ds := dlwd.(*DarksideStreamer)
+
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 4}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if err := common.DarksideStageTransaction(common.DarksideDefaultSession,
+		1003, rawTxData[0]); err != nil {
+		t.Fatal("DarksideStageTransaction failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1003}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+	// Staged but not applied, so not mined.
+	if err := common.DarksideStageTransaction(common.DarksideDefaultSession,
+		1004, rawTxData[1]); err != nil {
+		t.Fatal("DarksideStageTransaction failed:", err)
+	}
+	// Block 1001's coinbase transaction.
+	heightJSON, _ := json.Marshal("1001")
+	result, err := common.RawRequest("getblock", []json.RawMessage{heightJSON, json.RawMessage("0")})
+	if err != nil {
+		t.Fatal("darkside getblock failed:", err)
+	}
+	var blockHex string
+	json.Unmarshal(result, &blockHex)
+	blockBytes, _ := hex.DecodeString(blockHex)
+	block := parser.NewBlock()
+	if _, err := block.ParseFromSlice(blockBytes); err != nil {
+		t.Fatal(err)
+	}
+	coinbase := block.Transactions()[0].Bytes()
+
+	for _, bad := range [][]*walletrpc.DarksideBranchID{
+		{{Height: 1002, BranchID: "f5b9230"}},
+		{{Height: 1002, BranchID: "f5b9230b"}, {Height: 1002, BranchID: "c2d6d0b4"}},
+	} {
+		if _, err := ds.SetBranchIDs(context.Background(),
+			&walletrpc.DarksideBranchIDs{BranchIDs: bad}); err == nil {
+			t.Fatal("SetBranchIDs succeeded with", bad)
+		}
+	}
+	// Out of order; they're sorted by height.
+	if _, err := ds.SetBranchIDs(context.Background(), &walletrpc.DarksideBranchIDs{
+		BranchIDs: []*walletrpc.DarksideBranchID{
+			{Height: 1004, BranchID: "c2d6d0b4"},
+			{Height: 1002, BranchID: "f5b9230b"},
+		}}); err != nil {
+		t.Fatal("SetBranchIDs failed:", err)
+	}
+
+	result, err = common.RawRequest("getblockchaininfo", []json.RawMessage{})
+	if err != nil {
+		t.Fatal("getblockchaininfo failed:", err)
+	}
+	var info common.ZcashdRpcReplyGetblockchaininfo
+	if err := json.Unmarshal(result, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Consensus.Chaintip != "f5b9230b" || info.Consensus.Nextblock != "c2d6d0b4" {
+		t.Fatal("getblockchaininfo unexpected consensus", info.Consensus)
+	}
+
+	// Each transaction has the branch ID of its block's height.
+	for i, tt := range []struct {
+		txBytes []byte
+		want    string
+	}{
+		{coinbase, "2bb40e60"},     // at 1001
+		{rawTxData[0], "f5b9230b"}, // at 1003
+		{rawTxData[1], "c2d6d0b4"}, // the next block's
+	} {
+		tx := parser.NewTransaction()
+		if _, err := tx.ParseFromSlice(tt.txBytes); err != nil {
+			t.Fatal(err)
+		}
+		txidJSON, _ := json.Marshal(hex.EncodeToString(tx.GetDisplayHash()))
+		result, err := common.RawRequest("getrawtransaction", []json.RawMessage{txidJSON, json.RawMessage("1")})
+		if err != nil {
+			t.Fatal("getrawtransaction failed:", err)
+		}
+		var reply struct {
+			ConsensusBranchID string `json:"consensusbranchid"`
+		}
+		if err := json.Unmarshal(result, &reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply.ConsensusBranchID != tt.want {
+			t.Fatal("transaction", i, "unexpected branch ID", reply.ConsensusBranchID, "want", tt.want)
+		}
+	}
+
+	// Reset clears the ranges.
+	if _, err := dlwd.Reset(context.Background(), &walletrpc.DarksideMetaState{
+		SaplingActivation: 1000,
+		BranchID:          "2bb40e60",
+		ChainName:         "main",
+	}); err != nil {
+		t.Fatal("Reset failed:", err)
+	}
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 4}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1003}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+	result, err = common.RawRequest("getblockchaininfo", []json.RawMessage{})
+	if err != nil {
+		t.Fatal("getblockchaininfo failed:", err)
+	}
+	if err := json.Unmarshal(result, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Consensus.Chaintip != "2bb40e60" || info.Consensus.Nextblock != "2bb40e60" {
+		t.Fatal("getblockchaininfo unexpected consensus after Reset", info.Consensus)
+	}
+}
+
+// testCommitmentTree returns a serialized note commitment tree of the given
+// size whose rightmost leaves are the last of the given ones (the other
+// nodes are filler).
+func testCommitmentTree(size uint64, leaves [][]byte) string {
+	filler := bytes.Repeat([]byte{0xee}, 32)
+	node := func(n []byte) []byte { return append([]byte{1}, n...) }
+	var tree []byte
+	rest := size
+	switch {
+	case size == 0:
+		tree = []byte{0, 0}
+	case size%2 == 1:
+		tree = append(node(leaves[len(leaves)-1]), 0)
+		rest--
+	default:
+		tree = append(node(leaves[len(leaves)-2]), node(leaves[len(leaves)-1])...)
+		rest -= 2
+	}
+	var parents []byte
+	count := 0
+	for rest >>= 1; rest > 0; rest >>= 1 {
+		if rest&1 == 1 {
+			parents = append(parents, node(filler)...)
+		} else {
+			parents = append(parents, 0)
+		}
+		count++
+	}
+	tree = append(tree, byte(count))
+	return hex.EncodeToString(append(tree, parents...))
+}
+
+func TestDarksideCheckBlockTreeState(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+	ds := dlwd.(*DarksideStreamer)
+
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 4}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	// Block 1001 gets two shielded transactions.
+	for i := range rawTxData {
+		if err := common.DarksideStageTransaction(common.DarksideDefaultSession,
+			1001, rawTxData[i]); err != nil {
+			t.Fatal("DarksideStageTransaction failed:", err)
+		}
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1003}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+	block, err := lwd.GetBlock(context.Background(), &walletrpc.BlockID{Height: 1001})
+	if err != nil {
+		t.Fatal("GetBlock failed:", err)
+	}
+	var cmus [][]byte
+	for _, tx := range block.Vtx {
+		for _, output := range tx.Outputs {
+			cmus = append(cmus, output.Cmu)
+		}
+	}
+	if len(cmus) == 0 {
+		t.Fatal("block 1001 has no outputs")
+	}
+
+	// The tree had 5 leaves before block 1001.
+	prevLeaves := [][]byte{bytes.Repeat([]byte{0xaa}, 32)}
+	addTreeStates := func(height int, size uint64, leaves [][]byte) {
+		if _, err := ds.AddTreeState(context.Background(), &walletrpc.TreeState{
+			Height: uint64(height),
+			Hash:   darksideDisplayHash(t, height),
+			Tree:   testCommitmentTree(size, leaves),
+		}); err != nil {
+			t.Fatal("AddTreeState failed:", err)
+		}
+	}
+	addTreeStates(1000, 5, prevLeaves)
+	leaves := append(prevLeaves, cmus...)
+	addTreeStates(1001, uint64(5+len(cmus)), leaves)
+	if _, err := lwd.CheckBlockTreeState(context.Background(),
+		&walletrpc.BlockID{Height: 1001}); err != nil {
+		t.Fatal("CheckBlockTreeState failed:", err)
+	}
+
+	// The tree missed an output.
+	addTreeStates(1001, uint64(5+len(cmus)-1), leaves)
+	if _, err := lwd.CheckBlockTreeState(context.Background(),
+		&walletrpc.BlockID{Height: 1001}); status.Code(err) != codes.DataLoss {
+		t.Fatal("CheckBlockTreeState wrong size unexpected error", err)
+	}
+
+	// The tree ends with a different commitment.
+	addTreeStates(1001, uint64(5+len(cmus)),
+		append(leaves[:len(leaves)-1:len(leaves)-1], bytes.Repeat([]byte{0xbb}, 32)))
+	if _, err := lwd.CheckBlockTreeState(context.Background(),
+		&walletrpc.BlockID{Height: 1001}); status.Code(err) != codes.DataLoss {
+		t.Fatal("CheckBlockTreeState wrong leaf unexpected error", err)
+	}
+
+	// The tree state at 1000 belongs to another block.
+	addTreeStates(1001, uint64(5+len(cmus)), leaves)
+	if _, err := ds.AddTreeState(context.Background(), &walletrpc.TreeState{
+		Height: 1000,
+		Hash:   darksideDisplayHash(t, 1002),
+		Tree:   testCommitmentTree(5, prevLeaves),
+	}); err != nil {
+		t.Fatal("AddTreeState failed:", err)
+	}
+	if _, err := lwd.CheckBlockTreeState(context.Background(),
+		&walletrpc.BlockID{Height: 1001}); status.Code(err) != codes.DataLoss {
+		t.Fatal("CheckBlockTreeState wrong block unexpected error", err)
+	}
+
+	// Without tree states, zcashd's error is passed on.
+	if _, err := ds.ClearAllTreeStates(context.Background(), &walletrpc.Empty{}); err != nil {
+		t.Fatal("ClearAllTreeStates failed:", err)
+	}
+	if _, err := lwd.CheckBlockTreeState(context.Background(),
+		&walletrpc.BlockID{Height: 1001}); err == nil || status.Code(err) == codes.DataLoss {
+		t.Fatal("CheckBlockTreeState without tree states unexpected error", err)
+	}
+}
+
+func TestDarksideGetTreeStateSkipHash(t *testing.T) {
+	lwd, dlwd, cleanup := darksideSetup(t, 1000)
+	defer cleanup()
+
+	if _, err := dlwd.StageBlocksCreate(context.Background(),
+		&walletrpc.DarksideEmptyBlocks{Height: 1000, Count: 6}); err != nil {
+		t.Fatal("StageBlocksCreate failed:", err)
+	}
+	if _, err := dlwd.ApplyStaged(context.Background(),
+		&walletrpc.DarksideHeight{Height: 1005}); err != nil {
+		t.Fatal("ApplyStaged failed:", err)
+	}
+	tree := testCommitmentTree(1, [][]byte{bytes.Repeat([]byte{0xaa}, 32)})
+	addTreeState := func(height int, tree, skipHash string) {
+		if err := common.DarksideAddTreeState(common.DarksideDefaultSession, common.DarksideTreeState{
+			Height:   height,
+			Hash:     darksideDisplayHash(t, height),
+			Tree:     tree,
+			SkipHash: skipHash,
+		}); err != nil {
+			t.Fatal("DarksideAddTreeState failed:", err)
+		}
+	}
+	// Each of blocks 1001..1004 skips to the one before.
+	addTreeState(1000, tree, "")
+	for height := 1001; height <= 1004; height++ {
+		addTreeState(height, "", darksideDisplayHash(t, height-1))
+	}
+	treeState, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 1004})
+	if err != nil {
+		t.Fatal("GetTreeState failed:", err)
+	}
+	// The tree is 1000's, but the block is the one requested.
+	if treeState.Tree != tree || treeState.Height != 1004 || treeState.Hash != darksideDisplayHash(t, 1004) {
+		t.Fatal("GetTreeState unexpected tree state", treeState)
+	}
+
+	// A skip hash loop (1003 and 1002 skip to each other) ends.
+	addTreeState(1002, "", darksideDisplayHash(t, 1003))
+	_, err = lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 1003})
+	if status.Code(err) != codes.Internal || !strings.Contains(err.Error(), "within 100 hops") {
+		t.Fatal("GetTreeState skip hash loop unexpected error", err)
+	}
+
+	// So does a request whose client has gone away.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := lwd.GetTreeState(ctx, &walletrpc.BlockID{Height: 1003}); err != context.Canceled {
+		t.Fatal("GetTreeState canceled unexpected error", err)
+	}
+}
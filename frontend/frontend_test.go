@@ -7,17 +7,31 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/adityapk00/lightwalletd/common"
+	"github.com/adityapk00/lightwalletd/parser"
 	"github.com/adityapk00/lightwalletd/walletrpc"
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 var (
@@ -55,6 +69,7 @@ func TestMain(m *testing.M) {
 	common.Log = logger.WithFields(logrus.Fields{
 		"app": "test",
 	})
+	common.Metrics = common.GetPrometheusMetrics()
 
 	// Several tests need test blocks; read all 4 into memory just once
 	// (for efficiency).
@@ -124,18 +139,366 @@ func TestGetTransaction(t *testing.T) {
 
 	rawtx, err = lwd.GetTransaction(context.Background(),
 		&walletrpc.TxFilter{Block: &walletrpc.BlockID{Hash: []byte{}}})
-	if err == nil {
-		testT.Fatal("GetTransaction unexpectedly succeeded")
-	}
-	if err.Error() != "Can't GetTransaction with a blockhash+num. Please call GetTransaction with txid" {
-		testT.Fatal("GetTransaction unexpected error message")
+	if status.Code(err) != codes.InvalidArgument {
+		testT.Fatal("GetTransaction unexpected error", err)
 	}
 	if rawtx != nil {
 		testT.Fatal("GetTransaction non-nil rawtx returned")
 	}
 }
 
+func TestGetTransactionStatusOnly(t *testing.T) {
+	testT = t
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method != "getrawtransaction" {
+			testT.Fatal("unexpected method", method)
+		}
+		return json.Marshal(common.ZcashdRpcReplyGetrawtransaction{
+			Hex:           hex.EncodeToString(rawTxData[0]),
+			Height:        1234567,
+			Confirmations: 12,
+			Blockhash:     strings.Repeat("ab", 32),
+		})
+	}
+	lwd, _ := testsetup()
+
+	for _, statusOnly := range []bool{false, true} {
+		rawtx, err := lwd.GetTransaction(context.Background(),
+			&walletrpc.TxFilter{Hash: make([]byte, 32), StatusOnly: statusOnly})
+		if err != nil {
+			t.Fatal("GetTransaction failed:", err)
+		}
+		if statusOnly && rawtx.Data != nil {
+			t.Fatal("GetTransaction returned data with statusOnly")
+		}
+		if !statusOnly && !bytes.Equal(rawtx.Data, rawTxData[0]) {
+			t.Fatal("GetTransaction unexpected data")
+		}
+		if rawtx.Height != 1234567 || rawtx.Confirmations != 12 ||
+			hex.EncodeToString(rawtx.BlockHash) != strings.Repeat("ab", 32) {
+			t.Fatal("GetTransaction unexpected status", rawtx.Height, rawtx.Confirmations, rawtx.BlockHash)
+		}
+	}
+}
+
+func TestGetTransactionByBlockIndex(t *testing.T) {
+	testT = t
+	blockHash := strings.Repeat("cd", 32)
+	txids := []string{strings.Repeat("01", 32), strings.Repeat("02", 32)}
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		var arg string
+		json.Unmarshal(params[0], &arg)
+		switch method {
+		case "getblock":
+			if arg != blockHash {
+				return nil, errors.New("-5: Block not found")
+			}
+			if string(params[1]) != "1" {
+				testT.Fatal("unexpected getblock verbosity", string(params[1]))
+			}
+			return json.Marshal(common.ZcashdRpcReplyGetblock{
+				Hash:   blockHash,
+				Height: 1234567,
+				Tx:     txids,
+			})
+		case "getrawtransaction":
+			if arg != txids[1] {
+				testT.Fatal("unexpected txid", arg)
+			}
+			return json.Marshal(common.ZcashdRpcReplyGetrawtransaction{
+				Hex:           hex.EncodeToString(rawTxData[0]),
+				Height:        1234567,
+				Confirmations: 3,
+				Blockhash:     blockHash,
+			})
+		}
+		testT.Fatal("unexpected method", method)
+		return nil, nil
+	}
+	lwd, _ := testsetup()
+
+	hash, _ := parser.DisplayHexToInternal(blockHash)
+	rawtx, err := lwd.GetTransaction(context.Background(),
+		&walletrpc.TxFilter{Block: &walletrpc.BlockID{Hash: hash}, Index: 1})
+	if err != nil {
+		t.Fatal("GetTransaction failed:", err)
+	}
+	if !bytes.Equal(rawtx.Data, rawTxData[0]) || rawtx.Height != 1234567 ||
+		hex.EncodeToString(rawtx.BlockHash) != blockHash {
+		t.Fatal("GetTransaction unexpected reply", rawtx.Height, rawtx.BlockHash)
+	}
+
+	_, err = lwd.GetTransaction(context.Background(),
+		&walletrpc.TxFilter{Block: &walletrpc.BlockID{Hash: hash}, Index: 2})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatal("GetTransaction index out of range, unexpected error", err)
+	}
+	_, err = lwd.GetTransaction(context.Background(),
+		&walletrpc.TxFilter{Block: &walletrpc.BlockID{Hash: make([]byte, 32)}})
+	if status.Code(err) != codes.NotFound {
+		t.Fatal("GetTransaction unknown block, unexpected error", err)
+	}
+}
+
+func TestGetTransactionCheckMainChain(t *testing.T) {
+	testT = t
+	lwd, cache := testsetup()
+	fillTestCache(t, cache)
+	mainHash := parser.InternalToDisplayHex(cache.Get(380641).Hash)
+
+	// The transaction's block as zcashd reports it.
+	var blockHash string
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method != "getrawtransaction" {
+			testT.Fatal("unexpected method", method)
+		}
+		return json.Marshal(common.ZcashdRpcReplyGetrawtransaction{
+			Hex:           hex.EncodeToString(rawTxData[0]),
+			Height:        380641,
+			Confirmations: 3,
+			Blockhash:     blockHash,
+		})
+	}
+	for _, tt := range []struct {
+		blockHash      string
+		checkMainChain bool
+		want           bool
+	}{
+		{mainHash, true, true},
+		{strings.Repeat("ab", 32), true, false}, // reorged out
+		{mainHash, false, false},                // not asked
+	} {
+		blockHash = tt.blockHash
+		rawtx, err := lwd.GetTransaction(context.Background(),
+			&walletrpc.TxFilter{Hash: make([]byte, 32), CheckMainChain: tt.checkMainChain})
+		if err != nil {
+			t.Fatal("GetTransaction failed:", err)
+		}
+		if rawtx.ConfirmedOnMainChain != tt.want {
+			t.Fatal("GetTransaction blockhash", tt.blockHash, "check", tt.checkMainChain,
+				"unexpected confirmedOnMainChain", rawtx.ConfirmedOnMainChain)
+		}
+	}
+}
+
+func TestGetTransactionOrphaned(t *testing.T) {
+	testT = t
+	_, cache := testsetup()
+	mainHash := strings.Repeat("cd", 32)
+	staleHash := strings.Repeat("ab", 32)
+
+	// zcashd's getrawtransaction replies, in turn (the last repeats), its
+	// chain's height, and the height at which the transaction is in its
+	// chain (zero if it isn't)
+	var replies []string
+	var getblockhashCalls, getblockCalls int
+	tip, minedAt := 380641, 0
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getblock":
+			getblockCalls++
+			var heightStr string
+			json.Unmarshal(params[0], &heightStr)
+			height, _ := strconv.Atoi(heightStr)
+			if height > tip {
+				return nil, errors.New("-8: Block height out of range")
+			}
+			reply := common.ZcashdRpcReplyGetblock{
+				Hash:          fmt.Sprintf("%064x", height),
+				Height:        height,
+				Confirmations: tip - height + 1,
+				Tx:            []string{strings.Repeat("ee", 32)},
+			}
+			if height == minedAt {
+				reply.Tx = append(reply.Tx, strings.Repeat("00", 32))
+			}
+			return json.Marshal(reply)
+		case "getrawtransaction":
+			blockHash := replies[0]
+			if len(replies) > 1 {
+				replies = replies[1:]
+			}
+			reply := common.ZcashdRpcReplyGetrawtransaction{
+				Hex:       hex.EncodeToString(rawTxData[0]),
+				Blockhash: blockHash,
+			}
+			if blockHash != "" {
+				reply.Height = 380641
+				reply.Confirmations = 3
+			}
+			return json.Marshal(reply)
+		case "getblockhash":
+			getblockhashCalls++
+			if string(params[0]) != "380641" {
+				testT.Fatal("unexpected getblockhash height", string(params[0]))
+			}
+			if tip < 380641 {
+				return nil, errors.New("-8: Block height out of range")
+			}
+			return json.Marshal(mainHash)
+		}
+		testT.Fatal("unexpected method", method)
+		return nil, nil
+	}
+	reminedHash := fmt.Sprintf("%064x", 380642)
+	for _, tt := range []struct {
+		mode              common.OrphanedTxMode
+		replies           []string
+		tip, minedAt      int
+		wantHash          string // empty if reported not mined
+		wantHeight        uint64
+		wantConfirmations uint64
+		wantCalls         int // to getblockhash
+		wantBlocks        int // getblock calls
+	}{
+		{common.OrphanedTxIgnore, []string{staleHash}, 380641, 0, staleHash, 380641, 3, 0, 0},
+		{common.OrphanedTxUnconfirmed, []string{mainHash}, 380641, 0, mainHash, 380641, 3, 1, 0},
+		{common.OrphanedTxUnconfirmed, []string{staleHash, mainHash}, 380641, 0, "", 0, 0, 1, 0},
+		{common.OrphanedTxUnconfirmed, []string{staleHash}, 380640, 0, "", 0, 0, 1, 0},
+		{common.OrphanedTxReresolve, []string{mainHash}, 380641, 0, mainHash, 380641, 3, 1, 0},
+		// The reorg mined it again a block higher; the blocks from five
+		// below the stale height are searched.
+		{common.OrphanedTxReresolve, []string{staleHash}, 380643, 380642, reminedHash, 380642, 2, 1, 7},
+		// Not found up to zcashd's tip.
+		{common.OrphanedTxReresolve, []string{staleHash}, 380643, 0, "", 0, 0, 1, 9},
+		{common.OrphanedTxReresolve, []string{""}, 380641, 0, "", 0, 0, 0, 0}, // mempool
+	} {
+		lwd, err := NewLwdStreamerWithOptions(cache, WithOrphanedTxMode(tt.mode))
+		if err != nil {
+			t.Fatal(err)
+		}
+		replies = tt.replies
+		tip, minedAt = tt.tip, tt.minedAt
+		getblockhashCalls, getblockCalls = 0, 0
+		rawtx, err := lwd.GetTransaction(context.Background(),
+			&walletrpc.TxFilter{Hash: make([]byte, 32)})
+		if err != nil {
+			t.Fatal("GetTransaction failed:", err)
+		}
+		if hex.EncodeToString(rawtx.BlockHash) != tt.wantHash {
+			t.Fatal("mode", tt.mode, "replies", tt.replies, "unexpected block hash", hex.EncodeToString(rawtx.BlockHash))
+		}
+		if rawtx.Height != tt.wantHeight || rawtx.Confirmations != tt.wantConfirmations {
+			t.Fatal("mode", tt.mode, "replies", tt.replies, "unexpected height", rawtx.Height,
+				"confirmations", rawtx.Confirmations)
+		}
+		if len(rawtx.Data) == 0 {
+			t.Fatal("mode", tt.mode, "replies", tt.replies, "no transaction data")
+		}
+		if getblockhashCalls != tt.wantCalls || getblockCalls != tt.wantBlocks {
+			t.Fatal("mode", tt.mode, "replies", tt.replies, "unexpected getblockhash calls", getblockhashCalls,
+				"getblock calls", getblockCalls)
+		}
+	}
+
+	// Other errors fail the request.
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method == "getblockhash" {
+			return nil, errors.New("-28: Loading block index...")
+		}
+		return json.Marshal(common.ZcashdRpcReplyGetrawtransaction{
+			Hex:       hex.EncodeToString(rawTxData[0]),
+			Height:    380641,
+			Blockhash: staleHash,
+		})
+	}
+	lwd, _ := NewLwdStreamerWithOptions(cache, WithOrphanedTxMode(common.OrphanedTxUnconfirmed))
+	if _, err := lwd.GetTransaction(context.Background(),
+		&walletrpc.TxFilter{Hash: make([]byte, 32)}); err == nil {
+		t.Fatal("GetTransaction succeeded despite a getblockhash failure")
+	}
+	if _, err := common.ParseOrphanedTxMode("sometimes"); err == nil {
+		t.Fatal("ParseOrphanedTxMode accepted a bad mode")
+	}
+}
+
+func TestGetTransactionSummary(t *testing.T) {
+	testT = t
+	var txIndex int
+	txs := append(rawTxData[:2:2], darksideOrchardTx(1))
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method != "getrawtransaction" {
+			testT.Fatal("unexpected method", method)
+		}
+		return json.Marshal(common.ZcashdRpcReplyGetrawtransaction{
+			Hex:    hex.EncodeToString(txs[txIndex]),
+			Height: 1234567,
+		})
+	}
+	lwd, _ := testsetup()
+
+	// Both test transactions have Sapling elements; only the first has
+	// JoinSplits.
+	for i, hasSprout := range []bool{true, false} {
+		txIndex = i
+		summary, err := lwd.GetTransactionSummary(context.Background(),
+			&walletrpc.TxFilter{Hash: make([]byte, 32)})
+		if err != nil {
+			t.Fatal("GetTransactionSummary failed:", err)
+		}
+		if summary.HasSproutElements != hasSprout || !summary.HasSaplingElements {
+			t.Fatal("GetTransactionSummary unexpected pools for tx", i, summary)
+		}
+		if summary.Height != 1234567 || summary.IsCoinbase || summary.OrchardValueBalance != 0 {
+			t.Fatal("GetTransactionSummary unexpected summary for tx", i, summary)
+		}
+	}
+	// An Orchard-only transaction moving 5000 zatoshis into the pool.
+	txIndex = 2
+	summary, err := lwd.GetTransactionSummary(context.Background(),
+		&walletrpc.TxFilter{Hash: make([]byte, 32)})
+	if err != nil {
+		t.Fatal("GetTransactionSummary failed:", err)
+	}
+	if summary.OrchardValueBalance != -5000 || summary.SaplingValueBalance != 0 || summary.HasSaplingElements {
+		t.Fatal("GetTransactionSummary unexpected summary for Orchard tx", summary)
+	}
+	// Its txid is the one it's requested by, not its SHA256d hash.
+	v5Hash, _ := parser.DisplayHexToInternal(v5Txid)
+	summary, err = lwd.GetTransactionSummary(context.Background(),
+		&walletrpc.TxFilter{Hash: v5Hash})
+	if err != nil {
+		t.Fatal("GetTransactionSummary failed:", err)
+	}
+	if !bytes.Equal(summary.Txid, v5Hash) {
+		t.Fatal("GetTransactionSummary unexpected v5 txid", parser.InternalToDisplayHex(summary.Txid))
+	}
+	// Found by its index in a block, it's the txid zcashd lists there.
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getblock":
+			return json.Marshal(common.ZcashdRpcReplyGetblock{
+				Hash:   strings.Repeat("00", 32),
+				Height: 1234567,
+				Tx:     []string{strings.Repeat("11", 32), v5Txid},
+			})
+		case "getrawtransaction":
+			return json.Marshal(common.ZcashdRpcReplyGetrawtransaction{
+				Hex:    hex.EncodeToString(txs[2]),
+				Height: 1234567,
+			})
+		}
+		testT.Fatal("unexpected method", method)
+		return nil, nil
+	}
+	summary, err = lwd.GetTransactionSummary(context.Background(),
+		&walletrpc.TxFilter{Block: &walletrpc.BlockID{Hash: make([]byte, 32)}, Index: 1})
+	if err != nil {
+		t.Fatal("GetTransactionSummary by block index failed:", err)
+	}
+	if !bytes.Equal(summary.Txid, v5Hash) {
+		t.Fatal("GetTransactionSummary unexpected v5 txid by block index", parser.InternalToDisplayHex(summary.Txid))
+	}
+	if _, err := lwd.GetTransactionSummary(context.Background(), &walletrpc.TxFilter{}); err == nil {
+		t.Fatal("GetTransactionSummary without a txid succeeded")
+	}
+}
+
 func getblockStub(method string, params []json.RawMessage) (json.RawMessage, error) {
+	if method == "getblockchaininfo" {
+		// GetBlock checks, after a failure, whether zcashd is pruned.
+		return json.Marshal(&common.ZcashdRpcReplyGetblockchaininfo{})
+	}
 	step++
 	var height string
 	err := json.Unmarshal(params[0], &height)
@@ -159,39 +522,100 @@ func getblockStub(method string, params []json.RawMessage) (json.RawMessage, err
 
 func TestGetLatestBlock(t *testing.T) {
 	testT = t
-	common.RawRequest = getblockStub
-	lwd, cache := testsetup()
+	bestBlockHash := "00000000015" + strings.Repeat("ab", 24) + "6789c"
+	var rpcErr error
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method != "getblockchaininfo" {
+			testT.Fatal("unexpected method", method)
+		}
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		return json.Marshal(map[string]interface{}{
+			"blocks":        380640,
+			"bestblockhash": bestBlockHash,
+		})
+	}
+	lwd, _ := testsetup()
 
 	// This argument is not used (it may be in the future)
 	req := &walletrpc.ChainSpec{}
 
 	blockID, err := lwd.GetLatestBlock(context.Background(), req)
-	if err == nil {
-		t.Fatal("GetLatestBlock should have failed, empty cache")
+	if err != nil {
+		t.Fatal("lwd.GetLatestBlock failed", err)
+	}
+	if blockID.Height != 380640 {
+		t.Fatal("unexpected blockID.height")
+	}
+	// The hash is little-endian, as in CompactBlock.hash.
+	if parser.InternalToDisplayHex(blockID.Hash) != bestBlockHash {
+		t.Fatal("unexpected blockID.hash", hex.EncodeToString(blockID.Hash))
 	}
-	if err.Error() != "Cache is empty. Server is probably not yet ready" {
-		t.Fatal("GetLatestBlock incorrect error", err)
+
+	rpcErr = errors.New("getblockchaininfo test error")
+	blockID, err = lwd.GetLatestBlock(context.Background(), req)
+	if err == nil {
+		t.Fatal("GetLatestBlock should have failed")
 	}
 	if blockID != nil {
 		t.Fatal("unexpected blockID", blockID)
 	}
+}
 
-	// This does zcashd rpc "getblock", calls getblockStub() above
-	block, err := common.GetBlock(cache, 380640)
-	if err != nil {
-		t.Fatal("getBlockFromRPC failed", err)
+func TestGetLatestBlocks(t *testing.T) {
+	testT = t
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		testT.Fatal("unexpected method", method)
+		return nil, nil
 	}
-	if err = cache.Add(380640, block); err != nil {
-		t.Fatal("cache.Add failed:", err)
+	lwd, cache := testsetup()
+	defer cache.Close()
+
+	if _, err := lwd.GetLatestBlocks(context.Background(),
+		&walletrpc.LatestBlocksRequest{Count: 1}); err == nil {
+		t.Fatal("GetLatestBlocks of an empty cache succeeded")
 	}
-	blockID, err = lwd.GetLatestBlock(context.Background(), req)
-	if err != nil {
-		t.Fatal("lwd.GetLatestBlock failed", err)
+	fillTestCache(t, cache)
+
+	for _, count := range []uint32{0, defaultMaxLatestBlocks + 1} {
+		_, err := lwd.GetLatestBlocks(context.Background(),
+			&walletrpc.LatestBlocksRequest{Count: count})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatal("GetLatestBlocks count", count, "unexpected error", err)
+		}
 	}
-	if blockID.Height != 380640 {
-		t.Fatal("unexpected blockID.height")
+	for _, tt := range []struct {
+		count uint32
+		first uint64
+	}{
+		{1, 380643},
+		{3, 380641},
+		// Limited to the blocks from Sapling activation (the cache's start).
+		{defaultMaxLatestBlocks, 380640},
+	} {
+		list, err := lwd.GetLatestBlocks(context.Background(),
+			&walletrpc.LatestBlocksRequest{Count: tt.count})
+		if err != nil {
+			t.Fatal("GetLatestBlocks failed:", err)
+		}
+		if len(list.Blocks) != int(380643-tt.first+1) {
+			t.Fatal("GetLatestBlocks count", tt.count, "unexpected number of blocks", len(list.Blocks))
+		}
+		// Contiguous, and ending at the tip.
+		for i, id := range list.Blocks {
+			block := cache.Get(int(tt.first) + i)
+			if id.Height != tt.first+uint64(i) || !bytes.Equal(id.Hash, block.Hash) {
+				t.Fatal("GetLatestBlocks unexpected block ID", id.Height)
+			}
+			if i > 0 && !bytes.Equal(block.PrevHash, list.Blocks[i-1].Hash) {
+				t.Fatal("GetLatestBlocks block", id.Height, "doesn't link to the one before it")
+			}
+		}
+		if !bytes.Equal(list.Blocks[len(list.Blocks)-1].Hash, cache.GetLatestHash()) {
+			t.Fatal("GetLatestBlocks doesn't end at the tip")
+		}
 	}
-	step = 0
 }
 
 // A valid address starts with "t", followed by 34 alpha characters;
@@ -209,6 +633,162 @@ var addressTests = []string{
 	"t1234567890123456789012345678901234\n", // newline after
 }
 
+func TestCheckTaddressNetwork(t *testing.T) {
+	tests := []struct {
+		chainName string
+		taddr     string
+		valid     bool
+	}{
+		{"main", "t1234567890123456789012345678901234", true},
+		{"main", "t3234567890123456789012345678901234", true},
+		{"main", "tm234567890123456789012345678901234", false},
+		{"main", "t2234567890123456789012345678901234", false},
+		{"test", "tm234567890123456789012345678901234", true},
+		{"test", "t2234567890123456789012345678901234", true},
+		{"test", "t1234567890123456789012345678901234", false},
+		{"test", "t3234567890123456789012345678901234", false},
+		{"regtest", "tm234567890123456789012345678901234", true},
+		{"regtest", "t2234567890123456789012345678901234", true},
+		{"regtest", "t1234567890123456789012345678901234", false},
+		// unknown networks (such as darkside) accept any known prefix
+		{"darkside", "t1234567890123456789012345678901234", true},
+		{"darkside", "tm234567890123456789012345678901234", true},
+		{"darkside", "tz234567890123456789012345678901234", false},
+	}
+	for i, tt := range tests {
+		err := checkTaddress(tt.taddr, common.GetNetwork(tt.chainName))
+		if tt.valid && err != nil {
+			t.Fatal("checkTaddress unexpectedly failed, case", i, err)
+		}
+		if !tt.valid && err == nil {
+			t.Fatal("checkTaddress unexpectedly succeeded, case", i)
+		}
+	}
+}
+
+func TestClassifyAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		kind addressKind
+	}{
+		// mainnet
+		{"t1234567890123456789012345678901234", addressTransparent},
+		{"t3234567890123456789012345678901234", addressTransparent},
+		{"zc" + strings.Repeat("1", 93), addressSprout},
+		{"zs1z7rejlpsa98s2rrrfkwmaxu53e4ue0ulcrw0h4x5g8jl04tak0d3mm47vdtahatqrlkngh9sly", addressSapling},
+		{"u1l8xunezsvhq8fgzfl7404m450nwnd76zshscn6nfys7vyz2ywyh4cc5daaq0c7q2su5lqfh23sp7fkf3kt27ve5948mzpfdvckzaect2jtte308mkwlycj2u0eac077wu70vqcetkxf", addressUnified},
+		// testnet (and regtest)
+		{"tm234567890123456789012345678901234", addressTransparent},
+		{"t2234567890123456789012345678901234", addressTransparent},
+		{"zt" + strings.Repeat("1", 93), addressSprout},
+		{"ztestsapling1" + strings.Repeat("q", 75), addressSapling},
+		{"zregtestsapling1" + strings.Repeat("q", 75), addressSapling},
+		{"utest1" + strings.Repeat("q", 100), addressUnified},
+		{"uregtest1" + strings.Repeat("q", 100), addressUnified},
+		// not addresses
+		{"", addressUnknown},
+		{"zs1", addressUnknown},
+		{"zs1" + strings.Repeat("Q", 75), addressUnknown},
+		{"u1 " + strings.Repeat("q", 100), addressUnknown},
+		{"zc" + strings.Repeat("1", 92), addressUnknown},
+		{"ua1" + strings.Repeat("q", 100), addressUnknown},
+	}
+	for i, tt := range tests {
+		if kind := classifyAddress(tt.addr); kind != tt.kind {
+			t.Fatal("case", i, "classifyAddress", tt.addr, "returned", kind, "want", tt.kind)
+		}
+	}
+	for i, addr := range addressTests {
+		if kind := classifyAddress(addr); kind != addressUnknown {
+			t.Fatal("invalid address case", i, "classified as", kind)
+		}
+	}
+}
+
+func TestGetTaddressBalanceShielded(t *testing.T) {
+	lwd, _ := testsetup()
+	shielded := []string{
+		// Sapling
+		"zs1z7rejlpsa98s2rrrfkwmaxu53e4ue0ulcrw0h4x5g8jl04tak0d3mm47vdtahatqrlkngh9sly",
+		"ztestsapling1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqq",
+		// Sprout
+		"zc" + strings.Repeat("1", 93),
+		// unified
+		"u1l8xunezsvhq8fgzfl7404m450nwnd76zshscn6nfys7vyz2ywyh4cc5daaq0c7q2su5lqfh23sp7fkf3kt27ve5948mzpfdvckzaect2jtte308mkwlycj2u0eac077wu70vqcetkxf",
+		"utest1" + strings.Repeat("q", 100),
+	}
+	for i, addr := range shielded {
+		_, err := lwd.GetTaddressBalance(context.Background(),
+			&walletrpc.AddressList{Addresses: []string{"t1234567890123456789012345678901234", addr}})
+		if err == nil {
+			t.Fatal("GetTaddressBalance should have failed on a shielded address, case", i)
+		}
+		if err.Error() != "shielded balances require a viewing key and are not supported by this RPC" {
+			t.Fatal("GetTaddressBalance unexpected error, case", i, err)
+		}
+	}
+	// Other bad addresses still get the generic error.
+	_, err := lwd.GetTaddressBalance(context.Background(),
+		&walletrpc.AddressList{Addresses: []string{"s1234567890123456789012345678901234"}})
+	if err == nil || err.Error() != "Invalid address" {
+		t.Fatal("GetTaddressBalance unexpected error", err)
+	}
+}
+
+func TestGetTaddressBalanceMinConfirmations(t *testing.T) {
+	testT = t
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getaddressbalance":
+			return []byte(`{"balance": 7000, "received": 9000}`), nil
+		case "getaddressutxos":
+			var req common.ZcashdRpcRequestGetaddressutxos
+			json.Unmarshal(params[0], &req)
+			if !req.ChainInfo {
+				testT.Fatal("getaddressutxos without chainInfo")
+			}
+			var utxos []map[string]interface{}
+			for i, height := range []int{100, 105, 110} {
+				utxos = append(utxos, map[string]interface{}{
+					"address": "t1234567890123456789012345678901234", "txid": strings.Repeat("ab", 32),
+					"outputIndex": i, "script": "76a914", "satoshis": 1000 << uint(i), "height": height})
+			}
+			return json.Marshal(map[string]interface{}{
+				"utxos": utxos, "hash": strings.Repeat("cd", 32), "height": 110})
+		}
+		testT.Fatal("unexpected method", method)
+		return nil, nil
+	}
+	lwd, _ := testsetup()
+
+	for _, tt := range []struct {
+		minConfirmations uint32
+		confirmed        int64
+		unconfirmed      int64
+	}{
+		// Without a minimum, getaddressbalance's total is all confirmed.
+		{0, 7000, 0},
+		{1, 7000, 0},
+		// The tip's utxo has one confirmation, the one at 105 has six.
+		{2, 3000, 4000},
+		{6, 3000, 4000},
+		{7, 1000, 6000},
+		{20, 0, 7000},
+	} {
+		balance, err := lwd.GetTaddressBalance(context.Background(), &walletrpc.AddressList{
+			Addresses:        []string{"t1234567890123456789012345678901234"},
+			MinConfirmations: tt.minConfirmations,
+		})
+		if err != nil {
+			t.Fatal("GetTaddressBalance failed:", err)
+		}
+		if balance.ValueZat != 7000 || balance.ConfirmedZat != tt.confirmed ||
+			balance.UnconfirmedZat != tt.unconfirmed {
+			t.Fatal("minConfirmations", tt.minConfirmations, "unexpected balance", balance)
+		}
+	}
+}
+
 func zcashdrpcStub(method string, params []json.RawMessage) (json.RawMessage, error) {
 	step++
 	switch method {
@@ -305,76 +885,356 @@ func TestGetTaddressTxids(t *testing.T) {
 	step = 0
 }
 
-func TestGetTaddressTxidsNilArgs(t *testing.T) {
-	lwd, _ := testsetup()
+type testgettxPaged struct {
+	walletrpc.CompactTxStreamer_GetTaddressTxidsServer
+	sent    []*walletrpc.RawTransaction
+	trailer metadata.MD
+}
 
-	{
-		noRange := &walletrpc.TransparentAddressBlockFilter{
-			Range: nil,
-		}
-		err := lwd.GetTaddressTxids(noRange, &testgettx{})
-		if err == nil {
-			t.Fatal("GetBlockRange nil range argument should fail")
+func (tg *testgettxPaged) Context() context.Context {
+	return context.Background()
+}
+
+func (tg *testgettxPaged) Send(tx *walletrpc.RawTransaction) error {
+	tg.sent = append(tg.sent, tx)
+	return nil
+}
+
+func (tg *testgettxPaged) SetTrailer(md metadata.MD) {
+	tg.trailer = metadata.Join(tg.trailer, md)
+}
+
+func TestGetTaddressTxidsPaged(t *testing.T) {
+	testT = t
+	// zcashd's order, with one transaction having two deltas
+	heights := map[string]int{
+		strings.Repeat("03", 32): 21,
+		strings.Repeat("02", 32): 20,
+		strings.Repeat("04", 32): 22,
+		strings.Repeat("01", 32): 21,
+	}
+	deltas := []string{
+		strings.Repeat("03", 32), strings.Repeat("02", 32), strings.Repeat("04", 32),
+		strings.Repeat("01", 32), strings.Repeat("03", 32),
+	}
+	sorted := []string{
+		strings.Repeat("02", 32), strings.Repeat("01", 32), strings.Repeat("03", 32),
+		strings.Repeat("04", 32),
+	}
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getaddressdeltas":
+			var reply []map[string]interface{}
+			for _, txid := range deltas {
+				reply = append(reply, map[string]interface{}{"txid": txid, "height": heights[txid]})
+			}
+			return json.Marshal(reply)
+		case "getrawtransaction":
+			var txid string
+			json.Unmarshal(params[0], &txid)
+			return json.Marshal(common.ZcashdRpcReplyGetrawtransaction{
+				Hex:       hex.EncodeToString(rawTxData[0]),
+				Height:    heights[txid],
+				Blockhash: txid, // so the test can tell which was sent
+			})
 		}
+		testT.Fatal("unexpected method", method)
+		return nil, nil
 	}
-	{
-		noStart := &walletrpc.TransparentAddressBlockFilter{
+	lwd, _ := testsetup()
+
+	for _, tt := range []struct {
+		offset, limit uint64
+		want          []string
+	}{
+		{0, 2, sorted[:2]},
+		{2, 2, sorted[2:]},
+		{1, 0, sorted[1:]},
+		{3, 5, sorted[3:]},
+		{4, 1, nil},
+	} {
+		resp := &testgettxPaged{}
+		err := lwd.GetTaddressTxids(&walletrpc.TransparentAddressBlockFilter{
+			Address: "t1234567890123456789012345678901234",
 			Range: &walletrpc.BlockRange{
-				Start: nil,
-				End:   &walletrpc.BlockID{Height: 20},
+				Start: &walletrpc.BlockID{Height: 20},
+				End:   &walletrpc.BlockID{Height: 30},
 			},
+			Offset: tt.offset,
+			Limit:  tt.limit,
+		}, resp)
+		if err != nil {
+			t.Fatal("GetTaddressTxids failed:", err)
 		}
-		err := lwd.GetTaddressTxids(noStart, &testgettx{})
-		if err == nil {
-			t.Fatal("GetBlockRange nil range argument should fail")
+		if count := resp.trailer.Get(TxidCountTrailer); len(count) != 1 || count[0] != "4" {
+			t.Fatal("GetTaddressTxids unexpected count trailer", count)
 		}
-	}
-	{
-		noEnd := &walletrpc.TransparentAddressBlockFilter{
-			Range: &walletrpc.BlockRange{
-				Start: &walletrpc.BlockID{Height: 30},
-				End:   nil,
-			},
+		if len(resp.sent) != len(tt.want) {
+			t.Fatal("GetTaddressTxids offset", tt.offset, "limit", tt.limit,
+				"unexpected number of transactions", len(resp.sent))
 		}
-		err := lwd.GetTaddressTxids(noEnd, &testgettx{})
-		if err == nil {
-			t.Fatal("GetBlockRange nil range argument should fail")
+		for i, tx := range resp.sent {
+			if hex.EncodeToString(tx.BlockHash) != tt.want[i] {
+				t.Fatal("GetTaddressTxids offset", tt.offset, "limit", tt.limit,
+					"unexpected transaction", i, hex.EncodeToString(tx.BlockHash))
+			}
 		}
 	}
 }
 
-func TestGetBlock(t *testing.T) {
+func TestGetTaddressTxidsMaxEntries(t *testing.T) {
 	testT = t
-	common.RawRequest = getblockStub
-	lwd, _ := testsetup()
-
-	_, err := lwd.GetBlock(context.Background(), &walletrpc.BlockID{})
-	if err == nil {
-		t.Fatal("GetBlock should have failed")
+	heights := map[string]int{
+		strings.Repeat("03", 32): 21,
+		strings.Repeat("02", 32): 20,
+		strings.Repeat("04", 32): 22,
+		strings.Repeat("01", 32): 21,
 	}
-	_, err = lwd.GetBlock(context.Background(), &walletrpc.BlockID{Height: 0})
-	if err == nil {
-		t.Fatal("GetBlock should have failed")
-	}
-	_, err = lwd.GetBlock(context.Background(), &walletrpc.BlockID{Hash: []byte{0}})
-	if err == nil {
-		t.Fatal("GetBlock should have failed")
+	deltas := []string{
+		strings.Repeat("03", 32), strings.Repeat("02", 32), strings.Repeat("04", 32),
+		strings.Repeat("01", 32),
 	}
-	if err.Error() != "GetBlock by Hash is not yet implemented" {
-		t.Fatal("GetBlock hash unimplemented error message failed")
+	var start uint64
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getaddressdeltas":
+			var request common.ZcashdRpcRequestGetaddressdeltas
+			json.Unmarshal(params[0], &request)
+			start = request.Start
+			var reply []map[string]interface{}
+			for _, txid := range deltas {
+				if uint64(heights[txid]) >= start {
+					reply = append(reply, map[string]interface{}{"txid": txid, "height": heights[txid]})
+				}
+			}
+			return json.Marshal(reply)
+		case "getrawtransaction":
+			var txid string
+			json.Unmarshal(params[0], &txid)
+			return json.Marshal(common.ZcashdRpcReplyGetrawtransaction{
+				Hex:       hex.EncodeToString(rawTxData[0]),
+				Height:    heights[txid],
+				Blockhash: txid,
+			})
+		}
+		testT.Fatal("unexpected method", method)
+		return nil, nil
 	}
+	lwd, _ := testsetup()
 
-	// getblockStub() case 1: return error
-	block, err := lwd.GetBlock(context.Background(), &walletrpc.BlockID{Height: 380640})
-	if err != nil {
-		t.Fatal("GetBlock failed:", err)
+	for _, tt := range []struct {
+		startHeight uint64
+		maxEntries  int32
+		offset      uint64
+		wantStart   uint64
+		want        []string
+	}{
+		// Sorted by height before the cap is applied.
+		{0, 2, 0, 20, []string{strings.Repeat("02", 32), strings.Repeat("01", 32)}},
+		{21, 1, 0, 21, []string{strings.Repeat("01", 32)}},
+		{21, 5, 1, 21, []string{strings.Repeat("03", 32), strings.Repeat("04", 32)}},
+		{10, 1, 0, 20, []string{strings.Repeat("02", 32)}},
+		{31, 1, 0, 0, nil},
+	} {
+		start = 0
+		resp := &testgettxPaged{}
+		err := lwd.GetTaddressTxids(&walletrpc.TransparentAddressBlockFilter{
+			Address: "t1234567890123456789012345678901234",
+			Range: &walletrpc.BlockRange{
+				Start: &walletrpc.BlockID{Height: 20},
+				End:   &walletrpc.BlockID{Height: 30},
+			},
+			Offset:      tt.offset,
+			StartHeight: tt.startHeight,
+			MaxEntries:  tt.maxEntries,
+		}, resp)
+		if err != nil {
+			t.Fatal("GetTaddressTxids failed:", err)
+		}
+		if start != tt.wantStart {
+			t.Fatal("GetTaddressTxids startHeight", tt.startHeight, "unexpected start", start)
+		}
+		if len(resp.sent) != len(tt.want) {
+			t.Fatal("GetTaddressTxids startHeight", tt.startHeight, "maxEntries", tt.maxEntries,
+				"unexpected number of transactions", len(resp.sent))
+		}
+		for i, tx := range resp.sent {
+			if hex.EncodeToString(tx.BlockHash) != tt.want[i] {
+				t.Fatal("GetTaddressTxids startHeight", tt.startHeight, "maxEntries", tt.maxEntries,
+					"unexpected transaction", i, hex.EncodeToString(tx.BlockHash))
+			}
+		}
 	}
-	if block.Height != 380640 {
-		t.Fatal("GetBlock returned unexpected block:", err)
+
+	err := lwd.GetTaddressTxids(&walletrpc.TransparentAddressBlockFilter{
+		Address: "t1234567890123456789012345678901234",
+		Range: &walletrpc.BlockRange{
+			Start: &walletrpc.BlockID{Height: 20},
+			End:   &walletrpc.BlockID{Height: 30},
+		},
+		MaxEntries: -1,
+	}, &testgettxPaged{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatal("GetTaddressTxids negative maxEntries unexpected error", err)
 	}
-	// getblockStub() case 2: return error
-	block, err = lwd.GetBlock(context.Background(), &walletrpc.BlockID{Height: 380640})
-	if err == nil {
+}
+
+type testgettaddressestxids struct {
+	walletrpc.CompactTxStreamer_GetTaddressesTxidsServer
+	filters []*walletrpc.TransparentAddressBlockFilter
+	sent    []*walletrpc.RawTransaction
+}
+
+func (tg *testgettaddressestxids) Context() context.Context {
+	return context.Background()
+}
+
+func (tg *testgettaddressestxids) Recv() (*walletrpc.TransparentAddressBlockFilter, error) {
+	if len(tg.filters) == 0 {
+		return nil, io.EOF
+	}
+	filter := tg.filters[0]
+	tg.filters = tg.filters[1:]
+	return filter, nil
+}
+
+func (tg *testgettaddressestxids) Send(tx *walletrpc.RawTransaction) error {
+	tg.sent = append(tg.sent, tx)
+	return nil
+}
+
+func TestGetTaddressesTxids(t *testing.T) {
+	testT = t
+	txidA := "6732cf8d67aac5b82a2a0f0217a7d4aa245b2adb0b97fd2d923dfc674415e221"
+	txidB := "3fb2b1d4c5a1e9a3e6f7d0b2c6e1a9f8d7c6b5a4938271605f4e3d2c1b0a9988"
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getaddresstxids":
+			var filter common.ZcashdRpcRequestGetaddresstxids
+			if err := json.Unmarshal(params[0], &filter); err != nil {
+				testT.Fatal("could not unmarshal block filter")
+			}
+			if len(filter.Addresses) != 2 || filter.Start != 20 || filter.End != 30 {
+				testT.Fatal("unexpected getaddresstxids filter", filter)
+			}
+			// The transaction shared by both addresses is listed twice.
+			return json.Marshal([]string{txidA, txidB, txidA})
+		case "getrawtransaction":
+			var txid string
+			json.Unmarshal(params[0], &txid)
+			height := 25
+			if txid == txidB {
+				height = 21
+			}
+			return json.Marshal(&common.ZcashdRpcReplyGetrawtransaction{
+				Hex:    hex.EncodeToString([]byte(txid)),
+				Height: height,
+			})
+		}
+		testT.Fatal("unexpected method", method)
+		return nil, nil
+	}
+	lwd, _ := testsetup()
+
+	stream := &testgettaddressestxids{filters: []*walletrpc.TransparentAddressBlockFilter{
+		{
+			Address: "t1234567890123456789012345678901234",
+			Range: &walletrpc.BlockRange{
+				Start: &walletrpc.BlockID{Height: 20},
+				End:   &walletrpc.BlockID{Height: 30},
+			},
+		},
+		{Address: "t3234567890123456789012345678901234"},
+	}}
+	if err := lwd.GetTaddressesTxids(stream); err != nil {
+		t.Fatal("GetTaddressesTxids failed:", err)
+	}
+	if len(stream.sent) != 2 {
+		t.Fatal("GetTaddressesTxids unexpected number of transactions", len(stream.sent))
+	}
+	if string(stream.sent[0].Data) != txidB || string(stream.sent[1].Data) != txidA {
+		t.Fatal("GetTaddressesTxids transactions not sorted by height")
+	}
+
+	// Too many addresses
+	stream = &testgettaddressestxids{}
+	for i := 0; i <= maxTaddressesTxids; i++ {
+		stream.filters = append(stream.filters, &walletrpc.TransparentAddressBlockFilter{
+			Address: "t1234567890123456789012345678901234",
+		})
+	}
+	if err := lwd.GetTaddressesTxids(stream); err == nil {
+		t.Fatal("GetTaddressesTxids should have failed on too many addresses")
+	}
+}
+
+func TestGetTaddressTxidsNilArgs(t *testing.T) {
+	lwd, _ := testsetup()
+
+	{
+		noRange := &walletrpc.TransparentAddressBlockFilter{
+			Range: nil,
+		}
+		err := lwd.GetTaddressTxids(noRange, &testgettx{})
+		if err == nil {
+			t.Fatal("GetBlockRange nil range argument should fail")
+		}
+	}
+	{
+		noStart := &walletrpc.TransparentAddressBlockFilter{
+			Range: &walletrpc.BlockRange{
+				Start: nil,
+				End:   &walletrpc.BlockID{Height: 20},
+			},
+		}
+		err := lwd.GetTaddressTxids(noStart, &testgettx{})
+		if err == nil {
+			t.Fatal("GetBlockRange nil range argument should fail")
+		}
+	}
+	{
+		noEnd := &walletrpc.TransparentAddressBlockFilter{
+			Range: &walletrpc.BlockRange{
+				Start: &walletrpc.BlockID{Height: 30},
+				End:   nil,
+			},
+		}
+		err := lwd.GetTaddressTxids(noEnd, &testgettx{})
+		if err == nil {
+			t.Fatal("GetBlockRange nil range argument should fail")
+		}
+	}
+}
+
+func TestGetBlock(t *testing.T) {
+	testT = t
+	common.RawRequest = getblockStub
+	lwd, _ := testsetup()
+
+	_, err := lwd.GetBlock(context.Background(), &walletrpc.BlockID{})
+	if err == nil {
+		t.Fatal("GetBlock should have failed")
+	}
+	_, err = lwd.GetBlock(context.Background(), &walletrpc.BlockID{Height: 0})
+	if err == nil {
+		t.Fatal("GetBlock should have failed")
+	}
+	_, err = lwd.GetBlock(context.Background(), &walletrpc.BlockID{Hash: []byte{0}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatal("GetBlock should have rejected a short hash", err)
+	}
+
+	// getblockStub() case 1: return error
+	block, err := lwd.GetBlock(context.Background(), &walletrpc.BlockID{Height: 380640})
+	if err != nil {
+		t.Fatal("GetBlock failed:", err)
+	}
+	if block.Height != 380640 {
+		t.Fatal("GetBlock returned unexpected block:", err)
+	}
+	// getblockStub() case 2: return error
+	block, err = lwd.GetBlock(context.Background(), &walletrpc.BlockID{Height: 380640})
+	if err == nil {
 		t.Fatal("GetBlock should have failed")
 	}
 	if block != nil {
@@ -383,6 +1243,86 @@ func TestGetBlock(t *testing.T) {
 	step = 0
 }
 
+// v5Txid is the txid zcashd reports for the test v5 transaction; v5 txids
+// are ZIP 244 digests, not the SHA256d hash of the transaction.
+var v5Txid = strings.Repeat("5a", 32)
+
+func TestGetBlockV5Txid(t *testing.T) {
+	testT = t
+	// Block 380640 with a v5 (Orchard) transaction appended.
+	var blockHex string
+	if err := json.Unmarshal(blocks[0], &blockHex); err != nil {
+		t.Fatal(err)
+	}
+	blockData, err := hex.DecodeString(blockHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := parser.NewBlock()
+	if _, err := block.ParseFromSlice(blockData); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := parser.NewBlockHeader().ParseFromSlice(blockData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	b.Write(blockData[:len(blockData)-len(rest)])
+	b.WriteByte(byte(len(block.Transactions()) + 1))
+	txids := []string{}
+	for _, tx := range block.Transactions() {
+		b.Write(tx.Bytes())
+		txids = append(txids, hex.EncodeToString(tx.GetDisplayHash()))
+	}
+	b.Write(darksideOrchardTx(1))
+	txids = append(txids, v5Txid)
+
+	verboseCalls := 0
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method != "getblock" {
+			testT.Fatal("unexpected method", method)
+		}
+		if string(params[1]) == "0" {
+			return json.Marshal(hex.EncodeToString(b.Bytes()))
+		}
+		verboseCalls++
+		return json.Marshal(common.ZcashdRpcReplyGetblock{
+			Hash:   hex.EncodeToString(block.GetDisplayHash()),
+			Height: 380640,
+			Tx:     txids,
+		})
+	}
+	lwd, _ := testsetup()
+	cBlock, err := lwd.GetBlock(context.Background(), &walletrpc.BlockID{Height: 380640})
+	if err != nil {
+		t.Fatal("GetBlock failed:", err)
+	}
+	if verboseCalls != 1 {
+		t.Fatal("unexpected number of verbose getblock calls", verboseCalls)
+	}
+	last := cBlock.Vtx[len(cBlock.Vtx)-1]
+	if len(last.Actions) != 1 || parser.InternalToDisplayHex(last.Hash) != v5Txid {
+		t.Fatal("GetBlock unexpected v5 transaction", last)
+	}
+	// The older transactions keep their SHA256d txids.
+	for _, ctx := range cBlock.Vtx[:len(cBlock.Vtx)-1] {
+		if parser.InternalToDisplayHex(ctx.Hash) != txids[ctx.Index] {
+			t.Fatal("GetBlock unexpected txid at index", ctx.Index)
+		}
+	}
+
+	// Without v5 transactions, zcashd isn't asked for the txids.
+	verboseCalls = 0
+	b.Reset()
+	b.Write(blockData)
+	if _, err := common.GetBlockWithOptions(380640, parser.CompactOptions{}); err != nil {
+		t.Fatal("GetBlockWithOptions failed:", err)
+	}
+	if verboseCalls != 0 {
+		t.Fatal("verbose getblock called for a block without v5 transactions")
+	}
+}
+
 type testgetbrange struct {
 	walletrpc.CompactTxStreamer_GetBlockRangeServer
 }
@@ -418,177 +1358,2788 @@ func TestGetBlockRange(t *testing.T) {
 	step = 0
 }
 
-func TestGetBlockRangeNilArgs(t *testing.T) {
-	lwd, _ := testsetup()
-
-	{
-		noEnd := &walletrpc.BlockRange{
-			Start: &walletrpc.BlockID{Height: 380640},
-			End:   nil,
-		}
-		err := lwd.GetBlockRange(noEnd, &testgetbrange{})
-		if err == nil {
-			t.Fatal("GetBlockRange nil argument should fail")
+func TestPrunedNode(t *testing.T) {
+	testT = t
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getinfo":
+			return json.Marshal(&common.ZcashdRpcReplyGetinfo{})
+		case "getblockchaininfo":
+			return json.Marshal(&common.ZcashdRpcReplyGetblockchaininfo{
+				Blocks:      380643,
+				Pruned:      true,
+				PruneHeight: 380642,
+			})
+		case "getblock":
+			return nil, errors.New("-1: Block not available (pruned data)")
 		}
+		testT.Fatal("unexpected method", method)
+		return nil, nil
 	}
-	{
-		noStart := &walletrpc.BlockRange{
-			Start: nil,
-			End:   &walletrpc.BlockID{Height: 380640},
-		}
-		err := lwd.GetBlockRange(noStart, &testgetbrange{})
-		if err == nil {
-			t.Fatal("GetBlockRange nil argument should fail")
-		}
+	lwd, cache := testsetup()
+
+	info, err := lwd.GetLightdInfo(context.Background(), &walletrpc.Empty{})
+	if err != nil {
+		t.Fatal("GetLightdInfo failed:", err)
+	}
+	if info.PruneHeight != 380642 {
+		t.Fatal("GetLightdInfo unexpected prune height", info.PruneHeight)
 	}
-}
 
-func sendrawtransactionStub(method string, params []json.RawMessage) (json.RawMessage, error) {
-	step++
-	if method != "sendrawtransaction" {
-		testT.Fatal("unexpected method")
+	_, err = lwd.GetBlock(context.Background(), &walletrpc.BlockID{Height: 380641})
+	if status.Code(err) != codes.OutOfRange || !strings.Contains(err.Error(), "380642") {
+		t.Fatal("GetBlock of a pruned block, unexpected error", err)
 	}
-	if string(params[0]) != "\"07\"" {
-		testT.Fatal("unexpected tx data")
+	err = lwd.GetBlockRange(&walletrpc.BlockRange{
+		Start: &walletrpc.BlockID{Height: 380641},
+		End:   &walletrpc.BlockID{Height: 380643},
+	}, &testgetbrange{})
+	if status.Code(err) != codes.OutOfRange {
+		t.Fatal("GetBlockRange of pruned blocks, unexpected error", err)
 	}
-	switch step {
-	case 1:
-		return []byte("sendtxresult"), nil
-	case 2:
-		return nil, errors.New("-17: some error")
+
+	// Pruned blocks that are in the cache can still be served.
+	fillTestCache(t, cache)
+	block, err := lwd.GetBlock(context.Background(), &walletrpc.BlockID{Height: 380641})
+	if err != nil || block.Height != 380641 {
+		t.Fatal("GetBlock of a cached block failed:", err)
 	}
-	testT.Fatal("unexpected call to sendrawtransactionStub")
-	return nil, nil
 }
 
-func TestSendTransaction(t *testing.T) {
-	testT = t
-	lwd, _ := testsetup()
-	common.RawRequest = sendrawtransactionStub
-	rawtx := walletrpc.RawTransaction{Data: []byte{7}}
-	sendresult, err := lwd.SendTransaction(context.Background(), &rawtx)
-	if err != nil {
-		t.Fatal("SendTransaction failed", err)
+type testgetbrangeRecord struct {
+	testgetbrange
+	blocks []*walletrpc.CompactBlock
+}
+
+func (tg *testgetbrangeRecord) Send(cb *walletrpc.CompactBlock) error {
+	tg.blocks = append(tg.blocks, cb)
+	return nil
+}
+
+func TestGetBlockRangeMaxMessageSize(t *testing.T) {
+	lwd, cache := testsetup()
+
+	// An artificially large block: 20 transactions of about 10 KB each.
+	big := &walletrpc.CompactBlock{
+		Height:   380640,
+		Hash:     make([]byte, 32),
+		PrevHash: make([]byte, 32),
+		Time:     1,
 	}
-	if sendresult.ErrorCode != 0 {
-		t.Fatal("SendTransaction unexpected ErrorCode return")
+	for i := 0; i < 20; i++ {
+		tx := &walletrpc.CompactTx{Index: uint64(i), Hash: make([]byte, 32)}
+		for j := 0; j < 10; j++ {
+			tx.Outputs = append(tx.Outputs, &walletrpc.CompactOutput{
+				Cmu:        make([]byte, 32),
+				Epk:        make([]byte, 32),
+				Ciphertext: make([]byte, 948),
+			})
+		}
+		big.Vtx = append(big.Vtx, tx)
 	}
-	if sendresult.ErrorMessage != "sendtxresult" {
-		t.Fatal("SendTransaction unexpected ErrorMessage return")
+	if err := cache.Add(380640, big); err != nil {
+		t.Fatal(err)
 	}
-
-	// sendrawtransactionStub case 2 (error)
-	// but note that the error is send within the response
-	sendresult, err = lwd.SendTransaction(context.Background(), &rawtx)
-	if err != nil {
-		t.Fatal("SendTransaction failed:", err)
+	blockrange := &walletrpc.BlockRange{
+		Start: &walletrpc.BlockID{Height: 380640},
+		End:   &walletrpc.BlockID{Height: 380640},
 	}
-	if sendresult.ErrorCode != -17 {
-		t.Fatal("SendTransaction unexpected ErrorCode return")
+
+	// Without a limit, the block is sent whole.
+	resp := &testgetbrangeRecord{}
+	if err := lwd.GetBlockRange(blockrange, resp); err != nil {
+		t.Fatal("GetBlockRange failed", err)
 	}
-	if sendresult.ErrorMessage != "some error" {
-		t.Fatal("SendTransaction unexpected ErrorMessage return")
+	if len(resp.blocks) != 1 || resp.blocks[0].More || len(resp.blocks[0].Vtx) != 20 {
+		t.Fatal("GetBlockRange without a limit unexpected reply")
 	}
-	step = 0
-}
-
-var sampleconf = `
-testnet = 1
-rpcport = 18232
-rpcbind = 127.0.0.1
-rpcuser = testlightwduser
-rpcpassword = testlightwdpassword
-`
 
-func TestNewZRPCFromConf(t *testing.T) {
-	connCfg, err := connFromConf([]byte(sampleconf))
-	if err != nil {
-		t.Fatal("connFromConf failed")
+	blockrange.MaxMessageSize = 32 * 1024
+	resp = &testgetbrangeRecord{}
+	if err := lwd.GetBlockRange(blockrange, resp); err != nil {
+		t.Fatal("GetBlockRange failed", err)
 	}
-	if connCfg.Host != "127.0.0.1:18232" {
-		t.Fatal("connFromConf returned unexpected Host")
+	if len(resp.blocks) < 2 {
+		t.Fatal("GetBlockRange didn't split the block, messages:", len(resp.blocks))
 	}
-	if connCfg.User != "testlightwduser" {
-		t.Fatal("connFromConf returned unexpected User")
+	var vtx []*walletrpc.CompactTx
+	for i, part := range resp.blocks {
+		if size := proto.Size(part); size > 32*1024 {
+			t.Fatal("message", i, "too large:", size)
+		}
+		if part.Height != 380640 || !bytes.Equal(part.Hash, big.Hash) {
+			t.Fatal("message", i, "unexpected height or hash")
+		}
+		if part.More != (i < len(resp.blocks)-1) {
+			t.Fatal("message", i, "unexpected more flag")
+		}
+		vtx = append(vtx, part.Vtx...)
 	}
-	if connCfg.Pass != "testlightwdpassword" {
-		t.Fatal("connFromConf returned unexpected User")
+	if len(resp.blocks[0].PrevHash) != 32 || resp.blocks[0].Time != 1 {
+		t.Fatal("first message is missing header fields")
 	}
-	if !connCfg.HTTPPostMode {
-		t.Fatal("connFromConf returned unexpected HTTPPostMode")
+	if len(vtx) != 20 {
+		t.Fatal("unexpected number of transactions", len(vtx))
 	}
-	if !connCfg.DisableTLS {
-		t.Fatal("connFromConf returned unexpected DisableTLS")
+	for i, tx := range vtx {
+		if tx.Index != uint64(i) {
+			t.Fatal("transactions out of order")
+		}
 	}
 
-	// can't pass an integer
-	connCfg, err = connFromConf(10)
-	if err == nil {
-		t.Fatal("connFromConf unexpected success")
+	// The cached block must not have been modified.
+	cached := cache.Get(380640)
+	if cached.More || len(cached.Vtx) != 20 {
+		t.Fatal("GetBlockRange modified the cached block")
 	}
+}
 
-	// Can't verify returned values, but at least run it
-	_, err = NewZRPCFromConf([]byte(sampleconf))
-	if err != nil {
-		t.Fatal("NewZRPCFromClient failed")
+type testgetfullbrange struct {
+	walletrpc.CompactTxStreamer_GetFullBlockRangeServer
+	blocks []*walletrpc.FullBlock
+}
+
+func (tg *testgetfullbrange) Context() context.Context {
+	return context.Background()
+}
+
+func (tg *testgetfullbrange) Send(b *walletrpc.FullBlock) error {
+	tg.blocks = append(tg.blocks, b)
+	return nil
+}
+
+func TestRejectDuringIBD(t *testing.T) {
+	testT = t
+	complete := false
+	var calls int
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method != "getblockchaininfo" {
+			testT.Fatal("unexpected method", method)
+		}
+		calls++
+		return json.Marshal(&common.ZcashdRpcReplyGetblockchaininfo{
+			VerificationProgress:         0.5,
+			InitialBlockDownloadComplete: &complete,
+		})
 	}
-	_, err = NewZRPCFromConf(10)
-	if err == nil {
-		t.Fatal("NewZRPCFromClient unexpected success")
+	_, cache := testsetup()
+	fillTestCache(t, cache)
+	blockrange := &walletrpc.BlockRange{
+		Start: &walletrpc.BlockID{Height: 380640},
+		End:   &walletrpc.BlockID{Height: 380643},
 	}
-}
 
-func TestMempoolFilter(t *testing.T) {
-	txidlist := []string{
-		"2e819d0bab5c819dc7d5f92d1bfb4127ce321daf847f6602",
-		"29e594c312eee49bc2c9ad37367ba58f857c4a7387ec9715",
+	// Not enabled (the default), so zcashd isn't asked.
+	server, _ := NewLwdStreamerWithOptions(cache)
+	if _, err := server.GetBlock(context.Background(), &walletrpc.BlockID{Height: 380640}); err != nil {
+		t.Fatal("GetBlock failed", err)
+	}
+	if calls != 0 {
+		t.Fatal("unexpected getblockchaininfo calls", calls)
+	}
+
+	server, _ = NewLwdStreamerWithOptions(cache, WithRejectDuringIBD(true))
+	_, err := server.GetBlock(context.Background(), &walletrpc.BlockID{Height: 380640})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatal("GetBlock during IBD unexpected error", err)
+	}
+	err = server.GetBlockRange(blockrange, &testgetbrange{})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatal("GetBlockRange during IBD unexpected error", err)
+	}
+	// With no ChainInfoCacheTTL (the default), each request asks zcashd.
+	if calls != 2 {
+		t.Fatal("expected two getblockchaininfo calls, got", calls)
+	}
+
+	// Once zcashd has synced, blocks are served.
+	complete = true
+	if _, err := server.GetBlock(context.Background(), &walletrpc.BlockID{Height: 380640}); err != nil {
+		t.Fatal("GetBlock failed", err)
+	}
+	if err := server.GetBlockRange(blockrange, &testgetbrange{}); err != nil {
+		t.Fatal("GetBlockRange failed", err)
+	}
+}
+
+func TestGetBlockRangeInclusive(t *testing.T) {
+	testT = t
+	lwd, cache := testsetup()
+	fillTestCache(t, cache)
+
+	// The cache holds 380640 through 380643 (the tip).
+	for _, tt := range []struct {
+		start, end uint64
+		heights    []uint64
+	}{
+		{380641, 380641, []uint64{380641}},
+		{380643, 380643, []uint64{380643}},
+		{380642, 380643, []uint64{380642, 380643}},
+		{380643, 380642, []uint64{380643, 380642}},
+	} {
+		blockrange := &walletrpc.BlockRange{
+			Start: &walletrpc.BlockID{Height: tt.start},
+			End:   &walletrpc.BlockID{Height: tt.end},
+		}
+		resp := &testgetbrangeRecord{}
+		if err := lwd.GetBlockRange(blockrange, resp); err != nil {
+			t.Fatal("GetBlockRange failed", err)
+		}
+		if len(resp.blocks) != len(tt.heights) {
+			t.Fatal("GetBlockRange", tt.start, tt.end, "unexpected number of blocks", len(resp.blocks))
+		}
+		for i, block := range resp.blocks {
+			if block.Height != tt.heights[i] {
+				t.Fatal("GetBlockRange", tt.start, tt.end, "unexpected height", block.Height)
+			}
+		}
+	}
+}
+
+func TestGetBlockRangeMetadataOnly(t *testing.T) {
+	testT = t
+	lwd, cache := testsetup()
+	output := &walletrpc.CompactOutput{Cmu: make([]byte, 32), Ciphertext: make([]byte, 52)}
+	for i, ntx := range []int{2, 0, 1} {
+		block := &walletrpc.CompactBlock{
+			Height:   uint64(380640 + i),
+			Hash:     bytes.Repeat([]byte{byte(i + 1)}, 32),
+			PrevHash: bytes.Repeat([]byte{byte(i)}, 32),
+			Time:     uint32(1600000000 + i),
+		}
+		for j := 0; j < ntx; j++ {
+			block.Vtx = append(block.Vtx, &walletrpc.CompactTx{
+				Index:   uint64(j),
+				Outputs: []*walletrpc.CompactOutput{output},
+			})
+		}
+		if err := cache.Add(380640+i, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp := &testgetbrangeRecord{}
+	err := lwd.GetBlockRange(&walletrpc.BlockRange{
+		Start:        &walletrpc.BlockID{Height: 380640},
+		End:          &walletrpc.BlockID{Height: 380642},
+		MetadataOnly: true,
+	}, resp)
+	if err != nil {
+		t.Fatal("GetBlockRange failed", err)
+	}
+	if len(resp.blocks) != 3 {
+		t.Fatal("GetBlockRange unexpected number of blocks", len(resp.blocks))
+	}
+	for i, block := range resp.blocks {
+		cached := cache.Get(380640 + i)
+		if block.Height != cached.Height || !bytes.Equal(block.Hash, cached.Hash) ||
+			!bytes.Equal(block.PrevHash, cached.PrevHash) || block.Time != cached.Time {
+			t.Fatal("GetBlockRange unexpected metadata for block", cached.Height, block)
+		}
+		if block.TxCount != uint32(len(cached.Vtx)) {
+			t.Fatal("GetBlockRange unexpected txCount", block.TxCount, "for block", cached.Height)
+		}
+		if len(block.Vtx) != 0 {
+			t.Fatal("GetBlockRange sent transaction data in metadata-only mode")
+		}
+	}
+	if len(cache.Get(380640).Vtx) != 2 {
+		t.Fatal("GetBlockRange changed a cached block")
+	}
+}
+
+type testgetbrangeAcked struct {
+	walletrpc.CompactTxStreamer_GetBlockRangeAckedServer
+	acks   chan *walletrpc.BlockRangeAck
+	blocks chan *walletrpc.CompactBlock
+}
+
+func (tg *testgetbrangeAcked) Context() context.Context {
+	return context.Background()
+}
+
+func (tg *testgetbrangeAcked) Recv() (*walletrpc.BlockRangeAck, error) {
+	ack, ok := <-tg.acks
+	if !ok {
+		return nil, io.EOF
+	}
+	return ack, nil
+}
+
+func (tg *testgetbrangeAcked) Send(cb *walletrpc.CompactBlock) error {
+	tg.blocks <- cb
+	return nil
+}
+
+func TestGetBlockRangeAcked(t *testing.T) {
+	testT = t
+	lwd, cache := testsetup()
+	fillTestCache(t, cache)
+
+	stream := &testgetbrangeAcked{
+		acks:   make(chan *walletrpc.BlockRangeAck, 10),
+		blocks: make(chan *walletrpc.CompactBlock, 10),
+	}
+	stream.acks <- &walletrpc.BlockRangeAck{
+		Range: &walletrpc.BlockRange{
+			Start: &walletrpc.BlockID{Height: 380640},
+			End:   &walletrpc.BlockID{Height: 380643},
+		},
+		Window: 2,
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- lwd.GetBlockRangeAcked(stream)
+	}()
+
+	// expect receives the given blocks, and then nothing more, since the
+	// server is waiting for an acknowledgment.
+	expect := func(heights ...uint64) {
+		for _, height := range heights {
+			select {
+			case block := <-stream.blocks:
+				if block.Height != height {
+					t.Fatal("GetBlockRangeAcked unexpected height", block.Height)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("GetBlockRangeAcked didn't send block", height)
+			}
+		}
+		select {
+		case block := <-stream.blocks:
+			t.Fatal("GetBlockRangeAcked sent beyond the window", block.Height)
+		case err := <-done:
+			t.Fatal("GetBlockRangeAcked returned early", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	expect(380640, 380641)
+	stream.acks <- &walletrpc.BlockRangeAck{Received: 1}
+	expect(380642)
+
+	// Acknowledge everything sent so far; the last block follows.
+	stream.acks <- &walletrpc.BlockRangeAck{Received: 3}
+	select {
+	case block := <-stream.blocks:
+		if block.Height != 380643 {
+			t.Fatal("GetBlockRangeAcked unexpected height", block.Height)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetBlockRangeAcked didn't send the last block")
+	}
+	if err := <-done; err != nil {
+		t.Fatal("GetBlockRangeAcked failed", err)
+	}
+
+	// The client stops acknowledging (closes its side of the stream).
+	stream = &testgetbrangeAcked{
+		acks:   make(chan *walletrpc.BlockRangeAck, 10),
+		blocks: make(chan *walletrpc.CompactBlock, 10),
+	}
+	stream.acks <- &walletrpc.BlockRangeAck{
+		Range: &walletrpc.BlockRange{
+			Start: &walletrpc.BlockID{Height: 380640},
+			End:   &walletrpc.BlockID{Height: 380643},
+		},
+		Window: 1,
+	}
+	close(stream.acks)
+	if err := lwd.GetBlockRangeAcked(stream); status.Code(err) != codes.FailedPrecondition {
+		t.Fatal("GetBlockRangeAcked unexpected error", err)
+	}
+	if len(stream.blocks) != 1 {
+		t.Fatal("GetBlockRangeAcked sent beyond the window", len(stream.blocks))
+	}
+
+	// A window is required.
+	stream.acks = make(chan *walletrpc.BlockRangeAck, 1)
+	stream.acks <- &walletrpc.BlockRangeAck{Range: &walletrpc.BlockRange{}}
+	if err := lwd.GetBlockRangeAcked(stream); status.Code(err) != codes.InvalidArgument {
+		t.Fatal("GetBlockRangeAcked unexpected error", err)
+	}
+}
+
+func TestGetBlockRangeReverse(t *testing.T) {
+	testT = t
+	lwd, cache := testsetup()
+	fillTestCache(t, cache)
+
+	// The cache holds 380640 through 380643 (the tip).
+	for _, tt := range [][2]uint64{{380640, 380643}, {380643, 380640}, {380642, 380642}} {
+		blockrange := &walletrpc.BlockRange{
+			Start: &walletrpc.BlockID{Height: tt[0]},
+			End:   &walletrpc.BlockID{Height: tt[1]},
+		}
+		resp := &testgetbrangeRecord{}
+		if err := lwd.GetBlockRangeReverse(blockrange, resp); err != nil {
+			t.Fatal("GetBlockRangeReverse failed", err)
+		}
+		high := tt[0]
+		if tt[1] > high {
+			high = tt[1]
+		}
+		if len(resp.blocks) == 0 || resp.blocks[0].Height != high {
+			t.Fatal("GetBlockRangeReverse didn't start at the highest block", tt)
+		}
+		for i := 1; i < len(resp.blocks); i++ {
+			if resp.blocks[i].Height != resp.blocks[i-1].Height-1 {
+				t.Fatal("GetBlockRangeReverse unexpected height", resp.blocks[i].Height)
+			}
+		}
+		if len(resp.blocks) != int(high-tt[0]+high-tt[1])+1 {
+			t.Fatal("GetBlockRangeReverse unexpected number of blocks", len(resp.blocks))
+		}
+		if blockrange.Start.Height != tt[0] {
+			t.Fatal("GetBlockRangeReverse modified its argument")
+		}
+	}
+
+	// The start hash still refers to the start height.
+	blockrange := &walletrpc.BlockRange{
+		Start:     &walletrpc.BlockID{Height: 380641},
+		End:       &walletrpc.BlockID{Height: 380643},
+		StartHash: cache.Get(380643).Hash,
+	}
+	err := lwd.GetBlockRangeReverse(blockrange, &testgetbrangeRecord{})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatal("GetBlockRangeReverse unexpected error", err)
+	}
+	blockrange.StartHash = cache.Get(380641).Hash
+	if err := lwd.GetBlockRangeReverse(blockrange, &testgetbrangeRecord{}); err != nil {
+		t.Fatal("GetBlockRangeReverse failed", err)
+	}
+}
+
+type testgetnullifiers struct {
+	walletrpc.CompactTxStreamer_GetBlockNullifiersServer
+	blocks []*walletrpc.BlockNullifiers
+}
+
+func (tg *testgetnullifiers) Context() context.Context {
+	return context.Background()
+}
+
+func (tg *testgetnullifiers) Send(bn *walletrpc.BlockNullifiers) error {
+	tg.blocks = append(tg.blocks, bn)
+	return nil
+}
+
+type testexportblocks struct {
+	walletrpc.CompactTxStreamer_ExportBlocksServer
+	exports []*walletrpc.BlockExport
+}
+
+func (tg *testexportblocks) Context() context.Context {
+	return context.Background()
+}
+
+func (tg *testexportblocks) Send(be *walletrpc.BlockExport) error {
+	tg.exports = append(tg.exports, be)
+	return nil
+}
+
+func TestExportBlocks(t *testing.T) {
+	testT = t
+	lwd, cache := testsetup()
+	fillTestCache(t, cache)
+
+	resp := &testexportblocks{}
+	err := lwd.ExportBlocks(&walletrpc.BlockRange{
+		Start: &walletrpc.BlockID{Height: 380640},
+		End:   &walletrpc.BlockID{Height: 380643},
+		// Ignored; exports are always plain compact blocks.
+		IncludeTransparent: true,
+	}, resp)
+	if err != nil {
+		t.Fatal("ExportBlocks failed:", err)
+	}
+	if len(resp.exports) != 4 {
+		t.Fatal("ExportBlocks unexpected number of blocks", len(resp.exports))
+	}
+	var export bytes.Buffer
+	for i, be := range resp.exports {
+		if be.Height != uint64(380640+i) {
+			t.Fatal("ExportBlocks unexpected height", be.Height)
+		}
+		export.Write(be.Data)
+	}
+
+	// Import into a fresh cache, which then serves the same blocks.
+	importPath := unitTestPath + "-import"
+	os.RemoveAll(importPath)
+	defer os.RemoveAll(importPath)
+	imported := common.NewBlockCache(importPath, unitTestChain, 380640, true)
+	defer imported.Close()
+	n, err := common.ImportBlocks(imported, &export)
+	if err != nil {
+		t.Fatal("ImportBlocks failed:", err)
+	}
+	if n != 4 {
+		t.Fatal("ImportBlocks unexpected number of blocks", n)
+	}
+	importedLwd, err := NewLwdStreamer(imported, "main", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for height := 380640; height <= 380643; height++ {
+		want := cache.Get(height)
+		got, err := importedLwd.GetBlock(context.Background(), &walletrpc.BlockID{Height: uint64(height)})
+		if err != nil {
+			t.Fatal("GetBlock from imported cache failed:", err)
+		}
+		if !proto.Equal(got, want) {
+			t.Fatal("imported block differs at height", height)
+		}
+	}
+
+	// Importing the same blocks again adds nothing.
+	for _, be := range resp.exports {
+		export.Write(be.Data)
+	}
+	if n, err := common.ImportBlocks(imported, &export); err != nil || n != 0 {
+		t.Fatal("ImportBlocks of cached blocks unexpected result", n, err)
+	}
+
+	for _, span := range []*walletrpc.BlockRange{
+		{Start: &walletrpc.BlockID{Height: 380643}, End: &walletrpc.BlockID{Height: 380640}},
+		{Start: &walletrpc.BlockID{Height: 380640}, End: &walletrpc.BlockID{Height: 380640 + defaultMaxExportBlocks}},
+	} {
+		err := lwd.ExportBlocks(span, &testexportblocks{})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatal("ExportBlocks", span.Start.Height, span.End.Height, "unexpected error", err)
+		}
+	}
+}
+
+func TestGetBlockNullifiers(t *testing.T) {
+	testT = t
+	lwd, cache := testsetup()
+	nf := func(b byte) []byte {
+		return bytes.Repeat([]byte{b}, 32)
+	}
+	spends := func(nfs ...[]byte) []*walletrpc.CompactSpend {
+		var s []*walletrpc.CompactSpend
+		for _, n := range nfs {
+			s = append(s, &walletrpc.CompactSpend{Nf: n})
+		}
+		return s
+	}
+	for i, vtx := range [][]*walletrpc.CompactTx{
+		{{Spends: spends(nf(1), nf(2)), Outputs: []*walletrpc.CompactOutput{{Cmu: nf(9)}}}, {}},
+		nil,
+		{{Outputs: []*walletrpc.CompactOutput{{Cmu: nf(9)}}}, {Spends: spends(nf(3))}},
+	} {
+		block := &walletrpc.CompactBlock{Height: uint64(380640 + i), Hash: nf(byte(100 + i)), Vtx: vtx}
+		if err := cache.Add(380640+i, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp := &testgetnullifiers{}
+	err := lwd.GetBlockNullifiers(&walletrpc.BlockRange{
+		Start: &walletrpc.BlockID{Height: 380640},
+		End:   &walletrpc.BlockID{Height: 380642},
+		// Ignored; each block's nullifiers are sent in one message.
+		MaxMessageSize: 1,
+	}, resp)
+	if err != nil {
+		t.Fatal("GetBlockNullifiers failed", err)
+	}
+	want := [][][]byte{{nf(1), nf(2)}, nil, {nf(3)}}
+	if len(resp.blocks) != len(want) {
+		t.Fatal("GetBlockNullifiers unexpected number of blocks", len(resp.blocks))
+	}
+	for i, bn := range resp.blocks {
+		if bn.Height != uint64(380640+i) || !bytes.Equal(bn.Hash, nf(byte(100+i))) {
+			t.Fatal("GetBlockNullifiers unexpected block", bn.Height)
+		}
+		if len(bn.SaplingNullifiers) != len(want[i]) {
+			t.Fatal("GetBlockNullifiers unexpected number of nullifiers at", bn.Height)
+		}
+		for j := range want[i] {
+			if !bytes.Equal(bn.SaplingNullifiers[j], want[i][j]) {
+				t.Fatal("GetBlockNullifiers unexpected nullifier at", bn.Height)
+			}
+		}
+	}
+}
+
+func TestGetBlockRangeStartHash(t *testing.T) {
+	testT = t
+	lwd, cache := testsetup()
+	fillTestCache(t, cache)
+
+	startHash := cache.Get(380641).Hash
+	blockrange := &walletrpc.BlockRange{
+		Start:     &walletrpc.BlockID{Height: 380641},
+		End:       &walletrpc.BlockID{Height: 380643},
+		StartHash: startHash,
+	}
+	resp := &testgetbrangeRecord{}
+	if err := lwd.GetBlockRange(blockrange, resp); err != nil {
+		t.Fatal("GetBlockRange failed", err)
+	}
+	if len(resp.blocks) != 3 {
+		t.Fatal("GetBlockRange unexpected number of blocks", len(resp.blocks))
+	}
+
+	// The client's block at the start height was reorged away.
+	blockrange.StartHash = cache.Get(380640).Hash
+	resp = &testgetbrangeRecord{}
+	err := lwd.GetBlockRange(blockrange, resp)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatal("GetBlockRange unexpected error", err)
+	}
+	if !strings.Contains(err.Error(), parser.InternalToDisplayHex(startHash)) {
+		t.Fatal("GetBlockRange error doesn't give the actual hash:", err)
+	}
+	if len(resp.blocks) != 0 {
+		t.Fatal("GetBlockRange sent blocks after a hash mismatch")
+	}
+}
+
+func TestGetBlockRangeTransparent(t *testing.T) {
+	testT = t
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		var arg string
+		json.Unmarshal(params[0], &arg)
+		height, _ := strconv.Atoi(arg)
+		return blocks[height-380640], nil
+	}
+	lwd, cache := testsetup()
+	fillTestCache(t, cache)
+
+	blockrange := &walletrpc.BlockRange{
+		Start: &walletrpc.BlockID{Height: 380640},
+		End:   &walletrpc.BlockID{Height: 380643},
+	}
+	resp := &testgetbrangeRecord{}
+	if err := lwd.GetBlockRange(blockrange, resp); err != nil {
+		t.Fatal("GetBlockRange failed", err)
+	}
+	for _, block := range resp.blocks {
+		for _, tx := range block.Vtx {
+			if len(tx.Vout) > 0 {
+				t.Fatal("transparent outputs included by default")
+			}
+		}
+	}
+
+	blockrange.IncludeTransparent = true
+	resp = &testgetbrangeRecord{}
+	if err := lwd.GetBlockRange(blockrange, resp); err != nil {
+		t.Fatal("GetBlockRange failed", err)
+	}
+	if len(resp.blocks) != 4 {
+		t.Fatal("GetBlockRange unexpected number of blocks", len(resp.blocks))
+	}
+	for _, block := range resp.blocks {
+		// The coinbase has only transparent outputs.
+		coinbase := block.Vtx[0]
+		if coinbase.Index != 0 || len(coinbase.Vout) == 0 {
+			t.Fatal("coinbase transparent outputs missing at height", block.Height)
+		}
+		for _, out := range coinbase.Vout {
+			if out.Value == 0 || len(out.Script) == 0 {
+				t.Fatal("unexpected transparent output", out)
+			}
+		}
+	}
+}
+
+func TestGetBlockRangeCiphertextPrefix(t *testing.T) {
+	testT = t
+	lwd, _ := testsetup()
+
+	blockrange := &walletrpc.BlockRange{
+		Start:                   &walletrpc.BlockID{Height: 380640},
+		End:                     &walletrpc.BlockID{Height: 380640},
+		SaplingCiphertextPrefix: 581,
+	}
+	err := lwd.GetBlockRange(blockrange, &testgetbrange{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatal("GetBlockRange unexpected error for an overlong prefix", err)
+	}
+}
+
+func TestAddressIndexDisabled(t *testing.T) {
+	testT = t
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		return nil, errors.New("-1: Error: " + method + " is disabled. " +
+			"Run './zcash-cli help " + method + "' for instructions on how to enable this feature.")
+	}
+	lwd, _ := testsetup()
+	const addr = "t1234567890123456789012345678901234"
+	check := func(name string, err error) {
+		if status.Code(err) != codes.FailedPrecondition ||
+			!strings.Contains(err.Error(), "missing addressindex") {
+			t.Fatal(name, "unexpected error", err)
+		}
+	}
+
+	err := lwd.GetTaddressTxids(&walletrpc.TransparentAddressBlockFilter{
+		Address: addr,
+		Range: &walletrpc.BlockRange{
+			Start: &walletrpc.BlockID{Height: 20},
+			End:   &walletrpc.BlockID{Height: 30},
+		},
+	}, &testgettx{})
+	check("GetTaddressTxids", err)
+	_, err = lwd.GetTaddressBalance(context.Background(),
+		&walletrpc.AddressList{Addresses: []string{addr}})
+	check("GetTaddressBalance", err)
+	_, err = lwd.GetAddressUtxos(context.Background(),
+		&walletrpc.GetAddressUtxosArg{Addresses: []string{addr}})
+	check("GetAddressUtxos", err)
+
+	// Older zcashd's message, too.
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		return nil, errors.New("-5: Address index not enabled")
+	}
+	_, err = lwd.GetTaddressBalance(context.Background(),
+		&walletrpc.AddressList{Addresses: []string{addr}})
+	check("GetTaddressBalance", err)
+
+	// Other errors are unchanged.
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		return nil, errors.New("-8: some other error")
+	}
+	_, err = lwd.GetTaddressBalance(context.Background(),
+		&walletrpc.AddressList{Addresses: []string{addr}})
+	if err == nil || err.Error() != "-8: some other error" {
+		t.Fatal("GetTaddressBalance unexpected error", err)
+	}
+}
+
+func TestGetAddressUtxosCoinbase(t *testing.T) {
+	testT = t
+	otherTxid := strings.Repeat("ab", 32)
+	// The coinbase txid of each block, as zcashd has it.
+	coinbaseTxid := func(height int) string {
+		return fmt.Sprintf("%064x", height)
+	}
+	internal := func(txid string) []byte {
+		b, _ := parser.DisplayHexToInternal(txid)
+		return b
+	}
+
+	// Each utxo is otherTxid's or the coinbase's; zcashd fails to find
+	// block 380644.
+	type utxo struct {
+		height   int
+		coinbase bool
+	}
+	var utxos []utxo
+	lookups := make(map[string]int)
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getaddressutxos":
+			var reply []map[string]interface{}
+			for i, u := range utxos {
+				txid := otherTxid
+				if u.coinbase {
+					txid = coinbaseTxid(u.height)
+				}
+				reply = append(reply, map[string]interface{}{
+					"address": "t1234567890123456789012345678901234", "txid": txid,
+					"outputIndex": i, "script": "76a914", "satoshis": 1000, "height": u.height})
+			}
+			return json.Marshal(reply)
+		case "getblock":
+			var height string
+			json.Unmarshal(params[0], &height)
+			lookups[height]++
+			if string(params[1]) != "1" {
+				testT.Fatal("unexpected getblock verbosity", string(params[1]))
+			}
+			if height == "380644" {
+				return nil, errors.New("-8: Block height out of range")
+			}
+			h, _ := strconv.Atoi(height)
+			return json.Marshal(common.ZcashdRpcReplyGetblock{Tx: []string{coinbaseTxid(h), otherTxid}})
+		}
+		testT.Fatal("unexpected method", method)
+		return nil, nil
+	}
+	lwd, cache := testsetup()
+	// 380640's compact block includes its coinbase, 380641's only
+	// otherTxid, and 380642's neither; 380643 isn't cached.
+	for i, vtx := range [][]*walletrpc.CompactTx{
+		{{Index: 0, Hash: internal(coinbaseTxid(380640))}},
+		{{Index: 3, Hash: internal(otherTxid)}},
+		nil,
+	} {
+		if err := cache.Add(380640+i, &walletrpc.CompactBlock{Height: uint64(380640 + i), Vtx: vtx}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	getUtxos := func(maxEntries uint32) (*walletrpc.GetAddressUtxosReplyList, error) {
+		lookups = make(map[string]int)
+		return lwd.GetAddressUtxos(context.Background(), &walletrpc.GetAddressUtxosArg{
+			Addresses:  []string{"t1234567890123456789012345678901234"},
+			MaxEntries: maxEntries,
+		})
+	}
+
+	utxos = []utxo{
+		{380640, true}, {380640, false},
+		{380641, false},
+		{380642, true}, {380642, false},
+		{380643, false}, {380643, true},
+	}
+	reply, err := getUtxos(0)
+	if err != nil {
+		t.Fatal("GetAddressUtxos failed", err)
+	}
+	if len(reply.AddressUtxos) != len(utxos) {
+		t.Fatal("unexpected number of utxos", len(reply.AddressUtxos))
+	}
+	for _, u := range reply.AddressUtxos {
+		want := parser.InternalToDisplayHex(u.Txid) != otherTxid
+		if u.IsCoinbase != want {
+			t.Fatal("utxo at", u.Height, "unexpected IsCoinbase", u.IsCoinbase)
+		}
+	}
+	// The cache answers for 380640 and 380641; zcashd is asked once for
+	// each other height.
+	if len(lookups) != 2 || lookups["380642"] != 1 || lookups["380643"] != 1 {
+		t.Fatal("unexpected block lookups", lookups)
+	}
+
+	// If zcashd can't say, the request fails rather than guess.
+	utxos = []utxo{{380640, true}, {380644, false}}
+	if _, err := getUtxos(0); status.Code(err) != codes.Unavailable {
+		t.Fatal("GetAddressUtxos with a failed lookup unexpected error", err)
+	}
+
+	// Only so many blocks are looked up; beyond that the request fails,
+	// and the client can page.
+	utxos = nil
+	for i := 0; i <= maxCoinbaseLookups; i++ {
+		utxos = append(utxos, utxo{380700 + i, false})
+	}
+	if _, err := getUtxos(0); status.Code(err) != codes.ResourceExhausted {
+		t.Fatal("GetAddressUtxos beyond the lookup limit unexpected error", err)
+	}
+	if len(lookups) != maxCoinbaseLookups {
+		t.Fatal("unexpected number of block lookups", len(lookups))
+	}
+	if reply, err := getUtxos(maxCoinbaseLookups); err != nil || len(reply.AddressUtxos) != maxCoinbaseLookups {
+		t.Fatal("GetAddressUtxos page unexpected result", err)
+	}
+}
+
+type testgetaddressutxosstream struct {
+	walletrpc.CompactTxStreamer_GetAddressUtxosStreamServer
+	utxos []*walletrpc.GetAddressUtxosReply
+}
+
+func (tg *testgetaddressutxosstream) Send(utxo *walletrpc.GetAddressUtxosReply) error {
+	tg.utxos = append(tg.utxos, utxo)
+	return nil
+}
+
+func TestGetAddressUtxosOrder(t *testing.T) {
+	testT = t
+	txidA, txidB := strings.Repeat("0a", 32), strings.Repeat("0b", 32)
+	// In zcashd's (unspecified) order; order is the expected position.
+	utxos := []struct {
+		txid   string
+		index  int
+		height int
+		order  int
+	}{
+		{txidB, 0, 380641, 5},
+		{txidA, 1, 380640, 1},
+		{txidB, 2, 380640, 3},
+		{txidA, 0, 380641, 4},
+		{txidA, 0, 380640, 0},
+		{txidB, 1, 380640, 2},
+	}
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getaddressutxos":
+			var reply []map[string]interface{}
+			for _, u := range utxos {
+				reply = append(reply, map[string]interface{}{
+					"address": "t1234567890123456789012345678901234", "txid": u.txid,
+					"outputIndex": u.index, "script": "76a914", "satoshis": 1000, "height": u.height})
+			}
+			return json.Marshal(reply)
+		case "getblock":
+			return json.Marshal(common.ZcashdRpcReplyGetblock{Tx: []string{strings.Repeat("ee", 32)}})
+		}
+		testT.Fatal("unexpected method", method)
+		return nil, nil
+	}
+	lwd, _ := testsetup()
+
+	expected := make([]int, len(utxos))
+	for i, u := range utxos {
+		expected[u.order] = i
+	}
+	check := func(name string, got []*walletrpc.GetAddressUtxosReply, n int) {
+		if len(got) != n {
+			t.Fatal(name, "unexpected number of utxos", len(got))
+		}
+		for i, utxo := range got {
+			want := utxos[expected[i]]
+			if parser.InternalToDisplayHex(utxo.Txid) != want.txid ||
+				utxo.Index != int32(want.index) || utxo.Height != uint64(want.height) {
+				t.Fatal(name, "utxo", i, "out of order", utxo)
+			}
+		}
+	}
+	for _, maxEntries := range []uint32{0, 4} {
+		arg := &walletrpc.GetAddressUtxosArg{
+			Addresses:  []string{"t1234567890123456789012345678901234"},
+			MaxEntries: maxEntries,
+		}
+		n := len(utxos)
+		if maxEntries > 0 {
+			n = int(maxEntries)
+		}
+		reply, err := lwd.GetAddressUtxos(context.Background(), arg)
+		if err != nil {
+			t.Fatal("GetAddressUtxos failed:", err)
+		}
+		check("GetAddressUtxos", reply.AddressUtxos, n)
+		stream := &testgetaddressutxosstream{}
+		if err := lwd.GetAddressUtxosStream(arg, stream); err != nil {
+			t.Fatal("GetAddressUtxosStream failed:", err)
+		}
+		check("GetAddressUtxosStream", stream.utxos, n)
+	}
+}
+
+func TestGetAddressUtxosMinValue(t *testing.T) {
+	testT = t
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getaddressutxos":
+			var utxos []map[string]interface{}
+			for i, satoshis := range []int{500, 1000, 20, 3000, 999} {
+				utxos = append(utxos, map[string]interface{}{
+					"address": "t1234567890123456789012345678901234", "txid": strings.Repeat("ab", 32),
+					"outputIndex": i, "script": "76a914", "satoshis": satoshis, "height": 380640})
+			}
+			return json.Marshal(utxos)
+		case "getblock":
+			return json.Marshal(common.ZcashdRpcReplyGetblock{Tx: []string{strings.Repeat("ee", 32)}})
+		}
+		testT.Fatal("unexpected method", method)
+		return nil, nil
+	}
+	lwd, _ := testsetup()
+
+	for _, tt := range []struct {
+		minValue   uint64
+		maxEntries uint32
+		indexes    []int32
+	}{
+		{0, 0, []int32{0, 1, 2, 3, 4}},
+		{1000, 0, []int32{1, 3}},
+		{999, 0, []int32{1, 3, 4}},
+		// Dust isn't counted toward the limit.
+		{1000, 1, []int32{1}},
+		{600, 2, []int32{1, 3}},
+	} {
+		reply, err := lwd.GetAddressUtxos(context.Background(), &walletrpc.GetAddressUtxosArg{
+			Addresses:   []string{"t1234567890123456789012345678901234"},
+			MinValueZat: tt.minValue,
+			MaxEntries:  tt.maxEntries,
+		})
+		if err != nil {
+			t.Fatal("GetAddressUtxos failed", err)
+		}
+		if len(reply.AddressUtxos) != len(tt.indexes) {
+			t.Fatal("minimum", tt.minValue, "unexpected number of utxos", len(reply.AddressUtxos))
+		}
+		for i, utxo := range reply.AddressUtxos {
+			if utxo.Index != tt.indexes[i] {
+				t.Fatal("minimum", tt.minValue, "unexpected utxo", utxo.Index)
+			}
+		}
+	}
+}
+
+func TestGetFullBlockRange(t *testing.T) {
+	testT = t
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		var arg string
+		json.Unmarshal(params[0], &arg)
+		height, _ := strconv.Atoi(arg)
+		return blocks[height-380640], nil
+	}
+	lwd, _ := testsetup()
+
+	in := &walletrpc.FullBlockRange{
+		Range: &walletrpc.BlockRange{
+			Start: &walletrpc.BlockID{Height: 380643},
+			End:   &walletrpc.BlockID{Height: 380640},
+		},
+	}
+	resp := &testgetfullbrange{}
+	if err := lwd.GetFullBlockRange(in, resp); err != nil {
+		t.Fatal("GetFullBlockRange failed", err)
+	}
+	if len(resp.blocks) != 4 || resp.blocks[0].Height != 380643 || resp.blocks[0].Hash != nil {
+		t.Fatal("GetFullBlockRange unexpected reply")
+	}
+
+	in.IncludeHash = true
+	in.Range.Start.Height, in.Range.End.Height = 380640, 380643
+	resp = &testgetfullbrange{}
+	if err := lwd.GetFullBlockRange(in, resp); err != nil {
+		t.Fatal("GetFullBlockRange failed", err)
+	}
+	if len(resp.blocks) != 4 {
+		t.Fatal("GetFullBlockRange unexpected number of blocks", len(resp.blocks))
+	}
+	for i, b := range resp.blocks {
+		var blockHex string
+		json.Unmarshal(blocks[i], &blockHex)
+		if b.Height != uint64(380640+i) || hex.EncodeToString(b.Data) != blockHex {
+			t.Fatal("GetFullBlockRange unexpected block at", i)
+		}
+		// The header, with its 1344-byte Equihash solution, is 1487 bytes.
+		header := b.Data[:1487]
+		first := sha256.Sum256(header)
+		hash := sha256.Sum256(first[:])
+		if !bytes.Equal(b.Hash, hash[:]) {
+			t.Fatal("GetFullBlockRange unexpected hash at", i)
+		}
+	}
+}
+
+func TestGetBlockRangeNilArgs(t *testing.T) {
+	lwd, _ := testsetup()
+
+	{
+		noEnd := &walletrpc.BlockRange{
+			Start: &walletrpc.BlockID{Height: 380640},
+			End:   nil,
+		}
+		err := lwd.GetBlockRange(noEnd, &testgetbrange{})
+		if err == nil {
+			t.Fatal("GetBlockRange nil argument should fail")
+		}
+	}
+	{
+		noStart := &walletrpc.BlockRange{
+			Start: nil,
+			End:   &walletrpc.BlockID{Height: 380640},
+		}
+		err := lwd.GetBlockRange(noStart, &testgetbrange{})
+		if err == nil {
+			t.Fatal("GetBlockRange nil argument should fail")
+		}
+	}
+}
+
+func sendrawtransactionStub(method string, params []json.RawMessage) (json.RawMessage, error) {
+	step++
+	if method != "sendrawtransaction" {
+		testT.Fatal("unexpected method")
+	}
+	if string(params[0]) != "\"07\"" {
+		testT.Fatal("unexpected tx data")
+	}
+	switch step {
+	case 1:
+		return []byte("sendtxresult"), nil
+	case 2:
+		return nil, errors.New("-17: some error")
+	}
+	testT.Fatal("unexpected call to sendrawtransactionStub")
+	return nil, nil
+}
+
+func TestSendTransaction(t *testing.T) {
+	testT = t
+	lwd, _ := testsetup()
+	common.RawRequest = sendrawtransactionStub
+	rawtx := walletrpc.RawTransaction{Data: []byte{7}}
+	sendresult, err := lwd.SendTransaction(context.Background(), &rawtx)
+	if err != nil {
+		t.Fatal("SendTransaction failed", err)
+	}
+	if sendresult.ErrorCode != 0 {
+		t.Fatal("SendTransaction unexpected ErrorCode return")
+	}
+	if sendresult.ErrorMessage != "sendtxresult" {
+		t.Fatal("SendTransaction unexpected ErrorMessage return")
+	}
+
+	// sendrawtransactionStub case 2 (error)
+	// but note that the error is send within the response
+	// (forget the successful send, otherwise it's not forwarded again)
+	ResetStreamerState(lwd)
+	sendresult, err = lwd.SendTransaction(context.Background(), &rawtx)
+	if err != nil {
+		t.Fatal("SendTransaction failed:", err)
+	}
+	if sendresult.ErrorCode != -17 {
+		t.Fatal("SendTransaction unexpected ErrorCode return")
+	}
+	if sendresult.ErrorMessage != "some error" {
+		t.Fatal("SendTransaction unexpected ErrorMessage return")
+	}
+	step = 0
+}
+
+func TestSendTransactionDedup(t *testing.T) {
+	testT = t
+	lwd, _ := testsetup()
+	saved := sendDedupWindow
+	defer func() { sendDedupWindow = saved }()
+	calls := 0
+	fail := true
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method != "sendrawtransaction" {
+			testT.Fatal("unexpected method", method)
+		}
+		calls++
+		if fail {
+			return nil, errors.New("-26: some error")
+		}
+		return []byte("sendtxresult"), nil
+	}
+	send := func(data []byte) *walletrpc.SendResponse {
+		sendresult, err := lwd.SendTransaction(context.Background(), &walletrpc.RawTransaction{Data: data})
+		if err != nil {
+			t.Fatal("SendTransaction failed:", err)
+		}
+		return sendresult
+	}
+
+	// A failure isn't remembered.
+	send([]byte{7})
+	fail = false
+	if sendresult := send([]byte{7}); calls != 2 || sendresult.ErrorCode != 0 {
+		t.Fatal("failed SendTransaction not forwarded again, calls:", calls)
+	}
+
+	// A success is, within the window.
+	sendresult := send([]byte{7})
+	if calls != 2 {
+		t.Fatal("successful SendTransaction forwarded again, calls:", calls)
+	}
+	if sendresult.ErrorCode != 0 || sendresult.ErrorMessage != "sendtxresult" {
+		t.Fatal("deduplicated SendTransaction unexpected reply", sendresult)
+	}
+	send([]byte{8})
+	if calls != 3 {
+		t.Fatal("different transaction not forwarded, calls:", calls)
+	}
+
+	sendDedupWindow = 0
+	send([]byte{7})
+	if calls != 4 {
+		t.Fatal("SendTransaction not forwarded after the window, calls:", calls)
+	}
+}
+
+var sampleconf = `
+testnet = 1
+rpcport = 18232
+rpcbind = 127.0.0.1
+rpcuser = testlightwduser
+rpcpassword = testlightwdpassword
+`
+
+func TestNewZRPCFromConf(t *testing.T) {
+	connCfg, err := connFromConf([]byte(sampleconf))
+	if err != nil {
+		t.Fatal("connFromConf failed")
+	}
+	if connCfg.Host != "127.0.0.1:18232" {
+		t.Fatal("connFromConf returned unexpected Host")
+	}
+	if connCfg.User != "testlightwduser" {
+		t.Fatal("connFromConf returned unexpected User")
+	}
+	if connCfg.Pass != "testlightwdpassword" {
+		t.Fatal("connFromConf returned unexpected User")
+	}
+	if !connCfg.HTTPPostMode {
+		t.Fatal("connFromConf returned unexpected HTTPPostMode")
+	}
+	if !connCfg.DisableTLS {
+		t.Fatal("connFromConf returned unexpected DisableTLS")
+	}
+
+	// can't pass an integer
+	connCfg, err = connFromConf(10)
+	if err == nil {
+		t.Fatal("connFromConf unexpected success")
+	}
+
+	// Can't verify returned values, but at least run it
+	_, err = NewZRPCFromConf([]byte(sampleconf))
+	if err != nil {
+		t.Fatal("NewZRPCFromClient failed")
+	}
+	_, err = NewZRPCFromConf(10)
+	if err == nil {
+		t.Fatal("NewZRPCFromClient unexpected success")
+	}
+}
+
+func TestMempoolFilter(t *testing.T) {
+	txidlist := []string{
+		"2e819d0bab5c819dc7d5f92d1bfb4127ce321daf847f6602",
+		"29e594c312eee49bc2c9ad37367ba58f857c4a7387ec9715",
+		"d4d090e60bf9141c6573f0598b84cc1f9817543e55a4d84d",
+		"d4714779c6dd32a72077bd79d4a70cb2153b552d7addec15",
+		"9839c1d4deca000656caff57c1f720f4fbd114b52239edde",
+		"ce5a28854a509ab309faa433542e73414fef6e903a3d52f5",
+	}
+	exclude := []string{
+		"98aa", // common prefix (98) but no match
+		"19",   // no match
+		"29",   // one match (should not appear)
+		"d4",   // 2 matches (both should appear in result)
+		"ce5a28854a509ab309faa433542e73414fef6e903a3d52f5",   // exact match
+		"ce5a28854a509ab309faa433542e73414fef6e903a3d52f500", // extra stuff ignored
+	}
+	expected := []string{
+		"2e819d0bab5c819dc7d5f92d1bfb4127ce321daf847f6602",
+		"9839c1d4deca000656caff57c1f720f4fbd114b52239edde",
+		"d4714779c6dd32a72077bd79d4a70cb2153b552d7addec15",
+		"d4d090e60bf9141c6573f0598b84cc1f9817543e55a4d84d",
+	}
+	actual := MempoolFilter(txidlist, exclude)
+	if len(actual) != len(expected) {
+		t.Fatal("mempool: wrong number of filter results")
+	}
+	for i := 0; i < len(actual); i++ {
+		if actual[i] != expected[i] {
+			t.Fatal(fmt.Sprintf("mempool: expected: %s actual: %s",
+				expected[i], actual[i]))
+		}
+	}
+	// If the exclude list is empty, return the entire mempool.
+	actual = MempoolFilter(txidlist, []string{})
+	expected = []string{
+		"29e594c312eee49bc2c9ad37367ba58f857c4a7387ec9715",
+		"2e819d0bab5c819dc7d5f92d1bfb4127ce321daf847f6602",
+		"9839c1d4deca000656caff57c1f720f4fbd114b52239edde",
+		"ce5a28854a509ab309faa433542e73414fef6e903a3d52f5",
+		"d4714779c6dd32a72077bd79d4a70cb2153b552d7addec15",
+		"d4d090e60bf9141c6573f0598b84cc1f9817543e55a4d84d",
+	}
+	if len(actual) != len(expected) {
+		t.Fatal("mempool: wrong number of filter results")
+	}
+	for i := 0; i < len(actual); i++ {
+		if actual[i] != expected[i] {
+			t.Fatal(fmt.Sprintf("mempool: expected: %s actual: %s",
+				expected[i], actual[i]))
+		}
+	}
+
+}
+
+func TestMempoolFilterStrict(t *testing.T) {
+	txidlist := []string{
+		"2e819d0bab5c819dc7d5f92d1bfb4127ce321daf847f6602",
+		"29e594c312eee49bc2c9ad37367ba58f857c4a7387ec9715",
 		"d4d090e60bf9141c6573f0598b84cc1f9817543e55a4d84d",
 		"d4714779c6dd32a72077bd79d4a70cb2153b552d7addec15",
 		"9839c1d4deca000656caff57c1f720f4fbd114b52239edde",
 		"ce5a28854a509ab309faa433542e73414fef6e903a3d52f5",
 	}
-	exclude := []string{
-		"98aa", // common prefix (98) but no match
-		"19",   // no match
-		"29",   // one match (should not appear)
-		"d4",   // 2 matches (both should appear in result)
-		"ce5a28854a509ab309faa433542e73414fef6e903a3d52f5",   // exact match
-		"ce5a28854a509ab309faa433542e73414fef6e903a3d52f500", // extra stuff ignored
+	exclude := []string{
+		"29",   // prefix only, not excluded in strict mode
+		"d4d0", // prefix only, not excluded in strict mode
+		"ce5a28854a509ab309faa433542e73414fef6e903a3d52f5",   // exact match
+		"ce5a28854a509ab309faa433542e73414fef6e903a3d52f500", // extra stuff, no match
+		"d4714779c6dd32a72077bd79d4a70cb2153b552d7addec15",   // exact match
+	}
+	expected := []string{
+		"29e594c312eee49bc2c9ad37367ba58f857c4a7387ec9715",
+		"2e819d0bab5c819dc7d5f92d1bfb4127ce321daf847f6602",
+		"9839c1d4deca000656caff57c1f720f4fbd114b52239edde",
+		"d4d090e60bf9141c6573f0598b84cc1f9817543e55a4d84d",
+	}
+	actual := MempoolFilterStrict(txidlist, exclude)
+	if len(actual) != len(expected) {
+		t.Fatal("mempool: wrong number of filter results")
+	}
+	for i := 0; i < len(actual); i++ {
+		if actual[i] != expected[i] {
+			t.Fatal(fmt.Sprintf("mempool: expected: %s actual: %s",
+				expected[i], actual[i]))
+		}
+	}
+
+	// The same exclude list in the default (prefix) mode drops the
+	// uniquely-matched "29" prefix and keeps the ambiguous "d4" ones.
+	actual = MempoolFilter(txidlist, []string{"29", "d4"})
+	expected = []string{
+		"2e819d0bab5c819dc7d5f92d1bfb4127ce321daf847f6602",
+		"9839c1d4deca000656caff57c1f720f4fbd114b52239edde",
+		"ce5a28854a509ab309faa433542e73414fef6e903a3d52f5",
+		"d4714779c6dd32a72077bd79d4a70cb2153b552d7addec15",
+		"d4d090e60bf9141c6573f0598b84cc1f9817543e55a4d84d",
+	}
+	if len(actual) != len(expected) {
+		t.Fatal("mempool: wrong number of filter results")
+	}
+	for i := 0; i < len(actual); i++ {
+		if actual[i] != expected[i] {
+			t.Fatal(fmt.Sprintf("mempool: expected: %s actual: %s",
+				expected[i], actual[i]))
+		}
+	}
+}
+
+func getrawmempoolStub(method string, params []json.RawMessage) (json.RawMessage, error) {
+	if method != "getrawmempool" {
+		testT.Fatal("unexpected method", method)
+	}
+	return []byte("[]"), nil
+}
+
+type testgetmempooltx struct {
+	walletrpc.CompactTxStreamer_GetMempoolTxServer
+}
+
+func (tg *testgetmempooltx) Context() context.Context {
+	return context.Background()
+}
+
+func (tg *testgetmempooltx) Send(tx *walletrpc.CompactTx) error {
+	return nil
+}
+
+// syntheticMempoolStub answers getrawmempool with n made-up txids, and
+// getrawtransaction with the test transactions in turn.
+func syntheticMempoolStub(n int) func(method string, params []json.RawMessage) (json.RawMessage, error) {
+	txids := make([]string, n)
+	for i := range txids {
+		txids[i] = fmt.Sprintf("%064x", i+1)
+	}
+	mempoolJSON, _ := json.Marshal(txids)
+	txJSON := make(map[string]json.RawMessage)
+	for i, txid := range txids {
+		txJSON[txid], _ = json.Marshal(hex.EncodeToString(rawTxData[i%len(rawTxData)]))
+	}
+	return func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getrawmempool":
+			return mempoolJSON, nil
+		case "getrawtransaction":
+			var txid string
+			json.Unmarshal(params[0], &txid)
+			return txJSON[txid], nil
+		}
+		testT.Fatal("unexpected method", method)
+		return nil, nil
+	}
+}
+
+func TestRefreshMempoolWorkers(t *testing.T) {
+	testT = t
+	common.RawRequest = syntheticMempoolStub(200)
+	var serial map[string]*walletrpc.CompactTx
+	for _, workers := range []int{1, 8} {
+		st := &streamerState{}
+		if err := st.refreshMempoolTxns(0, workers); err != nil {
+			t.Fatal("refreshMempoolTxns failed:", err)
+		}
+		if len(st.mempoolList) != 200 || len(*st.mempoolMap) != 200 {
+			t.Fatal("unexpected mempool size", len(st.mempoolList), len(*st.mempoolMap))
+		}
+		if serial == nil {
+			serial = *st.mempoolMap
+			continue
+		}
+		for txid, ctx := range *st.mempoolMap {
+			if !proto.Equal(ctx, serial[txid]) {
+				t.Fatal("workers", workers, "compact tx", txid, "differs from the serial result")
+			}
+		}
+	}
+}
+
+// A refresh of a large mempool, none of whose transactions have been seen;
+// run with -cpu N to see how parsing scales with the number of workers.
+func BenchmarkRefreshMempool(b *testing.B) {
+	common.RawRequest = syntheticMempoolStub(5000)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				st := &streamerState{}
+				if err := st.refreshMempoolTxns(0, workers); err != nil {
+					b.Fatal("refreshMempoolTxns failed:", err)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamerStateNotShared(t *testing.T) {
+	testT = t
+	var refreshes int
+	mempool := "[]"
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method == "getrawtransaction" {
+			return json.Marshal(hex.EncodeToString(rawTxData[0]))
+		}
+		refreshes++
+		return []byte(mempool), nil
+	}
+	server1, _ := testsetup()
+	server2, _ := testsetup()
+	lwd1, lwd2 := server1.(*lwdStreamer), server2.(*lwdStreamer)
+
+	mempool = `["` + strings.Repeat("11", 32) + `"]`
+	if err := lwd1.GetMempoolTx(&walletrpc.Exclude{}, &testgetmempooltx{}); err != nil {
+		t.Fatal("GetMempoolTx failed:", err)
+	}
+	// The second streamer must fetch its own copy of the mempool.
+	mempool = "[]"
+	if err := lwd2.GetMempoolTx(&walletrpc.Exclude{}, &testgetmempooltx{}); err != nil {
+		t.Fatal("GetMempoolTx failed:", err)
+	}
+	if refreshes != 2 {
+		t.Fatal("expected a mempool refresh per streamer, got", refreshes)
+	}
+	if len(lwd1.state.mempoolList) != 1 || len(lwd2.state.mempoolList) != 0 {
+		t.Fatal("streamers share mempool state")
+	}
+
+	// Within the refresh interval, only a reset streamer refreshes again.
+	ResetStreamerState(lwd1)
+	if lwd1.state.mempoolList != nil || lwd1.state.mempoolMap != nil {
+		t.Fatal("ResetStreamerState didn't clear the mempool")
+	}
+	for _, lwd := range []*lwdStreamer{lwd1, lwd2} {
+		if err := lwd.GetMempoolTx(&walletrpc.Exclude{}, &testgetmempooltx{}); err != nil {
+			t.Fatal("GetMempoolTx failed:", err)
+		}
+	}
+	if refreshes != 3 {
+		t.Fatal("expected one more mempool refresh, got", refreshes)
+	}
+}
+
+type testgetmempooltxRecord struct {
+	testgetmempooltx
+	txs []*walletrpc.CompactTx
+}
+
+func (tg *testgetmempooltxRecord) Send(tx *walletrpc.CompactTx) error {
+	tg.txs = append(tg.txs, tx)
+	return nil
+}
+
+type testgetmempooltxforaddress struct {
+	walletrpc.CompactTxStreamer_GetMempoolTxForAddressServer
+	txs []*walletrpc.CompactTx
+}
+
+func (tg *testgetmempooltxforaddress) Context() context.Context {
+	return context.Background()
+}
+
+func (tg *testgetmempooltxforaddress) Send(tx *walletrpc.CompactTx) error {
+	tg.txs = append(tg.txs, tx)
+	return nil
+}
+
+func TestGetMempoolTxForAddress(t *testing.T) {
+	testT = t
+	// A transaction with one P2PKH input and two P2PKH outputs, among
+	// others that don't involve its addresses.
+	transparentTx := "0400008085202f8901950521a79e89ed418a4b506f42e9829739b1ca516d4c590bddb4465b4b347bb2000000006a4730440220142920f2a9240c5c64406668c9a16d223bd01db33a773beada7f9c9b930cf02b0220171cbee9232f9c5684eb918db70918e701b86813732871e1bec6fbfb38194f53012102975c020dd223263d2a9bfff2fa6004df4c07db9f01c531967546ef941e2fcfbffeffffff026daf9b00000000001976a91461af073e7679f06677c83aa48f205e4b98feb8d188ac61760356100000001976a91406f6b9a7e1525ee12fd77af9b94a54179785011b88ac4c880b007f880b000000000000000000000000"
+	txidTransparent := strings.Repeat("03", 32)
+	txs := map[string]string{
+		strings.Repeat("01", 32): hex.EncodeToString(rawTxData[0]),
+		strings.Repeat("02", 32): hex.EncodeToString(rawTxData[1]),
+		txidTransparent:          transparentTx,
+	}
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getrawmempool":
+			return json.Marshal([]string{strings.Repeat("01", 32), txidTransparent, strings.Repeat("02", 32)})
+		case "getrawtransaction":
+			var txid string
+			json.Unmarshal(params[0], &txid)
+			return json.Marshal(txs[txid])
+		}
+		testT.Fatal("unexpected method", method)
+		return nil, nil
+	}
+	lwd, _ := testsetup()
+
+	for _, tt := range []struct {
+		address string
+		want    int
+	}{
+		{"t1Sn7E83zEZqGjxF3U96uQ3KjQbFXPwkMpx", 1}, // paid by the first output
+		{"t1QBZeYNH3i5UGvtiEtMuGavZeDRHfYJpGe", 1}, // the input's address
+		{"t1Hsc1LR8yKnbbe3twRp88p6vFfC5t7DLbs", 0}, // unrelated (the zero hash)
+	} {
+		resp := &testgetmempooltxforaddress{}
+		if err := lwd.GetMempoolTxForAddress(&walletrpc.Address{Address: tt.address}, resp); err != nil {
+			t.Fatal("GetMempoolTxForAddress failed:", err)
+		}
+		if len(resp.txs) != tt.want {
+			t.Fatal("GetMempoolTxForAddress", tt.address, "unexpected number of transactions", len(resp.txs))
+		}
+		if tt.want == 0 {
+			continue
+		}
+		tx := resp.txs[0]
+		if parser.InternalToDisplayHex(tx.Hash) != txidTransparent || len(tx.Vout) != 2 || tx.Vout[0].Value != 0x9baf6d {
+			t.Fatal("GetMempoolTxForAddress unexpected transaction", tx)
+		}
+	}
+
+	for _, address := range []string{
+		"t1Sn7E83zEZqGjxF3U96uQ3KjQbFXPwkMpy", // bad checksum
+		"zs1z7rejlpsa98s2rrrfkwmaxu53e4ue0ulcrw0h4x5g8jl04tak0d3mm47vdtahatqrlkngh9sly",
+	} {
+		err := lwd.GetMempoolTxForAddress(&walletrpc.Address{Address: address}, &testgetmempooltxforaddress{})
+		if err == nil {
+			t.Fatal("GetMempoolTxForAddress accepted", address)
+		}
+	}
+}
+
+type testsubscribemempool struct {
+	walletrpc.CompactTxStreamer_SubscribeMempoolServer
+	ctx context.Context
+	txs []*walletrpc.CompactTx
+}
+
+func (tg *testsubscribemempool) Context() context.Context {
+	return tg.ctx
+}
+
+func (tg *testsubscribemempool) Send(tx *walletrpc.CompactTx) error {
+	tg.txs = append(tg.txs, tx)
+	return nil
+}
+
+func TestSubscribeMempool(t *testing.T) {
+	testT = t
+	txidA, txidB := strings.Repeat("0a", 32), strings.Repeat("0b", 32)
+	txs := map[string][]byte{txidA: rawTxData[0], txidB: rawTxData[1]}
+	// What getrawmempool returns each time it's called: B arrives, then A
+	// is evicted, and then comes back.
+	mempools := [][]string{{txidA}, {txidA, txidB}, {txidB}, {txidA, txidB}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getrawmempool":
+			if calls == len(mempools) {
+				// The client has seen enough.
+				cancel()
+				return json.Marshal(mempools[calls-1])
+			}
+			calls++
+			return json.Marshal(mempools[calls-1])
+		case "getrawtransaction":
+			var txid string
+			json.Unmarshal(params[0], &txid)
+			return json.Marshal(hex.EncodeToString(txs[txid]))
+		}
+		testT.Fatal("unexpected method", method)
+		return nil, nil
+	}
+	_, cache := testsetup()
+	lwd, err := NewLwdStreamerWithOptions(cache, WithMempoolInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := &testsubscribemempool{ctx: ctx}
+	if err := lwd.SubscribeMempool(&walletrpc.Empty{}, resp); err != nil {
+		t.Fatal("SubscribeMempool failed:", err)
+	}
+	if calls != len(mempools) {
+		t.Fatal("SubscribeMempool unexpected number of refreshes", calls)
+	}
+	// Each sent once while in the mempool, in the order they appeared; A
+	// was forgotten when it left, so it's sent again when it comes back.
+	if len(resp.txs) != 3 ||
+		parser.InternalToDisplayHex(resp.txs[0].Hash) != txidA ||
+		parser.InternalToDisplayHex(resp.txs[1].Hash) != txidB ||
+		parser.InternalToDisplayHex(resp.txs[2].Hash) != txidA {
+		t.Fatal("SubscribeMempool unexpected transactions", resp.txs)
+	}
+}
+
+func TestGetMempoolTxMaxExclude(t *testing.T) {
+	testT = t
+	calls := 0
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		calls++
+		if method == "getrawtransaction" {
+			return json.Marshal(hex.EncodeToString(rawTxData[0]))
+		}
+		return []byte(`["` + strings.Repeat("11", 32) + `"]`), nil
+	}
+	_, cache := testsetup()
+	lwd, err := NewLwdStreamerWithOptions(cache, WithMaxExclude(2))
+	if err != nil {
+		t.Fatal("NewLwdStreamerWithOptions failed:", err)
+	}
+	exclude := &walletrpc.Exclude{Txid: [][]byte{{0x22}, {0x33}}}
+	if err := lwd.GetMempoolTx(exclude, &testgetmempooltxRecord{}); err != nil {
+		t.Fatal("GetMempoolTx failed:", err)
+	}
+	exclude.Txid = append(exclude.Txid, []byte{0x44})
+	resp := &testgetmempooltxRecord{}
+	// Forget the mempool, so that a refresh would be needed; the request
+	// is rejected before that.
+	ResetStreamerState(lwd)
+	calls = 0
+	err = lwd.GetMempoolTx(exclude, resp)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatal("GetMempoolTx unexpected error with too many excluded txids", err)
+	}
+	if len(resp.txs) != 0 {
+		t.Fatal("GetMempoolTx sent transactions despite the error")
+	}
+	if calls != 0 {
+		t.Fatal("GetMempoolTx asked zcashd before rejecting the request")
+	}
+	if _, err := NewLwdStreamerWithOptions(cache, WithMaxExclude(0)); err == nil {
+		t.Fatal("NewLwdStreamerWithOptions accepted a zero exclude limit")
+	}
+}
+
+func TestGetMempoolTxHeightHint(t *testing.T) {
+	testT = t
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method == "getrawtransaction" {
+			return json.Marshal(hex.EncodeToString(rawTxData[0]))
+		}
+		return []byte(`["` + strings.Repeat("11", 32) + `"]`), nil
+	}
+	plain, cache := testsetup()
+	fillTestCache(t, cache)
+	hinted, err := NewLwdStreamerWithOptions(cache, WithMempoolHeightHint(true))
+	if err != nil {
+		t.Fatal("NewLwdStreamerWithOptions failed:", err)
+	}
+
+	for _, tt := range []struct {
+		lwd    walletrpc.CompactTxStreamerServer
+		height uint64
+	}{
+		{plain, 0},
+		{hinted, 380644}, // the cache's latest block is 380643
+	} {
+		resp := &testgetmempooltxRecord{}
+		if err := tt.lwd.GetMempoolTx(&walletrpc.Exclude{}, resp); err != nil {
+			t.Fatal("GetMempoolTx failed:", err)
+		}
+		if len(resp.txs) != 1 {
+			t.Fatal("GetMempoolTx unexpected number of transactions", len(resp.txs))
+		}
+		if resp.txs[0].Height != tt.height {
+			t.Fatal("GetMempoolTx unexpected height", resp.txs[0].Height, "expected", tt.height)
+		}
+	}
+	// The remembered transaction isn't changed.
+	for _, tx := range *hinted.(*lwdStreamer).state.mempoolMap {
+		if tx.Height != 0 {
+			t.Fatal("GetMempoolTx changed the remembered transaction")
+		}
+	}
+}
+
+func TestGetMempoolTxStrictExclude(t *testing.T) {
+	testT = t
+	common.RawRequest = getrawmempoolStub
+	lwd, _ := testsetup()
+
+	// A shortened txid is fine in the default (prefix) mode...
+	exclude := &walletrpc.Exclude{Txid: [][]byte{{0x12, 0x34}}}
+	if err := lwd.GetMempoolTx(exclude, &testgetmempooltx{}); err != nil {
+		t.Fatal("GetMempoolTx failed:", err)
+	}
+	// ... but rejected in strict mode.
+	exclude.Strict = true
+	err := lwd.GetMempoolTx(exclude, &testgetmempooltx{})
+	if status.Code(err) != codes.InvalidArgument ||
+		!strings.Contains(err.Error(), "strict exclude requires full 32-byte txids") {
+		t.Fatal("GetMempoolTx strict unexpected error:", err)
+	}
+	exclude.Txid = [][]byte{make([]byte, 32)}
+	if err := lwd.GetMempoolTx(exclude, &testgetmempooltx{}); err != nil {
+		t.Fatal("GetMempoolTx strict failed:", err)
+	}
+}
+
+func TestGetMempoolTxConcurrentRefresh(t *testing.T) {
+	testT = t
+	var refreshes int32
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method != "getrawmempool" {
+			return nil, errors.New("unexpected method " + method)
+		}
+		atomic.AddInt32(&refreshes, 1)
+		// Give the other callers time to pile up behind this refresh.
+		time.Sleep(50 * time.Millisecond)
+		return []byte("[]"), nil
+	}
+	lwd, _ := testsetup()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := lwd.GetMempoolTx(&walletrpc.Exclude{}, &testgetmempooltx{})
+			if err != nil {
+				t.Error("GetMempoolTx failed:", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if refreshes != 1 {
+		t.Fatal("expected a single mempool refresh, got", refreshes)
+	}
+}
+
+func TestGetMempoolTxConcurrentChanges(t *testing.T) {
+	testT = t
+	// The mempool alternates between one and two transactions, so that
+	// concurrent callers (run with -race) replace the remembered mempool
+	// while others read it.
+	txidA, txidB := strings.Repeat("0a", 32), strings.Repeat("0b", 32)
+	txs := map[string][]byte{txidA: rawTxData[0], txidB: rawTxData[1]}
+	var refreshes int32
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getrawmempool":
+			if atomic.AddInt32(&refreshes, 1)%2 == 0 {
+				return json.Marshal([]string{txidA})
+			}
+			return json.Marshal([]string{txidA, txidB})
+		case "getrawtransaction":
+			var txid string
+			json.Unmarshal(params[0], &txid)
+			return json.Marshal(hex.EncodeToString(txs[txid]))
+		}
+		return nil, errors.New("unexpected method " + method)
+	}
+	_, cache := testsetup()
+	fillTestCache(t, cache)
+	lwd, err := NewLwdStreamerWithOptions(cache, WithMempoolInterval(0), WithMempoolHeightHint(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				resp := &testgetmempooltxRecord{}
+				if err := lwd.GetMempoolTx(&walletrpc.Exclude{}, resp); err != nil {
+					t.Error("GetMempoolTx failed:", err)
+					return
+				}
+				if len(resp.txs) != 1 && len(resp.txs) != 2 {
+					t.Error("GetMempoolTx unexpected number of transactions", len(resp.txs))
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if refreshes < 2 {
+		t.Fatal("expected repeated mempool refreshes, got", refreshes)
+	}
+}
+
+// fillTestCache adds the four test blocks (starting at 380640) to the cache.
+func TestGetLightdInfoCacheRange(t *testing.T) {
+	testT = t
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getinfo":
+			return json.Marshal(&common.ZcashdRpcReplyGetinfo{})
+		case "getblockchaininfo":
+			return json.Marshal(&common.ZcashdRpcReplyGetblockchaininfo{Blocks: 380643})
+		}
+		testT.Fatal("unexpected method", method)
+		return nil, nil
+	}
+	lwd, cache := testsetup()
+
+	info, err := lwd.GetLightdInfo(context.Background(), &walletrpc.Empty{})
+	if err != nil {
+		t.Fatal("GetLightdInfo failed:", err)
+	}
+	if info.CacheFirstHeight != 0 || info.CacheLastHeight != 0 {
+		t.Fatal("unexpected cache range for an empty cache", info.CacheFirstHeight, info.CacheLastHeight)
+	}
+
+	fillTestCache(t, cache)
+	info, err = lwd.GetLightdInfo(context.Background(), &walletrpc.Empty{})
+	if err != nil {
+		t.Fatal("GetLightdInfo failed:", err)
+	}
+	if info.CacheFirstHeight != 380640 || info.CacheLastHeight != 380643 {
+		t.Fatal("unexpected cache range", info.CacheFirstHeight, info.CacheLastHeight)
+	}
+}
+
+func TestGetServerHealth(t *testing.T) {
+	testT = t
+	var calls int
+	var tip int
+	var ibd, down bool
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method != "getblockchaininfo" {
+			testT.Fatal("unexpected method", method)
+		}
+		calls++
+		if down {
+			return nil, errors.New("connection refused")
+		}
+		complete := !ibd
+		return json.Marshal(&common.ZcashdRpcReplyGetblockchaininfo{
+			Blocks:                       tip,
+			InitialBlockDownloadComplete: &complete,
+		})
+	}
+	_, cache := testsetup()
+	fillTestCache(t, cache) // up to 380643
+	health := func(lwd walletrpc.CompactTxStreamerServer) (*walletrpc.ServerHealth, error) {
+		return lwd.(*lwdStreamer).GetServerHealth(context.Background(), &walletrpc.Empty{})
+	}
+	// Another caller's recent reply is relied on.
+	lwd, err := NewLwdStreamerWithOptions(cache, WithHealthMaxAge(time.Hour), WithHealthMaxLag(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prime := func() {
+		if _, err := common.GetBlockchainInfo(); err != nil {
+			t.Fatal("GetBlockchainInfo failed:", err)
+		}
+	}
+	tip = 380645
+	prime()
+	calls = 0
+	reply, err := health(lwd)
+	if err != nil {
+		t.Fatal("GetServerHealth failed:", err)
+	}
+	if reply.ZcashdHeight != 380645 || reply.CacheHeight != 380643 || calls != 0 {
+		t.Fatal("GetServerHealth unexpected reply", reply, "calls", calls)
+	}
+	// The cache is too far behind.
+	tip = 380646
+	prime()
+	if _, err := health(lwd); status.Code(err) != codes.Unavailable {
+		t.Fatal("GetServerHealth lagging unexpected error", err)
+	}
+	tip = 380643
+	ibd = true
+	prime()
+	if _, err := health(lwd); status.Code(err) != codes.Unavailable {
+		t.Fatal("GetServerHealth in IBD unexpected error", err)
+	}
+	ibd = false
+
+	// Once the reply is old, it asks zcashd, but only once per maximum age,
+	// failing meanwhile if zcashd did.
+	lwd, err = NewLwdStreamerWithOptions(cache, WithHealthMaxAge(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	down = true
+	calls = 0
+	for i := 0; i < 3; i++ {
+		if _, err := health(lwd); status.Code(err) != codes.Unavailable {
+			t.Fatal("GetServerHealth with zcashd down unexpected error", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatal("GetServerHealth unexpected number of zcashd calls", calls)
+	}
+	down = false
+	if _, err := health(lwd); status.Code(err) != codes.Unavailable {
+		t.Fatal("GetServerHealth didn't wait to ask zcashd again", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := health(lwd); err != nil {
+		t.Fatal("GetServerHealth failed after zcashd recovered:", err)
+	}
+	if calls != 2 {
+		t.Fatal("GetServerHealth unexpected number of zcashd calls", calls)
+	}
+
+	if _, err := NewLwdStreamerWithOptions(cache, WithHealthMaxLag(-1)); err == nil {
+		t.Fatal("NewLwdStreamerWithOptions accepted a negative health lag")
+	}
+}
+
+func TestGetLightdInfoPingEnabled(t *testing.T) {
+	testT = t
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		switch method {
+		case "getinfo":
+			return json.Marshal(&common.ZcashdRpcReplyGetinfo{})
+		case "getblockchaininfo":
+			return json.Marshal(&common.ZcashdRpcReplyGetblockchaininfo{Blocks: 380643})
+		}
+		testT.Fatal("unexpected method", method)
+		return nil, nil
+	}
+	_, cache := testsetup()
+
+	for _, enable := range []bool{false, true} {
+		lwd, err := NewLwdStreamer(cache, "main", enable)
+		if err != nil {
+			t.Fatal("NewLwdStreamer failed:", err)
+		}
+		info, err := lwd.GetLightdInfo(context.Background(), &walletrpc.Empty{})
+		if err != nil {
+			t.Fatal("GetLightdInfo failed:", err)
+		}
+		if info.PingEnabled != enable {
+			t.Fatal("GetLightdInfo unexpected pingEnabled", info.PingEnabled, "expected", enable)
+		}
+	}
+}
+
+func fillTestCache(t *testing.T, cache *common.BlockCache) {
+	for i, blockJSON := range blocks {
+		var blockHex string
+		if err := json.Unmarshal(blockJSON, &blockHex); err != nil {
+			t.Fatal(err)
+		}
+		blockBytes, err := hex.DecodeString(blockHex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := parser.NewBlock()
+		if _, err := block.ParseFromSlice(blockBytes); err != nil {
+			t.Fatal(err)
+		}
+		if err := cache.Add(380640+i, block.ToCompact()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// gettreestateStub replies with a tree state for the requested height, or
+// for 380640 if the block is specified by hash.
+func gettreestateStub(method string, params []json.RawMessage) (json.RawMessage, error) {
+	if method != "z_gettreestate" {
+		testT.Fatal("unexpected method", method)
+	}
+	step++
+	var arg string
+	json.Unmarshal(params[0], &arg)
+	height, err := strconv.Atoi(arg)
+	if err != nil {
+		height = 380640
+	}
+	return []byte(fmt.Sprintf(`{"height": %d, "hash": "%064x", "time": 1,
+		"sapling": {"commitments": {"finalState": "01"}}}`, height, height)), nil
+}
+
+func TestGetTreeStateEmpty(t *testing.T) {
+	testT = t
+	lwd, _ := testsetup()
+
+	// Each reply's skipHash leads to the previous block, whose tree state
+	// is also empty, until the given height is reached.
+	stopAt := 0
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method != "z_gettreestate" {
+			testT.Fatal("unexpected method", method)
+		}
+		var arg string
+		json.Unmarshal(params[0], &arg)
+		height, err := strconv.Atoi(arg)
+		if err != nil {
+			// a skipHash, which is the height in hex
+			h, _ := strconv.ParseInt(arg, 16, 64)
+			height = int(h)
+		}
+		skipHash := ""
+		if height > stopAt {
+			skipHash = fmt.Sprintf("%064x", height-1)
+		}
+		return []byte(fmt.Sprintf(`{"height": %d, "hash": "%064x", "time": 1,
+			"sapling": {"skipHash": "%s", "commitments": {"finalState": ""}}}`,
+			height, height, skipHash)), nil
+	}
+
+	// Empty back to before Sapling activation (the cache's first height).
+	stopAt = 380639
+	_, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 380641})
+	if status.Code(err) != codes.OutOfRange {
+		t.Fatal("GetTreeState before activation unexpected error", err)
+	}
+
+	// Empty at a height where there should be a tree state.
+	stopAt = 380640
+	_, err = lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 380641})
+	if status.Code(err) != codes.Internal {
+		t.Fatal("GetTreeState backend failure unexpected error", err)
+	}
+}
+
+func TestGetTreeStateOrchard(t *testing.T) {
+	testT = t
+	lwd, _ := testsetup()
+
+	// By z_gettreestate argument: 380641's Sapling skip hash leads to 380640,
+	// and its Orchard skip hash, by way of another block, to "0a"'s state.
+	replies := map[string]string{
+		"380641": `"sapling": {"skipHash": "` + fmt.Sprintf("%064x", 380640) + `", "commitments": {"finalState": ""}},
+			"orchard": {"skipHash": "` + fmt.Sprintf("%064x", 0x0b) + `", "commitments": {"finalState": ""}}`,
+		fmt.Sprintf("%064x", 380640): `"sapling": {"commitments": {"finalState": "01"}},
+			"orchard": {"commitments": {"finalState": "ff"}}`,
+		fmt.Sprintf("%064x", 0x0b): `"sapling": {"commitments": {"finalState": ""}},
+			"orchard": {"skipHash": "` + fmt.Sprintf("%064x", 0x0a) + `", "commitments": {"finalState": ""}}`,
+		fmt.Sprintf("%064x", 0x0a): `"sapling": {"commitments": {"finalState": ""}},
+			"orchard": {"commitments": {"finalState": "02"}}`,
+		// before Orchard activation
+		"380642": `"sapling": {"commitments": {"finalState": "01"}}`,
+		"380643": `"sapling": {"commitments": {"finalState": "01"}},
+			"orchard": {"commitments": {"finalState": "03"}}`,
+	}
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method != "z_gettreestate" {
+			testT.Fatal("unexpected method", method)
+		}
+		var arg string
+		json.Unmarshal(params[0], &arg)
+		reply, ok := replies[arg]
+		if !ok {
+			testT.Fatal("unexpected z_gettreestate argument", arg)
+		}
+		return []byte(`{"height": 380640, "hash": "` + fmt.Sprintf("%064x", 380640) + `", "time": 1, ` + reply + `}`), nil
 	}
-	expected := []string{
-		"2e819d0bab5c819dc7d5f92d1bfb4127ce321daf847f6602",
-		"9839c1d4deca000656caff57c1f720f4fbd114b52239edde",
-		"d4714779c6dd32a72077bd79d4a70cb2153b552d7addec15",
-		"d4d090e60bf9141c6573f0598b84cc1f9817543e55a4d84d",
+	for _, tt := range []struct {
+		height      uint64
+		tree        string
+		orchardTree string
+	}{
+		{380641, "01", "02"},
+		{380642, "01", ""},
+		{380643, "01", "03"},
+	} {
+		treeState, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: tt.height})
+		if err != nil {
+			t.Fatal("GetTreeState failed:", err)
+		}
+		if treeState.Tree != tt.tree || treeState.OrchardTree != tt.orchardTree {
+			t.Fatal("GetTreeState", tt.height, "unexpected trees", treeState.Tree, treeState.OrchardTree)
+		}
 	}
-	actual := MempoolFilter(txidlist, exclude)
-	if len(actual) != len(expected) {
-		t.Fatal("mempool: wrong number of filter results")
+}
+
+func TestGetTreeStateSkipHashCache(t *testing.T) {
+	testT = t
+	lwd, cache := testsetup()
+	fillTestCache(t, cache)
+	saved := treeStateCacheDepth
+	defer func() { treeStateCacheDepth = saved }()
+	treeStateCacheDepth = 0
+
+	// 380642's Sapling skip hash leads to 380641, but their Orchard trees
+	// differ.
+	hash := func(height int) string { return fmt.Sprintf("%064x", height) }
+	replies := map[string]string{
+		"380642": `"height": 380642, "hash": "` + hash(380642) + `", "time": 2,
+			"sapling": {"skipHash": "` + hash(380641) + `", "commitments": {"finalState": ""}},
+			"orchard": {"commitments": {"finalState": "bb"}}`,
+		hash(380641): `"height": 380641, "hash": "` + hash(380641) + `", "time": 1,
+			"sapling": {"commitments": {"finalState": "01"}},
+			"orchard": {"commitments": {"finalState": "aa"}}`,
 	}
-	for i := 0; i < len(actual); i++ {
-		if actual[i] != expected[i] {
-			t.Fatal(fmt.Sprintf("mempool: expected: %s actual: %s",
-				expected[i], actual[i]))
+	replies["380641"] = replies[hash(380641)]
+	calls := 0
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method != "z_gettreestate" {
+			testT.Fatal("unexpected method", method)
 		}
+		calls++
+		var arg string
+		json.Unmarshal(params[0], &arg)
+		reply, ok := replies[arg]
+		if !ok {
+			testT.Fatal("unexpected z_gettreestate argument", arg)
+		}
+		return []byte(`{` + reply + `}`), nil
 	}
-	// If the exclude list is empty, return the entire mempool.
-	actual = MempoolFilter(txidlist, []string{})
-	expected = []string{
-		"29e594c312eee49bc2c9ad37367ba58f857c4a7387ec9715",
-		"2e819d0bab5c819dc7d5f92d1bfb4127ce321daf847f6602",
-		"9839c1d4deca000656caff57c1f720f4fbd114b52239edde",
-		"ce5a28854a509ab309faa433542e73414fef6e903a3d52f5",
-		"d4714779c6dd32a72077bd79d4a70cb2153b552d7addec15",
-		"d4d090e60bf9141c6573f0598b84cc1f9817543e55a4d84d",
+	for _, tt := range []struct {
+		height      uint64
+		time        uint32
+		orchardTree string
+		calls       int
+	}{
+		{380642, 2, "bb", 2},
+		// Not the cached reply for 380642.
+		{380641, 1, "aa", 3},
+		// Both now come from the cache.
+		{380642, 2, "bb", 3},
+		{380641, 1, "aa", 3},
+	} {
+		treeState, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: tt.height})
+		if err != nil {
+			t.Fatal("GetTreeState failed:", err)
+		}
+		if treeState.Height != tt.height || treeState.Hash != hash(int(tt.height)) ||
+			treeState.Time != tt.time || treeState.Tree != "01" || treeState.OrchardTree != tt.orchardTree {
+			t.Fatal("GetTreeState", tt.height, "unexpected tree state", treeState)
+		}
+		if calls != tt.calls {
+			t.Fatal("GetTreeState", tt.height, "unexpected number of z_gettreestate calls", calls)
+		}
 	}
-	if len(actual) != len(expected) {
-		t.Fatal("mempool: wrong number of filter results")
+}
+
+func TestGetTreeStateCache(t *testing.T) {
+	testT = t
+	common.RawRequest = gettreestateStub
+	step = 0
+	defer func() { step = 0 }()
+	lwd, cache := testsetup()
+	fillTestCache(t, cache)
+	saved := treeStateCacheDepth
+	defer func() { treeStateCacheDepth = saved }()
+	treeStateCacheDepth = 2
+
+	// A confirmed block is fetched once, then served from the cache,
+	// by height or by hash.
+	for i := 0; i < 2; i++ {
+		treeState, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 380640})
+		if err != nil {
+			t.Fatal("GetTreeState failed:", err)
+		}
+		if treeState.Height != 380640 || treeState.Tree != "01" {
+			t.Fatal("GetTreeState unexpected reply", treeState)
+		}
 	}
-	for i := 0; i < len(actual); i++ {
-		if actual[i] != expected[i] {
-			t.Fatal(fmt.Sprintf("mempool: expected: %s actual: %s",
-				expected[i], actual[i]))
+	hash, _ := hex.DecodeString(fmt.Sprintf("%064x", 380640))
+	if _, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Hash: hash}); err != nil {
+		t.Fatal("GetTreeState by hash failed:", err)
+	}
+	if step != 1 {
+		t.Fatal("expected a single z_gettreestate call, got", step)
+	}
+
+	// The tip isn't cached.
+	for i := 0; i < 2; i++ {
+		if _, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 380643}); err != nil {
+			t.Fatal("GetTreeState failed:", err)
+		}
+	}
+	if step != 3 {
+		t.Fatal("expected tip tree state not to be cached, calls:", step)
+	}
+}
+
+func TestGetBlockCoinbase(t *testing.T) {
+	testT = t
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method != "getblock" {
+			testT.Fatal("unexpected method", method)
+		}
+		// Always the first test block, at height 380640.
+		return blocks[0], nil
+	}
+	lwd, _ := testsetup()
+
+	info, err := lwd.GetBlockCoinbase(context.Background(), &walletrpc.BlockID{Height: 380640})
+	if err != nil {
+		t.Fatal("GetBlockCoinbase failed:", err)
+	}
+	if info.Height != 380640 || hex.EncodeToString(info.ScriptSig) != "03e0ce0500" {
+		t.Fatal("GetBlockCoinbase unexpected height", info.Height, hex.EncodeToString(info.ScriptSig))
+	}
+	want := []struct {
+		value  uint64
+		script string
+	}{
+		{1000000000, "76a914361683f47d7dfc6a8d17f8f7b9413ff1a27ec62988ac"},
+		{250000000, "a91414c884180589f6d0fdc7c400181afb1bb10c9fe487"}, // founders' reward
+	}
+	if len(info.Outputs) != len(want) {
+		t.Fatal("GetBlockCoinbase unexpected number of outputs", len(info.Outputs))
+	}
+	for i, out := range info.Outputs {
+		if out.Index != uint32(i) || out.Value != want[i].value || hex.EncodeToString(out.Script) != want[i].script {
+			t.Fatal("GetBlockCoinbase unexpected output", i, out)
+		}
+	}
+
+	// zcashd's block doesn't match the height asked for.
+	if _, err := lwd.GetBlockCoinbase(context.Background(), &walletrpc.BlockID{Height: 380641}); err == nil {
+		t.Fatal("GetBlockCoinbase accepted a block at the wrong height")
+	}
+	_, err = lwd.GetBlockCoinbase(context.Background(), &walletrpc.BlockID{Hash: make([]byte, 32)})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatal("GetBlockCoinbase by hash unexpected error", err)
+	}
+}
+
+func TestGetBlockWithAnchors(t *testing.T) {
+	testT = t
+	lwd, cache := testsetup()
+	fillTestCache(t, cache)
+	heights := make(map[string]int)
+	for height := 380640; height <= 380643; height++ {
+		block := cache.Get(height)
+		if block == nil {
+			t.Fatal("cache.Get failed at height", height)
+		}
+		heights[hex.EncodeToString(parser.Reverse(block.Hash))] = height
+	}
+	// The anchors depend on the block, which may be given by height or hash.
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method != "z_gettreestate" {
+			testT.Fatal("unexpected method", method)
+		}
+		var arg string
+		json.Unmarshal(params[0], &arg)
+		height, err := strconv.Atoi(arg)
+		if err != nil {
+			var ok bool
+			if height, ok = heights[arg]; !ok {
+				return nil, errors.New("-8: block not found")
+			}
+		}
+		return []byte(fmt.Sprintf(`{"height": %d, "hash": "%064x", "time": 1,
+			"sapling": {"commitments": {"finalRoot": "%064x", "finalState": "01"}},
+			"orchard": {"commitments": {"finalRoot": "%064x"}}}`,
+			height, height, height+1, height+2)), nil
+	}
+
+	reply, err := lwd.GetBlockWithAnchors(context.Background(), &walletrpc.BlockID{Height: 380641})
+	if err != nil {
+		t.Fatal("GetBlockWithAnchors failed:", err)
+	}
+	if reply.Block.Height != 380641 {
+		t.Fatal("GetBlockWithAnchors unexpected block height", reply.Block.Height)
+	}
+	treeState, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 380641})
+	if err != nil {
+		t.Fatal("GetTreeState failed:", err)
+	}
+	if reply.SaplingAnchor == "" || reply.SaplingAnchor != treeState.SaplingAnchor {
+		t.Fatal("sapling anchor", reply.SaplingAnchor, "doesn't match tree state", treeState.SaplingAnchor)
+	}
+	if reply.OrchardAnchor == "" || reply.OrchardAnchor != treeState.OrchardAnchor {
+		t.Fatal("orchard anchor", reply.OrchardAnchor, "doesn't match tree state", treeState.OrchardAnchor)
+	}
+}
+
+func TestSaplingActivationBoundary(t *testing.T) {
+	testT = t
+	common.RawRequest = gettreestateStub
+	defer func() { step = 0 }()
+	lwd, cache := testsetup()
+	fillTestCache(t, cache)
+
+	// Sapling activates at 380640 (the cache's first height).
+	below := &walletrpc.BlockRange{
+		Start: &walletrpc.BlockID{Height: 380639},
+		End:   &walletrpc.BlockID{Height: 380640},
+	}
+	err := lwd.GetBlockRange(below, &testgetbrange{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatal("GetBlockRange below Sapling activation unexpected error", err)
+	}
+	below = &walletrpc.BlockRange{
+		Start: &walletrpc.BlockID{Height: 380641},
+		End:   &walletrpc.BlockID{Height: 380639},
+	}
+	err = lwd.GetBlockRange(below, &testgetbrange{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatal("GetBlockRange below Sapling activation unexpected error", err)
+	}
+	_, err = lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 380639})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatal("GetTreeState below Sapling activation unexpected error", err)
+	}
+
+	at := &walletrpc.BlockRange{
+		Start: &walletrpc.BlockID{Height: 380640},
+		End:   &walletrpc.BlockID{Height: 380641},
+	}
+	if err := lwd.GetBlockRange(at, &testgetbrange{}); err != nil {
+		t.Fatal("GetBlockRange at Sapling activation failed", err)
+	}
+	if _, err := lwd.GetTreeState(context.Background(), &walletrpc.BlockID{Height: 380640}); err != nil {
+		t.Fatal("GetTreeState at Sapling activation failed", err)
+	}
+}
+
+func TestLatencyCacheRecord(t *testing.T) {
+	c := newLatencyCache(1, 2, 30*time.Second)
+	now := time.Now().UnixNano()
+	if prev, ok := c.record("1.1.1.1", 100, 199, now); prev != nil || !ok {
+		t.Fatal("unexpected previous entry", prev, ok)
+	}
+	prev, ok := c.record("1.1.1.1", 200, 299, now+1)
+	if !ok || prev == nil || prev.lastBlock != 199 || prev.totalBlocks != 100 || prev.timeNanos != now {
+		t.Fatal("unexpected previous entry", prev, ok)
+	}
+
+	// The cache is capped; a third peer isn't tracked.
+	c.record("2.2.2.2", 100, 199, now)
+	c.record("3.3.3.3", 100, 199, now)
+	if _, ok := c.shards[0].entries["3.3.3.3"]; ok {
+		t.Fatal("latency cache exceeded its maximum size")
+	}
+
+	// Expired entries are ignored even if not yet swept.
+	if prev, _ := c.record("1.1.1.1", 300, 399, now+int64(30*time.Second)+2); prev != nil {
+		t.Fatal("stale entry was returned", prev)
+	}
+
+	// A busy shard is skipped, not waited for.
+	c.shards[0].busy = 1
+	if _, ok := c.record("1.1.1.1", 400, 499, now); ok {
+		t.Fatal("record should have skipped a busy shard")
+	}
+}
+
+func TestLatencyCacheSweeper(t *testing.T) {
+	retention := 50 * time.Millisecond
+	c := newLatencyCache(latencyCacheShards, latencyCacheMaxEntries, retention)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.sweeper(10*time.Millisecond, stop)
+		close(done)
+	}()
+	c.record("1.1.1.1", 100, 199, time.Now().UnixNano())
+	c.record("2.2.2.2", 100, 199, time.Now().UnixNano()+int64(time.Hour))
+	time.Sleep(retention + 50*time.Millisecond)
+	close(stop)
+	<-done
+
+	if _, ok := c.shard("1.1.1.1").entries["1.1.1.1"]; ok {
+		t.Fatal("sweeper did not evict the expired entry")
+	}
+	if _, ok := c.shard("2.2.2.2").entries["2.2.2.2"]; !ok {
+		t.Fatal("sweeper evicted an entry within the retention window")
+	}
+}
+
+// Run with -race -cpu N to compare contention with and without sharding.
+func BenchmarkLatencyCacheRecord(b *testing.B) {
+	for _, shards := range []int{1, latencyCacheShards} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			c := newLatencyCache(shards, latencyCacheMaxEntries, defaultLatencyCacheRetention)
+			var peers, dropped uint32
+			b.RunParallel(func(pb *testing.PB) {
+				ip := fmt.Sprintf("10.0.0.%d", atomic.AddUint32(&peers, 1))
+				height := uint64(0)
+				for pb.Next() {
+					if _, ok := c.record(ip, height, height+99, time.Now().UnixNano()); !ok {
+						atomic.AddUint32(&dropped, 1)
+					}
+					height += 100
+				}
+			})
+			b.Logf("%d of %d records dropped", dropped, b.N)
+		})
+	}
+}
+
+func TestForEachKeyBlock(t *testing.T) {
+	for _, tt := range [][2]uint64{
+		{0, 0}, {1, 1151}, {1, 1152}, {1152, 1152}, {1151, 2305}, {1153, 2303},
+		{419200, 520000}, {5, 4},
+		{math.MaxUint64 - 5000, math.MaxUint64},
+	} {
+		// Check every height, as dailyActiveBlock did.
+		var want []uint64
+		for height := tt[0]; height <= tt[1]; height++ {
+			if height%dailyActiveBlockInterval == 0 {
+				want = append(want, height)
+			}
+			if height == math.MaxUint64 {
+				break
+			}
+		}
+		var got []uint64
+		forEachKeyBlock(tt[0], tt[1], func(height uint64) {
+			got = append(got, height)
+		})
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatal("range", tt, "unexpected key blocks", got, "want", want)
+		}
+	}
+
+	// Only key blocks are visited, so even the largest range is quick.
+	var calls int
+	forEachKeyBlock(0, 1<<32, func(height uint64) {
+		calls++
+	})
+	if calls != 1<<32/dailyActiveBlockInterval+1 {
+		t.Fatal("unexpected number of key blocks", calls)
+	}
+}
+
+// The cost of GetBlockRange's logging shouldn't grow (beyond the few key
+// blocks logged) with the size of the range.
+func BenchmarkLogBlockRange(b *testing.B) {
+	server, err := NewLwdStreamerWithOptions(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	lwd := server.(*lwdStreamer)
+	for _, size := range []uint64{100, 10000, 1000000} {
+		b.Run(fmt.Sprintf("blocks=%d", size), func(b *testing.B) {
+			span := &walletrpc.BlockRange{
+				Start: &walletrpc.BlockID{Height: 419200},
+				End:   &walletrpc.BlockID{Height: 419200 + size - 1},
+			}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				lwd.logBlockRange(span, "10.0.0.1")
+			}
+		})
+	}
+}
+
+func TestPingDisabled(t *testing.T) {
+	testT = t
+	lwd, _ := testsetup()
+
+	var before, after dto.Metric
+	common.Metrics.PingCounter.Write(&before)
+	_, err := lwd.Ping(context.Background(), &walletrpc.Duration{})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatal("Ping unexpected status", err)
+	}
+	if status.Convert(err).Message() != PingDisabledMessage {
+		t.Fatal("Ping unexpected message", err)
+	}
+	common.Metrics.PingCounter.Write(&after)
+	if after.GetCounter().GetValue() != before.GetCounter().GetValue()+1 {
+		t.Fatal("Ping wasn't counted")
+	}
+}
+
+func TestNewLwdStreamerWithOptions(t *testing.T) {
+	testT = t
+	_, cache := testsetup()
+	server, err := NewLwdStreamerWithOptions(cache,
+		WithChainName("test"),
+		WithPing(true),
+		WithMempoolInterval(0),
+		WithLatencyRetention(time.Minute),
+		WithTreeStateCacheSize(10))
+	if err != nil {
+		t.Fatal("NewLwdStreamerWithOptions failed:", err)
+	}
+	lwd := server.(*lwdStreamer)
+	if lwd.chainName != "test" || !lwd.pingEnable {
+		t.Fatal("options not applied", lwd.chainName, lwd.pingEnable)
+	}
+	if lwd.latency.retention != int64(time.Minute) || lwd.treeStates.size != 10 {
+		t.Fatal("cache options not applied")
+	}
+
+	// With no minimum interval, every GetMempoolTx refreshes the mempool.
+	var refreshes int
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		refreshes++
+		return getrawmempoolStub(method, params)
+	}
+	for i := 0; i < 2; i++ {
+		if err := lwd.GetMempoolTx(&walletrpc.Exclude{}, &testgetmempooltx{}); err != nil {
+			t.Fatal("GetMempoolTx failed:", err)
+		}
+	}
+	if refreshes != 2 {
+		t.Fatal("expected a mempool refresh per call, got", refreshes)
+	}
+
+	// Defaults
+	server, err = NewLwdStreamerWithOptions(cache)
+	if err != nil {
+		t.Fatal("NewLwdStreamerWithOptions failed:", err)
+	}
+	lwd = server.(*lwdStreamer)
+	if lwd.chainName != "" || lwd.pingEnable || lwd.mempoolInterval != 2*time.Second {
+		t.Fatal("unexpected defaults")
+	}
+
+	if _, err := NewLwdStreamerWithOptions(cache, WithLatencyRetention(0)); err == nil {
+		t.Fatal("NewLwdStreamerWithOptions should have rejected a zero retention")
+	}
+	if _, err := NewLwdStreamerWithOptions(cache, WithLogSampling(0)); err == nil {
+		t.Fatal("NewLwdStreamerWithOptions should have rejected a zero log sample rate")
+	}
+}
+
+func TestGetTransactionRetry(t *testing.T) {
+	testT = t
+	var calls int
+	common.RawRequest = func(method string, params []json.RawMessage) (json.RawMessage, error) {
+		if method != "getrawtransaction" {
+			testT.Fatal("unexpected method", method)
+		}
+		calls++
+		// The transaction is still propagating on the first attempt.
+		if calls%2 == 1 {
+			return nil, errors.New("-5: No such mempool or blockchain transaction")
+		}
+		return json.Marshal(&common.ZcashdRpcReplyGetrawtransaction{
+			Hex:    hex.EncodeToString(rawTxData[0]),
+			Height: -1,
+		})
+	}
+	_, cache := testsetup()
+	txf := &walletrpc.TxFilter{Hash: make([]byte, 32)}
+
+	// By default, not found is returned immediately.
+	lwd, _ := NewLwdStreamerWithOptions(cache)
+	if _, err := lwd.GetTransaction(context.Background(), txf); err == nil {
+		t.Fatal("GetTransaction should have failed without retries")
+	}
+
+	calls = 0
+	lwd, _ = NewLwdStreamerWithOptions(cache, WithTransactionRetry(3, time.Millisecond))
+	rawtx, err := lwd.GetTransaction(context.Background(), txf)
+	if err != nil {
+		t.Fatal("GetTransaction failed:", err)
+	}
+	if !bytes.Equal(rawtx.Data, rawTxData[0]) || calls != 2 {
+		t.Fatal("GetTransaction unexpected result, calls:", calls)
+	}
+
+	// The retries stop when the context is done.
+	calls = 0
+	lwd, _ = NewLwdStreamerWithOptions(cache, WithTransactionRetry(3, time.Hour))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := lwd.GetTransaction(ctx, txf); err == nil {
+		t.Fatal("GetTransaction should have failed when its context expired")
+	}
+	if calls != 1 {
+		t.Fatal("unexpected calls", calls)
+	}
+}
+
+func TestDailyQuota(t *testing.T) {
+	quota := NewDailyQuota(2)
+	now := time.Date(2020, 6, 1, 23, 0, 0, 0, time.UTC)
+	quota.now = func() time.Time { return now }
+	peerCtx := func(ip string) context.Context {
+		return metadata.NewIncomingContext(context.Background(),
+			metadata.Pairs("x-real-ip", ip))
+	}
+	calls := 0
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls++
+		return nil, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/test"}
+	call := func(ip string) error {
+		_, err := quota.UnaryInterceptor(peerCtx(ip), nil, info, handler)
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := call("1.2.3.4"); err != nil {
+			t.Fatal("request within quota failed", err)
+		}
+	}
+	err := call("1.2.3.4")
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatal("unexpected error exceeding quota", err)
+	}
+	if !strings.Contains(err.Error(), "resets at 2020-06-02T00:00:00Z") {
+		t.Fatal("unexpected quota error", err)
+	}
+	// Other peers have their own quota.
+	if err := call("5.6.7.8"); err != nil {
+		t.Fatal("other peer's request failed", err)
+	}
+	if calls != 3 {
+		t.Fatal("unexpected handler calls", calls)
+	}
+
+	// Counts reset at UTC midnight.
+	now = now.Add(time.Hour)
+	if err := call("1.2.3.4"); err != nil {
+		t.Fatal("request after reset failed", err)
+	}
+
+	// Streams count too.
+	stream := &testgetbrangeRecord{}
+	streamHandler := func(srv interface{}, ss grpc.ServerStream) error { return nil }
+	streamInfo := &grpc.StreamServerInfo{FullMethod: "/test"}
+	if err := quota.StreamInterceptor(nil, stream, streamInfo, streamHandler); err != nil {
+		t.Fatal("stream within quota failed", err)
+	}
+	if err := quota.StreamInterceptor(nil, stream, streamInfo, streamHandler); err != nil {
+		t.Fatal("stream within quota failed", err)
+	}
+	if err := quota.StreamInterceptor(nil, stream, streamInfo, streamHandler); status.Code(err) != codes.ResourceExhausted {
+		t.Fatal("unexpected error exceeding quota with streams", err)
+	}
+
+	// Zero means no limit.
+	quota = NewDailyQuota(0)
+	for i := 0; i < 5; i++ {
+		if err := call("1.2.3.4"); err != nil {
+			t.Fatal("unlimited quota failed", err)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	limit := NewRateLimit(2, 3)
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	limit.now = func() time.Time { return now }
+	peerCtx := func(ip string) context.Context {
+		return metadata.NewIncomingContext(context.Background(),
+			metadata.Pairs("x-real-ip", ip))
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/test"}
+	call := func(ip string) error {
+		_, err := limit.UnaryInterceptor(peerCtx(ip), nil, info, handler)
+		return err
+	}
+
+	// A burst of three is allowed, then the bucket is empty.
+	for i := 0; i < 3; i++ {
+		if err := call("1.2.3.4"); err != nil {
+			t.Fatal("request within burst failed", err)
+		}
+	}
+	err := call("1.2.3.4")
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatal("unexpected error exceeding rate", err)
+	}
+	if !strings.Contains(err.Error(), "try again in 500ms") {
+		t.Fatal("unexpected rate limit error", err)
+	}
+	// Other peers have their own buckets, for streams too.
+	stream := &testgetbrangeRecord{}
+	streamHandler := func(srv interface{}, ss grpc.ServerStream) error { return nil }
+	streamInfo := &grpc.StreamServerInfo{FullMethod: "/test"}
+	if err := limit.StreamInterceptor(nil, stream, streamInfo, streamHandler); err != nil {
+		t.Fatal("other peer's stream failed", err)
+	}
+
+	// Two tokens a second are added.
+	now = now.Add(time.Second)
+	for i := 0; i < 2; i++ {
+		if err := call("1.2.3.4"); err != nil {
+			t.Fatal("request after refill failed", err)
+		}
+	}
+	if err := call("1.2.3.4"); status.Code(err) != codes.ResourceExhausted {
+		t.Fatal("unexpected error exceeding rate after refill", err)
+	}
+
+	// Idle peers' buckets are removed once they would be full again.
+	now = now.Add(time.Second)
+	limit.sweep()
+	if len(limit.buckets) != 1 {
+		t.Fatal("unexpected buckets after sweep", len(limit.buckets))
+	}
+	now = now.Add(time.Second)
+	limit.sweep()
+	if len(limit.buckets) != 0 {
+		t.Fatal("unexpected buckets after sweep", len(limit.buckets))
+	}
+
+	// Zero means no limit.
+	limit = NewRateLimit(0, 1)
+	for i := 0; i < 5; i++ {
+		if err := call("1.2.3.4"); err != nil {
+			t.Fatal("unlimited rate failed", err)
 		}
 	}
+}
+
+// testgetbrangeTrailer records the trailer a stream interceptor sets.
+type testgetbrangeTrailer struct {
+	testgetbrange
+	trailer metadata.MD
+}
+
+func (tg *testgetbrangeTrailer) SetTrailer(md metadata.MD) {
+	tg.trailer = metadata.Join(tg.trailer, md)
+}
+
+func TestMaintenance(t *testing.T) {
+	m := NewMaintenance(30 * time.Second)
+	calls := 0
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls++
+		return nil, nil
+	}
+	walletInfo := &grpc.UnaryServerInfo{FullMethod: "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetLightdInfo"}
+	adminInfo := &grpc.UnaryServerInfo{FullMethod: "/cash.z.wallet.sdk.rpc.DarksideStreamer/Reset"}
+
+	if _, err := m.UnaryInterceptor(context.Background(), nil, walletInfo, handler); err != nil {
+		t.Fatal("call failed outside maintenance:", err)
+	}
+	if !m.Toggle() || !m.Enabled() {
+		t.Fatal("Toggle didn't turn maintenance mode on")
+	}
+	stream := &testServerStream{}
+	ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+	_, err := m.UnaryInterceptor(ctx, nil, walletInfo, handler)
+	if status.Code(err) != codes.Unavailable {
+		t.Fatal("unexpected error in maintenance", err)
+	}
+	if retry := stream.trailer.Get(RetryAfterTrailer); len(retry) != 1 || retry[0] != "30" {
+		t.Fatal("unexpected retry-after trailer", retry)
+	}
+	// Administrative calls are still served.
+	if _, err := m.UnaryInterceptor(context.Background(), nil, adminInfo, handler); err != nil {
+		t.Fatal("admin call failed in maintenance:", err)
+	}
 
+	ss := &testgetbrangeTrailer{}
+	streamInfo := &grpc.StreamServerInfo{FullMethod: "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetBlockRange"}
+	streamHandler := func(srv interface{}, ss grpc.ServerStream) error {
+		calls++
+		return nil
+	}
+	if err := m.StreamInterceptor(nil, ss, streamInfo, streamHandler); status.Code(err) != codes.Unavailable {
+		t.Fatal("unexpected stream error in maintenance", err)
+	}
+	if retry := ss.trailer.Get(RetryAfterTrailer); len(retry) != 1 || retry[0] != "30" {
+		t.Fatal("unexpected stream retry-after trailer", retry)
+	}
+
+	if m.Toggle() || m.Enabled() {
+		t.Fatal("Toggle didn't turn maintenance mode off")
+	}
+	if _, err := m.UnaryInterceptor(context.Background(), nil, walletInfo, handler); err != nil {
+		t.Fatal("call failed after maintenance:", err)
+	}
+	if err := m.StreamInterceptor(nil, ss, streamInfo, streamHandler); err != nil {
+		t.Fatal("stream failed after maintenance:", err)
+	}
+	if calls != 4 {
+		t.Fatal("unexpected handler calls", calls)
+	}
 }
@@ -0,0 +1,71 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package frontend
+
+import (
+	"context"
+	"time"
+
+	"github.com/adityapk00/lightwalletd/common"
+	"github.com/adityapk00/lightwalletd/walletrpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// healthChainInfo returns zcashd's most recent getblockchaininfo reply and
+// when it was given, asking zcashd only if the reply is older than
+// healthMaxAge and no other health check has asked within that time (if one
+// did and failed, its error is returned).
+func (s *lwdStreamer) healthChainInfo() (*common.ZcashdRpcReplyGetblockchaininfo, time.Time, error) {
+	if info, at := common.LastBlockchainInfo(); info != nil && time.Since(at) <= s.healthMaxAge {
+		return info, at, nil
+	}
+	st := s.state
+	st.healthMutex.Lock()
+	defer st.healthMutex.Unlock()
+	if time.Since(st.healthChecked) < s.healthMaxAge {
+		// Another check has just asked (while this one waited for the lock).
+		if st.healthErr != nil {
+			return nil, time.Time{}, st.healthErr
+		}
+		if info, at := common.LastBlockchainInfo(); info != nil && time.Since(at) <= s.healthMaxAge {
+			return info, at, nil
+		}
+	}
+	st.healthChecked = time.Now()
+	_, st.healthErr = common.GetBlockchainInfo()
+	if st.healthErr != nil {
+		return nil, time.Time{}, st.healthErr
+	}
+	info, at := common.LastBlockchainInfo()
+	return info, at, nil
+}
+
+// GetServerHealth reports whether this server can serve wallets: zcashd has
+// answered recently and isn't in initial block download, and the cache is
+// within healthMaxLag blocks of zcashd's tip. If not, it fails with
+// Unavailable.
+func (s *lwdStreamer) GetServerHealth(ctx context.Context, in *walletrpc.Empty) (*walletrpc.ServerHealth, error) {
+	info, at, err := s.healthChainInfo()
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "zcashd unreachable: %s", err)
+	}
+	if info.InitialBlockDownload() {
+		return nil, status.Error(codes.Unavailable, "zcashd is in initial block download")
+	}
+	latest := s.cache.GetLatestHeight()
+	if latest < 0 {
+		return nil, status.Error(codes.Unavailable, "block cache is empty")
+	}
+	if info.Blocks-latest > s.healthMaxLag {
+		return nil, status.Errorf(codes.Unavailable,
+			"block cache is at height %d, %d blocks behind zcashd (at most %d allowed)",
+			latest, info.Blocks-latest, s.healthMaxLag)
+	}
+	return &walletrpc.ServerHealth{
+		ZcashdHeight:   uint64(info.Blocks),
+		CacheHeight:    uint64(latest),
+		ChainInfoAgeMs: uint64(time.Since(at) / time.Millisecond),
+	}, nil
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package frontend
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+)
+
+// latencyCacheShards is the number of independently-locked parts of the
+// latency cache; requests from different peers rarely contend.
+const latencyCacheShards = 16
+
+// latencyCacheMaxEntries bounds the number of peers the latency cache tracks.
+const latencyCacheMaxEntries = 10000
+
+// defaultLatencyCacheRetention is how long a peer's entry is kept after its
+// most recent bulk request (see WithLatencyRetention); consecutive requests
+// further apart than this aren't logged.
+const defaultLatencyCacheRetention = 30 * time.Second
+
+type latencyCacheEntry struct {
+	timeNanos   int64
+	lastBlock   uint64
+	totalBlocks uint64
+}
+
+// latencyCache remembers each peer's most recent bulk GetBlockRange request
+// so that the time between consecutive requests can be logged. It's sharded
+// by peer address, and an update that finds its shard busy is dropped rather
+// than waiting; this is only logging, so it must never hold up serving blocks.
+type latencyCache struct {
+	shards     []latencyShard
+	maxEntries int   // per shard
+	retention  int64 // nanoseconds
+}
+
+type latencyShard struct {
+	busy    int32 // nonzero while a goroutine owns entries
+	entries map[string]*latencyCacheEntry
+}
+
+func newLatencyCache(shards, maxEntries int, retention time.Duration) *latencyCache {
+	c := &latencyCache{
+		shards:     make([]latencyShard, shards),
+		maxEntries: (maxEntries + shards - 1) / shards,
+		retention:  int64(retention),
+	}
+	for i := range c.shards {
+		c.shards[i].entries = make(map[string]*latencyCacheEntry)
+	}
+	return c
+}
+
+func (c *latencyCache) shard(peerip string) *latencyShard {
+	h := fnv.New32a()
+	h.Write([]byte(peerip))
+	return &c.shards[h.Sum32()%uint32(len(c.shards))]
+}
+
+// record replaces the peer's entry with one for the given block range
+// requested at time now (nanoseconds), returning the entry it replaced (nil
+// if none). If the shard is busy, nothing is recorded and ok is false.
+func (c *latencyCache) record(peerip string, start, end uint64, now int64) (prev *latencyCacheEntry, ok bool) {
+	shard := c.shard(peerip)
+	if !atomic.CompareAndSwapInt32(&shard.busy, 0, 1) {
+		return nil, false
+	}
+	defer atomic.StoreInt32(&shard.busy, 0)
+
+	prev = shard.entries[peerip]
+	if prev != nil && prev.timeNanos+c.retention < now {
+		// expired, but the sweeper hasn't removed it yet
+		prev = nil
+	}
+	if prev == nil && len(shard.entries) >= c.maxEntries {
+		// Full; don't track this peer.
+		return nil, true
+	}
+	shard.entries[peerip] = &latencyCacheEntry{
+		lastBlock:   end,
+		totalBlocks: end - start + 1,
+		timeNanos:   now,
+	}
+	return prev, true
+}
+
+// sweep removes entries older than the retention window. A shard that's busy
+// is left for the next sweep.
+func (c *latencyCache) sweep(now int64) {
+	for i := range c.shards {
+		shard := &c.shards[i]
+		if !atomic.CompareAndSwapInt32(&shard.busy, 0, 1) {
+			continue
+		}
+		for ip, entry := range shard.entries {
+			if entry.timeNanos+c.retention < now {
+				delete(shard.entries, ip)
+			}
+		}
+		atomic.StoreInt32(&shard.busy, 0)
+	}
+}
+
+// sweeper calls sweep every interval until stop is closed.
+func (c *latencyCache) sweeper(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.sweep(time.Now().UnixNano())
+		case <-stop:
+			return
+		}
+	}
+}
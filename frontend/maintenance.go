@@ -0,0 +1,103 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package frontend
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/adityapk00/lightwalletd/walletrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RetryAfterTrailer is the trailer, set on calls refused during maintenance,
+// that gives the number of seconds after which the client should try again.
+const RetryAfterTrailer = "retry-after"
+
+// Maintenance is a switch that, while on, makes every wallet (CompactTxStreamer)
+// call fail with Unavailable, so that the backend can be worked on without
+// closing the listener. Administrative (DarksideStreamer) calls are still
+// served. Use its interceptors when creating the gRPC server.
+type Maintenance struct {
+	on         int32 // accessed atomically
+	retryAfter time.Duration
+}
+
+// NewMaintenance returns a switch, initially off, whose refusals suggest
+// retrying after the given time.
+func NewMaintenance(retryAfter time.Duration) *Maintenance {
+	return &Maintenance{retryAfter: retryAfter}
+}
+
+// Set turns maintenance mode on or off.
+func (m *Maintenance) Set(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&m.on, v)
+}
+
+// Toggle turns maintenance mode on if it's off, and vice versa, returning
+// the new setting.
+func (m *Maintenance) Toggle() bool {
+	for {
+		old := atomic.LoadInt32(&m.on)
+		if atomic.CompareAndSwapInt32(&m.on, old, 1-old) {
+			return old == 0
+		}
+	}
+}
+
+// Enabled indicates whether maintenance mode is on.
+func (m *Maintenance) Enabled() bool {
+	return atomic.LoadInt32(&m.on) != 0
+}
+
+// refuses returns the trailer and error with which to refuse the given
+// method, or a nil error if it should be served.
+func (m *Maintenance) refuses(fullMethod string) (metadata.MD, error) {
+	if !m.Enabled() || !strings.HasPrefix(fullMethod, "/"+walletrpc.CompactTxStreamer_ServiceDesc.ServiceName+"/") {
+		return nil, nil
+	}
+	seconds := strconv.Itoa(int(m.retryAfter / time.Second))
+	return metadata.Pairs(RetryAfterTrailer, seconds),
+		status.Error(codes.Unavailable, "server in maintenance, retry after "+seconds+" seconds")
+}
+
+// UnaryInterceptor refuses wallet calls during maintenance.
+func (m *Maintenance) UnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if trailer, err := m.refuses(info.FullMethod); err != nil {
+		// This fails only if there's no gRPC stream in the context
+		// (direct calls), which is harmless.
+		grpc.SetTrailer(ctx, trailer)
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor refuses wallet streams during maintenance.
+func (m *Maintenance) StreamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if trailer, err := m.refuses(info.FullMethod); err != nil {
+		ss.SetTrailer(trailer)
+		return err
+	}
+	return handler(srv, ss)
+}
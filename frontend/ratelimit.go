@@ -0,0 +1,149 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package frontend
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/adityapk00/lightwalletd/common/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// rateLimitMaxEntries bounds the number of peers the rate limiter tracks;
+// while that many have recently made requests, further peers aren't limited.
+const rateLimitMaxEntries = 100000
+
+// rateLimitSweepInterval is how often idle peers' buckets are removed.
+const rateLimitSweepInterval = time.Minute
+
+// RateLimit limits the rate of requests (unary calls and streams) from each
+// peer IP address with a token bucket: each request takes a token, and a
+// peer's bucket refills at a steady rate up to its burst size. Use its
+// interceptors when creating the gRPC server.
+type RateLimit struct {
+	rate  float64 // tokens per second
+	burst float64
+	now   func() time.Time // a variable only so that tests can change it
+
+	mutex   sync.Mutex
+	buckets map[string]*rateBucket
+}
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time // when tokens was last brought up to date
+}
+
+// NewRateLimit returns a limit of rate requests per second per peer, with
+// bursts of up to burst requests (at least one); a rate of zero means no
+// limit.
+func NewRateLimit(rate float64, burst int) *RateLimit {
+	if burst < 1 {
+		burst = 1
+	}
+	r := &RateLimit{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*rateBucket),
+	}
+	if rate > 0 {
+		// The limiter lives as long as the server, so the sweeper is never stopped.
+		go r.sweeper(rateLimitSweepInterval, nil)
+	}
+	return r
+}
+
+// refill brings the bucket's tokens up to date.
+func (r *RateLimit) refill(b *rateBucket, now time.Time) {
+	b.tokens = math.Min(r.burst, b.tokens+now.Sub(b.last).Seconds()*r.rate)
+	b.last = now
+}
+
+// take counts a request from the given peer, returning an error if the
+// peer's bucket is empty.
+func (r *RateLimit) take(peerip string) error {
+	if r.rate <= 0 {
+		return nil
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	now := r.now()
+	b, ok := r.buckets[peerip]
+	if !ok {
+		if len(r.buckets) >= rateLimitMaxEntries {
+			// Full; don't track this peer.
+			return nil
+		}
+		b = &rateBucket{tokens: r.burst, last: now}
+		r.buckets[peerip] = b
+	}
+	r.refill(b, now)
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / r.rate * float64(time.Second))
+		return status.Errorf(codes.ResourceExhausted,
+			"rate limit exceeded, try again in %s", wait.Round(time.Millisecond))
+	}
+	b.tokens--
+	return nil
+}
+
+// sweep removes the buckets of peers that have been idle long enough for
+// their buckets to be full again, which is the same as having none.
+func (r *RateLimit) sweep() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	now := r.now()
+	for ip, b := range r.buckets {
+		r.refill(b, now)
+		if b.tokens >= r.burst {
+			delete(r.buckets, ip)
+		}
+	}
+}
+
+// sweeper calls sweep every interval until stop is closed.
+func (r *RateLimit) sweeper(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.sweep()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// UnaryInterceptor rejects unary calls from peers over their rate.
+func (r *RateLimit) UnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if err := r.take(logging.PeerIPFromContext(ctx)); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor rejects streams from peers over their rate.
+func (r *RateLimit) StreamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if err := r.take(logging.PeerIPFromContext(ss.Context())); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package frontend
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/adityapk00/lightwalletd/walletrpc"
+)
+
+// sendDedupWindow is how long a successful SendTransaction reply is
+// remembered; resubmitting the same transaction within this time returns
+// that reply without asking zcashd again. (A variable only so that tests
+// can change it.)
+var sendDedupWindow = 60 * time.Second
+
+// sendDedupCache remembers recent successful SendTransaction replies, keyed
+// by the hash of the raw transaction (which is the txid before v5). The zero
+// value is ready to use.
+type sendDedupCache struct {
+	mutex   sync.Mutex
+	entries map[[32]byte]sendDedupEntry
+}
+
+type sendDedupEntry struct {
+	errorCode    int32
+	errorMessage string
+	time         time.Time
+}
+
+func sendDedupKey(rawtx []byte) [32]byte {
+	digest := sha256.Sum256(rawtx)
+	return sha256.Sum256(digest[:])
+}
+
+// get returns the reply remembered for the given transaction, or nil if
+// there isn't one from within the window.
+func (c *sendDedupCache) get(key [32]byte, now time.Time) *walletrpc.SendResponse {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || now.Sub(entry.time) >= sendDedupWindow {
+		return nil
+	}
+	return &walletrpc.SendResponse{
+		ErrorCode:    entry.errorCode,
+		ErrorMessage: entry.errorMessage,
+	}
+}
+
+// add remembers a successful reply, and forgets any that have expired.
+func (c *sendDedupCache) add(key [32]byte, resp *walletrpc.SendResponse, now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[[32]byte]sendDedupEntry)
+	}
+	for k, entry := range c.entries {
+		if now.Sub(entry.time) >= sendDedupWindow {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = sendDedupEntry{
+		errorCode:    resp.ErrorCode,
+		errorMessage: resp.ErrorMessage,
+		time:         now,
+	}
+}
+
+func (c *sendDedupCache) reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = nil
+}
@@ -6,14 +6,16 @@
 package frontend
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"io"
 	"math"
-	"net"
 	"regexp"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
@@ -22,73 +24,569 @@ import (
 	"time"
 
 	"github.com/adityapk00/lightwalletd/common"
+	"github.com/adityapk00/lightwalletd/common/logging"
 	"github.com/adityapk00/lightwalletd/parser"
 	"github.com/adityapk00/lightwalletd/walletrpc"
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/golang/protobuf/proto"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
-type latencyCacheEntry struct {
-	timeNanos   int64
-	lastBlock   uint64
-	totalBlocks uint64
-}
+// BlockHashHeader is the response header that GetBlock sets to the
+// returned block's hash (hex, big-endian display order).
+const BlockHashHeader = "block-hash"
+
+// TxidCountTrailer is the response trailer that a paged GetTaddressTxids
+// (one with an offset or limit) sets to the total number of transactions in
+// the range, so the client can tell how many pages there are.
+const TxidCountTrailer = "txid-count"
+
+// DarksideSessionHeader is the request metadata key that names the darkside
+// session a DarksideStreamer request operates on; without it, the request
+// operates on the default session.
+const DarksideSessionHeader = "darkside-session"
 
 type lwdStreamer struct {
 	cache      *common.BlockCache
 	chainName  string
 	pingEnable bool
 	walletrpc.UnimplementedCompactTxStreamerServer
-	latencyCache map[string]*latencyCacheEntry
-	latencyMutex sync.RWMutex
+	latency    *latencyCache
+	treeStates *treeStateCache
+
+	// how often GetMempoolTx refreshes its copy of the mempool
+	mempoolInterval time.Duration
+
+	// how many goroutines convert new mempool transactions to compact form
+	mempoolWorkers int
+
+	// GetTransaction retries for transactions not (yet) found
+	txRetries    int
+	txRetryDelay time.Duration
+
+	// fail block requests while zcashd is in initial block download
+	rejectDuringIBD bool
+
+	// stamp GetMempoolTx transactions with the next block's height
+	mempoolHeightHint bool
+
+	// the most txids a GetMempoolTx exclude list may have
+	maxExclude int
+
+	// the most block IDs GetLatestBlocks may return
+	maxLatestBlocks int
+
+	// the most blocks an ExportBlocks request may span
+	maxExportBlocks int
+
+	// whether GetBlockRange adds blocks it fetches from zcashd to the cache
+	rangeCacheMode common.RangeCacheMode
+
+	// how old a getblockchaininfo reply GetServerHealth relies on, and how
+	// far behind zcashd's tip the cache may be while it reports serving
+	healthMaxAge time.Duration
+	healthMaxLag int
+
+	// how GetTransaction handles transactions in reorged-out blocks
+	orphanedTxMode common.OrphanedTxMode
+
+	// by method; methods without a sampler log every request
+	logSamplers map[string]*logging.Sampler
+
+	state *streamerState
+}
+
+// streamerState is the lwdStreamer state that changes as requests are
+// served (as opposed to its configuration); see ResetStreamerState.
+type streamerState struct {
+	// Number of Ping requests in progress (first for 64-bit alignment).
+	concurrent int64
+
+	// mempoolMutex protects the mempool fields; it's held for the duration
+	// of a refresh so that concurrent GetMempoolTx callers wait for, and
+	// share, a single refresh rather than each stampeding zcashd.
+	mempoolMutex sync.Mutex
+
+	// Key is 32-byte txid (as a 64-character string), data is pointer to compact tx.
+	mempoolMap  *map[string]*walletrpc.CompactTx
+	mempoolList []string
+
+	// The transactions in mempoolMap that have transparent inputs or
+	// outputs, with the same keys.
+	mempoolTaddrs *map[string]*mempoolTaddrTx
+
+	// Last time we pulled a copy of the mempool from zcashd.
+	lastMempool time.Time
+
+	// Recent successful SendTransaction replies.
+	sent sendDedupCache
+
+	// When GetServerHealth last asked zcashd for its chain info, and the
+	// error if that failed; protected by healthMutex.
+	healthMutex   sync.Mutex
+	healthChecked time.Time
+	healthErr     error
+}
+
+// reset forgets the streamer's copy of the mempool, its Ping count, and
+// the transactions it has recently sent.
+func (st *streamerState) reset() {
+	st.mempoolMutex.Lock()
+	defer st.mempoolMutex.Unlock()
+	st.mempoolMap = nil
+	st.mempoolList = nil
+	st.mempoolTaddrs = nil
+	st.lastMempool = time.Time{}
+	atomic.StoreInt64(&st.concurrent, 0)
+
+	st.healthMutex.Lock()
+	defer st.healthMutex.Unlock()
+	st.healthChecked = time.Time{}
+	st.healthErr = nil
+
+	st.sent.reset()
+}
+
+// ResetStreamerState clears the state that the given streamer (as returned
+// by NewLwdStreamer or NewLwdStreamerWithOptions) has accumulated while
+// serving requests, such as its copy of the mempool, so it behaves as if
+// newly constructed.
+func ResetStreamerState(server walletrpc.CompactTxStreamerServer) {
+	if s, ok := server.(*lwdStreamer); ok {
+		s.state.reset()
+	}
+}
+
+// StreamerOption configures an optional NewLwdStreamerWithOptions setting.
+type StreamerOption func(*streamerConfig)
+
+type streamerConfig struct {
+	chainName         string
+	pingEnable        bool
+	mempoolInterval   time.Duration
+	mempoolWorkers    int
+	latencyRetention  time.Duration
+	treeStateCacheLen int
+	txRetries         int
+	txRetryDelay      time.Duration
+	rejectDuringIBD   bool
+	logSampleRate     int
+	mempoolHeightHint bool
+	maxExclude        int
+	maxLatestBlocks   int
+	maxExportBlocks   int
+	rangeCacheMode    common.RangeCacheMode
+	healthMaxAge      time.Duration
+	healthMaxLag      int
+	orphanedTxMode    common.OrphanedTxMode
+}
+
+// WithChainName sets the chain name ("main", "test", ...) reported by zcashd.
+func WithChainName(chainName string) StreamerOption {
+	return func(c *streamerConfig) { c.chainName = chainName }
+}
+
+// WithPing enables the testing-only Ping rpc.
+func WithPing(enable bool) StreamerOption {
+	return func(c *streamerConfig) { c.pingEnable = enable }
+}
+
+// WithMempoolInterval sets how out of date GetMempoolTx results may be
+// (default 2 seconds).
+func WithMempoolInterval(interval time.Duration) StreamerOption {
+	return func(c *streamerConfig) { c.mempoolInterval = interval }
+}
+
+// WithMempoolWorkers sets how many goroutines parse and convert new
+// mempool transactions during a GetMempoolTx refresh (default, or if n is
+// zero, the number of CPUs).
+func WithMempoolWorkers(n int) StreamerOption {
+	return func(c *streamerConfig) { c.mempoolWorkers = n }
+}
+
+// WithLatencyRetention sets how far apart a peer's bulk block requests can
+// be and still have their latency logged (default 30 seconds).
+func WithLatencyRetention(retention time.Duration) StreamerOption {
+	return func(c *streamerConfig) { c.latencyRetention = retention }
+}
+
+// WithTreeStateCacheSize sets the number of tree states GetTreeState
+// remembers (default 1000).
+func WithTreeStateCacheSize(size int) StreamerOption {
+	return func(c *streamerConfig) { c.treeStateCacheLen = size }
+}
+
+// WithTransactionRetry makes GetTransaction retry, up to the given number of
+// times, delay apart, when zcashd doesn't know of the transaction; it may have
+// been relayed (by SendTransaction) only moments ago. The default is not to
+// retry.
+func WithTransactionRetry(retries int, delay time.Duration) StreamerOption {
+	return func(c *streamerConfig) {
+		c.txRetries = retries
+		c.txRetryDelay = delay
+	}
+}
+
+// WithRejectDuringIBD makes block requests fail, with codes.Unavailable,
+// while zcashd is in initial block download, so wallets don't sync against
+// a node that doesn't yet have all blocks.
+func WithRejectDuringIBD(reject bool) StreamerOption {
+	return func(c *streamerConfig) { c.rejectDuringIBD = reject }
+}
+
+// WithLogSampling makes the busiest rpcs (GetBlockRange and
+// GetFullBlockRange) log only one of every n successful requests; failed
+// requests are always logged. The default, 1, logs every request.
+func WithLogSampling(n int) StreamerOption {
+	return func(c *streamerConfig) { c.logSampleRate = n }
+}
+
+// WithMempoolHeightHint makes GetMempoolTx set each compact transaction's
+// height to that of the next block (the latest plus one), the height at
+// which it's expected to be mined. The default leaves it zero.
+func WithMempoolHeightHint(enable bool) StreamerOption {
+	return func(c *streamerConfig) { c.mempoolHeightHint = enable }
+}
+
+// defaultMaxExclude is the default limit on the size of a GetMempoolTx
+// exclude list, far more than a mempool normally holds.
+const defaultMaxExclude = 10000
+
+// WithMaxExclude limits the number of txids a GetMempoolTx exclude list may
+// have (default 10000); filtering by a huge list is expensive.
+func WithMaxExclude(n int) StreamerOption {
+	return func(c *streamerConfig) { c.maxExclude = n }
+}
+
+// defaultMaxLatestBlocks is the default limit on the number of block IDs
+// GetLatestBlocks returns, more than the deepest expected reorg.
+const defaultMaxLatestBlocks = 100
+
+// WithMaxLatestBlocks limits the number of block IDs GetLatestBlocks may be
+// asked for (default 100).
+func WithMaxLatestBlocks(n int) StreamerOption {
+	return func(c *streamerConfig) { c.maxLatestBlocks = n }
+}
+
+// defaultMaxExportBlocks is the default limit on the number of blocks an
+// ExportBlocks request may span.
+const defaultMaxExportBlocks = 10000
+
+// WithMaxExportBlocks limits the number of blocks an ExportBlocks request
+// may span (default 10000); larger exports are made in several requests.
+func WithMaxExportBlocks(n int) StreamerOption {
+	return func(c *streamerConfig) { c.maxExportBlocks = n }
+}
+
+// WithRangeCacheMode sets whether GetBlockRange adds the blocks it fetches
+// from zcashd to the cache (default common.RangeCachePassthrough, it doesn't).
+func WithRangeCacheMode(mode common.RangeCacheMode) StreamerOption {
+	return func(c *streamerConfig) { c.rangeCacheMode = mode }
+}
+
+// Defaults for GetServerHealth: it relies on a getblockchaininfo reply for up
+// to defaultHealthMaxAge, and reports serving while the cache is no more than
+// defaultHealthMaxLag blocks behind zcashd.
+const (
+	defaultHealthMaxAge = 30 * time.Second
+	defaultHealthMaxLag = 10
+)
+
+// WithHealthMaxAge sets how old a getblockchaininfo reply (from any caller)
+// GetServerHealth relies on before asking zcashd itself, which it then does
+// at most once per maxAge however often it's called (default 30 seconds).
+func WithHealthMaxAge(maxAge time.Duration) StreamerOption {
+	return func(c *streamerConfig) { c.healthMaxAge = maxAge }
+}
+
+// WithHealthMaxLag sets how many blocks the cache may be behind zcashd's tip
+// while GetServerHealth reports serving (default 10).
+func WithHealthMaxLag(blocks int) StreamerOption {
+	return func(c *streamerConfig) { c.healthMaxLag = blocks }
+}
+
+// WithOrphanedTxMode sets what GetTransaction does when zcashd reports a
+// transaction in a block that its getblockhash doesn't give for the reported
+// height (default common.OrphanedTxIgnore, nothing; it isn't checked).
+func WithOrphanedTxMode(mode common.OrphanedTxMode) StreamerOption {
+	return func(c *streamerConfig) { c.orphanedTxMode = mode }
 }
 
 // NewLwdStreamer constructs a gRPC context.
 func NewLwdStreamer(cache *common.BlockCache, chainName string, enablePing bool) (walletrpc.CompactTxStreamerServer, error) {
-	return &lwdStreamer{cache: cache, chainName: chainName, pingEnable: enablePing, latencyCache: make(map[string]*latencyCacheEntry), latencyMutex: sync.RWMutex{}}, nil
+	return NewLwdStreamerWithOptions(cache, WithChainName(chainName), WithPing(enablePing))
+}
+
+// NewLwdStreamerWithOptions constructs a gRPC context; settings that
+// aren't given take their defaults.
+func NewLwdStreamerWithOptions(cache *common.BlockCache, options ...StreamerOption) (walletrpc.CompactTxStreamerServer, error) {
+	config := &streamerConfig{
+		mempoolInterval:   2 * time.Second,
+		latencyRetention:  defaultLatencyCacheRetention,
+		treeStateCacheLen: treeStateCacheSize,
+		logSampleRate:     1,
+		maxExclude:        defaultMaxExclude,
+		maxLatestBlocks:   defaultMaxLatestBlocks,
+		maxExportBlocks:   defaultMaxExportBlocks,
+		healthMaxAge:      defaultHealthMaxAge,
+		healthMaxLag:      defaultHealthMaxLag,
+	}
+	for _, option := range options {
+		option(config)
+	}
+	if config.latencyRetention <= 0 {
+		return nil, errors.New("latency cache retention must be positive")
+	}
+	if config.mempoolInterval < 0 {
+		return nil, errors.New("mempool interval must not be negative")
+	}
+	if config.mempoolWorkers < 0 {
+		return nil, errors.New("mempool worker count must not be negative")
+	}
+	if config.mempoolWorkers == 0 {
+		config.mempoolWorkers = runtime.NumCPU()
+	}
+	if config.treeStateCacheLen <= 0 {
+		return nil, errors.New("tree state cache size must be positive")
+	}
+	if config.txRetries < 0 || config.txRetryDelay < 0 {
+		return nil, errors.New("transaction retries and delay must not be negative")
+	}
+	if config.logSampleRate < 1 {
+		return nil, errors.New("log sample rate must be positive")
+	}
+	if config.maxExclude <= 0 {
+		return nil, errors.New("maximum exclude list size must be positive")
+	}
+	if config.maxLatestBlocks <= 0 {
+		return nil, errors.New("maximum latest block count must be positive")
+	}
+	if config.maxExportBlocks <= 0 {
+		return nil, errors.New("maximum export block count must be positive")
+	}
+	if config.healthMaxAge < 0 || config.healthMaxLag < 0 {
+		return nil, errors.New("health check maximum age and lag must not be negative")
+	}
+	latency := newLatencyCache(latencyCacheShards, latencyCacheMaxEntries, config.latencyRetention)
+	// The streamer lives as long as the server, so the sweeper is never stopped.
+	go latency.sweeper(config.latencyRetention, nil)
+	return &lwdStreamer{
+		cache:             cache,
+		chainName:         config.chainName,
+		pingEnable:        config.pingEnable,
+		latency:           latency,
+		treeStates:        newTreeStateCache(config.treeStateCacheLen),
+		mempoolInterval:   config.mempoolInterval,
+		mempoolWorkers:    config.mempoolWorkers,
+		txRetries:         config.txRetries,
+		txRetryDelay:      config.txRetryDelay,
+		rejectDuringIBD:   config.rejectDuringIBD,
+		mempoolHeightHint: config.mempoolHeightHint,
+		maxExclude:        config.maxExclude,
+		maxLatestBlocks:   config.maxLatestBlocks,
+		maxExportBlocks:   config.maxExportBlocks,
+		rangeCacheMode:    config.rangeCacheMode,
+		healthMaxAge:      config.healthMaxAge,
+		healthMaxLag:      config.healthMaxLag,
+		orphanedTxMode:    config.orphanedTxMode,
+		logSamplers: map[string]*logging.Sampler{
+			"GetBlockRange":        logging.NewSampler(config.logSampleRate),
+			"GetBlockRangeLatency": logging.NewSampler(config.logSampleRate),
+			"GetFullBlockRange":    logging.NewSampler(config.logSampleRate),
+		},
+		state: &streamerState{},
+	}, nil
 }
 
 // DarksideStreamer holds the gRPC state for darksidewalletd.
 type DarksideStreamer struct {
 	cache *common.BlockCache
+	lwd   walletrpc.CompactTxStreamerServer // its state is cleared by Reset
 	walletrpc.UnimplementedDarksideStreamerServer
 }
 
-// NewDarksideStreamer constructs a gRPC context for darksidewalletd.
-func NewDarksideStreamer(cache *common.BlockCache) (walletrpc.DarksideStreamerServer, error) {
-	return &DarksideStreamer{cache: cache}, nil
+// NewDarksideStreamer constructs a gRPC context for darksidewalletd; lwd is
+// the production streamer that presents the mock zcashd's chain.
+func NewDarksideStreamer(cache *common.BlockCache, lwd walletrpc.CompactTxStreamerServer) (walletrpc.DarksideStreamerServer, error) {
+	return &DarksideStreamer{cache: cache, lwd: lwd}, nil
 }
 
-// Test to make sure Address is a single t address
-func checkTaddress(taddr string) error {
-	match, err := regexp.Match("\\At[a-zA-Z0-9]{34}\\z", []byte(taddr))
-	if err != nil || !match {
+// addressKind is the kind of Zcash address that classifyAddress recognizes.
+type addressKind int
+
+const (
+	addressUnknown     addressKind = iota
+	addressTransparent             // P2PKH or P2SH
+	addressSprout
+	addressSapling
+	addressUnified
+)
+
+var (
+	taddrRegexp = regexp.MustCompile("\\At[a-zA-Z0-9]{34}\\z")
+	// The part after the prefix of a Base58Check Sprout address, or of a
+	// Bech32 (Sapling) or Bech32m (unified) address after its HRP and "1".
+	sproutRegexp = regexp.MustCompile("\\A[a-zA-Z0-9]{93}\\z")
+	bech32Regexp = regexp.MustCompile("\\A[a-z0-9]+\\z")
+)
+
+// Prefixes (the human-readable part and separator) of Bech32 Sapling and
+// Bech32m unified addresses, on mainnet, testnet, and regtest.
+var (
+	saplingPrefixes = []string{"zs1", "ztestsapling1", "zregtestsapling1"}
+	unifiedPrefixes = []string{"u1", "utest1", "uregtest1"}
+)
+
+func hasBech32Prefix(addr string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(addr, prefix) && bech32Regexp.MatchString(addr[len(prefix):]) {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyAddress returns the kind of the given (encoded) address, on any
+// network, by its form; it doesn't verify the checksum. Use the network's
+// prefixes (see checkTaddress) to check that an address is for the right
+// network.
+func classifyAddress(addr string) addressKind {
+	switch {
+	case taddrRegexp.MatchString(addr):
+		return addressTransparent
+	case hasBech32Prefix(addr, saplingPrefixes):
+		return addressSapling
+	case hasBech32Prefix(addr, unifiedPrefixes):
+		return addressUnified
+	// Mainnet "zc", testnet and regtest "zt"
+	case (strings.HasPrefix(addr, "zc") || strings.HasPrefix(addr, "zt")) && sproutRegexp.MatchString(addr[2:]):
+		return addressSprout
+	}
+	return addressUnknown
+}
+
+// Test to make sure Address is a single t address on the given network
+func checkTaddress(taddr string, network *common.Network) error {
+	if classifyAddress(taddr) != addressTransparent || !network.IsTaddrPrefix(taddr) {
 		return errors.New("Invalid address")
 	}
 	return nil
 }
 
-func (s *lwdStreamer) peerIPFromContext(ctx context.Context) string {
-	if xRealIP, ok := metadata.FromIncomingContext(ctx); ok {
-		realIP := xRealIP.Get("x-real-ip")
-		if len(realIP) > 0 {
-			return realIP[0]
-		}
+// taddrScriptFuncs maps the two-byte Base58Check version of each kind of
+// transparent address to the function that makes the script paying it.
+var taddrScriptFuncs = map[[2]byte]func([]byte) []byte{
+	{0x1c, 0xb8}: parser.P2PKHScript, // mainnet t1
+	{0x1d, 0x25}: parser.P2PKHScript, // testnet and regtest tm
+	{0x1c, 0xbd}: parser.P2SHScript,  // mainnet t3
+	{0x1c, 0xba}: parser.P2SHScript,  // testnet and regtest t2
+}
+
+// taddrScript returns the output script that pays the given transparent
+// address, after verifying its checksum.
+func taddrScript(taddr string) ([]byte, error) {
+	// version (2 bytes), hash (20), checksum (4)
+	decoded := base58.Decode(taddr)
+	if len(decoded) != 26 {
+		return nil, errors.New("Invalid address")
+	}
+	digest := sha256.Sum256(decoded[:22])
+	digest = sha256.Sum256(digest[:])
+	if !bytes.Equal(digest[:4], decoded[22:]) {
+		return nil, errors.New("Invalid address checksum")
 	}
+	toScript, ok := taddrScriptFuncs[[2]byte{decoded[0], decoded[1]}]
+	if !ok {
+		return nil, errors.New("Invalid address")
+	}
+	return toScript(decoded[2:22]), nil
+}
 
-	if peerInfo, ok := peer.FromContext(ctx); ok {
-		ip, _, err := net.SplitHostPort(peerInfo.Addr.String())
-		if err == nil {
-			return ip
-		}
+// errShieldedBalance is returned when a shielded or unified address is passed
+// to an rpc that can only report transparent balances.
+var errShieldedBalance = errors.New("shielded balances require a viewing key and are not supported by this RPC")
+
+// isShieldedAddress indicates whether the address looks like a Sapling,
+// Sprout, or unified address (on any network).
+func isShieldedAddress(addr string) bool {
+	switch classifyAddress(addr) {
+	case addressSprout, addressSapling, addressUnified:
+		return true
 	}
+	return false
+}
+
+// checkSaplingHeight returns an InvalidArgument error if the height is below
+// Sapling activation (the cache's first height, which comes from zcashd's
+// getblockchaininfo); there are no compact blocks or Sapling tree states
+// before then.
+func (s *lwdStreamer) checkSaplingHeight(height uint64) error {
+	if activation := s.cache.GetFirstHeight(); height < uint64(activation) {
+		return status.Errorf(codes.InvalidArgument,
+			"height %d is below Sapling activation height %d", height, activation)
+	}
+	return nil
+}
+
+// chainInfo returns whether zcashd is in initial block download, and its
+// prune height (zero if it isn't pruned), from common.GetBlockchainInfo
+// (so as recently as ChainInfoCacheTTL allows).
+func (s *lwdStreamer) chainInfo() (inIBD bool, pruneHeight int, err error) {
+	info, err := common.GetBlockchainInfo()
+	if err != nil {
+		return false, 0, err
+	}
+	if info.Pruned {
+		pruneHeight = info.PruneHeight
+	}
+	return info.InitialBlockDownload(), pruneHeight, nil
+}
+
+// checkNotInIBD returns an Unavailable error if rejecting block requests
+// during initial block download is enabled (see WithRejectDuringIBD) and
+// zcashd is in initial block download.
+func (s *lwdStreamer) checkNotInIBD() error {
+	if !s.rejectDuringIBD {
+		return nil
+	}
+	inIBD, _, err := s.chainInfo()
+	if err != nil {
+		return err
+	}
+	if inIBD {
+		return status.Error(codes.Unavailable,
+			"zcashd is in initial block download, blocks may be incomplete")
+	}
+	return nil
+}
 
-	return "unknown"
+// prunedError is called when fetching the block at the given height (or a
+// range starting there) fails; if that's because zcashd has pruned the block,
+// it returns an OutOfRange error that includes the earliest available height,
+// to return instead. Otherwise it returns nil.
+func (s *lwdStreamer) prunedError(height uint64) error {
+	_, pruneHeight, err := s.chainInfo()
+	if err != nil {
+		return nil
+	}
+	if height < uint64(pruneHeight) {
+		return status.Errorf(codes.OutOfRange,
+			"block %d has been pruned by zcashd, the earliest available height is %d", height, pruneHeight)
+	}
+	return nil
 }
 
+// dailyActiveBlockInterval is about a day's worth of blocks; a client that
+// requests a block at a multiple of this height is counted (logged) as a
+// daily active user.
+const dailyActiveBlockInterval = 1152
+
 func (s *lwdStreamer) dailyActiveBlock(height uint64, peerip string) {
-	if height%1152 == 0 {
+	if height%dailyActiveBlockInterval == 0 {
 		common.Log.WithFields(logrus.Fields{
 			"method":       "DailyActiveBlock",
 			"peer_addr":    peerip,
@@ -97,6 +595,29 @@ func (s *lwdStreamer) dailyActiveBlock(height uint64, peerip string) {
 	}
 }
 
+// dailyActiveBlocks logs a daily active user for each "key block" from start
+// to end (inclusive).
+func (s *lwdStreamer) dailyActiveBlocks(start, end uint64, peerip string) {
+	forEachKeyBlock(start, end, func(height uint64) {
+		s.dailyActiveBlock(height, peerip)
+	})
+}
+
+// forEachKeyBlock calls f with each multiple of dailyActiveBlockInterval
+// from start to end (inclusive), in order, going directly from one to the
+// next rather than checking every height.
+func forEachKeyBlock(start, end uint64, f func(height uint64)) {
+	first := (start + dailyActiveBlockInterval - 1) / dailyActiveBlockInterval * dailyActiveBlockInterval
+	if first < start {
+		// rounding up overflowed; there's no multiple at or after start
+		return
+	}
+	// (The height >= first test stops the loop if height overflows.)
+	for height := first; height >= first && height <= end; height += dailyActiveBlockInterval {
+		f(height)
+	}
+}
+
 func (s *lwdStreamer) GetZECPrice(ctx context.Context, in *walletrpc.PriceRequest) (*walletrpc.PriceResponse, error) {
 	// Check for prices before zcash was born
 	if in == nil || in.Timestamp <= 1477551600 /* Zcash birthday: 2016-10-28*/ {
@@ -139,73 +660,172 @@ func (s *lwdStreamer) GetCurrentZECPrice(ctx context.Context, in *walletrpc.Empt
 
 // GetLatestBlock returns the height of the best chain, according to zcashd.
 func (s *lwdStreamer) GetLatestBlock(ctx context.Context, placeholder *walletrpc.ChainSpec) (*walletrpc.BlockID, error) {
-	result, rpcErr := common.RawRequest("getblockchaininfo", []json.RawMessage{})
-	if rpcErr != nil {
-		return nil, rpcErr
-	}
-	var getblockchaininfoReply common.ZcashdRpcReplyGetblockchaininfo
-	err := json.Unmarshal(result, &getblockchaininfoReply)
+	getblockchaininfoReply, err := common.GetBlockchainInfo()
 	if err != nil {
 		return nil, err
 	}
 
-	hash, err := hex.DecodeString(getblockchaininfoReply.BestBlockHash)
+	hash, err := parser.DisplayHexToInternal(getblockchaininfoReply.BestBlockHash)
 	if err != nil {
 		return nil, err
 	}
 
 	common.Metrics.LatestBlockCounter.Inc()
-	return &walletrpc.BlockID{Height: uint64(getblockchaininfoReply.Blocks), Hash: parser.Reverse(hash)}, nil
+	return &walletrpc.BlockID{Height: uint64(getblockchaininfoReply.Blocks), Hash: hash}, nil
 }
 
-// GetTaddressTxids is a streaming RPC that returns transaction IDs that have
-// the given transparent address (taddr) as either an input or output.
-func (s *lwdStreamer) GetTaddressTxids(addressBlockFilter *walletrpc.TransparentAddressBlockFilter, resp walletrpc.CompactTxStreamer_GetTaddressTxidsServer) error {
-	if err := checkTaddress(addressBlockFilter.Address); err != nil {
-		return err
-	}
+// maxLongPollTimeout bounds how long GetLatestBlockLongPoll will wait.
+const maxLongPollTimeout = 60 * time.Second
 
-	if addressBlockFilter.Range == nil {
-		return errors.New("Must specify block range")
+// GetLatestBlockLongPoll waits until the cache's tip is above the height the
+// client already knows about, then returns the new tip. If that doesn't happen
+// before the timeout, it returns the current tip (which may be unchanged).
+func (s *lwdStreamer) GetLatestBlockLongPoll(ctx context.Context, in *walletrpc.LatestBlockWait) (*walletrpc.BlockID, error) {
+	timeout := time.Duration(in.TimeoutSeconds) * time.Second
+	if timeout == 0 || timeout > maxLongPollTimeout {
+		timeout = maxLongPollTimeout
 	}
-	if addressBlockFilter.Range.Start == nil {
-		return errors.New("Must specify a start block height")
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		tipChanged := s.cache.TipChanged()
+		height := s.cache.GetLatestHeight()
+		if height >= 0 && uint64(height) > in.Height {
+			break
+		}
+		select {
+		case <-tipChanged:
+			continue
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// Timed out; return the current tip.
+		break
 	}
-	if addressBlockFilter.Range.End == nil {
-		return errors.New("Must specify an end block height")
+	height := s.cache.GetLatestHeight()
+	if height < 0 {
+		return nil, errors.New("no blocks available")
 	}
-	params := make([]json.RawMessage, 1)
-	request := &common.ZcashdRpcRequestGetaddresstxids{
-		Addresses: []string{addressBlockFilter.Address},
-		Start:     addressBlockFilter.Range.Start.Height,
-		End:       addressBlockFilter.Range.End.Height,
+	block := s.cache.Get(height)
+	if block == nil {
+		return nil, errors.New("latest block not available")
 	}
-	param, err := json.Marshal(request)
-	if err != nil {
-		return err
+	common.Metrics.LatestBlockCounter.Inc()
+	return &walletrpc.BlockID{Height: block.Height, Hash: block.Hash}, nil
+}
+
+// SubscribeNewBlocks sends the ID of the cache's tip, then the new tip each
+// time it changes, until the client goes away. After a reorg the tip may be
+// lower, or at the same height with a different hash, than the last one
+// sent. A client that falls behind is sent only the latest tip, not each
+// block in between.
+func (s *lwdStreamer) SubscribeNewBlocks(_ *walletrpc.Empty, resp walletrpc.CompactTxStreamer_SubscribeNewBlocksServer) error {
+	ctx := resp.Context()
+	var last *walletrpc.BlockID
+	for {
+		tipChanged := s.cache.TipChanged()
+		// (The block is nil if a reorg has just removed it; that's a change
+		// still to be signaled.)
+		if block := s.cache.Get(s.cache.GetLatestHeight()); block != nil &&
+			(last == nil || block.Height != last.Height || !bytes.Equal(block.Hash, last.Hash)) {
+			last = &walletrpc.BlockID{Height: block.Height, Hash: block.Hash}
+			if err := resp.Send(last); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tipChanged:
+		}
 	}
-	params[0] = param
-	result, rpcErr := common.RawRequest("getaddresstxids", params)
+}
 
-	// For some reason, the error responses are not JSON
-	if rpcErr != nil {
-		return rpcErr
+// GetLatestBlocks returns the IDs of the given number of most recent blocks
+// (fewer if the chain from Sapling activation is shorter), lowest first and
+// ending with the cache's tip. The blocks come from the cache, or zcashd for
+// any the cache doesn't have; if they don't all link (the chain changed while
+// they were being read), it fails with Aborted, and the client can retry.
+func (s *lwdStreamer) GetLatestBlocks(ctx context.Context, in *walletrpc.LatestBlocksRequest) (*walletrpc.BlockIDList, error) {
+	if in.Count == 0 || int(in.Count) > s.maxLatestBlocks {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"block count %d must be between 1 and %d", in.Count, s.maxLatestBlocks)
+	}
+	tip := s.cache.GetLatestHeight()
+	if tip < 0 {
+		return nil, errors.New("no blocks available")
+	}
+	first := tip - int(in.Count) + 1
+	if first < s.cache.GetFirstHeight() {
+		first = s.cache.GetFirstHeight()
+	}
+	ids := make([]*walletrpc.BlockID, tip-first+1)
+	var child *walletrpc.CompactBlock
+	for height := tip; height >= first; height-- {
+		block, err := common.GetBlock(s.cache, height)
+		if err != nil {
+			return nil, err
+		}
+		if child != nil && !bytes.Equal(child.PrevHash, block.Hash) {
+			return nil, status.Error(codes.Aborted, "the chain changed while reading block IDs, please retry")
+		}
+		ids[height-first] = &walletrpc.BlockID{Height: block.Height, Hash: block.Hash}
+		child = block
 	}
+	common.Metrics.LatestBlockCounter.Inc()
+	return &walletrpc.BlockIDList{Blocks: ids}, nil
+}
 
+// GetTaddressTxids is a streaming RPC that returns transaction IDs that have
+// the given transparent address (taddr) as either an input or output.
+func (s *lwdStreamer) GetTaddressTxids(addressBlockFilter *walletrpc.TransparentAddressBlockFilter, resp walletrpc.CompactTxStreamer_GetTaddressTxidsServer) error {
+	if err := checkTaddress(addressBlockFilter.Address, common.GetNetwork(s.chainName)); err != nil {
+		return err
+	}
+	if addressBlockFilter.MaxEntries < 0 {
+		return status.Errorf(codes.InvalidArgument,
+			"maxEntries %d must not be negative", addressBlockFilter.MaxEntries)
+	}
+	if err := checkAddressBlockRange(addressBlockFilter.Range); err != nil {
+		return err
+	}
+	blockRange := addressBlockFilter.Range
+	if addressBlockFilter.StartHeight > blockRange.Start.Height {
+		blockRange = &walletrpc.BlockRange{
+			Start: &walletrpc.BlockID{Height: addressBlockFilter.StartHeight},
+			End:   blockRange.End,
+		}
+	}
 	var txids []string
-	err = json.Unmarshal(result, &txids)
+	var err error
+	paged := addressBlockFilter.Offset > 0 || addressBlockFilter.Limit > 0 || addressBlockFilter.MaxEntries > 0
+	if blockRange.Start.Height > blockRange.End.Height {
+		// startHeight is beyond the range; there's nothing to send.
+	} else if paged {
+		txids, err = getAddressTxidsSorted(addressBlockFilter.Address, blockRange)
+	} else {
+		txids, err = getAddressTxids([]string{addressBlockFilter.Address}, blockRange)
+	}
 	if err != nil {
 		return err
 	}
+	if paged {
+		resp.SetTrailer(metadata.Pairs(TxidCountTrailer, strconv.Itoa(len(txids))))
+		txids = txidsPage(txids, addressBlockFilter.Offset, addressBlockFilter.Limit)
+		if addressBlockFilter.MaxEntries > 0 {
+			txids = txidsPage(txids, 0, uint64(addressBlockFilter.MaxEntries))
+		}
+	}
 
 	timeout, cancel := context.WithTimeout(resp.Context(), 30*time.Second)
 	defer cancel()
 
 	for _, txidstr := range txids {
-		txid, _ := hex.DecodeString(txidstr)
 		// Txid is read as a string, which is in big-endian order. But when converting
 		// to bytes, it should be little-endian
-		tx, err := s.GetTransaction(timeout, &walletrpc.TxFilter{Hash: parser.Reverse(txid)})
+		txid, _ := parser.DisplayHexToInternal(txidstr)
+		tx, err := s.GetTransaction(timeout, &walletrpc.TxFilter{Hash: txid})
 		if err != nil {
 			return err
 		}
@@ -216,67 +836,452 @@ func (s *lwdStreamer) GetTaddressTxids(addressBlockFilter *walletrpc.Transparent
 	return nil
 }
 
-// GetBlock returns the compact block at the requested height. Requesting a
-// block by hash is not yet supported.
-func (s *lwdStreamer) GetBlock(ctx context.Context, id *walletrpc.BlockID) (*walletrpc.CompactBlock, error) {
-	if id.Height == 0 && id.Hash == nil {
-		return nil, errors.New("request for unspecified identifier")
-	}
+// maxTaddressesTxids is the most addresses GetTaddressesTxids will accept.
+const maxTaddressesTxids = 100
 
-	// Precedence: a hash is more specific than a height. If we have it, use it first.
-	if id.Hash != nil {
-		// TODO: Get block by hash
-		return nil, errors.New("GetBlock by Hash is not yet implemented")
+// GetTaddressesTxids is like GetTaddressTxids, but for a client-streamed list
+// of addresses, all queried in a single getaddresstxids call. The block range
+// is taken from the first message; later messages need only the address.
+// Each transaction is sent once, in order of block height, even if it
+// involves several of the addresses.
+func (s *lwdStreamer) GetTaddressesTxids(filters walletrpc.CompactTxStreamer_GetTaddressesTxidsServer) error {
+	addressList := make([]string, 0)
+	var blockRange *walletrpc.BlockRange
+	for {
+		filter, err := filters.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkTaddress(filter.Address, common.GetNetwork(s.chainName)); err != nil {
+			return err
+		}
+		if len(addressList) >= maxTaddressesTxids {
+			return errors.New("too many addresses, the maximum is " + strconv.Itoa(maxTaddressesTxids))
+		}
+		addressList = append(addressList, filter.Address)
+		if blockRange == nil {
+			blockRange = filter.Range
+		}
 	}
-	cBlock, err := common.GetBlock(s.cache, int(id.Height))
-
+	if len(addressList) == 0 {
+		return errors.New("Must specify at least one address")
+	}
+	txids, err := getAddressTxids(addressList, blockRange)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	common.Metrics.TotalBlocksServedConter.Inc()
-	return cBlock, err
-}
+	timeout, cancel := context.WithTimeout(filters.Context(), 30*time.Second)
+	defer cancel()
 
-// GetBlockRange is a streaming RPC that returns blocks, in compact form,
-// (as also returned by GetBlock) from the block height 'start' to height
-// 'end' inclusively.
-func (s *lwdStreamer) GetBlockRange(span *walletrpc.BlockRange, resp walletrpc.CompactTxStreamer_GetBlockRangeServer) error {
-	blockChan := make(chan *walletrpc.CompactBlock)
-	errChan := make(chan error)
-	if span.Start == nil || span.End == nil {
-		return errors.New("Must specify start and end heights")
+	seen := make(map[string]bool)
+	txs := make([]*walletrpc.RawTransaction, 0, len(txids))
+	for _, txidstr := range txids {
+		if seen[txidstr] {
+			continue
+		}
+		seen[txidstr] = true
+		txid, _ := parser.DisplayHexToInternal(txidstr)
+		tx, err := s.GetTransaction(timeout, &walletrpc.TxFilter{Hash: txid})
+		if err != nil {
+			return err
+		}
+		txs = append(txs, tx)
 	}
-
-	peerip := s.peerIPFromContext(resp.Context())
-
-	// Latency logging
-	go func() {
-		// If there is no ip, ignore
-		if peerip == "unknown" {
-			return
+	sort.SliceStable(txs, func(i, j int) bool { return txs[i].Height < txs[j].Height })
+	for _, tx := range txs {
+		if err = filters.Send(tx); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		// Log only if bulk requesting blocks
-		if span.End.Height-span.Start.Height < 100 {
-			return
-		}
+func checkAddressBlockRange(blockRange *walletrpc.BlockRange) error {
+	if blockRange == nil {
+		return errors.New("Must specify block range")
+	}
+	if blockRange.Start == nil {
+		return errors.New("Must specify a start block height")
+	}
+	if blockRange.End == nil {
+		return errors.New("Must specify an end block height")
+	}
+	return nil
+}
 
-		now := time.Now().UnixNano()
-		s.latencyMutex.Lock()
-		defer s.latencyMutex.Unlock()
+// getAddressTxids returns the txids (big-endian hex strings) of the transactions
+// involving any of the given addresses within the given block range.
+func getAddressTxids(addresses []string, blockRange *walletrpc.BlockRange) ([]string, error) {
+	if err := checkAddressBlockRange(blockRange); err != nil {
+		return nil, err
+	}
+	params := make([]json.RawMessage, 1)
+	request := &common.ZcashdRpcRequestGetaddresstxids{
+		Addresses: addresses,
+		Start:     blockRange.Start.Height,
+		End:       blockRange.End.Height,
+	}
+	param, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	params[0] = param
+	result, rpcErr := common.RawRequest("getaddresstxids", params)
 
-		// remove all old entries
-		for ip, entry := range s.latencyCache {
-			if entry.timeNanos+int64(30*math.Pow10(9)) < now { // delete after 30 seconds
-				delete(s.latencyCache, ip)
+	// For some reason, the error responses are not JSON
+	if rpcErr != nil {
+		return nil, addressIndexError(rpcErr)
+	}
+
+	var txids []string
+	err = json.Unmarshal(result, &txids)
+	if err != nil {
+		return nil, err
+	}
+	return txids, nil
+}
+
+// getAddressTxidsSorted is like getAddressTxids (for a single address), but
+// the txids are sorted by height, then txid (which zcashd's getaddresstxids
+// doesn't guarantee), so that they can be paged through. The heights come
+// from getaddressdeltas, which has one entry per input or output.
+func getAddressTxidsSorted(address string, blockRange *walletrpc.BlockRange) ([]string, error) {
+	if err := checkAddressBlockRange(blockRange); err != nil {
+		return nil, err
+	}
+	param, err := json.Marshal(&common.ZcashdRpcRequestGetaddressdeltas{
+		Addresses: []string{address},
+		Start:     blockRange.Start.Height,
+		End:       blockRange.End.Height,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result, rpcErr := common.RawRequest("getaddressdeltas", []json.RawMessage{param})
+	if rpcErr != nil {
+		return nil, addressIndexError(rpcErr)
+	}
+	var deltas common.ZcashdRpcReplyGetaddressdeltas
+	if err := json.Unmarshal(result, &deltas); err != nil {
+		return nil, err
+	}
+	heights := make(map[string]int)
+	txids := make([]string, 0, len(deltas))
+	for _, delta := range deltas {
+		if _, ok := heights[delta.Txid]; ok {
+			continue
+		}
+		heights[delta.Txid] = delta.Height
+		txids = append(txids, delta.Txid)
+	}
+	sort.Slice(txids, func(i, j int) bool {
+		if heights[txids[i]] != heights[txids[j]] {
+			return heights[txids[i]] < heights[txids[j]]
+		}
+		return txids[i] < txids[j]
+	})
+	return txids, nil
+}
+
+// txidsPage returns the txids starting at offset, at most limit of them
+// (zero means no limit).
+func txidsPage(txids []string, offset, limit uint64) []string {
+	if offset >= uint64(len(txids)) {
+		return nil
+	}
+	txids = txids[offset:]
+	if limit > 0 && limit < uint64(len(txids)) {
+		txids = txids[:limit]
+	}
+	return txids
+}
+
+// GetBlock returns the compact block with the requested hash, if one is
+// given (32 bytes, little-endian as in CompactBlock.Hash), else the one at
+// the requested height. A hash that zcashd doesn't know fails with NotFound.
+// The block's hash is also returned in the BlockHashHeader response header.
+func (s *lwdStreamer) GetBlock(ctx context.Context, id *walletrpc.BlockID) (*walletrpc.CompactBlock, error) {
+	if id.Height == 0 && id.Hash == nil {
+		return nil, errors.New("request for unspecified identifier")
+	}
+
+	if err := s.checkNotInIBD(); err != nil {
+		return nil, err
+	}
+	var cBlock *walletrpc.CompactBlock
+	var err error
+	// Precedence: a hash is more specific than a height. If we have it, use it first.
+	if id.Hash != nil {
+		if len(id.Hash) != 32 {
+			return nil, status.Error(codes.InvalidArgument, "block hash must be 32 bytes")
+		}
+		cBlock, err = common.GetBlockByHash(s.cache, id.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if cBlock == nil {
+			return nil, status.Errorf(codes.NotFound, "block %s not found", parser.InternalToDisplayHex(id.Hash))
+		}
+	} else {
+		cBlock, err = common.GetBlock(s.cache, int(id.Height))
+		if err != nil {
+			if prunedErr := s.prunedError(id.Height); prunedErr != nil {
+				return nil, prunedErr
+			}
+			return nil, err
+		}
+	}
+
+	// Let caching proxies key the response on (height, hash). This fails
+	// only if there's no gRPC stream in the context (direct calls), which
+	// is harmless.
+	grpc.SetHeader(ctx, metadata.Pairs(BlockHashHeader,
+		parser.InternalToDisplayHex(cBlock.Hash)))
+
+	common.Metrics.TotalBlocksServedConter.Inc()
+	return cBlock, err
+}
+
+// GetBlockWithAnchors returns the compact block at the given height along
+// with the anchors as of that block. The tree state is requested by the
+// returned block's hash, so the two are consistent even across a reorg.
+func (s *lwdStreamer) GetBlockWithAnchors(ctx context.Context, id *walletrpc.BlockID) (*walletrpc.BlockWithAnchors, error) {
+	cBlock, err := s.GetBlock(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	treeState, err := s.GetTreeState(ctx, &walletrpc.BlockID{Hash: parser.InternalToDisplay(cBlock.Hash)})
+	if err != nil {
+		return nil, err
+	}
+	return &walletrpc.BlockWithAnchors{
+		Block:         cBlock,
+		SaplingAnchor: treeState.SaplingAnchor,
+		OrchardAnchor: treeState.OrchardAnchor,
+	}, nil
+}
+
+// GetBlockCoinbase returns the coinbase transaction details of the block at
+// the given height (a hash isn't accepted).
+func (s *lwdStreamer) GetBlockCoinbase(ctx context.Context, id *walletrpc.BlockID) (*walletrpc.CoinbaseInfo, error) {
+	if id.Height == 0 {
+		return nil, status.Error(codes.InvalidArgument, "must specify a block height")
+	}
+	if err := s.checkNotInIBD(); err != nil {
+		return nil, err
+	}
+	return common.GetBlockCoinbase(int(id.Height))
+}
+
+// GetBlockRange is a streaming RPC that returns blocks, in compact form,
+// (as also returned by GetBlock) from the block height 'start' to height
+// 'end' inclusively.
+func (s *lwdStreamer) GetBlockRange(span *walletrpc.BlockRange, resp walletrpc.CompactTxStreamer_GetBlockRangeServer) error {
+	return s.sendBlockRange(resp.Context(), span, resp.Send)
+}
+
+// sendBlockRange does the work of GetBlockRange, passing each message to send.
+func (s *lwdStreamer) sendBlockRange(ctx context.Context, span *walletrpc.BlockRange, send func(*walletrpc.CompactBlock) error) error {
+	blockChan := make(chan *walletrpc.CompactBlock)
+	errChan := make(chan error)
+	if span.Start == nil || span.End == nil {
+		return errors.New("Must specify start and end heights")
+	}
+	if err := s.checkSaplingHeight(span.Start.Height); err != nil {
+		return err
+	}
+	if err := s.checkSaplingHeight(span.End.Height); err != nil {
+		return err
+	}
+	if err := s.checkNotInIBD(); err != nil {
+		return err
+	}
+	options := parser.CompactOptions{
+		Transparent:             span.IncludeTransparent,
+		SaplingCiphertextPrefix: int(span.SaplingCiphertextPrefix),
+		OrchardCiphertextPrefix: int(span.OrchardCiphertextPrefix),
+	}
+	if err := options.Validate(); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if span.MetadataOnly && span.SpendsOnly {
+		return status.Error(codes.InvalidArgument, "metadataOnly and spendsOnly can't be combined")
+	}
+	if span.StartHash != nil {
+		if err := s.checkStartHash(span.Start.Height, span.StartHash); err != nil {
+			return err
+		}
+	}
+
+	peerip := logging.PeerIPFromContext(ctx)
+	s.logBlockRange(span, peerip)
+
+	// Stop fetching blocks if the client goes away or a send fails.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if options != (parser.CompactOptions{}) {
+		go common.GetBlockRangeWithOptions(ctx, options, blockChan, errChan, int(span.Start.Height), int(span.End.Height))
+	} else {
+		go common.GetBlockRange(ctx, s.cache, s.rangeCacheMode, blockChan, errChan, int(span.Start.Height), int(span.End.Height))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errChan:
+			if err != nil {
+				low := span.Start.Height
+				if span.End.Height < low {
+					low = span.End.Height
+				}
+				if prunedErr := s.prunedError(low); prunedErr != nil {
+					err = prunedErr
+				}
+				common.Log.WithFields(logrus.Fields{
+					"method":    "GetBlockRange",
+					"start":     span.Start.Height,
+					"end":       span.End.Height,
+					"peer_addr": peerip,
+					"error":     err,
+				}).Warn("Service")
 			}
+			return err
+		case cBlock := <-blockChan:
+			if span.MetadataOnly {
+				cBlock = compactBlockMetadata(cBlock)
+			} else {
+				if span.SpendsOnly {
+					cBlock = compactBlockSpends(cBlock)
+				}
+				cBlock = filterCompactBlock(cBlock, int(span.MinTransactions))
+			}
+			for _, part := range splitCompactBlock(cBlock, int(span.MaxMessageSize)) {
+				if err := send(part); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// GetBlockNullifiers streams, for each block in the range, just its Sapling
+// nullifiers, taken from the compact blocks as GetBlockRange reads them.
+func (s *lwdStreamer) GetBlockNullifiers(span *walletrpc.BlockRange, resp walletrpc.CompactTxStreamer_GetBlockNullifiersServer) error {
+	// Plain compact blocks (so from the cache), each sent whole.
+	plain := &walletrpc.BlockRange{
+		Start:     span.Start,
+		End:       span.End,
+		StartHash: span.StartHash,
+	}
+	return s.sendBlockRange(resp.Context(), plain, func(cBlock *walletrpc.CompactBlock) error {
+		nullifiers := &walletrpc.BlockNullifiers{
+			Height: cBlock.Height,
+			Hash:   cBlock.Hash,
+		}
+		for _, tx := range cBlock.Vtx {
+			for _, spend := range tx.Spends {
+				nullifiers.SaplingNullifiers = append(nullifiers.SaplingNullifiers, spend.Nf)
+			}
+			for _, action := range tx.Actions {
+				nullifiers.OrchardNullifiers = append(nullifiers.OrchardNullifiers, action.Nullifier)
+			}
+		}
+		return resp.Send(nullifiers)
+	})
+}
+
+// ExportBlocks streams the compact blocks in the given range, in the format
+// common.ImportBlocks reads, so they can be backed up or loaded into another
+// lightwalletd's cache.
+func (s *lwdStreamer) ExportBlocks(span *walletrpc.BlockRange, resp walletrpc.CompactTxStreamer_ExportBlocksServer) error {
+	if span.Start == nil || span.End == nil {
+		return errors.New("Must specify start and end heights")
+	}
+	if span.Start.Height > span.End.Height {
+		return status.Errorf(codes.InvalidArgument,
+			"start height %d is above end height %d", span.Start.Height, span.End.Height)
+	}
+	if count := span.End.Height - span.Start.Height + 1; count > uint64(s.maxExportBlocks) {
+		return status.Errorf(codes.InvalidArgument,
+			"range spans %d blocks, more than the maximum %d", count, s.maxExportBlocks)
+	}
+	// Plain compact blocks (so from the cache), each sent whole.
+	plain := &walletrpc.BlockRange{
+		Start:     span.Start,
+		End:       span.End,
+		StartHash: span.StartHash,
+	}
+	return s.sendBlockRange(resp.Context(), plain, func(cBlock *walletrpc.CompactBlock) error {
+		data, err := common.MarshalExportRecord(cBlock)
+		if err != nil {
+			return err
+		}
+		return resp.Send(&walletrpc.BlockExport{Height: cBlock.Height, Data: data})
+	})
+}
+
+// checkStartHash returns FailedPrecondition, giving the actual hash, if the
+// block at the given height doesn't have the given hash (see BlockRange).
+func (s *lwdStreamer) checkStartHash(height uint64, hash []byte) error {
+	startBlock, err := common.GetBlock(s.cache, int(height))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(startBlock.Hash, hash) {
+		return status.Errorf(codes.FailedPrecondition,
+			"block at height %d has hash %s", height,
+			parser.InternalToDisplayHex(startBlock.Hash))
+	}
+	return nil
+}
+
+// GetBlockRangeReverse is GetBlockRange, but streams the blocks from the
+// higher of the two heights down to the lower. A startHash is still checked
+// against the block at start.height.
+func (s *lwdStreamer) GetBlockRangeReverse(span *walletrpc.BlockRange, resp walletrpc.CompactTxStreamer_GetBlockRangeReverseServer) error {
+	if span.Start == nil || span.End == nil {
+		return errors.New("Must specify start and end heights")
+	}
+	if span.StartHash != nil {
+		if err := s.checkSaplingHeight(span.Start.Height); err != nil {
+			return err
 		}
+		if err := s.checkStartHash(span.Start.Height, span.StartHash); err != nil {
+			return err
+		}
+	}
+	reversed := proto.Clone(span).(*walletrpc.BlockRange)
+	reversed.StartHash = nil
+	if reversed.Start.Height < reversed.End.Height {
+		reversed.Start, reversed.End = reversed.End, reversed.Start
+	}
+	return s.sendBlockRange(resp.Context(), reversed, resp.Send)
+}
 
-		// Look up if this ip address has a previous getblock range
-		if entry, ok := s.latencyCache[peerip]; ok {
+// logBlockRange does GetBlockRange's logging and metrics. None of it blocks
+// (the latency cache drops rather than waits), and the work doesn't depend
+// on the size of the range, so it's done in line rather than in goroutines,
+// which would add up with many concurrent streams.
+func (s *lwdStreamer) logBlockRange(span *walletrpc.BlockRange, peerip string) {
+	// The range may be in either order.
+	low, high := span.Start.Height, span.End.Height
+	if low > high {
+		low, high = high, low
+	}
+	// Latency logging, only if bulk requesting blocks, and if there is an ip
+	if peerip != "unknown" && high-low >= 100 {
+		now := time.Now().UnixNano()
+		// Add or update the ip entry, and look up if this ip address has a
+		// previous getblock range
+		entry, _ := s.latency.record(peerip, low, high, now)
+		if entry != nil {
 			// Log only continous blocks
-			if entry.lastBlock+1 == span.Start.Height {
+			if entry.lastBlock+1 == low && s.logSamplers["GetBlockRangeLatency"].Sample() {
 				common.Log.WithFields(logrus.Fields{
 					"method":         "GetBlockRangeLatency",
 					"peer_addr":      peerip,
@@ -286,54 +1291,268 @@ func (s *lwdStreamer) GetBlockRange(span *walletrpc.BlockRange, resp walletrpc.C
 				}).Info("Service")
 			}
 		}
+	}
 
-		// Add or update the ip entry
-		s.latencyCache[peerip] = &latencyCacheEntry{
-			lastBlock:   span.End.Height,
-			totalBlocks: span.End.Height - span.Start.Height + 1,
-			timeNanos:   now,
-		}
-	}()
-
-	// Logging and metrics
-	go func() {
-		// Log a daily active user if the user requests the day's "key block"
-		for height := span.Start.Height; height <= span.End.Height; height++ {
-			s.dailyActiveBlock(height, peerip)
-		}
+	// Log a daily active user if the user requests the day's "key block"
+	s.dailyActiveBlocks(low, high, peerip)
 
+	if s.logSamplers["GetBlockRange"].Sample() {
 		common.Log.WithFields(logrus.Fields{
 			"method":    "GetBlockRange",
 			"start":     span.Start.Height,
 			"end":       span.End.Height,
 			"peer_addr": peerip,
 		}).Info("Service")
-		common.Metrics.TotalBlocksServedConter.Add(math.Abs(float64(span.Start.Height) - float64(span.End.Height)))
-	}()
+	}
+	common.Metrics.TotalBlocksServedConter.Add(math.Abs(float64(span.Start.Height) - float64(span.End.Height)))
+}
 
-	go common.GetBlockRange(s.cache, blockChan, errChan, int(span.Start.Height), int(span.End.Height))
+// GetBlockRangeAcked is GetBlockRange with flow control: the client's first
+// message gives the range and a window, and its later messages acknowledge
+// the blocks it has received; the server sends (and fetches) no more than
+// the window's worth of blocks beyond those acknowledged.
+func (s *lwdStreamer) GetBlockRangeAcked(stream walletrpc.CompactTxStreamer_GetBlockRangeAckedServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if first.Range == nil {
+		return status.Error(codes.InvalidArgument, "the first message must give the range")
+	}
+	if first.Window == 0 {
+		return status.Error(codes.InvalidArgument, "the window must be nonzero")
+	}
+	window := uint64(first.Window)
 
-	for {
-		select {
-		case err := <-errChan:
-			return err
-		case cBlock := <-blockChan:
-			err := resp.Send(cBlock)
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	// Read acknowledgments until the client closes its side of the stream.
+	acks := make(chan uint64)
+	ackErr := make(chan error, 1)
+	go func() {
+		for {
+			ack, err := stream.Recv()
 			if err != nil {
+				ackErr <- err
+				return
+			}
+			select {
+			case acks <- ack.Received:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var sent, received uint64
+	var partial bool // some, but not all, of a block's messages have been sent
+	return s.sendBlockRange(ctx, first.Range, func(part *walletrpc.CompactBlock) error {
+		for !partial && sent-received >= window {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case err := <-ackErr:
+				if err == io.EOF {
+					return status.Error(codes.FailedPrecondition,
+						"stream closed with blocks unacknowledged")
+				}
 				return err
+			case r := <-acks:
+				if r < received || r > sent {
+					return status.Errorf(codes.InvalidArgument,
+						"acknowledged %d blocks, but %d sent and %d acknowledged before", r, sent, received)
+				}
+				received = r
+			}
+		}
+		if err := stream.Send(part); err != nil {
+			return err
+		}
+		partial = part.More
+		if !part.More {
+			sent++
+		}
+		return nil
+	})
+}
+
+// GetFullBlockRange is like GetBlockRange, but streams full blocks (from
+// zcashd, not the cache), optionally with each block's hash.
+func (s *lwdStreamer) GetFullBlockRange(in *walletrpc.FullBlockRange, resp walletrpc.CompactTxStreamer_GetFullBlockRangeServer) error {
+	span := in.Range
+	if span == nil || span.Start == nil || span.End == nil {
+		return errors.New("Must specify start and end heights")
+	}
+	if err := s.checkNotInIBD(); err != nil {
+		return err
+	}
+	logFields := logrus.Fields{
+		"method":    "GetFullBlockRange",
+		"start":     span.Start.Height,
+		"end":       span.End.Height,
+		"peer_addr": logging.PeerIPFromContext(resp.Context()),
+	}
+	if s.logSamplers["GetFullBlockRange"].Sample() {
+		common.Log.WithFields(logFields).Info("Service")
+	}
+
+	start, end := int(span.Start.Height), int(span.End.Height)
+	dir := 1
+	if start > end {
+		dir = -1
+	}
+	for height := start; ; height += dir {
+		if err := resp.Context().Err(); err != nil {
+			return err
+		}
+		data, hash, err := common.GetFullBlock(height)
+		if err != nil {
+			common.Log.WithFields(logFields).WithField("error", err).Warn("Service")
+			return err
+		}
+		block := &walletrpc.FullBlock{Height: uint64(height), Data: data}
+		if in.IncludeHash {
+			block.Hash = hash
+		}
+		if err := resp.Send(block); err != nil {
+			return err
+		}
+		if height == end {
+			return nil
+		}
+	}
+}
+
+// filterCompactBlock returns the block, or if it has fewer than minTx compact
+// transactions, a marker for it without the transactions. The block (which
+// may be cached) isn't modified.
+func filterCompactBlock(block *walletrpc.CompactBlock, minTx int) *walletrpc.CompactBlock {
+	if len(block.Vtx) >= minTx {
+		return block
+	}
+	return &walletrpc.CompactBlock{
+		ProtoVersion: block.ProtoVersion,
+		Height:       block.Height,
+		Hash:         block.Hash,
+		PrevHash:     block.PrevHash,
+		Time:         block.Time,
+		Header:       block.Header,
+		Filtered:     true,
+	}
+}
+
+// compactBlockMetadata returns a copy of the block without its compact
+// transactions, only their number (see BlockRange.metadataOnly).
+func compactBlockMetadata(block *walletrpc.CompactBlock) *walletrpc.CompactBlock {
+	return &walletrpc.CompactBlock{
+		ProtoVersion: block.ProtoVersion,
+		Height:       block.Height,
+		Hash:         block.Hash,
+		PrevHash:     block.PrevHash,
+		Time:         block.Time,
+		TxCount:      uint32(len(block.Vtx)),
+	}
+}
+
+// compactBlockSpends returns a copy of the block with only the compact
+// transactions that have Sapling spends or Orchard actions, reduced to their
+// nullifiers (see BlockRange.spendsOnly).
+func compactBlockSpends(block *walletrpc.CompactBlock) *walletrpc.CompactBlock {
+	spends := &walletrpc.CompactBlock{
+		ProtoVersion: block.ProtoVersion,
+		Height:       block.Height,
+		Hash:         block.Hash,
+		PrevHash:     block.PrevHash,
+		Time:         block.Time,
+		Header:       block.Header,
+	}
+	for _, tx := range block.Vtx {
+		if len(tx.Spends) == 0 && len(tx.Actions) == 0 {
+			continue
+		}
+		ctx := &walletrpc.CompactTx{
+			Index:  tx.Index,
+			Hash:   tx.Hash,
+			Spends: tx.Spends,
+		}
+		for _, action := range tx.Actions {
+			ctx.Actions = append(ctx.Actions, &walletrpc.CompactOrchardAction{Nullifier: action.Nullifier})
+		}
+		spends.Vtx = append(spends.Vtx, ctx)
+	}
+	return spends
+}
+
+// splitCompactBlock returns the block as a list of messages each no larger
+// than maxSize bytes (if possible; a single transaction isn't split). The
+// first message carries the block's header fields, the continuations only
+// its height and hash; all but the last have "more" set. The given block
+// may be shared with the cache, so it's never modified.
+func splitCompactBlock(block *walletrpc.CompactBlock, maxSize int) []*walletrpc.CompactBlock {
+	if maxSize <= 0 || proto.Size(block) <= maxSize {
+		return []*walletrpc.CompactBlock{block}
+	}
+	part := &walletrpc.CompactBlock{
+		ProtoVersion: block.ProtoVersion,
+		Height:       block.Height,
+		Hash:         block.Hash,
+		PrevHash:     block.PrevHash,
+		Time:         block.Time,
+		Header:       block.Header,
+		More:         true,
+	}
+	size := proto.Size(part)
+	parts := []*walletrpc.CompactBlock{part}
+	for _, tx := range block.Vtx {
+		// Key (one byte), length, and the transaction itself
+		txSize := proto.Size(tx)
+		txSize += 1 + proto.SizeVarint(uint64(txSize))
+		if len(part.Vtx) > 0 && size+txSize > maxSize {
+			part = &walletrpc.CompactBlock{
+				ProtoVersion: block.ProtoVersion,
+				Height:       block.Height,
+				Hash:         block.Hash,
+				More:         true,
 			}
+			size = proto.Size(part)
+			parts = append(parts, part)
 		}
+		part.Vtx = append(part.Vtx, tx)
+		size += txSize
 	}
+	part.More = false
+	return parts
 }
 
+// maxSkipHashHops is the most skip hashes (each naming an earlier block with
+// the same tree state) GetTreeState follows; zcashd's lead straight to the
+// block with the state, so more means a broken reply.
+const maxSkipHashHops = 100
+
 // GetTreeState returns the note commitment tree state corresponding to the given block.
 // See section 3.7 of the Zcash protocol specification. It returns several other useful
 // values also (even though they can be obtained using GetBlock).
-// The block can be specified by either height or hash.
+// The block can be specified by either height or hash. An empty tree state
+// gives codes.OutOfRange if it's from before Sapling activation, else
+// codes.Internal. From Orchard activation, the Orchard tree state is
+// included too.
 func (s *lwdStreamer) GetTreeState(ctx context.Context, id *walletrpc.BlockID) (*walletrpc.TreeState, error) {
 	if id.Height == 0 && id.Hash == nil {
 		return nil, errors.New("request for unspecified identifier")
 	}
+	var key string
+	if id.Height > 0 {
+		if err := s.checkSaplingHeight(id.Height); err != nil {
+			return nil, err
+		}
+		key = treeStateHeightKey(id.Height)
+	} else {
+		key = treeStateHashKey(hex.EncodeToString(id.Hash))
+	}
+	if treeState := s.treeStates.get(key); treeState != nil {
+		return treeState, nil
+	}
 	// The Zcash z_gettreestate rpc accepts either a block height or block hash
 	params := make([]json.RawMessage, 1)
 	var hashJSON []byte
@@ -352,7 +1571,21 @@ func (s *lwdStreamer) GetTreeState(ctx context.Context, id *walletrpc.BlockID) (
 		params[0] = hashJSON
 	}
 	var gettreestateReply common.ZcashdRpcReplyGettreestate
-	for {
+	// height and anchors of the requested block (the skip-hash loop may
+	// move to an earlier one)
+	requestedHeight := -1
+	var saplingAnchor, orchardAnchor string
+	// the reply for the requested block, whose Orchard skip hash (if any)
+	// differs from its Sapling one
+	var requested common.ZcashdRpcReplyGettreestate
+	for hops := 0; ; hops++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if hops > maxSkipHashHops {
+			return nil, status.Errorf(codes.Internal,
+				"zcashd's tree state skip hashes didn't lead to a tree state within %d hops", maxSkipHashHops)
+		}
 		result, rpcErr := common.RawRequest("z_gettreestate", params)
 		if rpcErr != nil {
 			return nil, rpcErr
@@ -361,6 +1594,16 @@ func (s *lwdStreamer) GetTreeState(ctx context.Context, id *walletrpc.BlockID) (
 		if err != nil {
 			return nil, err
 		}
+		if requestedHeight < 0 {
+			requestedHeight = gettreestateReply.Height
+			requested = gettreestateReply
+			saplingAnchor = gettreestateReply.Sapling.Commitments.FinalRoot
+			orchardAnchor = gettreestateReply.Orchard.Commitments.FinalRoot
+			// The block may have been specified by hash.
+			if err := s.checkSaplingHeight(uint64(requestedHeight)); err != nil {
+				return nil, err
+			}
+		}
 		if gettreestateReply.Sapling.Commitments.FinalState != "" {
 			break
 		}
@@ -374,64 +1617,412 @@ func (s *lwdStreamer) GetTreeState(ctx context.Context, id *walletrpc.BlockID) (
 		params[0] = hashJSON
 	}
 	if gettreestateReply.Sapling.Commitments.FinalState == "" {
-		return nil, errors.New("zcashd did not return treestate")
+		// The skip-hash loop can legitimately end before Sapling activation
+		// (the tree was still empty); anything else is zcashd's failure.
+		if activation := s.cache.GetFirstHeight(); gettreestateReply.Height < activation {
+			return nil, status.Errorf(codes.OutOfRange,
+				"no Sapling tree state: height %d is before Sapling activation height %d",
+				gettreestateReply.Height, activation)
+		}
+		return nil, status.Errorf(codes.Internal,
+			"zcashd did not return a tree state for height %d", gettreestateReply.Height)
+	}
+	orchardTree, err := orchardTreeState(ctx, &requested)
+	if err != nil {
+		return nil, err
+	}
+	// The tree states (the Sapling one found by way of skip hashes) are as
+	// of the requested block, which the reply describes.
+	treeState := &walletrpc.TreeState{
+		Network: s.chainName,
+		Height:  uint64(requested.Height),
+		Hash:    requested.Hash,
+		Time:    requested.Time,
+		Tree:    gettreestateReply.Sapling.Commitments.FinalState,
+
+		SaplingAnchor: saplingAnchor,
+		OrchardAnchor: orchardAnchor,
+		OrchardTree:   orchardTree,
+	}
+	// Don't cache blocks near the tip; they may still be reorged away. The
+	// reply is cached only for the requested block (by height and hash),
+	// not for a block a skip hash led to, whose Orchard tree may differ.
+	if tip := s.cache.GetLatestHeight(); tip >= 0 && requestedHeight <= tip-treeStateCacheDepth {
+		s.treeStates.add(key, treeState)
+		s.treeStates.add(treeStateHeightKey(treeState.Height), treeState)
+		s.treeStates.add(treeStateHashKey(treeState.Hash), treeState)
+	}
+	return treeState, nil
+}
+
+// orchardTreeState returns the Orchard tree state as of the block of the
+// given z_gettreestate reply, following its Orchard skip hashes as
+// GetTreeState follows Sapling ones. It's empty before Orchard activation
+// (zcashd gives no state or skip hash).
+func orchardTreeState(ctx context.Context, reply *common.ZcashdRpcReplyGettreestate) (string, error) {
+	for hops := 0; reply.Orchard.Commitments.FinalState == "" && reply.Orchard.SkipHash != ""; hops++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if hops >= maxSkipHashHops {
+			return "", status.Errorf(codes.Internal,
+				"zcashd's Orchard tree state skip hashes didn't lead to a tree state within %d hops", maxSkipHashHops)
+		}
+		hashJSON, err := json.Marshal(reply.Orchard.SkipHash)
+		if err != nil {
+			return "", err
+		}
+		result, rpcErr := common.RawRequest("z_gettreestate", []json.RawMessage{hashJSON})
+		if rpcErr != nil {
+			return "", rpcErr
+		}
+		reply = &common.ZcashdRpcReplyGettreestate{}
+		if err := json.Unmarshal(result, reply); err != nil {
+			return "", err
+		}
+	}
+	return reply.Orchard.Commitments.FinalState, nil
+}
+
+// GetTransaction returns the raw transaction bytes that are returned
+// by the zcashd 'getrawtransaction' RPC.
+func (s *lwdStreamer) GetTransaction(ctx context.Context, txf *walletrpc.TxFilter) (*walletrpc.RawTransaction, error) {
+	if txf.Hash != nil {
+		return s.getTransactionByHash(ctx, txf, true)
+	}
+
+	if txf.Block != nil && txf.Block.Hash != nil {
+		return s.getTransactionByBlockIndex(ctx, txf)
+	}
+	return nil, errors.New("Please call GetTransaction with txid")
+}
+
+// getTransactionByHash returns the transaction with hash txf.Hash; if
+// checkOrphaned is set, zcashd's reply is checked as orphanedTxMode says.
+func (s *lwdStreamer) getTransactionByHash(ctx context.Context, txf *walletrpc.TxFilter, checkOrphaned bool) (*walletrpc.RawTransaction, error) {
+	if len(txf.Hash) != 32 {
+		return nil, errors.New("Transaction ID has invalid length")
+	}
+	txinfo, err := s.getRawTransaction(ctx, txf.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if checkOrphaned && s.orphanedTxMode != common.OrphanedTxIgnore {
+		orphaned, err := isOrphaned(txinfo)
+		if err != nil {
+			return nil, err
+		}
+		if orphaned && s.orphanedTxMode == common.OrphanedTxReresolve {
+			found, err := reresolveOrphaned(ctx, txf.Hash, txinfo)
+			if err != nil {
+				return nil, err
+			}
+			orphaned = !found
+		}
+		if orphaned {
+			txinfo.Height = 0
+			txinfo.Confirmations = 0
+			txinfo.Blockhash = ""
+		}
+	}
+	// Clients polling for confirmation needn't be sent the data.
+	var txBytes []byte
+	if !txf.StatusOnly {
+		txBytes, err = hex.DecodeString(txinfo.Hex)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Mempool transactions have no block hash.
+	blockHash, err := hex.DecodeString(txinfo.Blockhash)
+	if err != nil {
+		return nil, err
+	}
+	var confirmations uint64
+	if txinfo.Confirmations > 0 {
+		confirmations = uint64(txinfo.Confirmations)
+	}
+	var onMainChain bool
+	if txf.CheckMainChain && len(blockHash) > 0 && txinfo.Height > 0 {
+		onMainChain, err = s.onMainChain(txinfo.Height, blockHash)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &walletrpc.RawTransaction{
+		Data:                 txBytes,
+		Height:               uint64(txinfo.Height),
+		BlockHash:            blockHash,
+		Confirmations:        confirmations,
+		ConfirmedOnMainChain: onMainChain,
+	}, nil
+}
+
+// getRawTransaction returns zcashd's (verbose) getrawtransaction reply for
+// the transaction with the given hash (little-endian), retrying as
+// txRetries says while zcashd doesn't know of it.
+func (s *lwdStreamer) getRawTransaction(ctx context.Context, hash []byte) (*common.ZcashdRpcReplyGetrawtransaction, error) {
+	leHashStringJSON, err := json.Marshal(parser.InternalToDisplayHex(hash))
+	if err != nil {
+		return nil, err
+	}
+	params := []json.RawMessage{
+		leHashStringJSON,
+		json.RawMessage("1"),
+	}
+	result, rpcErr := common.RawRequest("getrawtransaction", params)
+	for retry := 0; retry < s.txRetries && isTxNotFound(rpcErr); retry++ {
+		timer := time.NewTimer(s.txRetryDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, rpcErr
+		case <-timer.C:
+		}
+		result, rpcErr = common.RawRequest("getrawtransaction", params)
+	}
+
+	// For some reason, the error responses are not JSON
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	// Many other fields are returned, but we need only these.
+	var txinfo common.ZcashdRpcReplyGetrawtransaction
+	if err := json.Unmarshal(result, &txinfo); err != nil {
+		return nil, err
+	}
+	return &txinfo, nil
+}
+
+// orphanedTxSearchDepth is how many blocks either side of an orphaned
+// transaction's stale height reresolveOrphaned looks in.
+const orphanedTxSearchDepth = 5
+
+// reresolveOrphaned looks for the transaction (hash little-endian), which
+// getrawtransaction reported in a block that's no longer on zcashd's best
+// chain, in the best chain's blocks within orphanedTxSearchDepth of the
+// reported height. If it's found, txinfo is updated to the block it's in.
+func reresolveOrphaned(ctx context.Context, hash []byte, txinfo *common.ZcashdRpcReplyGetrawtransaction) (bool, error) {
+	txid := parser.InternalToDisplayHex(hash)
+	start := txinfo.Height - orphanedTxSearchDepth
+	if start < 1 {
+		start = 1
+	}
+	for height := start; height <= txinfo.Height+orphanedTxSearchDepth; height++ {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		heightJSON, err := json.Marshal(strconv.Itoa(height))
+		if err != nil {
+			return false, err
+		}
+		result, rpcErr := common.RawRequest("getblock", []json.RawMessage{heightJSON, json.RawMessage("1")})
+		if rpcErr != nil {
+			// zcashd's "Block height out of range": past its tip
+			if strings.HasPrefix(rpcErr.Error(), "-8:") {
+				break
+			}
+			return false, rpcErr
+		}
+		var block common.ZcashdRpcReplyGetblock
+		if err := json.Unmarshal(result, &block); err != nil {
+			return false, err
+		}
+		for _, blockTxid := range block.Tx {
+			if strings.EqualFold(blockTxid, txid) {
+				txinfo.Height = block.Height
+				txinfo.Blockhash = block.Hash
+				txinfo.Confirmations = block.Confirmations
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// isOrphaned returns whether the transaction, as getrawtransaction reported
+// it, is mined in a block other than the one zcashd's getblockhash gives at
+// the reported height (or zcashd's chain no longer reaches that height).
+func isOrphaned(txinfo *common.ZcashdRpcReplyGetrawtransaction) (bool, error) {
+	if txinfo.Blockhash == "" || txinfo.Height <= 0 {
+		return false, nil
+	}
+	heightJSON, err := json.Marshal(txinfo.Height)
+	if err != nil {
+		return false, err
+	}
+	result, rpcErr := common.RawRequest("getblockhash", []json.RawMessage{heightJSON})
+	if rpcErr != nil {
+		// zcashd's "Block height out of range"
+		if strings.HasPrefix(rpcErr.Error(), "-8:") {
+			return true, nil
+		}
+		return false, rpcErr
+	}
+	var hash string
+	if err := json.Unmarshal(result, &hash); err != nil {
+		return false, err
+	}
+	return !strings.EqualFold(hash, txinfo.Blockhash), nil
+}
+
+// onMainChain returns whether the block at the given height (from the cache,
+// or zcashd if the cache doesn't have it yet) has the given (big-endian) hash.
+func (s *lwdStreamer) onMainChain(height int, blockHash []byte) (bool, error) {
+	cBlock, err := common.GetBlock(s.cache, height)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(parser.InternalToDisplay(cBlock.Hash), blockHash), nil
+}
+
+// getTransactionByBlockIndex returns the transaction at txf.Index in the
+// block with hash txf.Block.Hash (little-endian, as CompactBlock.hash).
+func (s *lwdStreamer) getTransactionByBlockIndex(ctx context.Context, txf *walletrpc.TxFilter) (*walletrpc.RawTransaction, error) {
+	block, txid, err := blockTxid(txf)
+	if err != nil {
+		return nil, err
+	}
+	// The block is known; there's no reported height to check.
+	rawtx, err := s.getTransactionByHash(ctx, &walletrpc.TxFilter{Hash: txid, StatusOnly: txf.StatusOnly}, false)
+	if err != nil {
+		return nil, err
+	}
+	// The block needn't be on the best chain; report the one asked about.
+	blockHash, err := hex.DecodeString(block.Hash)
+	if err != nil {
+		return nil, err
 	}
-	return &walletrpc.TreeState{
-		Network: s.chainName,
-		Height:  uint64(gettreestateReply.Height),
-		Hash:    gettreestateReply.Hash,
-		Time:    gettreestateReply.Time,
-		Tree:    gettreestateReply.Sapling.Commitments.FinalState,
-	}, nil
-}
-
-// GetTransaction returns the raw transaction bytes that are returned
-// by the zcashd 'getrawtransaction' RPC.
-func (s *lwdStreamer) GetTransaction(ctx context.Context, txf *walletrpc.TxFilter) (*walletrpc.RawTransaction, error) {
-	if txf.Hash != nil {
-		if len(txf.Hash) != 32 {
-			return nil, errors.New("Transaction ID has invalid length")
-		}
-		leHashStringJSON, err := json.Marshal(hex.EncodeToString(parser.Reverse(txf.Hash)))
+	rawtx.Height = uint64(block.Height)
+	rawtx.BlockHash = blockHash
+	if txf.CheckMainChain {
+		rawtx.ConfirmedOnMainChain, err = s.onMainChain(block.Height, blockHash)
 		if err != nil {
 			return nil, err
 		}
-		params := []json.RawMessage{
-			leHashStringJSON,
-			json.RawMessage("1"),
-		}
-		result, rpcErr := common.RawRequest("getrawtransaction", params)
+	}
+	return rawtx, nil
+}
 
-		// For some reason, the error responses are not JSON
-		if rpcErr != nil {
-			return nil, rpcErr
-		}
-		// Many other fields are returned, but we need only these two.
-		var txinfo common.ZcashdRpcReplyGetrawtransaction
-		err = json.Unmarshal(result, &txinfo)
-		if err != nil {
-			return nil, err
-		}
-		txBytes, err := hex.DecodeString(txinfo.Hex)
-		if err != nil {
-			return nil, err
+// blockTxid returns zcashd's verbose getblock reply for the block with hash
+// txf.Block.Hash, and the txid (little-endian) at txf.Index in it.
+func blockTxid(txf *walletrpc.TxFilter) (*common.ZcashdRpcReplyGetblock, []byte, error) {
+	if len(txf.Block.Hash) != 32 {
+		return nil, nil, status.Error(codes.InvalidArgument, "block hash must be 32 bytes")
+	}
+	hashJSON, err := json.Marshal(parser.InternalToDisplayHex(txf.Block.Hash))
+	if err != nil {
+		return nil, nil, err
+	}
+	params := []json.RawMessage{
+		hashJSON,
+		json.RawMessage("1"),
+	}
+	result, rpcErr := common.RawRequest("getblock", params)
+	if rpcErr != nil {
+		// zcashd's "Block not found"
+		if strings.HasPrefix(rpcErr.Error(), "-5:") {
+			return nil, nil, status.Errorf(codes.NotFound, "block %s not found",
+				parser.InternalToDisplayHex(txf.Block.Hash))
 		}
-		return &walletrpc.RawTransaction{
-			Data:   txBytes,
-			Height: uint64(txinfo.Height),
-		}, nil
+		return nil, nil, rpcErr
+	}
+	var block common.ZcashdRpcReplyGetblock
+	if err := json.Unmarshal(result, &block); err != nil {
+		return nil, nil, err
 	}
+	if txf.Index >= uint64(len(block.Tx)) {
+		return nil, nil, status.Errorf(codes.InvalidArgument,
+			"index %d is out of range, block has %d transactions", txf.Index, len(block.Tx))
+	}
+	txid, err := parser.DisplayHexToInternal(block.Tx[txf.Index])
+	if err != nil {
+		return nil, nil, err
+	}
+	return &block, txid, nil
+}
 
-	if txf.Block != nil && txf.Block.Hash != nil {
-		return nil, errors.New("Can't GetTransaction with a blockhash+num. Please call GetTransaction with txid")
+// GetTransactionSummary returns a summary of the requested transaction,
+// which is found as by GetTransaction (statusOnly is ignored; the data is
+// needed).
+func (s *lwdStreamer) GetTransactionSummary(ctx context.Context, txf *walletrpc.TxFilter) (*walletrpc.TransactionSummary, error) {
+	rawtx, err := s.GetTransaction(ctx, &walletrpc.TxFilter{Block: txf.Block, Index: txf.Index, Hash: txf.Hash})
+	if err != nil {
+		return nil, err
 	}
-	return nil, errors.New("Please call GetTransaction with txid")
+	tx := parser.NewTransaction()
+	rest, err := tx.ParseFromSlice(rawtx.Data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("transaction has extra data")
+	}
+	// The parser doesn't compute a v5 transaction's txid (ZIP 244); use
+	// the one it was found by.
+	if tx.Version() >= 5 {
+		txid := txf.Hash
+		if txid == nil {
+			if _, txid, err = blockTxid(txf); err != nil {
+				return nil, err
+			}
+		}
+		tx.SetTxID(parser.InternalToDisplay(txid))
+	}
+	return &walletrpc.TransactionSummary{
+		Txid:                tx.GetEncodableHash(),
+		Height:              rawtx.Height,
+		BlockHash:           rawtx.BlockHash,
+		IsCoinbase:          tx.IsCoinbase(),
+		HasSaplingElements:  tx.HasSaplingElements(),
+		HasSproutElements:   tx.HasSproutElements(),
+		SaplingValueBalance: tx.SaplingValueBalance(),
+		OrchardValueBalance: tx.OrchardValueBalance(),
+	}, nil
+}
+
+// isTxNotFound indicates whether the error is zcashd's RPC_INVALID_ADDRESS_OR_KEY
+// (-5), which getrawtransaction returns for an unknown transaction.
+func isTxNotFound(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "-5:")
+}
+
+// addressIndexError returns, in place of the error zcashd gives for an
+// address query (getaddresstxids and so on) when it isn't maintaining the
+// address index (-insightexplorer or -lightwalletd, formerly -addressindex),
+// a clear FailedPrecondition error; other errors are returned unchanged.
+func addressIndexError(err error) error {
+	msg := err.Error()
+	if strings.Contains(msg, "Address index not enabled") ||
+		(strings.Contains(msg, "getaddress") && strings.Contains(msg, "is disabled")) {
+		return status.Error(codes.FailedPrecondition,
+			"server's zcashd is missing addressindex; transparent address queries unavailable")
+	}
+	return err
 }
 
 // GetLightdInfo gets the LightWalletD (this server) info, and includes information
-// it gets from its backend zcashd.
+// it gets from its backend zcashd, the range of blocks in its cache, and
+// whether Ping is enabled.
 func (s *lwdStreamer) GetLightdInfo(ctx context.Context, in *walletrpc.Empty) (*walletrpc.LightdInfo, error) {
-	return common.GetLightdInfo()
+	info, err := common.GetLightdInfo()
+	if err != nil {
+		return nil, err
+	}
+	info.PingEnabled = s.pingEnable
+	if latest := s.cache.GetLatestHeight(); latest >= 0 {
+		// The cache can hold blocks above zcashd's tip for a while (after
+		// a reorg to a shorter chain, or a darkside rewind); they're no
+		// longer on the chain, so don't count them.
+		if latest > int(info.BlockHeight) {
+			latest = int(info.BlockHeight)
+		}
+		if first := s.cache.GetFirstHeight(); first <= latest {
+			info.CacheFirstHeight = uint64(first)
+			info.CacheLastHeight = uint64(latest)
+		}
+	}
+	return info, nil
 }
 
 // SendTransaction forwards raw transaction bytes to a zcashd instance over JSON-RPC
@@ -447,6 +2038,19 @@ func (s *lwdStreamer) SendTransaction(ctx context.Context, rawtx *walletrpc.RawT
 		return nil, errors.New("Bad Transaction or Data")
 	}
 
+	// A wallet retrying a send that already succeeded gets the same reply;
+	// failures are always forwarded again. Darkside tests may resend a
+	// transaction deliberately (after a reorg, say), so they always reach
+	// the mock zcashd.
+	dedup := !common.DarksideEnabled
+	dedupKey := sendDedupKey(rawtx.Data)
+	if dedup {
+		if resp := s.state.sent.get(dedupKey, time.Now()); resp != nil {
+			common.Metrics.DedupedSendsCounter.Inc()
+			return resp, nil
+		}
+	}
+
 	// Construct raw JSON-RPC params
 	params := make([]json.RawMessage, 1)
 	txJSON, err := json.Marshal(hex.EncodeToString(rawtx.Data))
@@ -482,18 +2086,27 @@ func (s *lwdStreamer) SendTransaction(ctx context.Context, rawtx *walletrpc.RawT
 		ErrorCode:    int32(errCode),
 		ErrorMessage: errMsg,
 	}
+	if dedup && rpcErr == nil {
+		s.state.sent.add(dedupKey, resp, time.Now())
+	}
 
 	common.Metrics.SendTransactionsCounter.Inc()
 
 	return resp, nil
 }
 
-func getTaddressBalanceZcashdRpc(addressList []string) (*walletrpc.Balance, error) {
+func getTaddressBalanceZcashdRpc(addressList []string, minConfirmations uint32, network *common.Network) (*walletrpc.Balance, error) {
 	for _, addr := range addressList {
-		if err := checkTaddress(addr); err != nil {
+		if isShieldedAddress(addr) {
+			return &walletrpc.Balance{}, errShieldedBalance
+		}
+		if err := checkTaddress(addr, network); err != nil {
 			return &walletrpc.Balance{}, err
 		}
 	}
+	if minConfirmations > 0 {
+		return getTaddressBalanceConfirmed(addressList, minConfirmations)
+	}
 	params := make([]json.RawMessage, 1)
 	addrList := &common.ZcashdRpcRequestGetaddressbalance{
 		Addresses: addressList,
@@ -506,19 +2119,55 @@ func getTaddressBalanceZcashdRpc(addressList []string) (*walletrpc.Balance, erro
 
 	result, rpcErr := common.RawRequest("getaddressbalance", params)
 	if rpcErr != nil {
-		return &walletrpc.Balance{}, rpcErr
+		return &walletrpc.Balance{}, addressIndexError(rpcErr)
 	}
 	var balanceReply common.ZcashdRpcReplyGetaddressbalance
 	err = json.Unmarshal(result, &balanceReply)
 	if err != nil {
 		return &walletrpc.Balance{}, err
 	}
-	return &walletrpc.Balance{ValueZat: balanceReply.Balance}, nil
+	return &walletrpc.Balance{
+		ValueZat:     balanceReply.Balance,
+		ConfirmedZat: balanceReply.Balance,
+	}, nil
+}
+
+// getTaddressBalanceConfirmed adds up the addresses' utxos, splitting them
+// by whether they have at least minConfirmations confirmations. zcashd
+// reports the utxos along with its tip, so the two are consistent.
+func getTaddressBalanceConfirmed(addressList []string, minConfirmations uint32) (*walletrpc.Balance, error) {
+	param, err := json.Marshal(&common.ZcashdRpcRequestGetaddressutxos{
+		Addresses: addressList,
+		ChainInfo: true,
+	})
+	if err != nil {
+		return &walletrpc.Balance{}, err
+	}
+	result, rpcErr := common.RawRequest("getaddressutxos", []json.RawMessage{param})
+	if rpcErr != nil {
+		return &walletrpc.Balance{}, addressIndexError(rpcErr)
+	}
+	var utxosReply common.ZcashdRpcReplyGetaddressutxosChainInfo
+	if err := json.Unmarshal(result, &utxosReply); err != nil {
+		return &walletrpc.Balance{}, err
+	}
+	balance := &walletrpc.Balance{}
+	for _, utxo := range utxosReply.Utxos {
+		balance.ValueZat += int64(utxo.Satoshis)
+		if confirmations := utxosReply.Height - utxo.Height + 1; confirmations >= int(minConfirmations) {
+			balance.ConfirmedZat += int64(utxo.Satoshis)
+		} else {
+			balance.UnconfirmedZat += int64(utxo.Satoshis)
+		}
+	}
+	return balance, nil
 }
 
-// GetTaddressBalance returns the total balance for a list of taddrs
+// GetTaddressBalance returns the total balance for a list of taddrs,
+// optionally split by confirmations
 func (s *lwdStreamer) GetTaddressBalance(ctx context.Context, addresses *walletrpc.AddressList) (*walletrpc.Balance, error) {
-	return getTaddressBalanceZcashdRpc(addresses.Addresses)
+	return getTaddressBalanceZcashdRpc(addresses.Addresses, addresses.MinConfirmations,
+		common.GetNetwork(s.chainName))
 }
 
 // GetTaddressBalanceStream returns the total balance for a list of taddrs
@@ -534,7 +2183,7 @@ func (s *lwdStreamer) GetTaddressBalanceStream(addresses walletrpc.CompactTxStre
 		}
 		addressList = append(addressList, addr.Address)
 	}
-	balance, err := getTaddressBalanceZcashdRpc(addressList)
+	balance, err := getTaddressBalanceZcashdRpc(addressList, 0, common.GetNetwork(s.chainName))
 	if err != nil {
 		return err
 	}
@@ -542,34 +2191,117 @@ func (s *lwdStreamer) GetTaddressBalanceStream(addresses walletrpc.CompactTxStre
 	return nil
 }
 
-// Key is 32-byte txid (as a 64-character string), data is pointer to compact tx.
-var mempoolMap *map[string]*walletrpc.CompactTx
-var mempoolList []string
+// mempoolTx is a mempool transaction that's being converted to compact form.
+type mempoolTx struct {
+	txid  string // big-endian hex, as zcashd gives it
+	data  []byte
+	ctx   *walletrpc.CompactTx
+	taddr *mempoolTaddrTx // nil if it has no transparent inputs or outputs
+	err   error
+}
 
-// Last time we pulled a copy of the mempool from zcashd.
-var lastMempool time.Time
+// mempoolTaddrTx is a mempool transaction that has transparent inputs or
+// outputs, as GetMempoolTxForAddress needs it.
+type mempoolTaddrTx struct {
+	// The (hex) scripts that it pays, or that its inputs spend, as far as
+	// they can be told (see parser.Transaction.TransparentSpentScripts).
+	scripts map[string]bool
+	// Its compact form, including transparent outputs.
+	ctx *walletrpc.CompactTx
+}
 
-func (s *lwdStreamer) GetMempoolTx(exclude *walletrpc.Exclude, resp walletrpc.CompactTxStreamer_GetMempoolTxServer) error {
-	if time.Now().Sub(lastMempool).Seconds() >= 2 {
-		lastMempool = time.Now()
+// compact sets the transaction's compact form, which is empty (but not nil)
+// if it has no shielded elements, and its transparent form, or its error.
+func (mtx *mempoolTx) compact() {
+	tx := parser.NewTransaction()
+	// A transaction that doesn't parse gets an empty compact form.
+	txdata, _ := tx.ParseFromSlice(mtx.data)
+	if len(txdata) > 0 {
+		mtx.err = errors.New("extra data deserializing transaction")
+		return
+	}
+	// The parser doesn't compute v5 (ZIP 244) txids; use zcashd's.
+	hash, err := parser.DisplayHexToInternal(mtx.txid)
+	mtx.ctx = &walletrpc.CompactTx{}
+	if tx.HasSaplingElements() || tx.HasOrchardActions() {
+		if err != nil {
+			mtx.err = err
+			return
+		}
+		mtx.ctx = tx.ToCompact( /* index */ 0)
+		mtx.ctx.Hash = hash
+	}
+	scripts := append(tx.TransparentOutputScripts(), tx.TransparentSpentScripts()...)
+	if len(scripts) > 0 && err == nil {
+		mtx.taddr = &mempoolTaddrTx{
+			scripts: make(map[string]bool),
+			ctx:     tx.ToCompactWithOptions(0, parser.CompactOptions{Transparent: true}),
+		}
+		mtx.taddr.ctx.Hash = hash
+		for _, script := range scripts {
+			mtx.taddr.scripts[hex.EncodeToString(script)] = true
+		}
+	}
+}
+
+// compactMempoolTxns converts the given transactions to compact form, using
+// up to workers goroutines, since parsing a large mempool is CPU-bound.
+func compactMempoolTxns(txns []mempoolTx, workers int) {
+	if workers > len(txns) {
+		workers = len(txns)
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				txns[i].compact()
+			}
+		}()
+	}
+	for i := range txns {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// refreshMempoolTxns updates our copy of the mempool from zcashd if it's
+// at least interval old, converting new transactions to compact form with
+// up to workers goroutines. The caller must hold st.mempoolMutex.
+func (st *streamerState) refreshMempoolTxns(interval time.Duration, workers int) error {
+	if time.Now().Sub(st.lastMempool) >= interval {
+		st.lastMempool = time.Now()
 		// Refresh our copy of the mempool.
 		params := make([]json.RawMessage, 0)
 		result, rpcErr := common.RawRequest("getrawmempool", params)
 		if rpcErr != nil {
 			return rpcErr
 		}
-		err := json.Unmarshal(result, &mempoolList)
+		// Unmarshal into a fresh slice; callers may still be reading the old one.
+		var newmempoolList []string
+		err := json.Unmarshal(result, &newmempoolList)
 		if err != nil {
 			return err
 		}
 		newmempoolMap := make(map[string]*walletrpc.CompactTx)
-		if mempoolMap == nil {
-			mempoolMap = &newmempoolMap
+		newmempoolTaddrs := make(map[string]*mempoolTaddrTx)
+		if st.mempoolMap == nil {
+			st.mempoolMap = &newmempoolMap
+			st.mempoolTaddrs = &newmempoolTaddrs
 		}
-		for _, txidstr := range mempoolList {
-			if ctx, ok := (*mempoolMap)[txidstr]; ok {
+		// Fetch the transactions not seen before, one at a time, then
+		// convert them all in parallel.
+		var txns []mempoolTx
+		for _, txidstr := range newmempoolList {
+			if ctx, ok := (*st.mempoolMap)[txidstr]; ok {
 				// This ctx has already been fetched, copy pointer to it.
 				newmempoolMap[txidstr] = ctx
+				if taddr, ok := (*st.mempoolTaddrs)[txidstr]; ok {
+					newmempoolTaddrs[txidstr] = taddr
+				}
 				continue
 			}
 			txidJSON, err := json.Marshal(txidstr)
@@ -596,25 +2328,62 @@ func (s *lwdStreamer) GetMempoolTx(exclude *walletrpc.Exclude, resp walletrpc.Co
 			if err != nil {
 				return err
 			}
-			tx := parser.NewTransaction()
-			txdata, err := tx.ParseFromSlice(txBytes)
-			if len(txdata) > 0 {
-				return errors.New("extra data deserializing transaction")
+			txns = append(txns, mempoolTx{txid: txidstr, data: txBytes})
+		}
+		compactMempoolTxns(txns, workers)
+		for i := range txns {
+			if txns[i].err != nil {
+				return txns[i].err
 			}
-			newmempoolMap[txidstr] = &walletrpc.CompactTx{}
-			if tx.HasSaplingElements() {
-				newmempoolMap[txidstr] = tx.ToCompact( /* height */ 0)
+			newmempoolMap[txns[i].txid] = txns[i].ctx
+			if txns[i].taddr != nil {
+				newmempoolTaddrs[txns[i].txid] = txns[i].taddr
 			}
 		}
-		mempoolMap = &newmempoolMap
+		st.mempoolList = newmempoolList
+		st.mempoolMap = &newmempoolMap
+		st.mempoolTaddrs = &newmempoolTaddrs
+	}
+	return nil
+}
+
+func (s *lwdStreamer) GetMempoolTx(exclude *walletrpc.Exclude, resp walletrpc.CompactTxStreamer_GetMempoolTxServer) error {
+	if len(exclude.Txid) > s.maxExclude {
+		return status.Errorf(codes.InvalidArgument,
+			"exclude list has %d txids, more than the maximum %d", len(exclude.Txid), s.maxExclude)
 	}
 	excludeHex := make([]string, len(exclude.Txid))
 	for i := 0; i < len(exclude.Txid); i++ {
-		excludeHex[i] = hex.EncodeToString(parser.Reverse(exclude.Txid[i]))
+		if exclude.Strict && len(exclude.Txid[i]) != 32 {
+			return status.Errorf(codes.InvalidArgument,
+				"strict exclude requires full 32-byte txids, txid %d has %d bytes", i, len(exclude.Txid[i]))
+		}
+		excludeHex[i] = parser.InternalToDisplayHex(exclude.Txid[i])
 	}
-	for _, txid := range MempoolFilter(mempoolList, excludeHex) {
-		tx := (*mempoolMap)[txid]
+	s.state.mempoolMutex.Lock()
+	err := s.state.refreshMempoolTxns(s.mempoolInterval, s.mempoolWorkers)
+	// Take a consistent snapshot so we can send without holding the lock.
+	list, txns := s.state.mempoolList, s.state.mempoolMap
+	s.state.mempoolMutex.Unlock()
+	if err != nil {
+		return err
+	}
+	filter := MempoolFilter
+	if exclude.Strict {
+		filter = MempoolFilterStrict
+	}
+	var height uint64
+	if latest := s.cache.GetLatestHeight(); s.mempoolHeightHint && latest >= 0 {
+		height = uint64(latest) + 1
+	}
+	for _, txid := range filter(list, excludeHex) {
+		tx := (*txns)[txid]
 		if len(tx.Hash) > 0 {
+			if height > 0 {
+				// The remembered transaction is shared; stamp a copy.
+				tx = proto.Clone(tx).(*walletrpc.CompactTx)
+				tx.Height = height
+			}
 			err := resp.Send(tx)
 			if err != nil {
 				return err
@@ -624,6 +2393,113 @@ func (s *lwdStreamer) GetMempoolTx(exclude *walletrpc.Exclude, resp walletrpc.Co
 	return nil
 }
 
+// GetMempoolTxForAddress returns the mempool transactions that pay, or (as
+// far as can be told from their inputs alone) spend from, the given
+// transparent address, in compact form including their transparent outputs.
+// The mempool is refreshed as for GetMempoolTx.
+func (s *lwdStreamer) GetMempoolTxForAddress(address *walletrpc.Address, resp walletrpc.CompactTxStreamer_GetMempoolTxForAddressServer) error {
+	if err := checkTaddress(address.Address, common.GetNetwork(s.chainName)); err != nil {
+		return err
+	}
+	script, err := taddrScript(address.Address)
+	if err != nil {
+		return err
+	}
+	s.state.mempoolMutex.Lock()
+	err = s.state.refreshMempoolTxns(s.mempoolInterval, s.mempoolWorkers)
+	// Take a consistent snapshot so we can send without holding the lock.
+	list, txns := s.state.mempoolList, s.state.mempoolTaddrs
+	s.state.mempoolMutex.Unlock()
+	if err != nil {
+		return err
+	}
+	key := hex.EncodeToString(script)
+	var height uint64
+	if latest := s.cache.GetLatestHeight(); s.mempoolHeightHint && latest >= 0 {
+		height = uint64(latest) + 1
+	}
+	for _, txid := range list {
+		taddr, ok := (*txns)[txid]
+		if !ok || !taddr.scripts[key] {
+			continue
+		}
+		tx := taddr.ctx
+		if height > 0 {
+			// The remembered transaction is shared; stamp a copy.
+			tx = proto.Clone(tx).(*walletrpc.CompactTx)
+			tx.Height = height
+		}
+		if err := resp.Send(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscribeMempoolMinWait is the least time SubscribeMempool waits between
+// checks for new transactions, even if the mempool is refreshed more often.
+const subscribeMempoolMinWait = 100 * time.Millisecond
+
+// SubscribeMempool sends the mempool transactions in compact form, as
+// GetMempoolTx does, then keeps checking (as often as the mempool is
+// refreshed) for new ones and sends those, until the client goes away.
+// Each transaction is sent only once while it stays in the mempool (one
+// that leaves it, and later returns, is sent again).
+func (s *lwdStreamer) SubscribeMempool(_ *walletrpc.Empty, resp walletrpc.CompactTxStreamer_SubscribeMempoolServer) error {
+	ctx := resp.Context()
+	// The txids seen (sent, or skipped for having no shielded elements)
+	// that are still in the mempool, so that it doesn't grow without
+	// bound however long the stream lasts.
+	seen := make(map[string]bool)
+	for {
+		s.state.mempoolMutex.Lock()
+		err := s.state.refreshMempoolTxns(s.mempoolInterval, s.mempoolWorkers)
+		// Take a consistent snapshot so we can send without holding the lock.
+		list, txns := s.state.mempoolList, s.state.mempoolMap
+		s.state.mempoolMutex.Unlock()
+		if err != nil {
+			return err
+		}
+		var height uint64
+		if latest := s.cache.GetLatestHeight(); s.mempoolHeightHint && latest >= 0 {
+			height = uint64(latest) + 1
+		}
+		current := make(map[string]bool, len(list))
+		for _, txid := range list {
+			tx, ok := (*txns)[txid]
+			if !ok {
+				// It left the mempool before it could be fetched.
+				continue
+			}
+			current[txid] = true
+			if seen[txid] {
+				continue
+			}
+			if len(tx.Hash) == 0 {
+				continue
+			}
+			if height > 0 {
+				// The remembered transaction is shared; stamp a copy.
+				tx = proto.Clone(tx).(*walletrpc.CompactTx)
+				tx.Height = height
+			}
+			if err := resp.Send(tx); err != nil {
+				return err
+			}
+		}
+		seen = current
+		wait := s.mempoolInterval
+		if wait < subscribeMempoolMinWait {
+			wait = subscribeMempoolMinWait
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
 func (s *lwdStreamer) GetMempoolStream(_empty *walletrpc.Empty, resp walletrpc.CompactTxStreamer_GetMempoolStreamServer) error {
 	ch := make(chan *walletrpc.RawTransaction, 200)
 	go common.AddNewClient(ch)
@@ -691,9 +2567,28 @@ func MempoolFilter(items, exclude []string) []string {
 	return tosend
 }
 
-func getAddressUtxos(arg *walletrpc.GetAddressUtxosArg, f func(*walletrpc.GetAddressUtxosReply) error) error {
+// Return the subset of items that aren't excluded; each exclude entry
+// must be a complete txid, and removes only the item equal to it.
+func MempoolFilterStrict(items, exclude []string) []string {
+	sort.Slice(items, func(i, j int) bool {
+		return items[i] < items[j]
+	})
+	excluded := make(map[string]bool, len(exclude))
+	for _, e := range exclude {
+		excluded[e] = true
+	}
+	tosend := make([]string, 0)
+	for _, item := range items {
+		if !excluded[item] {
+			tosend = append(tosend, item)
+		}
+	}
+	return tosend
+}
+
+func getAddressUtxos(cache *common.BlockCache, arg *walletrpc.GetAddressUtxosArg, network *common.Network, f func(*walletrpc.GetAddressUtxosReply) error) error {
 	for _, a := range arg.Addresses {
-		if err := checkTaddress(a); err != nil {
+		if err := checkTaddress(a, network); err != nil {
 			return err
 		}
 	}
@@ -708,23 +2603,37 @@ func getAddressUtxos(arg *walletrpc.GetAddressUtxosArg, f func(*walletrpc.GetAdd
 	params[0] = param
 	result, rpcErr := common.RawRequest("getaddressutxos", params)
 	if rpcErr != nil {
-		return rpcErr
+		return addressIndexError(rpcErr)
 	}
 	var utxosReply common.ZcashdRpcReplyGetaddressutxos
 	err = json.Unmarshal(result, &utxosReply)
 	if err != nil {
 		return err
 	}
+	// zcashd's order isn't specified; make it deterministic, so that
+	// maxEntries pages are stable.
+	sort.Slice(utxosReply, func(i, j int) bool {
+		a, b := utxosReply[i], utxosReply[j]
+		if a.Height != b.Height {
+			return a.Height < b.Height
+		}
+		if a.Txid != b.Txid {
+			return a.Txid < b.Txid
+		}
+		return a.OutputIndex < b.OutputIndex
+	})
+	// zcashd doesn't say whether an output is from a coinbase transaction.
+	coinbase := newCoinbaseLookup(cache)
 	n := 0
 	for _, utxo := range utxosReply {
-		if uint64(utxo.Height) < arg.StartHeight {
+		if uint64(utxo.Height) < arg.StartHeight || utxo.Satoshis < arg.MinValueZat {
 			continue
 		}
 		n++
 		if arg.MaxEntries > 0 && uint32(n) > arg.MaxEntries {
 			break
 		}
-		txidBytes, err := hex.DecodeString(utxo.Txid)
+		txidBytes, err := parser.DisplayHexToInternal(utxo.Txid)
 		if err != nil {
 			return err
 		}
@@ -732,13 +2641,18 @@ func getAddressUtxos(arg *walletrpc.GetAddressUtxosArg, f func(*walletrpc.GetAdd
 		if err != nil {
 			return err
 		}
+		isCoinbase, err := coinbase.isCoinbase(utxo.Height, txidBytes)
+		if err != nil {
+			return err
+		}
 		err = f(&walletrpc.GetAddressUtxosReply{
-			Address:  utxo.Address,
-			Txid:     parser.Reverse(txidBytes),
-			Index:    int32(utxo.OutputIndex),
-			Script:   scriptBytes,
-			ValueZat: int64(utxo.Satoshis),
-			Height:   uint64(utxo.Height),
+			Address:    utxo.Address,
+			Txid:       txidBytes,
+			Index:      int32(utxo.OutputIndex),
+			Script:     scriptBytes,
+			ValueZat:   int64(utxo.Satoshis),
+			Height:     uint64(utxo.Height),
+			IsCoinbase: isCoinbase,
 		})
 		if err != nil {
 			return err
@@ -747,9 +2661,87 @@ func getAddressUtxos(arg *walletrpc.GetAddressUtxosArg, f func(*walletrpc.GetAdd
 	return nil
 }
 
+// maxCoinbaseLookups is the most blocks a GetAddressUtxos request asks
+// zcashd about, where the cache can't tell, to find which outputs are from
+// coinbase transactions. A request that needs more fails with
+// ResourceExhausted; the client can page with startHeight or maxEntries.
+const maxCoinbaseLookups = 100
+
+// coinbaseLookup tells whether a transaction is the coinbase (the first
+// transaction) of the block at its height: from the cached compact block
+// if that includes the transaction or the coinbase, else by asking zcashd
+// for the height's coinbase txid, once.
+type coinbaseLookup struct {
+	cache   *common.BlockCache
+	txids   map[int]string // by height, big-endian hex
+	lookups int
+}
+
+func newCoinbaseLookup(cache *common.BlockCache) *coinbaseLookup {
+	return &coinbaseLookup{cache: cache, txids: make(map[int]string)}
+}
+
+// isCoinbase returns whether the transaction (txid little-endian) mined at
+// the given height is that block's coinbase. Wallets rely on this to
+// enforce coinbase maturity, so if it can't tell, it returns an error
+// rather than guess.
+func (c *coinbaseLookup) isCoinbase(height int, txid []byte) (bool, error) {
+	if cBlock := c.cache.Get(height); cBlock != nil {
+		for _, tx := range cBlock.Vtx {
+			if bytes.Equal(tx.Hash, txid) {
+				return tx.Index == 0, nil
+			}
+		}
+		if len(cBlock.Vtx) > 0 && cBlock.Vtx[0].Index == 0 {
+			// The coinbase is there, and isn't this transaction.
+			return false, nil
+		}
+	}
+	coinbaseTxid, ok := c.txids[height]
+	if !ok {
+		if c.lookups >= maxCoinbaseLookups {
+			return false, status.Errorf(codes.ResourceExhausted,
+				"outputs are in more than %d blocks whose coinbase isn't cached; use startHeight or maxEntries to request fewer",
+				maxCoinbaseLookups)
+		}
+		c.lookups++
+		var err error
+		coinbaseTxid, err = getCoinbaseTxid(height)
+		if err != nil {
+			return false, status.Errorf(codes.Unavailable,
+				"couldn't find the coinbase transaction at height %d: %s", height, err.Error())
+		}
+		c.txids[height] = coinbaseTxid
+	}
+	return strings.EqualFold(coinbaseTxid, parser.InternalToDisplayHex(txid)), nil
+}
+
+// getCoinbaseTxid returns the txid (big-endian hex) of the coinbase
+// transaction of the block at the given height on zcashd's best chain.
+func getCoinbaseTxid(height int) (string, error) {
+	heightJSON, err := json.Marshal(strconv.Itoa(height))
+	if err != nil {
+		return "", err
+	}
+	// Verbosity 1 lists the txids without the transactions themselves.
+	params := []json.RawMessage{heightJSON, json.RawMessage("1")}
+	result, rpcErr := common.RawRequest("getblock", params)
+	if rpcErr != nil {
+		return "", rpcErr
+	}
+	var block common.ZcashdRpcReplyGetblock
+	if err := json.Unmarshal(result, &block); err != nil {
+		return "", err
+	}
+	if len(block.Tx) == 0 {
+		return "", errors.New("block has no transactions")
+	}
+	return block.Tx[0], nil
+}
+
 func (s *lwdStreamer) GetAddressUtxos(ctx context.Context, arg *walletrpc.GetAddressUtxosArg) (*walletrpc.GetAddressUtxosReplyList, error) {
 	addressUtxos := make([]*walletrpc.GetAddressUtxosReply, 0)
-	err := getAddressUtxos(arg, func(utxo *walletrpc.GetAddressUtxosReply) error {
+	err := getAddressUtxos(s.cache, arg, common.GetNetwork(s.chainName), func(utxo *walletrpc.GetAddressUtxosReply) error {
 		addressUtxos = append(addressUtxos, utxo)
 		return nil
 	})
@@ -760,7 +2752,7 @@ func (s *lwdStreamer) GetAddressUtxos(ctx context.Context, arg *walletrpc.GetAdd
 }
 
 func (s *lwdStreamer) GetAddressUtxosStream(arg *walletrpc.GetAddressUtxosArg, resp walletrpc.CompactTxStreamer_GetAddressUtxosStreamServer) error {
-	err := getAddressUtxos(arg, func(utxo *walletrpc.GetAddressUtxosReply) error {
+	err := getAddressUtxos(s.cache, arg, common.GetNetwork(s.chainName), func(utxo *walletrpc.GetAddressUtxosReply) error {
 		return resp.Send(utxo)
 	})
 	if err != nil {
@@ -769,20 +2761,23 @@ func (s *lwdStreamer) GetAddressUtxosStream(arg *walletrpc.GetAddressUtxosArg, r
 	return nil
 }
 
-// This rpc is used only for testing.
-var concurrent int64
+// PingDisabledMessage is the message of the FailedPrecondition status that
+// Ping returns when it isn't enabled.
+const PingDisabledMessage = "ping not enabled; start lightwalletd with --ping-very-insecure"
 
+// This rpc is used only for testing.
 func (s *lwdStreamer) Ping(ctx context.Context, in *walletrpc.Duration) (*walletrpc.PingResponse, error) {
+	common.Metrics.PingCounter.Inc()
 	// This gRPC allows the client to create an arbitrary number of
 	// concurrent threads, which could run the server out of resources,
 	// so only allow if explicitly enabled.
 	if !s.pingEnable {
-		return nil, errors.New("Ping not enabled, start lightwalletd with --ping-very-insecure")
+		return nil, status.Error(codes.FailedPrecondition, PingDisabledMessage)
 	}
 	var response walletrpc.PingResponse
-	response.Entry = atomic.AddInt64(&concurrent, 1)
+	response.Entry = atomic.AddInt64(&s.state.concurrent, 1)
 	time.Sleep(time.Duration(in.IntervalUs) * time.Microsecond)
-	response.Exit = atomic.AddInt64(&concurrent, -1)
+	response.Exit = atomic.AddInt64(&s.state.concurrent, -1)
 	return &response, nil
 }
 
@@ -797,18 +2792,24 @@ func (s *DarksideStreamer) Reset(ctx context.Context, ms *walletrpc.DarksideMeta
 	if err != nil || !match {
 		return nil, errors.New("Invalid chain name")
 	}
-	err = common.DarksideReset(int(ms.SaplingActivation), ms.BranchID, ms.ChainName)
+	if ms.OrchardActivation != 0 && ms.OrchardActivation < ms.SaplingActivation {
+		return nil, errors.New("Orchard activation height is below Sapling activation height")
+	}
+	session := darksideSessionFromContext(ctx)
+	err = common.DarksideReset(session, int(ms.SaplingActivation), int(ms.OrchardActivation), ms.BranchID, ms.ChainName, ms.StrictStagedHeights)
 	if err != nil {
 		return nil, err
 	}
-	mempoolMap = nil
-	mempoolList = nil
+	if session == common.DarksideDefaultSession {
+		ResetStreamerState(s.lwd)
+	}
 	return &walletrpc.Empty{}, nil
 }
 
 // StageBlocksStream accepts a list of blocks from the wallet test code,
 // and makes them available to present from the mock zcashd's GetBlock rpc.
 func (s *DarksideStreamer) StageBlocksStream(blocks walletrpc.DarksideStreamer_StageBlocksStreamServer) error {
+	session := darksideSessionFromContext(blocks.Context())
 	for {
 		b, err := blocks.Recv()
 		if err == io.EOF {
@@ -818,13 +2819,22 @@ func (s *DarksideStreamer) StageBlocksStream(blocks walletrpc.DarksideStreamer_S
 		if err != nil {
 			return err
 		}
-		common.DarksideStageBlockStream(b.Block)
+		common.DarksideStageBlockStream(session, b.Block)
 	}
 }
 
 // StageBlocks loads blocks from the given URL to the staging area.
 func (s *DarksideStreamer) StageBlocks(ctx context.Context, u *walletrpc.DarksideBlocksURL) (*walletrpc.Empty, error) {
-	if err := common.DarksideStageBlocks(u.Url); err != nil {
+	if err := common.DarksideStageBlocks(darksideSessionFromContext(ctx), u.Url); err != nil {
+		return nil, err
+	}
+	return &walletrpc.Empty{}, nil
+}
+
+// StageBlockWithPrevhash stages a block that keeps the given prevhash
+// rather than being linked to the block before it.
+func (s *DarksideStreamer) StageBlockWithPrevhash(ctx context.Context, b *walletrpc.DarksideBlockPrevhash) (*walletrpc.Empty, error) {
+	if err := common.DarksideStageBlockWithPrevhash(darksideSessionFromContext(ctx), b.Block, b.PrevHash); err != nil {
 		return nil, err
 	}
 	return &walletrpc.Empty{}, nil
@@ -832,7 +2842,68 @@ func (s *DarksideStreamer) StageBlocks(ctx context.Context, u *walletrpc.Darksid
 
 // StageBlocksCreate stages a set of synthetic (manufactured on the fly) blocks.
 func (s *DarksideStreamer) StageBlocksCreate(ctx context.Context, e *walletrpc.DarksideEmptyBlocks) (*walletrpc.Empty, error) {
-	if err := common.DarksideStageBlocksCreate(e.Height, e.Nonce, e.Count); err != nil {
+	if err := common.DarksideStageBlocksCreate(darksideSessionFromContext(ctx), e.Height, e.Nonce, e.Count); err != nil {
+		return nil, err
+	}
+	return &walletrpc.Empty{}, nil
+}
+
+// SetProofOfWork sets the nBits and solution of subsequently created blocks.
+func (s *DarksideStreamer) SetProofOfWork(ctx context.Context, pow *walletrpc.DarksideProofOfWork) (*walletrpc.Empty, error) {
+	if err := common.DarksideSetProofOfWork(darksideSessionFromContext(ctx), pow.NBits, pow.Solution); err != nil {
+		return nil, err
+	}
+	return &walletrpc.Empty{}, nil
+}
+
+// SetChainTime sets the time of subsequently created blocks and the mediantime.
+func (s *DarksideStreamer) SetChainTime(ctx context.Context, t *walletrpc.DarksideChainTime) (*walletrpc.Empty, error) {
+	if err := common.DarksideSetChainTime(darksideSessionFromContext(ctx), t.Time, t.MedianTime); err != nil {
+		return nil, err
+	}
+	return &walletrpc.Empty{}, nil
+}
+
+// AddTreeState adds a tree state for the mock zcashd's z_gettreestate.
+func (s *DarksideStreamer) AddTreeState(ctx context.Context, t *walletrpc.TreeState) (*walletrpc.Empty, error) {
+	err := common.DarksideAddTreeState(darksideSessionFromContext(ctx), common.DarksideTreeState{
+		Height:        int(t.Height),
+		Hash:          t.Hash,
+		Time:          t.Time,
+		Tree:          t.Tree,
+		SaplingAnchor: t.SaplingAnchor,
+		OrchardAnchor: t.OrchardAnchor,
+		OrchardTree:   t.OrchardTree,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &walletrpc.Empty{}, nil
+}
+
+// ClearAllTreeStates removes the tree states added by AddTreeState.
+func (s *DarksideStreamer) ClearAllTreeStates(ctx context.Context, _ *walletrpc.Empty) (*walletrpc.Empty, error) {
+	if err := common.DarksideClearTreeStates(darksideSessionFromContext(ctx)); err != nil {
+		return nil, err
+	}
+	return &walletrpc.Empty{}, nil
+}
+
+// SetBranchIDs sets the consensus branch IDs by height range.
+func (s *DarksideStreamer) SetBranchIDs(ctx context.Context, b *walletrpc.DarksideBranchIDs) (*walletrpc.Empty, error) {
+	branchIDs := make([]common.DarksideBranchID, len(b.BranchIDs))
+	for i, branchID := range b.BranchIDs {
+		branchIDs[i] = common.DarksideBranchID{Height: int(branchID.Height), BranchID: branchID.BranchID}
+	}
+	if err := common.DarksideSetBranchIDs(darksideSessionFromContext(ctx), branchIDs); err != nil {
+		return nil, err
+	}
+	return &walletrpc.Empty{}, nil
+}
+
+// SetBackendDown makes the mock zcashd unreachable, or reachable again.
+func (s *DarksideStreamer) SetBackendDown(ctx context.Context, d *walletrpc.DarksideBackendDown) (*walletrpc.Empty, error) {
+	if err := common.DarksideSetBackendDown(darksideSessionFromContext(ctx), d.Down, d.Methods); err != nil {
 		return nil, err
 	}
 	return &walletrpc.Empty{}, nil
@@ -843,6 +2914,7 @@ func (s *DarksideStreamer) StageTransactionsStream(tx walletrpc.DarksideStreamer
 	// My current thinking is that this should take a JSON array of {height, txid}, store them,
 	// then DarksideAddBlock() would "inject" transactions into blocks as its storing
 	// them (remembering to update the header so the block hash changes).
+	session := darksideSessionFromContext(tx.Context())
 	for {
 		transaction, err := tx.Recv()
 		if err == io.EOF {
@@ -852,7 +2924,7 @@ func (s *DarksideStreamer) StageTransactionsStream(tx walletrpc.DarksideStreamer
 		if err != nil {
 			return err
 		}
-		err = common.DarksideStageTransaction(int(transaction.Height), transaction.Data)
+		err = common.DarksideStageTransaction(session, int(transaction.Height), transaction.Data)
 		if err != nil {
 			return err
 		}
@@ -861,7 +2933,7 @@ func (s *DarksideStreamer) StageTransactionsStream(tx walletrpc.DarksideStreamer
 
 // StageTransactions loads blocks from the given URL to the staging area.
 func (s *DarksideStreamer) StageTransactions(ctx context.Context, u *walletrpc.DarksideTransactionsURL) (*walletrpc.Empty, error) {
-	if err := common.DarksideStageTransactionsURL(int(u.Height), u.Url); err != nil {
+	if err := common.DarksideStageTransactionsURL(darksideSessionFromContext(ctx), int(u.Height), u.Url); err != nil {
 		return nil, err
 	}
 	return &walletrpc.Empty{}, nil
@@ -869,13 +2941,17 @@ func (s *DarksideStreamer) StageTransactions(ctx context.Context, u *walletrpc.D
 
 // ApplyStaged merges all staged transactions into staged blocks and all staged blocks into the active blockchain.
 func (s *DarksideStreamer) ApplyStaged(ctx context.Context, h *walletrpc.DarksideHeight) (*walletrpc.Empty, error) {
-	return &walletrpc.Empty{}, common.DarksideApplyStaged(int(h.Height))
+	return &walletrpc.Empty{}, common.DarksideApplyStaged(darksideSessionFromContext(ctx), int(h.Height))
 }
 
 // GetIncomingTransactions returns the transactions that were submitted via SendTransaction().
 func (s *DarksideStreamer) GetIncomingTransactions(in *walletrpc.Empty, resp walletrpc.DarksideStreamer_GetIncomingTransactionsServer) error {
 	// Get all of the incoming transactions we're received via SendTransaction()
-	for _, txBytes := range common.DarksideGetIncomingTransactions() {
+	txs, err := common.DarksideGetIncomingTransactions(darksideSessionFromContext(resp.Context()))
+	if err != nil {
+		return err
+	}
+	for _, txBytes := range txs {
 		err := resp.Send(&walletrpc.RawTransaction{Data: txBytes, Height: 0})
 		if err != nil {
 			return err
@@ -884,8 +2960,69 @@ func (s *DarksideStreamer) GetIncomingTransactions(in *walletrpc.Empty, resp wal
 	return nil
 }
 
+// GetIncomingTransactionsSince returns the transactions that were submitted
+// via SendTransaction() after the given cursor, and the cursor for next time.
+func (s *DarksideStreamer) GetIncomingTransactionsSince(ctx context.Context, in *walletrpc.DarksideIncomingCursor) (*walletrpc.DarksideIncomingTransactions, error) {
+	txs, cursor, err := common.DarksideGetIncomingTransactionsSince(darksideSessionFromContext(ctx), int(in.Since))
+	if err != nil {
+		return nil, err
+	}
+	reply := &walletrpc.DarksideIncomingTransactions{
+		Transactions: make([]*walletrpc.RawTransaction, len(txs)),
+		Cursor:       uint64(cursor),
+	}
+	for i, txBytes := range txs {
+		reply.Transactions[i] = &walletrpc.RawTransaction{Data: txBytes, Height: 0}
+	}
+	return reply, nil
+}
+
+// GetIncomingTransactionCount returns the number of transactions submitted
+// via SendTransaction() and, optionally, their txids.
+func (s *DarksideStreamer) GetIncomingTransactionCount(ctx context.Context, in *walletrpc.DarksideIncomingCountArg) (*walletrpc.DarksideIncomingCount, error) {
+	count, txids, err := common.DarksideGetIncomingTransactionCount(darksideSessionFromContext(ctx), in.IncludeTxids)
+	if err != nil {
+		return nil, err
+	}
+	return &walletrpc.DarksideIncomingCount{Count: uint32(count), Txids: txids}, nil
+}
+
 // ClearIncomingTransactions empties the incoming transaction list.
 func (s *DarksideStreamer) ClearIncomingTransactions(ctx context.Context, e *walletrpc.Empty) (*walletrpc.Empty, error) {
-	common.DarksideClearIncomingTransactions()
+	if err := common.DarksideClearIncomingTransactions(darksideSessionFromContext(ctx)); err != nil {
+		return nil, err
+	}
+	return &walletrpc.Empty{}, nil
+}
+
+// GetBlockHash returns the computed hash of an active or staged block.
+func (s *DarksideStreamer) GetBlockHash(ctx context.Context, sel *walletrpc.DarksideBlockSelector) (*walletrpc.DarksideBlockHash, error) {
+	height, hash, err := common.DarksideGetBlockHash(darksideSessionFromContext(ctx),
+		int(sel.Height), sel.Staged, int(sel.Index))
+	if err != nil {
+		return nil, err
+	}
+	return &walletrpc.DarksideBlockHash{
+		Height: int32(height),
+		Hash:   hex.EncodeToString(hash),
+	}, nil
+}
+
+// EndSession discards the caller's darkside session.
+func (s *DarksideStreamer) EndSession(ctx context.Context, e *walletrpc.Empty) (*walletrpc.Empty, error) {
+	if err := common.DarksideEndSession(darksideSessionFromContext(ctx)); err != nil {
+		return nil, err
+	}
 	return &walletrpc.Empty{}, nil
 }
+
+// darksideSessionFromContext returns the session named by the request's
+// DarksideSessionHeader metadata, or the default session if there's none.
+func darksideSessionFromContext(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if session := md.Get(DarksideSessionHeader); len(session) > 0 {
+			return session[0]
+		}
+	}
+	return common.DarksideDefaultSession
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package frontend
+
+import (
+	"container/list"
+	"strconv"
+	"sync"
+
+	"github.com/adityapk00/lightwalletd/walletrpc"
+)
+
+// treeStateCacheSize is the default number of tree states (keyed by height
+// or hash) that GetTreeState remembers.
+const treeStateCacheSize = 1000
+
+// treeStateCacheDepth is how far below the tip a block must be before its
+// tree state is cached; shallower blocks could still be reorged away.
+// (A variable only so that tests can lower it.)
+var treeStateCacheDepth = 100
+
+// treeStateCache is a least-recently-used cache of tree states. Tree states
+// of confirmed blocks never change, so these can be returned without asking
+// zcashd again.
+type treeStateCache struct {
+	mutex   sync.Mutex
+	size    int
+	lru     *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+type treeStateCacheEntry struct {
+	key       string
+	treeState *walletrpc.TreeState
+}
+
+func newTreeStateCache(size int) *treeStateCache {
+	return &treeStateCache{
+		size:    size,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// treeStateHeightKey and treeStateHashKey return the cache key for a block
+// identified by height or by (big-endian, hex) hash.
+func treeStateHeightKey(height uint64) string {
+	return "height:" + strconv.FormatUint(height, 10)
+}
+
+func treeStateHashKey(hash string) string {
+	return "hash:" + hash
+}
+
+func (c *treeStateCache) get(key string) *walletrpc.TreeState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*treeStateCacheEntry).treeState
+}
+
+func (c *treeStateCache) add(key string, treeState *walletrpc.TreeState) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*treeStateCacheEntry).treeState = treeState
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&treeStateCacheEntry{key: key, treeState: treeState})
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*treeStateCacheEntry).key)
+	}
+}
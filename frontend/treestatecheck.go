@@ -0,0 +1,198 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package frontend
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+
+	"github.com/adityapk00/lightwalletd/parser"
+	"github.com/adityapk00/lightwalletd/walletrpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// commitmentFrontier is the part of a serialized (legacy, as in
+// z_gettreestate's finalState) Sapling note commitment tree that can be
+// checked without computing Pedersen hashes: its rightmost leaves and its
+// size.
+type commitmentFrontier struct {
+	left, right []byte // the rightmost leaf pair; nil if absent
+	size        uint64 // number of leaves
+}
+
+// treeReader reads a serialized tree.
+type treeReader []byte
+
+// node reads a node: a byte saying whether it's present, then (if so) the
+// 32-byte node.
+func (r *treeReader) node() ([]byte, error) {
+	if len(*r) < 1 || (*r)[0] > 1 {
+		return nil, errors.New("bad node presence byte")
+	}
+	present := (*r)[0] == 1
+	*r = (*r)[1:]
+	if !present {
+		return nil, nil
+	}
+	if len(*r) < 32 {
+		return nil, errors.New("truncated node")
+	}
+	node := (*r)[:32]
+	*r = (*r)[32:]
+	return node, nil
+}
+
+// compactSize reads a Bitcoin-style variable-length count (small enough
+// for a tree's parent count).
+func (r *treeReader) compactSize() (uint64, error) {
+	if len(*r) < 1 {
+		return 0, errors.New("truncated count")
+	}
+	size := uint64((*r)[0])
+	*r = (*r)[1:]
+	if size == 0xfd {
+		if len(*r) < 2 {
+			return 0, errors.New("truncated count")
+		}
+		size = uint64(binary.LittleEndian.Uint16(*r))
+		*r = (*r)[2:]
+	} else if size > 0xfd {
+		return 0, errors.New("count too large")
+	}
+	return size, nil
+}
+
+// parseCommitmentFrontier parses a serialized note commitment tree: the
+// optional left and right leaves, then the optional parents, the i'th of
+// which (from zero) covers 2^(i+1) leaves.
+func parseCommitmentFrontier(treeHex string) (*commitmentFrontier, error) {
+	treeBytes, err := hex.DecodeString(treeHex)
+	if err != nil {
+		return nil, err
+	}
+	r := treeReader(treeBytes)
+	f := &commitmentFrontier{}
+	if f.left, err = r.node(); err != nil {
+		return nil, err
+	}
+	if f.right, err = r.node(); err != nil {
+		return nil, err
+	}
+	if f.left == nil && f.right != nil {
+		return nil, errors.New("right leaf without a left leaf")
+	}
+	parentCount, err := r.compactSize()
+	if err != nil {
+		return nil, err
+	}
+	if parentCount > 62 {
+		return nil, errors.New("too many parents")
+	}
+	if f.left != nil {
+		f.size++
+	}
+	if f.right != nil {
+		f.size++
+	}
+	for i := uint64(0); i < parentCount; i++ {
+		parent, err := r.node()
+		if err != nil {
+			return nil, err
+		}
+		if parent != nil {
+			f.size += 1 << (i + 1)
+		}
+	}
+	if len(r) > 0 {
+		return nil, errors.New("unexpected data after tree")
+	}
+	return f, nil
+}
+
+// displayHash returns the hex of a block hash in the (reversed) order that
+// zcashd displays it.
+func displayHash(hash []byte) string {
+	return hex.EncodeToString(parser.Reverse(append([]byte(nil), hash...)))
+}
+
+// CheckBlockTreeState checks that the Sapling tree state at the given height
+// follows from the one at the height before and the note commitments of the
+// compact block at the height: that it grew by the number of outputs, that
+// its rightmost leaves are the block's last commitments, and that both
+// states belong to the block and its parent where they were reported at
+// those heights (a state may come from an earlier block that left the tree
+// as it was). The hashes aren't recomputed.
+func (s *lwdStreamer) CheckBlockTreeState(ctx context.Context, id *walletrpc.BlockID) (*walletrpc.Empty, error) {
+	if id.Height == 0 {
+		return nil, status.Error(codes.InvalidArgument, "CheckBlockTreeState requires a block height")
+	}
+	if err := s.checkSaplingHeight(id.Height); err != nil {
+		return nil, err
+	}
+	block, err := s.GetBlock(ctx, &walletrpc.BlockID{Height: id.Height})
+	if err != nil {
+		return nil, err
+	}
+	cur, err := s.GetTreeState(ctx, &walletrpc.BlockID{Height: id.Height})
+	if err != nil {
+		return nil, err
+	}
+	curTree, err := parseCommitmentFrontier(cur.Tree)
+	if err != nil {
+		return nil, status.Errorf(codes.DataLoss, "tree state at height %d: %s", id.Height, err)
+	}
+	if cur.Height == id.Height && cur.Hash != displayHash(block.Hash) {
+		return nil, status.Errorf(codes.DataLoss,
+			"tree state at height %d is for block %s, not %s", id.Height, cur.Hash, displayHash(block.Hash))
+	}
+	// Before the first Sapling block the tree is empty.
+	var prevSize uint64
+	if id.Height > uint64(s.cache.GetFirstHeight()) {
+		prev, err := s.GetTreeState(ctx, &walletrpc.BlockID{Height: id.Height - 1})
+		if err != nil {
+			return nil, err
+		}
+		prevTree, err := parseCommitmentFrontier(prev.Tree)
+		if err != nil {
+			return nil, status.Errorf(codes.DataLoss, "tree state at height %d: %s", id.Height-1, err)
+		}
+		if prev.Height == id.Height-1 && prev.Hash != displayHash(block.PrevHash) {
+			return nil, status.Errorf(codes.DataLoss,
+				"tree state at height %d is for block %s, not %s", id.Height-1, prev.Hash, displayHash(block.PrevHash))
+		}
+		prevSize = prevTree.size
+	}
+	var cmus [][]byte
+	for _, tx := range block.Vtx {
+		for _, output := range tx.Outputs {
+			cmus = append(cmus, output.Cmu)
+		}
+	}
+	if curTree.size != prevSize+uint64(len(cmus)) {
+		return nil, status.Errorf(codes.DataLoss,
+			"tree grew by %d at height %d, but the block has %d Sapling outputs",
+			int64(curTree.size)-int64(prevSize), id.Height, len(cmus))
+	}
+	// The last commitment is the right leaf if there is one, else the left;
+	// with a right leaf, the one before is the left.
+	n := len(cmus)
+	switch {
+	case n == 0:
+	case curTree.right != nil:
+		if !bytes.Equal(curTree.right, cmus[n-1]) || (n > 1 && !bytes.Equal(curTree.left, cmus[n-2])) {
+			return nil, status.Errorf(codes.DataLoss,
+				"tree state at height %d doesn't end with the block's note commitments", id.Height)
+		}
+	default:
+		if !bytes.Equal(curTree.left, cmus[n-1]) {
+			return nil, status.Errorf(codes.DataLoss,
+				"tree state at height %d doesn't end with the block's note commitments", id.Height)
+		}
+	}
+	return &walletrpc.Empty{}, nil
+}
@@ -100,6 +100,33 @@ func (b *Block) GetHeight() int {
 	return int(blockHeight)
 }
 
+// CoinbaseInfo returns the details of the block's coinbase transaction, or
+// an error if its first transaction isn't a coinbase or doesn't encode a
+// height.
+func (b *Block) CoinbaseInfo() (*walletrpc.CoinbaseInfo, error) {
+	if len(b.vtx) == 0 || !b.vtx[0].IsCoinbase() {
+		return nil, errors.New("block has no coinbase transaction")
+	}
+	height := b.GetHeight()
+	if height < 0 {
+		return nil, errors.New("coinbase transaction doesn't encode the block height")
+	}
+	coinbase := b.vtx[0]
+	info := &walletrpc.CoinbaseInfo{
+		Height:    uint64(height),
+		Hash:      b.GetEncodableHash(),
+		ScriptSig: coinbase.transparentInputs[0].ScriptSig,
+	}
+	for i, out := range coinbase.transparentOutputs {
+		info.Outputs = append(info.Outputs, &walletrpc.CompactTxOut{
+			Index:  uint32(i),
+			Value:  out.Value,
+			Script: out.Script,
+		})
+	}
+	return info, nil
+}
+
 // GetPrevHash returns the hash of the block's previous block (little-endian).
 func (b *Block) GetPrevHash() []byte {
 	return b.hdr.HashPrevBlock
@@ -107,6 +134,12 @@ func (b *Block) GetPrevHash() []byte {
 
 // ToCompact returns the compact representation of the full block.
 func (b *Block) ToCompact() *walletrpc.CompactBlock {
+	return b.ToCompactWithOptions(CompactOptions{})
+}
+
+// ToCompactWithOptions is like ToCompact, with control over what's included;
+// the options must be valid (see CompactOptions.Validate).
+func (b *Block) ToCompactWithOptions(options CompactOptions) *walletrpc.CompactBlock {
 	compactBlock := &walletrpc.CompactBlock{
 		//TODO ProtoVersion: 1,
 		Height:   uint64(b.GetHeight()),
@@ -115,11 +148,16 @@ func (b *Block) ToCompact() *walletrpc.CompactBlock {
 		Time:     b.hdr.Time,
 	}
 
-	// Only Sapling transactions have a meaningful compact encoding
+	// Only Sapling and Orchard transactions have a meaningful compact
+	// encoding (unless transparent outputs are wanted)
 	saplingTxns := make([]*walletrpc.CompactTx, 0, len(b.vtx))
 	for idx, tx := range b.vtx {
-		if tx.HasSaplingElements() {
-			saplingTxns = append(saplingTxns, tx.ToCompact(idx))
+		if tx.HasSaplingElements() || tx.HasOrchardActions() {
+			saplingTxns = append(saplingTxns, tx.ToCompactWithOptions(idx, options))
+		} else if options.Transparent {
+			if ctx := tx.ToCompactWithOptions(idx, options); len(ctx.Vout) > 0 {
+				saplingTxns = append(saplingTxns, ctx)
+			}
 		}
 	}
 	compactBlock.Vtx = saplingTxns
@@ -141,6 +179,9 @@ func (b *Block) ParseFromSlice(data []byte) (rest []byte, err error) {
 	if !s.ReadCompactSize(&txCount) {
 		return nil, errors.New("could not read tx_count")
 	}
+	if err := checkCount(s, txCount, minTransactionSize, "tx_count"); err != nil {
+		return nil, err
+	}
 	data = []byte(s)
 
 	vtx := make([]*Transaction, 0, txCount)
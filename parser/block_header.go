@@ -209,8 +209,7 @@ func (hdr *BlockHeader) GetDisplayHash() []byte {
 	digest := sha256.Sum256(serializedHeader)
 	digest = sha256.Sum256(digest[:])
 
-	// Convert to big-endian
-	hdr.cachedHash = Reverse(digest[:])
+	hdr.cachedHash = InternalToDisplay(digest[:])
 	return hdr.cachedHash
 }
 
@@ -231,5 +230,5 @@ func (hdr *BlockHeader) GetEncodableHash() []byte {
 
 // GetDisplayPrevHash returns the block hash in big-endian order.
 func (hdr *BlockHeader) GetDisplayPrevHash() []byte {
-	return Reverse(hdr.HashPrevBlock)
+	return InternalToDisplay(hdr.HashPrevBlock)
 }
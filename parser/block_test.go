@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/pkg/errors"
@@ -173,6 +174,34 @@ func TestBlockParserFail(t *testing.T) {
 	}
 }
 
+func TestBlockParserAbsurdTxCount(t *testing.T) {
+	testBlocks, err := os.Open("../testdata/blocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testBlocks.Close()
+	scan := bufio.NewScanner(testBlocks)
+	scan.Scan()
+	blockData, err := hex.DecodeString(scan.Text())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest, err := NewBlockHeader().ParseFromSlice(blockData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Replace the (one-byte) transaction count with 0x02000000.
+	headerLen := len(blockData) - len(rest)
+	var bad []byte
+	bad = append(bad, blockData[:headerLen]...)
+	bad = append(bad, 0xfe, 0x00, 0x00, 0x00, 0x02)
+	bad = append(bad, blockData[headerLen+1:]...)
+	_, err = NewBlock().ParseFromSlice(bad)
+	if err == nil || !strings.Contains(err.Error(), "tx_count") {
+		t.Fatal("ParseFromSlice with an absurd tx_count, unexpected error", err)
+	}
+}
+
 // Checks on the first 20 blocks from mainnet genesis.
 func TestGenesisBlockParser(t *testing.T) {
 	blockFile, err := os.Open("../testdata/mainnet_genesis")
@@ -209,6 +238,14 @@ func TestGenesisBlockParser(t *testing.T) {
 		if block.GetHeight() != i {
 			t.Errorf("Got wrong height for block %d: %d", i, block.GetHeight())
 		}
+		if info, err := block.CoinbaseInfo(); err != nil || info.Height != uint64(i) || len(info.Outputs) == 0 {
+			t.Errorf("Got wrong coinbase info for block %d: %v %v", i, info, err)
+		}
+	}
+
+	// A block without transactions has no coinbase.
+	if _, err := NewBlock().CoinbaseInfo(); err == nil {
+		t.Error("CoinbaseInfo of an empty block succeeded")
 	}
 }
 
@@ -273,3 +310,124 @@ func TestCompactBlocks(t *testing.T) {
 	}
 
 }
+
+func TestCompactBlocksTransparent(t *testing.T) {
+	type compactTest struct {
+		BlockHeight int    `json:"block"`
+		Full        string `json:"full"`
+	}
+	var compactTests []compactTest
+
+	blockJSON, err := ioutil.ReadFile("../testdata/compact_blocks.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal(blockJSON, &compactTests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range compactTests {
+		blockData, _ := hex.DecodeString(test.Full)
+		block := NewBlock()
+		if _, err = block.ParseFromSlice(blockData); err != nil {
+			t.Fatal(err)
+		}
+		compact := block.ToCompactWithOptions(CompactOptions{Transparent: true})
+		// Every transaction in these blocks has a transparent output or
+		// shielded elements, so none are left out.
+		if len(compact.Vtx) != len(block.vtx) {
+			t.Fatalf("block %d: unexpected number of transactions %d", test.BlockHeight, len(compact.Vtx))
+		}
+		if compact.Vtx[0].Index != 0 || len(compact.Vtx[0].Vout) == 0 {
+			t.Fatalf("block %d: coinbase has no transparent outputs", test.BlockHeight)
+		}
+		for i, ctx := range compact.Vtx {
+			tx := block.vtx[ctx.Index]
+			if len(ctx.Vout) != len(tx.transparentOutputs) {
+				t.Fatalf("block %d tx %d: unexpected number of outputs", test.BlockHeight, i)
+			}
+			for j, out := range ctx.Vout {
+				if out.Index != uint32(j) ||
+					out.Value != tx.transparentOutputs[j].Value ||
+					!bytes.Equal(out.Script, tx.transparentOutputs[j].Script) {
+					t.Fatalf("block %d tx %d: unexpected output %d", test.BlockHeight, i, j)
+				}
+			}
+			if len(ctx.Outputs) != len(tx.shieldedOutputs) || len(ctx.Spends) != len(tx.shieldedSpends) {
+				t.Fatalf("block %d tx %d: unexpected shielded elements", test.BlockHeight, i)
+			}
+		}
+	}
+
+	// Outputs with overlong scripts are left out.
+	tx := &Transaction{rawTransaction: &rawTransaction{
+		transparentOutputs: []*txOut{
+			{Value: 1, Script: make([]byte, MaxCompactScriptSize+1)},
+			{Value: 2, Script: make([]byte, 25)},
+		},
+	}, cachedTxID: make([]byte, 32)}
+	ctx := tx.ToCompactWithOptions(0, CompactOptions{Transparent: true})
+	if len(ctx.Vout) != 1 || ctx.Vout[0].Index != 1 || ctx.Vout[0].Value != 2 {
+		t.Fatal("overlong script not omitted")
+	}
+}
+
+func TestCompactBlocksCiphertextPrefix(t *testing.T) {
+	type compactTest struct {
+		BlockHeight int    `json:"block"`
+		Full        string `json:"full"`
+	}
+	var compactTests []compactTest
+
+	blockJSON, err := ioutil.ReadFile("../testdata/compact_blocks.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal(blockJSON, &compactTests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, prefix := range []int{0, 1, 100, NoteCiphertextSize} {
+		options := CompactOptions{SaplingCiphertextPrefix: prefix}
+		if err := options.Validate(); err != nil {
+			t.Fatal("unexpected invalid prefix", prefix, err)
+		}
+		want := prefix
+		if want == 0 {
+			want = DefaultCiphertextPrefix
+		}
+		var outputs int
+		for _, test := range compactTests {
+			blockData, _ := hex.DecodeString(test.Full)
+			block := NewBlock()
+			if _, err = block.ParseFromSlice(blockData); err != nil {
+				t.Fatal(err)
+			}
+			compact := block.ToCompactWithOptions(options)
+			for _, ctx := range compact.Vtx {
+				tx := block.vtx[ctx.Index]
+				for i, output := range ctx.Outputs {
+					if !bytes.Equal(output.Ciphertext, tx.shieldedOutputs[i].encCiphertext[:want]) {
+						t.Fatalf("block %d: unexpected ciphertext with prefix %d", test.BlockHeight, prefix)
+					}
+					outputs++
+				}
+			}
+		}
+		if outputs == 0 {
+			t.Fatal("no Sapling outputs in test blocks")
+		}
+	}
+
+	for _, options := range []CompactOptions{
+		{SaplingCiphertextPrefix: -1},
+		{SaplingCiphertextPrefix: NoteCiphertextSize + 1},
+		{OrchardCiphertextPrefix: NoteCiphertextSize + 1},
+	} {
+		if options.Validate() == nil {
+			t.Fatal("expected invalid options", options)
+		}
+	}
+}
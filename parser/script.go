@@ -0,0 +1,121 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package parser
+
+import (
+	"encoding/binary"
+
+	"github.com/btcsuite/btcutil"
+)
+
+// Script opcodes used by the standard transparent scripts.
+const (
+	opPushData1   = 0x4c
+	opPushData2   = 0x4d
+	opPushData4   = 0x4e
+	opDup         = 0x76
+	opEqual       = 0x87
+	opEqualVerify = 0x88
+	opHash160     = 0xa9
+	opCheckSig    = 0xac
+)
+
+// P2PKHScript returns the output script that pays to the given 20-byte
+// public key hash.
+func P2PKHScript(pubKeyHash []byte) []byte {
+	script := []byte{opDup, opHash160, byte(len(pubKeyHash))}
+	script = append(script, pubKeyHash...)
+	return append(script, opEqualVerify, opCheckSig)
+}
+
+// P2SHScript returns the output script that pays to the given 20-byte
+// script hash.
+func P2SHScript(scriptHash []byte) []byte {
+	script := []byte{opHash160, byte(len(scriptHash))}
+	script = append(script, scriptHash...)
+	return append(script, opEqual)
+}
+
+// scriptPushes returns the data pushed by the given script, or nil if it
+// isn't entirely pushes (as a standard scriptSig is).
+func scriptPushes(script []byte) [][]byte {
+	var pushes [][]byte
+	for len(script) > 0 {
+		op := script[0]
+		script = script[1:]
+		var size int
+		switch {
+		case op < opPushData1:
+			size = int(op)
+		case op == opPushData1 && len(script) >= 1:
+			size = int(script[0])
+			script = script[1:]
+		case op == opPushData2 && len(script) >= 2:
+			size = int(binary.LittleEndian.Uint16(script))
+			script = script[2:]
+		case op == opPushData4 && len(script) >= 4:
+			size = int(binary.LittleEndian.Uint32(script))
+			script = script[4:]
+		default:
+			return nil
+		}
+		if size < 0 || size > len(script) {
+			return nil
+		}
+		pushes = append(pushes, script[:size])
+		script = script[size:]
+	}
+	return pushes
+}
+
+// isPubKey indicates whether the data looks like a (compressed or
+// uncompressed) public key.
+func isPubKey(data []byte) bool {
+	return (len(data) == 33 && (data[0] == 2 || data[0] == 3)) ||
+		(len(data) == 65 && data[0] == 4)
+}
+
+// spentScript returns the output script that an input with the given
+// scriptSig spends, if it can be told from the scriptSig alone: a signature
+// and public key spend P2PKH, and a longer sequence of pushes ending with a
+// redeem script spends P2SH. Otherwise (for example, spending P2PK) it
+// returns nil.
+func spentScript(scriptSig []byte) []byte {
+	pushes := scriptPushes(scriptSig)
+	if len(pushes) < 2 {
+		return nil
+	}
+	last := pushes[len(pushes)-1]
+	if len(pushes) == 2 && isPubKey(last) {
+		return P2PKHScript(btcutil.Hash160(last))
+	}
+	return P2SHScript(btcutil.Hash160(last))
+}
+
+// TransparentOutputScripts returns the scripts of the transaction's
+// transparent outputs.
+func (tx *Transaction) TransparentOutputScripts() [][]byte {
+	scripts := make([][]byte, len(tx.transparentOutputs))
+	for i, out := range tx.transparentOutputs {
+		scripts[i] = out.Script
+	}
+	return scripts
+}
+
+// TransparentSpentScripts returns the output scripts that the transaction's
+// transparent inputs spend, as far as they can be told from the inputs
+// themselves (without looking up the outputs they spend); inputs that don't
+// tell are left out, as is a coinbase input.
+func (tx *Transaction) TransparentSpentScripts() [][]byte {
+	if tx.IsCoinbase() {
+		return nil
+	}
+	var scripts [][]byte
+	for _, in := range tx.transparentInputs {
+		if script := spentScript(in.ScriptSig); script != nil {
+			scripts = append(scripts, script)
+		}
+	}
+	return scripts
+}
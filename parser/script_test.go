@@ -0,0 +1,54 @@
+// Copyright (c) 2019-2020 The Zcash developers
+// Distributed under the MIT software license, see the accompanying
+// file COPYING or https://www.opensource.org/licenses/mit-license.php .
+package parser
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// A v4 transaction with one P2PKH input and two P2PKH outputs.
+const transparentTxHex = "0400008085202f8901950521a79e89ed418a4b506f42e9829739b1ca516d4c590bddb4465b4b347bb2000000006a4730440220142920f2a9240c5c64406668c9a16d223bd01db33a773beada7f9c9b930cf02b0220171cbee9232f9c5684eb918db70918e701b86813732871e1bec6fbfb38194f53012102975c020dd223263d2a9bfff2fa6004df4c07db9f01c531967546ef941e2fcfbffeffffff026daf9b00000000001976a91461af073e7679f06677c83aa48f205e4b98feb8d188ac61760356100000001976a91406f6b9a7e1525ee12fd77af9b94a54179785011b88ac4c880b007f880b000000000000000000000000"
+
+func TestTransparentScripts(t *testing.T) {
+	txBytes, _ := hex.DecodeString(transparentTxHex)
+	tx := NewTransaction()
+	if _, err := tx.ParseFromSlice(txBytes); err != nil {
+		t.Fatal(err)
+	}
+	outputs := tx.TransparentOutputScripts()
+	if len(outputs) != 2 ||
+		hex.EncodeToString(outputs[0]) != "76a91461af073e7679f06677c83aa48f205e4b98feb8d188ac" ||
+		hex.EncodeToString(outputs[1]) != "76a91406f6b9a7e1525ee12fd77af9b94a54179785011b88ac" {
+		t.Fatal("unexpected output scripts", outputs)
+	}
+	// The input's public key is 02975c02...; this is its hash.
+	spent := tx.TransparentSpentScripts()
+	if len(spent) != 1 ||
+		hex.EncodeToString(spent[0]) != "76a914453645f20a4e4864373758c9d17ab7b014fe644488ac" {
+		t.Fatal("unexpected spent scripts", spent)
+	}
+}
+
+func TestSpentScript(t *testing.T) {
+	for _, tt := range []struct {
+		scriptSig string
+		want      string
+	}{
+		// signature only (P2PK)
+		{"0201ff", ""},
+		// not all pushes
+		{"0201ff76", ""},
+		// a push that runs past the end
+		{"0201ff05aabb", ""},
+		// OP_0, a signature, and a redeem script (P2SH multisig), using
+		// PUSHDATA1 for the last
+		{"000201ff4c0351ae52", "a914" + "16d83a49502c422b2a50948ce3a9dc7f88c7083b" + "87"},
+	} {
+		scriptSig, _ := hex.DecodeString(tt.scriptSig)
+		if got := hex.EncodeToString(spentScript(scriptSig)); got != tt.want {
+			t.Fatal("spentScript", tt.scriptSig, "unexpected script", got)
+		}
+	}
+}
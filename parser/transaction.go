@@ -14,20 +14,27 @@ import (
 )
 
 type rawTransaction struct {
-	fOverwintered      bool
-	version            uint32
-	nVersionGroupID    uint32
-	transparentInputs  []*txIn
-	transparentOutputs []*txOut
-	nLockTime          uint32
-	nExpiryHeight      uint32
-	valueBalance       int64
-	shieldedSpends     []*spend
-	shieldedOutputs    []*output
-	joinSplits         []*joinSplit
-	joinSplitPubKey    []byte
-	joinSplitSig       []byte
-	bindingSig         []byte
+	fOverwintered       bool
+	version             uint32
+	nVersionGroupID     uint32
+	consensusBranchID   uint32 // v5
+	transparentInputs   []*txIn
+	transparentOutputs  []*txOut
+	nLockTime           uint32
+	nExpiryHeight       uint32
+	valueBalance        int64
+	shieldedSpends      []*spend
+	shieldedOutputs     []*output
+	joinSplits          []*joinSplit
+	joinSplitPubKey     []byte
+	joinSplitSig        []byte
+	bindingSig          []byte
+	orchardActions      []*action // v5
+	orchardFlags        byte
+	orchardValueBalance int64
+	orchardAnchor       []byte
+	orchardProofs       []byte
+	orchardBindingSig   []byte
 }
 
 // Txin format as described in https://en.bitcoin.it/wiki/Transaction
@@ -67,6 +74,48 @@ func (tx *txIn) ParseFromSlice(data []byte) ([]byte, error) {
 	return []byte(s), nil
 }
 
+// MaxCompactScriptSize is the longest transparent output script included in
+// a compact transaction (see CompactOptions); standard scripts (P2PKH, P2SH,
+// P2PK) are shorter.
+const MaxCompactScriptSize = 128
+
+const (
+	// NoteCiphertextSize is the length of a Sapling (or Orchard) note's
+	// encrypted ciphertext.
+	NoteCiphertextSize = 580
+
+	// DefaultCiphertextPrefix is how much of each note ciphertext the
+	// compact format includes: enough to trial-decrypt the note plaintext
+	// (without the memo).
+	DefaultCiphertextPrefix = 52
+)
+
+// CompactOptions selects what goes into compact blocks and transactions;
+// the zero value selects the standard compact format.
+type CompactOptions struct {
+	// Include transparent outputs (with scripts no longer than
+	// MaxCompactScriptSize), and transactions that have only those.
+	Transparent bool
+
+	// Number of bytes of each note ciphertext to include, by pool; zero
+	// means DefaultCiphertextPrefix.
+	SaplingCiphertextPrefix int
+	OrchardCiphertextPrefix int
+}
+
+// Validate returns an error if the options can't be honored.
+func (o CompactOptions) Validate() error {
+	if o.SaplingCiphertextPrefix < 0 || o.SaplingCiphertextPrefix > NoteCiphertextSize {
+		return errors.Errorf("Sapling ciphertext prefix length %d is not between 0 and %d",
+			o.SaplingCiphertextPrefix, NoteCiphertextSize)
+	}
+	if o.OrchardCiphertextPrefix < 0 || o.OrchardCiphertextPrefix > NoteCiphertextSize {
+		return errors.Errorf("Orchard ciphertext prefix length %d is not between 0 and %d",
+			o.OrchardCiphertextPrefix, NoteCiphertextSize)
+	}
+	return nil
+}
+
 // Txout format as described in https://en.bitcoin.it/wiki/Transaction
 type txOut struct {
 	// Non-negative int giving the number of zatoshis to be transferred
@@ -131,6 +180,27 @@ func (p *spend) ParseFromSlice(data []byte) ([]byte, error) {
 	return []byte(s), nil
 }
 
+// parseV5 reads the part of a v5 Spend Description that's in the
+// transaction's vSpendsSapling; the anchor, proof and signature are stored
+// separately (and shared, in the case of the anchor).
+func (p *spend) parseV5(data []byte) ([]byte, error) {
+	s := bytestring.String(data)
+
+	if !s.ReadBytes(&p.cv, 32) {
+		return nil, errors.New("could not read cv")
+	}
+
+	if !s.ReadBytes(&p.nullifier, 32) {
+		return nil, errors.New("could not read nullifier")
+	}
+
+	if !s.ReadBytes(&p.rk, 32) {
+		return nil, errors.New("could not read rk")
+	}
+
+	return []byte(s), nil
+}
+
 func (p *spend) ToCompact() *walletrpc.CompactSpend {
 	return &walletrpc.CompactSpend{
 		Nf: p.nullifier,
@@ -178,11 +248,94 @@ func (p *output) ParseFromSlice(data []byte) ([]byte, error) {
 	return []byte(s), nil
 }
 
-func (p *output) ToCompact() *walletrpc.CompactOutput {
+// parseV5 reads the part of a v5 Output Description that's in the
+// transaction's vOutputsSapling; the proof is stored separately.
+func (p *output) parseV5(data []byte) ([]byte, error) {
+	s := bytestring.String(data)
+
+	if !s.ReadBytes(&p.cv, 32) {
+		return nil, errors.New("could not read cv")
+	}
+
+	if !s.ReadBytes(&p.cmu, 32) {
+		return nil, errors.New("could not read cmu")
+	}
+
+	if !s.ReadBytes(&p.ephemeralKey, 32) {
+		return nil, errors.New("could not read ephemeralKey")
+	}
+
+	if !s.ReadBytes(&p.encCiphertext, 580) {
+		return nil, errors.New("could not read encCiphertext")
+	}
+
+	if !s.ReadBytes(&p.outCiphertext, 80) {
+		return nil, errors.New("could not read outCiphertext")
+	}
+
+	return []byte(s), nil
+}
+
+func (p *output) ToCompact(prefixLen int) *walletrpc.CompactOutput {
 	return &walletrpc.CompactOutput{
 		Cmu:        p.cmu,
 		Epk:        p.ephemeralKey,
-		Ciphertext: p.encCiphertext[:52],
+		Ciphertext: p.encCiphertext[:prefixLen],
+	}
+}
+
+// action is an Orchard Action Description as described in section 7.5 of
+// the Zcash protocol spec. Total size is 820.
+type action struct {
+	cv            []byte // 32
+	nullifier     []byte // 32
+	rk            []byte // 32
+	cmx           []byte // 32
+	ephemeralKey  []byte // 32
+	encCiphertext []byte // 580
+	outCiphertext []byte // 80
+}
+
+func (a *action) ParseFromSlice(data []byte) ([]byte, error) {
+	s := bytestring.String(data)
+
+	if !s.ReadBytes(&a.cv, 32) {
+		return nil, errors.New("could not read action cv")
+	}
+
+	if !s.ReadBytes(&a.nullifier, 32) {
+		return nil, errors.New("could not read action nullifier")
+	}
+
+	if !s.ReadBytes(&a.rk, 32) {
+		return nil, errors.New("could not read action rk")
+	}
+
+	if !s.ReadBytes(&a.cmx, 32) {
+		return nil, errors.New("could not read action cmx")
+	}
+
+	if !s.ReadBytes(&a.ephemeralKey, 32) {
+		return nil, errors.New("could not read action ephemeralKey")
+	}
+
+	if !s.ReadBytes(&a.encCiphertext, 580) {
+		return nil, errors.New("could not read action encCiphertext")
+	}
+
+	if !s.ReadBytes(&a.outCiphertext, 80) {
+		return nil, errors.New("could not read action outCiphertext")
+	}
+
+	return []byte(s), nil
+}
+
+func (a *action) ToCompact(prefixLen int) *walletrpc.CompactOrchardAction {
+	return &walletrpc.CompactOrchardAction{
+		Nullifier:    a.nullifier,
+		Cmx:          a.cmx,
+		EphemeralKey: a.ephemeralKey,
+		Ciphertext:   a.encCiphertext[:prefixLen],
 	}
 }
 
@@ -268,6 +421,31 @@ func (p *joinSplit) ParseFromSlice(data []byte) ([]byte, error) {
 	return []byte(s), nil
 }
 
+// Minimum sizes, in bytes, of the elements of a transaction, with anything
+// stored separately (such as a v5 spend's proof and signature).
+const (
+	minTransactionSize = 4 + 1 + 1 + 4  // v1, no inputs or outputs
+	minTxInSize        = 32 + 4 + 1 + 4 // empty scriptSig
+	minTxOutSize       = 8 + 1          // empty script
+	spendSize          = 384
+	outputSize         = 948
+	minJoinSplitSize   = 1698 // Groth16 proof
+	spendV5Size        = 96 + 192 + 64
+	outputV5Size       = 756 + 192
+	actionSize         = 820 + 64
+)
+
+// checkCount returns an error if count elements, each at least minSize
+// bytes, can't fit in the rest of the data. The counts are read before the
+// elements, so without this a crafted transaction could declare millions of
+// elements and cause a huge allocation before failing.
+func checkCount(s bytestring.String, count, minSize int, name string) error {
+	if count > len(s)/minSize {
+		return errors.Errorf("%s %d is more than the remaining %d bytes can hold", name, count, len(s))
+	}
+	return nil
+}
+
 // Transaction encodes a full (zcashd) transaction.
 type Transaction struct {
 	*rawTransaction
@@ -276,6 +454,9 @@ type Transaction struct {
 }
 
 // GetDisplayHash returns the transaction hash in big-endian display order.
+// This is the txid of transactions before v5; a v5 transaction's txid is
+// instead a digest of its parts (ZIP 244), which isn't computed here, so
+// it's the txid only if it was given by SetTxID.
 func (tx *Transaction) GetDisplayHash() []byte {
 	if tx.cachedTxID != nil {
 		return tx.cachedTxID
@@ -284,16 +465,26 @@ func (tx *Transaction) GetDisplayHash() []byte {
 	// SHA256d
 	digest := sha256.Sum256(tx.rawBytes)
 	digest = sha256.Sum256(digest[:])
-	// Convert to big-endian
-	tx.cachedTxID = Reverse(digest[:])
+	tx.cachedTxID = InternalToDisplay(digest[:])
 	return tx.cachedTxID
 }
 
 // GetEncodableHash returns the transaction hash in little-endian wire format order.
 func (tx *Transaction) GetEncodableHash() []byte {
-	digest := sha256.Sum256(tx.rawBytes)
-	digest = sha256.Sum256(digest[:])
-	return digest[:]
+	return DisplayToInternal(tx.GetDisplayHash())
+}
+
+// SetTxID sets the transaction's txid (big-endian display order), which
+// GetDisplayHash and GetEncodableHash then return; this is how a v5
+// transaction gets its txid, from zcashd.
+func (tx *Transaction) SetTxID(txid []byte) {
+	tx.cachedTxID = txid
+}
+
+// Version returns the transaction's version number (without the
+// fOverwintered flag).
+func (tx *Transaction) Version() uint32 {
+	return tx.version
 }
 
 // Bytes returns a full transaction's raw bytes.
@@ -307,8 +498,70 @@ func (tx *Transaction) HasSaplingElements() bool {
 	return tx.version >= 4 && (len(tx.shieldedSpends)+len(tx.shieldedOutputs)) > 0
 }
 
+// HasOrchardActions indicates whether a (v5) transaction has at least one
+// Orchard action.
+func (tx *Transaction) HasOrchardActions() bool {
+	return len(tx.orchardActions) > 0
+}
+
+// HasSproutElements indicates whether a transaction has at least one
+// (Sprout) JoinSplit description. Only v2 through v4 transactions can;
+// v1 and v5 transactions have no JoinSplit fields.
+func (tx *Transaction) HasSproutElements() bool {
+	return len(tx.joinSplits) > 0
+}
+
+// IsCoinbase returns true if this is a coinbase transaction: it has a single
+// input, which refers to no previous output (null hash, index 0xffffffff).
+func (tx *Transaction) IsCoinbase() bool {
+	if len(tx.transparentInputs) != 1 {
+		return false
+	}
+	in := tx.transparentInputs[0]
+	if in.PrevTxOutIndex != 0xffffffff {
+		return false
+	}
+	for _, b := range in.PrevTxHash {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// SaplingValueBalance returns the net value (in zatoshis) leaving the
+// Sapling pool in this transaction; negative values move funds into the
+// pool. Pre-Sapling (v1-v3) transactions have no value balance, so 0.
+func (tx *Transaction) SaplingValueBalance() int64 {
+	if tx.version < 4 {
+		return 0
+	}
+	return tx.valueBalance
+}
+
+// OrchardValueBalance returns the net value (in zatoshis) leaving the
+// Orchard pool in this transaction; 0 if it has no Orchard actions (which
+// only v5 transactions can have).
+func (tx *Transaction) OrchardValueBalance() int64 {
+	return tx.orchardValueBalance
+}
+
 // ToCompact converts the given (full) transaction to compact format.
 func (tx *Transaction) ToCompact(index int) *walletrpc.CompactTx {
+	return tx.ToCompactWithOptions(index, CompactOptions{})
+}
+
+// ToCompactWithOptions is like ToCompact, with control over what's included;
+// the options must be valid (see CompactOptions.Validate).
+func (tx *Transaction) ToCompactWithOptions(index int, options CompactOptions) *walletrpc.CompactTx {
+	saplingPrefix := options.SaplingCiphertextPrefix
+	if saplingPrefix == 0 {
+		saplingPrefix = DefaultCiphertextPrefix
+	}
+	orchardPrefix := options.OrchardCiphertextPrefix
+	if orchardPrefix == 0 {
+		orchardPrefix = DefaultCiphertextPrefix
+	}
 	ctx := &walletrpc.CompactTx{
 		Index: uint64(index), // index is contextual
 		Hash:  tx.GetEncodableHash(),
@@ -320,7 +573,23 @@ func (tx *Transaction) ToCompact(index int) *walletrpc.CompactTx {
 		ctx.Spends[i] = spend.ToCompact()
 	}
 	for i, output := range tx.shieldedOutputs {
-		ctx.Outputs[i] = output.ToCompact()
+		ctx.Outputs[i] = output.ToCompact(saplingPrefix)
+	}
+	for _, action := range tx.orchardActions {
+		ctx.Actions = append(ctx.Actions, action.ToCompact(orchardPrefix))
+	}
+	if !options.Transparent {
+		return ctx
+	}
+	for i, out := range tx.transparentOutputs {
+		if len(out.Script) > MaxCompactScriptSize {
+			continue
+		}
+		ctx.Vout = append(ctx.Vout, &walletrpc.CompactTxOut{
+			Index:  uint32(i),
+			Value:  out.Value,
+			Script: out.Script,
+		})
 	}
 	return ctx
 }
@@ -346,10 +615,17 @@ func (tx *Transaction) ParseFromSlice(data []byte) ([]byte, error) {
 		}
 	}
 
+	if tx.version >= 5 {
+		return tx.parseV5(data, s)
+	}
+
 	var txInCount int
 	if !s.ReadCompactSize(&txInCount) {
 		return nil, errors.New("could not read tx_in_count")
 	}
+	if err := checkCount(s, txInCount, minTxInSize, "tx_in_count"); err != nil {
+		return nil, err
+	}
 
 	// TODO: Duplicate/otherwise-too-many transactions are a possible DoS
 	// TODO: vector. At the moment we're assuming trusted input.
@@ -371,6 +647,9 @@ func (tx *Transaction) ParseFromSlice(data []byte) ([]byte, error) {
 	if !s.ReadCompactSize(&txOutCount) {
 		return nil, errors.New("could not read tx_out_count")
 	}
+	if err := checkCount(s, txOutCount, minTxOutSize, "tx_out_count"); err != nil {
+		return nil, err
+	}
 
 	if txOutCount > 0 {
 		tx.transparentOutputs = make([]*txOut, txOutCount)
@@ -404,6 +683,9 @@ func (tx *Transaction) ParseFromSlice(data []byte) ([]byte, error) {
 		if !s.ReadCompactSize(&spendCount) {
 			return nil, errors.New("could not read nShieldedSpend")
 		}
+		if err := checkCount(s, spendCount, spendSize, "nShieldedSpend"); err != nil {
+			return nil, err
+		}
 
 		if spendCount > 0 {
 			tx.shieldedSpends = make([]*spend, spendCount)
@@ -420,6 +702,9 @@ func (tx *Transaction) ParseFromSlice(data []byte) ([]byte, error) {
 		if !s.ReadCompactSize(&outputCount) {
 			return nil, errors.New("could not read nShieldedOutput")
 		}
+		if err := checkCount(s, outputCount, outputSize, "nShieldedOutput"); err != nil {
+			return nil, err
+		}
 
 		if outputCount > 0 {
 			tx.shieldedOutputs = make([]*output, outputCount)
@@ -439,6 +724,9 @@ func (tx *Transaction) ParseFromSlice(data []byte) ([]byte, error) {
 		if !s.ReadCompactSize(&joinSplitCount) {
 			return nil, errors.New("could not read nJoinSplit")
 		}
+		if err := checkCount(s, joinSplitCount, minJoinSplitSize, "nJoinSplit"); err != nil {
+			return nil, err
+		}
 
 		if joinSplitCount > 0 {
 			tx.joinSplits = make([]*joinSplit, joinSplitCount)
@@ -480,3 +768,161 @@ func NewTransaction() *Transaction {
 		rawTransaction: new(rawTransaction),
 	}
 }
+
+// parseV5 parses the rest (following nVersionGroupId) of a v5 transaction,
+// whose format is described in ZIP 225.
+func (tx *Transaction) parseV5(data []byte, s bytestring.String) ([]byte, error) {
+	var err error
+
+	if !s.ReadUint32(&tx.consensusBranchID) {
+		return nil, errors.New("could not read nConsensusBranchId")
+	}
+
+	if !s.ReadUint32(&tx.nLockTime) {
+		return nil, errors.New("could not read nLockTime")
+	}
+
+	if !s.ReadUint32(&tx.nExpiryHeight) {
+		return nil, errors.New("could not read nExpiryHeight")
+	}
+
+	var txInCount int
+	if !s.ReadCompactSize(&txInCount) {
+		return nil, errors.New("could not read tx_in_count")
+	}
+	if err := checkCount(s, txInCount, minTxInSize, "tx_in_count"); err != nil {
+		return nil, err
+	}
+	for i := 0; i < txInCount; i++ {
+		ti := &txIn{}
+		s, err = ti.ParseFromSlice([]byte(s))
+		if err != nil {
+			return nil, errors.Wrap(err, "while parsing transparent input")
+		}
+		tx.transparentInputs = append(tx.transparentInputs, ti)
+	}
+
+	var txOutCount int
+	if !s.ReadCompactSize(&txOutCount) {
+		return nil, errors.New("could not read tx_out_count")
+	}
+	if err := checkCount(s, txOutCount, minTxOutSize, "tx_out_count"); err != nil {
+		return nil, err
+	}
+	for i := 0; i < txOutCount; i++ {
+		to := &txOut{}
+		s, err = to.ParseFromSlice([]byte(s))
+		if err != nil {
+			return nil, errors.Wrap(err, "while parsing transparent output")
+		}
+		tx.transparentOutputs = append(tx.transparentOutputs, to)
+	}
+
+	// Sapling
+	var spendCount, outputCount int
+	if !s.ReadCompactSize(&spendCount) {
+		return nil, errors.New("could not read nSpendsSapling")
+	}
+	if err := checkCount(s, spendCount, spendV5Size, "nSpendsSapling"); err != nil {
+		return nil, err
+	}
+	for i := 0; i < spendCount; i++ {
+		newSpend := &spend{}
+		s, err = newSpend.parseV5([]byte(s))
+		if err != nil {
+			return nil, errors.Wrap(err, "while parsing shielded Spend")
+		}
+		tx.shieldedSpends = append(tx.shieldedSpends, newSpend)
+	}
+	if !s.ReadCompactSize(&outputCount) {
+		return nil, errors.New("could not read nOutputsSapling")
+	}
+	if err := checkCount(s, outputCount, outputV5Size, "nOutputsSapling"); err != nil {
+		return nil, err
+	}
+	for i := 0; i < outputCount; i++ {
+		newOutput := &output{}
+		s, err = newOutput.parseV5([]byte(s))
+		if err != nil {
+			return nil, errors.Wrap(err, "while parsing shielded Output")
+		}
+		tx.shieldedOutputs = append(tx.shieldedOutputs, newOutput)
+	}
+	if spendCount+outputCount > 0 {
+		if !s.ReadInt64(&tx.valueBalance) {
+			return nil, errors.New("could not read valueBalanceSapling")
+		}
+	}
+	if spendCount > 0 {
+		var anchor []byte
+		if !s.ReadBytes(&anchor, 32) {
+			return nil, errors.New("could not read anchorSapling")
+		}
+		for _, spend := range tx.shieldedSpends {
+			spend.anchor = anchor
+		}
+	}
+	for _, spend := range tx.shieldedSpends {
+		if !s.ReadBytes(&spend.zkproof, 192) {
+			return nil, errors.New("could not read Sapling spend zkproof")
+		}
+	}
+	for _, spend := range tx.shieldedSpends {
+		if !s.ReadBytes(&spend.spendAuthSig, 64) {
+			return nil, errors.New("could not read Sapling spendAuthSig")
+		}
+	}
+	for _, output := range tx.shieldedOutputs {
+		if !s.ReadBytes(&output.zkproof, 192) {
+			return nil, errors.New("could not read Sapling output zkproof")
+		}
+	}
+	if spendCount+outputCount > 0 {
+		if !s.ReadBytes(&tx.bindingSig, 64) {
+			return nil, errors.New("could not read bindingSigSapling")
+		}
+	}
+
+	// Orchard
+	var actionCount int
+	if !s.ReadCompactSize(&actionCount) {
+		return nil, errors.New("could not read nActionsOrchard")
+	}
+	if err := checkCount(s, actionCount, actionSize, "nActionsOrchard"); err != nil {
+		return nil, err
+	}
+	for i := 0; i < actionCount; i++ {
+		a := &action{}
+		s, err = a.ParseFromSlice([]byte(s))
+		if err != nil {
+			return nil, errors.Wrap(err, "while parsing Orchard action")
+		}
+		tx.orchardActions = append(tx.orchardActions, a)
+	}
+	if actionCount > 0 {
+		if !s.ReadByte(&tx.orchardFlags) {
+			return nil, errors.New("could not read flagsOrchard")
+		}
+		if !s.ReadInt64(&tx.orchardValueBalance) {
+			return nil, errors.New("could not read valueBalanceOrchard")
+		}
+		if !s.ReadBytes(&tx.orchardAnchor, 32) {
+			return nil, errors.New("could not read anchorOrchard")
+		}
+		if !s.ReadCompactLengthPrefixed((*bytestring.String)(&tx.orchardProofs)) {
+			return nil, errors.New("could not read proofsOrchard")
+		}
+		// vSpendAuthSigsOrchard
+		if !s.Skip(64 * actionCount) {
+			return nil, errors.New("could not read Orchard spendAuthSigs")
+		}
+		if !s.ReadBytes(&tx.orchardBindingSig, 64) {
+			return nil, errors.New("could not read bindingSigOrchard")
+		}
+	}
+
+	txLen := len(data) - len(s)
+	tx.rawBytes = data[:txLen]
+
+	return []byte(s), nil
+}
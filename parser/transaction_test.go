@@ -212,6 +212,10 @@ func TestSproutTransactionParser(t *testing.T) {
 		if !subTestJoinSplits(tt.vJoinSplits, tx.joinSplits, t, i) {
 			continue
 		}
+		if tx.HasSproutElements() != (len(tt.vJoinSplits) > 0) {
+			t.Errorf("Test %d: HasSproutElements %v", i, tx.HasSproutElements())
+			continue
+		}
 
 		testJSPubKey, _ := hex.DecodeString(tt.joinSplitPubKey)
 		if !bytes.Equal(testJSPubKey, tx.joinSplitPubKey) {
@@ -227,6 +231,11 @@ func TestSproutTransactionParser(t *testing.T) {
 		if hex.EncodeToString(tx.GetDisplayHash()) != tt.txid {
 			t.Errorf("Test %d: incorrect txid", i)
 		}
+
+		// Pre-Sapling transactions have no value balance
+		if tx.SaplingValueBalance() != 0 || tx.OrchardValueBalance() != 0 {
+			t.Errorf("Test %d: unexpected value balance on pre-Sapling tx", i)
+		}
 	}
 }
 
@@ -733,6 +742,10 @@ func TestSaplingTransactionParser(t *testing.T) {
 		if !subTestJoinSplits(tt.vJoinSplits, tx.joinSplits, t, i) {
 			continue
 		}
+		if tx.HasSproutElements() != (len(tt.vJoinSplits) > 0) {
+			t.Errorf("Test %d: HasSproutElements %v", i, tx.HasSproutElements())
+			continue
+		}
 
 		testJSPubKey, _ := hex.DecodeString(tt.joinSplitPubKey)
 		if !bytes.Equal(testJSPubKey, tx.joinSplitPubKey) {
@@ -753,6 +766,14 @@ func TestSaplingTransactionParser(t *testing.T) {
 			t.Errorf("Test %d: valueBalance mismatch %d %d", i, testValueBalance, tx.valueBalance)
 			continue
 		}
+		if testValueBalance != tx.SaplingValueBalance() {
+			t.Errorf("Test %d: SaplingValueBalance mismatch %d %d", i, testValueBalance, tx.SaplingValueBalance())
+			continue
+		}
+		if tx.OrchardValueBalance() != 0 {
+			t.Errorf("Test %d: unexpected Orchard valueBalance %d", i, tx.OrchardValueBalance())
+			continue
+		}
 
 		if !subTestShieldedSpends(tt.spends, tx.shieldedSpends, t, i) {
 			continue
@@ -881,3 +902,95 @@ func subTestShieldedOutputs(testOutputs []outputTestVector, txOutputs []*output,
 
 	return success
 }
+
+// orchardOnlyTx returns a (syntactically valid, but otherwise meaningless)
+// v5 transaction with the given number of Orchard actions and no transparent
+// or Sapling parts. Each byte of action i's fields is i*8 plus the field's
+// position in the action.
+func orchardOnlyTx(nActions int) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(5|1<<31)) // header
+	binary.Write(&b, binary.LittleEndian, uint32(0x26A7270A))
+	binary.Write(&b, binary.LittleEndian, uint32(0xc2d6d0b4)) // NU5
+	binary.Write(&b, binary.LittleEndian, uint32(0))          // nLockTime
+	binary.Write(&b, binary.LittleEndian, uint32(1687104))    // nExpiryHeight
+	b.Write([]byte{0, 0})                                     // transparent
+	b.Write([]byte{0, 0})                                     // Sapling
+	b.WriteByte(byte(nActions))
+	for i := 0; i < nActions; i++ {
+		for j, size := range []int{32, 32, 32, 32, 32, 580, 80} {
+			b.Write(bytes.Repeat([]byte{byte(i*8 + j)}, size))
+		}
+	}
+	b.WriteByte(3)                                      // flagsOrchard
+	binary.Write(&b, binary.LittleEndian, int64(-5000)) // valueBalanceOrchard
+	b.Write(bytes.Repeat([]byte{0xaa}, 32))             // anchorOrchard
+	b.Write([]byte{0xfd, 0x00, 0x01})                   // sizeProofsOrchard
+	b.Write(bytes.Repeat([]byte{0xbb}, 256))
+	b.Write(bytes.Repeat([]byte{0xcc}, 64*nActions)) // vSpendAuthSigsOrchard
+	b.Write(bytes.Repeat([]byte{0xdd}, 64))          // bindingSigOrchard
+	return b.Bytes()
+}
+
+func TestOrchardOnlyTransaction(t *testing.T) {
+	rawTx := orchardOnlyTx(2)
+	tx := NewTransaction()
+	rest, err := tx.ParseFromSlice(rawTx)
+	if err != nil {
+		t.Fatal("ParseFromSlice failed:", err)
+	}
+	if len(rest) != 0 {
+		t.Fatal("ParseFromSlice did not consume the entire buffer")
+	}
+	for j := 0; j < len(rawTx); j++ {
+		if _, err := NewTransaction().ParseFromSlice(rawTx[:j]); err == nil {
+			t.Fatal("ParseFromSlice of a truncated transaction succeeded, length", j)
+		}
+	}
+	if tx.HasSaplingElements() || tx.HasSproutElements() || !tx.HasOrchardActions() {
+		t.Fatal("unexpected pools", tx.HasSaplingElements(), tx.HasSproutElements(), tx.HasOrchardActions())
+	}
+	if tx.OrchardValueBalance() != -5000 || tx.SaplingValueBalance() != 0 {
+		t.Fatal("unexpected value balances", tx.OrchardValueBalance(), tx.SaplingValueBalance())
+	}
+	if !bytes.Equal(tx.Bytes(), rawTx) {
+		t.Fatal("unexpected raw bytes")
+	}
+
+	ctx := tx.ToCompactWithOptions(0, CompactOptions{OrchardCiphertextPrefix: 100})
+	if len(ctx.Spends) != 0 || len(ctx.Outputs) != 0 || len(ctx.Actions) != 2 {
+		t.Fatal("unexpected compact transaction", len(ctx.Spends), len(ctx.Outputs), len(ctx.Actions))
+	}
+	for i, a := range ctx.Actions {
+		if !bytes.Equal(a.Nullifier, bytes.Repeat([]byte{byte(i*8 + 1)}, 32)) ||
+			!bytes.Equal(a.Cmx, bytes.Repeat([]byte{byte(i*8 + 3)}, 32)) ||
+			!bytes.Equal(a.EphemeralKey, bytes.Repeat([]byte{byte(i*8 + 4)}, 32)) ||
+			!bytes.Equal(a.Ciphertext, bytes.Repeat([]byte{byte(i*8 + 5)}, 100)) {
+			t.Fatal("unexpected compact action", i, a)
+		}
+	}
+	if len(tx.ToCompact(0).Actions[0].Ciphertext) != DefaultCiphertextPrefix {
+		t.Fatal("unexpected default ciphertext prefix length")
+	}
+}
+
+func TestTransactionAbsurdCount(t *testing.T) {
+	// 0x02000000 (the largest count ReadCompactSize accepts) in each case.
+	huge := []byte{0xfe, 0x00, 0x00, 0x00, 0x02}
+	v4 := []byte{0x04, 0x00, 0x00, 0x80, 0x85, 0x20, 0x2f, 0x89}
+	v5 := orchardOnlyTx(1)[:24] // up to nActionsOrchard
+	padding := make([]byte, 1000)
+	for _, tt := range []struct {
+		rawTx []byte
+		field string
+	}{
+		{append(append(append([]byte{}, v4...), huge...), padding...), "tx_in_count"},
+		{append(append(append(append([]byte{}, v4...), 0), huge...), padding...), "tx_out_count"},
+		{append(append(append([]byte{}, v5...), huge...), padding...), "nActionsOrchard"},
+	} {
+		_, err := NewTransaction().ParseFromSlice(tt.rawTx)
+		if err == nil || !strings.Contains(err.Error(), tt.field) {
+			t.Fatal("ParseFromSlice with an absurd", tt.field, "unexpected error", err)
+		}
+	}
+}
@@ -4,6 +4,8 @@
 
 package parser
 
+import "encoding/hex"
+
 // Reverse the given byte slice, returning a slice pointing to new data;
 // the input slice is unchanged.
 func Reverse(a []byte) []byte {
@@ -13,3 +15,38 @@ func Reverse(a []byte) []byte {
 	}
 	return r
 }
+
+// Transaction IDs and block hashes appear in two byte orders. Serialized
+// transactions and blocks, and the hash fields of the compact formats and
+// of most gRPC messages, use the internal (little-endian) order; zcashd's RPC
+// interface and block explorers display them (as hex) in the reverse, big-
+// endian order. Use these rather than Reverse to convert between the two, so
+// the direction of each conversion is clear. The input is never modified.
+
+// InternalToDisplay returns the display-order form of an internal-order
+// txid or block hash.
+func InternalToDisplay(hash []byte) []byte {
+	return Reverse(hash)
+}
+
+// DisplayToInternal returns the internal-order form of a display-order
+// txid or block hash.
+func DisplayToInternal(hash []byte) []byte {
+	return Reverse(hash)
+}
+
+// InternalToDisplayHex returns the hex string that zcashd uses for an
+// internal-order txid or block hash.
+func InternalToDisplayHex(hash []byte) string {
+	return hex.EncodeToString(InternalToDisplay(hash))
+}
+
+// DisplayHexToInternal parses a txid or block hash as zcashd displays it
+// (hex) into internal order.
+func DisplayHexToInternal(hash string) ([]byte, error) {
+	b, err := hex.DecodeString(hash)
+	if err != nil {
+		return nil, err
+	}
+	return DisplayToInternal(b), nil
+}
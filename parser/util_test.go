@@ -5,6 +5,10 @@
 package parser
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"os"
 	"testing"
 )
 
@@ -35,3 +39,62 @@ func TestReverseOdd(t *testing.T) {
 		}
 	}
 }
+
+func TestByteOrderRoundTrip(t *testing.T) {
+	s := make([]byte, 32)
+	for i := range s {
+		s[i] = byte(i)
+	}
+	if !bytes.Equal(DisplayToInternal(InternalToDisplay(s)), s) {
+		t.Fatal("internal to display round trip mismatch")
+	}
+	if !bytes.Equal(InternalToDisplay(DisplayToInternal(s)), s) {
+		t.Fatal("display to internal round trip mismatch")
+	}
+	internal, err := DisplayHexToInternal(InternalToDisplayHex(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(internal, s) {
+		t.Fatal("hex round trip mismatch")
+	}
+	if _, err := DisplayHexToInternal("not hex"); err == nil {
+		t.Fatal("DisplayHexToInternal accepted a bad hex string")
+	}
+}
+
+func TestByteOrderKnownTxid(t *testing.T) {
+	// The coinbase of the first block in testdata/blocks.
+	const txid = "81096ff101a4f01d25ffd34a446bee4368bd46c233a59ac0faf101e1861c6b22"
+	testBlocks, err := os.Open("../testdata/blocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testBlocks.Close()
+	scan := bufio.NewScanner(testBlocks)
+	if !scan.Scan() {
+		t.Fatal("no test blocks")
+	}
+	blockData, err := hex.DecodeString(scan.Text())
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := NewBlock()
+	if _, err := block.ParseFromSlice(blockData); err != nil {
+		t.Fatal(err)
+	}
+	tx := block.Transactions()[0]
+	if InternalToDisplayHex(tx.GetEncodableHash()) != txid {
+		t.Fatal("unexpected display txid", InternalToDisplayHex(tx.GetEncodableHash()))
+	}
+	internal, err := DisplayHexToInternal(txid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(internal, tx.GetEncodableHash()) {
+		t.Fatal("unexpected internal txid", hex.EncodeToString(internal))
+	}
+	if !bytes.Equal(tx.GetDisplayHash(), InternalToDisplay(internal)) {
+		t.Fatal("GetDisplayHash doesn't match InternalToDisplay")
+	}
+}
@@ -32,6 +32,11 @@ type DarksideMetaState struct {
 	SaplingActivation int32  `protobuf:"varint,1,opt,name=saplingActivation,proto3" json:"saplingActivation,omitempty"`
 	BranchID          string `protobuf:"bytes,2,opt,name=branchID,proto3" json:"branchID,omitempty"`
 	ChainName         string `protobuf:"bytes,3,opt,name=chainName,proto3" json:"chainName,omitempty"`
+	// If set, ApplyStaged() fails when two staged blocks have the same
+	// height; otherwise the later one replaces the earlier one.
+	StrictStagedHeights bool `protobuf:"varint,4,opt,name=strictStagedHeights,proto3" json:"strictStagedHeights,omitempty"`
+	// Reported by GetLightdInfo() as the Orchard activation height (none if zero).
+	OrchardActivation int32 `protobuf:"varint,5,opt,name=orchardActivation,proto3" json:"orchardActivation,omitempty"`
 }
 
 func (x *DarksideMetaState) Reset() {
@@ -87,32 +92,696 @@ func (x *DarksideMetaState) GetChainName() string {
 	return ""
 }
 
+func (x *DarksideMetaState) GetStrictStagedHeights() bool {
+	if x != nil {
+		return x.StrictStagedHeights
+	}
+	return false
+}
+
+func (x *DarksideMetaState) GetOrchardActivation() int32 {
+	if x != nil {
+		return x.OrchardActivation
+	}
+	return 0
+}
+
 // A block is a hex-encoded string.
 type DarksideBlock struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Block string `protobuf:"bytes,1,opt,name=block,proto3" json:"block,omitempty"`
+	Block string `protobuf:"bytes,1,opt,name=block,proto3" json:"block,omitempty"`
+}
+
+func (x *DarksideBlock) Reset() {
+	*x = DarksideBlock{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_darkside_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DarksideBlock) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DarksideBlock) ProtoMessage() {}
+
+func (x *DarksideBlock) ProtoReflect() protoreflect.Message {
+	mi := &file_darkside_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DarksideBlock.ProtoReflect.Descriptor instead.
+func (*DarksideBlock) Descriptor() ([]byte, []int) {
+	return file_darkside_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *DarksideBlock) GetBlock() string {
+	if x != nil {
+		return x.Block
+	}
+	return ""
+}
+
+// DarksideBlockPrevhash is a hex-encoded block and the prevhash (32 bytes,
+// in block header byte order) it must keep; if empty, the block's own.
+type DarksideBlockPrevhash struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Block    string `protobuf:"bytes,1,opt,name=block,proto3" json:"block,omitempty"`
+	PrevHash []byte `protobuf:"bytes,2,opt,name=prevHash,proto3" json:"prevHash,omitempty"`
+}
+
+func (x *DarksideBlockPrevhash) Reset() {
+	*x = DarksideBlockPrevhash{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_darkside_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DarksideBlockPrevhash) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DarksideBlockPrevhash) ProtoMessage() {}
+
+func (x *DarksideBlockPrevhash) ProtoReflect() protoreflect.Message {
+	mi := &file_darkside_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DarksideBlockPrevhash.ProtoReflect.Descriptor instead.
+func (*DarksideBlockPrevhash) Descriptor() ([]byte, []int) {
+	return file_darkside_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *DarksideBlockPrevhash) GetBlock() string {
+	if x != nil {
+		return x.Block
+	}
+	return ""
+}
+
+func (x *DarksideBlockPrevhash) GetPrevHash() []byte {
+	if x != nil {
+		return x.PrevHash
+	}
+	return nil
+}
+
+// DarksideBlocksURL is typically something like:
+// https://raw.githubusercontent.com/zcash-hackworks/darksidewalletd-test-data/master/basic-reorg/before-reorg.txt
+type DarksideBlocksURL struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Url string `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+}
+
+func (x *DarksideBlocksURL) Reset() {
+	*x = DarksideBlocksURL{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_darkside_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DarksideBlocksURL) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DarksideBlocksURL) ProtoMessage() {}
+
+func (x *DarksideBlocksURL) ProtoReflect() protoreflect.Message {
+	mi := &file_darkside_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DarksideBlocksURL.ProtoReflect.Descriptor instead.
+func (*DarksideBlocksURL) Descriptor() ([]byte, []int) {
+	return file_darkside_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *DarksideBlocksURL) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+// DarksideTransactionsURL refers to an HTTP source that contains a list
+// of hex-encoded transactions, one per line, that are to be associated
+// with the given height (fake-mined into the block at that height)
+type DarksideTransactionsURL struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Height int32  `protobuf:"varint,1,opt,name=height,proto3" json:"height,omitempty"`
+	Url    string `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+}
+
+func (x *DarksideTransactionsURL) Reset() {
+	*x = DarksideTransactionsURL{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_darkside_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DarksideTransactionsURL) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DarksideTransactionsURL) ProtoMessage() {}
+
+func (x *DarksideTransactionsURL) ProtoReflect() protoreflect.Message {
+	mi := &file_darkside_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DarksideTransactionsURL.ProtoReflect.Descriptor instead.
+func (*DarksideTransactionsURL) Descriptor() ([]byte, []int) {
+	return file_darkside_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *DarksideTransactionsURL) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *DarksideTransactionsURL) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+type DarksideHeight struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Height int32 `protobuf:"varint,1,opt,name=height,proto3" json:"height,omitempty"`
+}
+
+func (x *DarksideHeight) Reset() {
+	*x = DarksideHeight{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_darkside_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DarksideHeight) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DarksideHeight) ProtoMessage() {}
+
+func (x *DarksideHeight) ProtoReflect() protoreflect.Message {
+	mi := &file_darkside_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DarksideHeight.ProtoReflect.Descriptor instead.
+func (*DarksideHeight) Descriptor() ([]byte, []int) {
+	return file_darkside_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *DarksideHeight) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+type DarksideEmptyBlocks struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Height int32 `protobuf:"varint,1,opt,name=height,proto3" json:"height,omitempty"`
+	Nonce  int32 `protobuf:"varint,2,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	Count  int32 `protobuf:"varint,3,opt,name=count,proto3" json:"count,omitempty"`
+}
+
+func (x *DarksideEmptyBlocks) Reset() {
+	*x = DarksideEmptyBlocks{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_darkside_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DarksideEmptyBlocks) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DarksideEmptyBlocks) ProtoMessage() {}
+
+func (x *DarksideEmptyBlocks) ProtoReflect() protoreflect.Message {
+	mi := &file_darkside_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DarksideEmptyBlocks.ProtoReflect.Descriptor instead.
+func (*DarksideEmptyBlocks) Descriptor() ([]byte, []int) {
+	return file_darkside_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DarksideEmptyBlocks) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *DarksideEmptyBlocks) GetNonce() int32 {
+	if x != nil {
+		return x.Nonce
+	}
+	return 0
+}
+
+func (x *DarksideEmptyBlocks) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+// DarksideProofOfWork is the header nBits (4 bytes, as serialized) and
+// Equihash solution given to blocks created by StageBlocksCreate(). An
+// empty value means the default (all zeros).
+type DarksideProofOfWork struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	NBits    []byte `protobuf:"bytes,1,opt,name=nBits,proto3" json:"nBits,omitempty"`
+	Solution []byte `protobuf:"bytes,2,opt,name=solution,proto3" json:"solution,omitempty"`
+}
+
+func (x *DarksideProofOfWork) Reset() {
+	*x = DarksideProofOfWork{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_darkside_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DarksideProofOfWork) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DarksideProofOfWork) ProtoMessage() {}
+
+func (x *DarksideProofOfWork) ProtoReflect() protoreflect.Message {
+	mi := &file_darkside_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DarksideProofOfWork.ProtoReflect.Descriptor instead.
+func (*DarksideProofOfWork) Descriptor() ([]byte, []int) {
+	return file_darkside_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DarksideProofOfWork) GetNBits() []byte {
+	if x != nil {
+		return x.NBits
+	}
+	return nil
+}
+
+func (x *DarksideProofOfWork) GetSolution() []byte {
+	if x != nil {
+		return x.Solution
+	}
+	return nil
+}
+
+// DarksideChainTime is the header time (Unix epoch seconds) of blocks
+// created by StageBlocksCreate(), and the mediantime that the mock zcashd's
+// getblockchaininfo reports.
+type DarksideChainTime struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Time       uint32 `protobuf:"varint,1,opt,name=time,proto3" json:"time,omitempty"`
+	MedianTime int64  `protobuf:"varint,2,opt,name=medianTime,proto3" json:"medianTime,omitempty"`
+}
+
+func (x *DarksideChainTime) Reset() {
+	*x = DarksideChainTime{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_darkside_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DarksideChainTime) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DarksideChainTime) ProtoMessage() {}
+
+func (x *DarksideChainTime) ProtoReflect() protoreflect.Message {
+	mi := &file_darkside_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DarksideChainTime.ProtoReflect.Descriptor instead.
+func (*DarksideChainTime) Descriptor() ([]byte, []int) {
+	return file_darkside_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DarksideChainTime) GetTime() uint32 {
+	if x != nil {
+		return x.Time
+	}
+	return 0
+}
+
+func (x *DarksideChainTime) GetMedianTime() int64 {
+	if x != nil {
+		return x.MedianTime
+	}
+	return 0
+}
+
+// DarksideBranchID is the consensus branch ID (8 hex digits, as in Reset())
+// of blocks from the given height up to the next DarksideBranchID's height.
+type DarksideBranchID struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Height   int32  `protobuf:"varint,1,opt,name=height,proto3" json:"height,omitempty"`
+	BranchID string `protobuf:"bytes,2,opt,name=branchID,proto3" json:"branchID,omitempty"`
+}
+
+func (x *DarksideBranchID) Reset() {
+	*x = DarksideBranchID{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_darkside_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DarksideBranchID) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DarksideBranchID) ProtoMessage() {}
+
+func (x *DarksideBranchID) ProtoReflect() protoreflect.Message {
+	mi := &file_darkside_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DarksideBranchID.ProtoReflect.Descriptor instead.
+func (*DarksideBranchID) Descriptor() ([]byte, []int) {
+	return file_darkside_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *DarksideBranchID) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *DarksideBranchID) GetBranchID() string {
+	if x != nil {
+		return x.BranchID
+	}
+	return ""
+}
+
+type DarksideBranchIDs struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	BranchIDs []*DarksideBranchID `protobuf:"bytes,1,rep,name=branchIDs,proto3" json:"branchIDs,omitempty"`
+}
+
+func (x *DarksideBranchIDs) Reset() {
+	*x = DarksideBranchIDs{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_darkside_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DarksideBranchIDs) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DarksideBranchIDs) ProtoMessage() {}
+
+func (x *DarksideBranchIDs) ProtoReflect() protoreflect.Message {
+	mi := &file_darkside_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DarksideBranchIDs.ProtoReflect.Descriptor instead.
+func (*DarksideBranchIDs) Descriptor() ([]byte, []int) {
+	return file_darkside_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *DarksideBranchIDs) GetBranchIDs() []*DarksideBranchID {
+	if x != nil {
+		return x.BranchIDs
+	}
+	return nil
+}
+
+// DarksideBackendDown says whether the mock zcashd is unreachable, and
+// for which rpc methods (such as "getblock"); none means all.
+type DarksideBackendDown struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Down    bool     `protobuf:"varint,1,opt,name=down,proto3" json:"down,omitempty"`
+	Methods []string `protobuf:"bytes,2,rep,name=methods,proto3" json:"methods,omitempty"`
+}
+
+func (x *DarksideBackendDown) Reset() {
+	*x = DarksideBackendDown{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_darkside_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DarksideBackendDown) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DarksideBackendDown) ProtoMessage() {}
+
+func (x *DarksideBackendDown) ProtoReflect() protoreflect.Message {
+	mi := &file_darkside_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DarksideBackendDown.ProtoReflect.Descriptor instead.
+func (*DarksideBackendDown) Descriptor() ([]byte, []int) {
+	return file_darkside_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *DarksideBackendDown) GetDown() bool {
+	if x != nil {
+		return x.Down
+	}
+	return false
+}
+
+func (x *DarksideBackendDown) GetMethods() []string {
+	if x != nil {
+		return x.Methods
+	}
+	return nil
+}
+
+// DarksideIncomingCursor selects the incoming transactions received at or
+// after the given index (counting from Reset; 0 selects all of them).
+type DarksideIncomingCursor struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Since uint64 `protobuf:"varint,1,opt,name=since,proto3" json:"since,omitempty"`
+}
+
+func (x *DarksideIncomingCursor) Reset() {
+	*x = DarksideIncomingCursor{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_darkside_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DarksideIncomingCursor) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DarksideIncomingCursor) ProtoMessage() {}
+
+func (x *DarksideIncomingCursor) ProtoReflect() protoreflect.Message {
+	mi := &file_darkside_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DarksideIncomingCursor.ProtoReflect.Descriptor instead.
+func (*DarksideIncomingCursor) Descriptor() ([]byte, []int) {
+	return file_darkside_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *DarksideIncomingCursor) GetSince() uint64 {
+	if x != nil {
+		return x.Since
+	}
+	return 0
+}
+
+// DarksideIncomingTransactions is a page of incoming transactions; pass
+// cursor to the next call to get only transactions received after these.
+type DarksideIncomingTransactions struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Transactions []*RawTransaction `protobuf:"bytes,1,rep,name=transactions,proto3" json:"transactions,omitempty"`
+	Cursor       uint64            `protobuf:"varint,2,opt,name=cursor,proto3" json:"cursor,omitempty"`
 }
 
-func (x *DarksideBlock) Reset() {
-	*x = DarksideBlock{}
+func (x *DarksideIncomingTransactions) Reset() {
+	*x = DarksideIncomingTransactions{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_darkside_proto_msgTypes[1]
+		mi := &file_darkside_proto_msgTypes[13]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *DarksideBlock) String() string {
+func (x *DarksideIncomingTransactions) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*DarksideBlock) ProtoMessage() {}
+func (*DarksideIncomingTransactions) ProtoMessage() {}
 
-func (x *DarksideBlock) ProtoReflect() protoreflect.Message {
-	mi := &file_darkside_proto_msgTypes[1]
+func (x *DarksideIncomingTransactions) ProtoReflect() protoreflect.Message {
+	mi := &file_darkside_proto_msgTypes[13]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -123,45 +792,51 @@ func (x *DarksideBlock) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use DarksideBlock.ProtoReflect.Descriptor instead.
-func (*DarksideBlock) Descriptor() ([]byte, []int) {
-	return file_darkside_proto_rawDescGZIP(), []int{1}
+// Deprecated: Use DarksideIncomingTransactions.ProtoReflect.Descriptor instead.
+func (*DarksideIncomingTransactions) Descriptor() ([]byte, []int) {
+	return file_darkside_proto_rawDescGZIP(), []int{13}
 }
 
-func (x *DarksideBlock) GetBlock() string {
+func (x *DarksideIncomingTransactions) GetTransactions() []*RawTransaction {
 	if x != nil {
-		return x.Block
+		return x.Transactions
 	}
-	return ""
+	return nil
 }
 
-// DarksideBlocksURL is typically something like:
-// https://raw.githubusercontent.com/zcash-hackworks/darksidewalletd-test-data/master/basic-reorg/before-reorg.txt
-type DarksideBlocksURL struct {
+func (x *DarksideIncomingTransactions) GetCursor() uint64 {
+	if x != nil {
+		return x.Cursor
+	}
+	return 0
+}
+
+// DarksideIncomingCountArg is the argument to GetIncomingTransactionCount.
+type DarksideIncomingCountArg struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Url string `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	IncludeTxids bool `protobuf:"varint,1,opt,name=includeTxids,proto3" json:"includeTxids,omitempty"`
 }
 
-func (x *DarksideBlocksURL) Reset() {
-	*x = DarksideBlocksURL{}
+func (x *DarksideIncomingCountArg) Reset() {
+	*x = DarksideIncomingCountArg{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_darkside_proto_msgTypes[2]
+		mi := &file_darkside_proto_msgTypes[14]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *DarksideBlocksURL) String() string {
+func (x *DarksideIncomingCountArg) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*DarksideBlocksURL) ProtoMessage() {}
+func (*DarksideIncomingCountArg) ProtoMessage() {}
 
-func (x *DarksideBlocksURL) ProtoReflect() protoreflect.Message {
-	mi := &file_darkside_proto_msgTypes[2]
+func (x *DarksideIncomingCountArg) ProtoReflect() protoreflect.Message {
+	mi := &file_darkside_proto_msgTypes[14]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -172,47 +847,46 @@ func (x *DarksideBlocksURL) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use DarksideBlocksURL.ProtoReflect.Descriptor instead.
-func (*DarksideBlocksURL) Descriptor() ([]byte, []int) {
-	return file_darkside_proto_rawDescGZIP(), []int{2}
+// Deprecated: Use DarksideIncomingCountArg.ProtoReflect.Descriptor instead.
+func (*DarksideIncomingCountArg) Descriptor() ([]byte, []int) {
+	return file_darkside_proto_rawDescGZIP(), []int{14}
 }
 
-func (x *DarksideBlocksURL) GetUrl() string {
+func (x *DarksideIncomingCountArg) GetIncludeTxids() bool {
 	if x != nil {
-		return x.Url
+		return x.IncludeTxids
 	}
-	return ""
+	return false
 }
 
-// DarksideTransactionsURL refers to an HTTP source that contains a list
-// of hex-encoded transactions, one per line, that are to be associated
-// with the given height (fake-mined into the block at that height)
-type DarksideTransactionsURL struct {
+// DarksideIncomingCount is the number of incoming transactions and, if
+// requested, their txids (little-endian, as in TxFilter.hash).
+type DarksideIncomingCount struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Height int32  `protobuf:"varint,1,opt,name=height,proto3" json:"height,omitempty"`
-	Url    string `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	Count uint32   `protobuf:"varint,1,opt,name=count,proto3" json:"count,omitempty"`
+	Txids [][]byte `protobuf:"bytes,2,rep,name=txids,proto3" json:"txids,omitempty"`
 }
 
-func (x *DarksideTransactionsURL) Reset() {
-	*x = DarksideTransactionsURL{}
+func (x *DarksideIncomingCount) Reset() {
+	*x = DarksideIncomingCount{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_darkside_proto_msgTypes[3]
+		mi := &file_darkside_proto_msgTypes[15]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *DarksideTransactionsURL) String() string {
+func (x *DarksideIncomingCount) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*DarksideTransactionsURL) ProtoMessage() {}
+func (*DarksideIncomingCount) ProtoMessage() {}
 
-func (x *DarksideTransactionsURL) ProtoReflect() protoreflect.Message {
-	mi := &file_darkside_proto_msgTypes[3]
+func (x *DarksideIncomingCount) ProtoReflect() protoreflect.Message {
+	mi := &file_darkside_proto_msgTypes[15]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -223,50 +897,54 @@ func (x *DarksideTransactionsURL) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use DarksideTransactionsURL.ProtoReflect.Descriptor instead.
-func (*DarksideTransactionsURL) Descriptor() ([]byte, []int) {
-	return file_darkside_proto_rawDescGZIP(), []int{3}
+// Deprecated: Use DarksideIncomingCount.ProtoReflect.Descriptor instead.
+func (*DarksideIncomingCount) Descriptor() ([]byte, []int) {
+	return file_darkside_proto_rawDescGZIP(), []int{15}
 }
 
-func (x *DarksideTransactionsURL) GetHeight() int32 {
+func (x *DarksideIncomingCount) GetCount() uint32 {
 	if x != nil {
-		return x.Height
+		return x.Count
 	}
 	return 0
 }
 
-func (x *DarksideTransactionsURL) GetUrl() string {
+func (x *DarksideIncomingCount) GetTxids() [][]byte {
 	if x != nil {
-		return x.Url
+		return x.Txids
 	}
-	return ""
+	return nil
 }
 
-type DarksideHeight struct {
+// DarksideBlockSelector selects an active block by height or, if staged is
+// set, a staged block by its index in the staging area (in staging order).
+type DarksideBlockSelector struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
 	Height int32 `protobuf:"varint,1,opt,name=height,proto3" json:"height,omitempty"`
+	Staged bool  `protobuf:"varint,2,opt,name=staged,proto3" json:"staged,omitempty"`
+	Index  int32 `protobuf:"varint,3,opt,name=index,proto3" json:"index,omitempty"`
 }
 
-func (x *DarksideHeight) Reset() {
-	*x = DarksideHeight{}
+func (x *DarksideBlockSelector) Reset() {
+	*x = DarksideBlockSelector{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_darkside_proto_msgTypes[4]
+		mi := &file_darkside_proto_msgTypes[16]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *DarksideHeight) String() string {
+func (x *DarksideBlockSelector) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*DarksideHeight) ProtoMessage() {}
+func (*DarksideBlockSelector) ProtoMessage() {}
 
-func (x *DarksideHeight) ProtoReflect() protoreflect.Message {
-	mi := &file_darkside_proto_msgTypes[4]
+func (x *DarksideBlockSelector) ProtoReflect() protoreflect.Message {
+	mi := &file_darkside_proto_msgTypes[16]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -277,45 +955,60 @@ func (x *DarksideHeight) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use DarksideHeight.ProtoReflect.Descriptor instead.
-func (*DarksideHeight) Descriptor() ([]byte, []int) {
-	return file_darkside_proto_rawDescGZIP(), []int{4}
+// Deprecated: Use DarksideBlockSelector.ProtoReflect.Descriptor instead.
+func (*DarksideBlockSelector) Descriptor() ([]byte, []int) {
+	return file_darkside_proto_rawDescGZIP(), []int{16}
 }
 
-func (x *DarksideHeight) GetHeight() int32 {
+func (x *DarksideBlockSelector) GetHeight() int32 {
 	if x != nil {
 		return x.Height
 	}
 	return 0
 }
 
-type DarksideEmptyBlocks struct {
+func (x *DarksideBlockSelector) GetStaged() bool {
+	if x != nil {
+		return x.Staged
+	}
+	return false
+}
+
+func (x *DarksideBlockSelector) GetIndex() int32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+// DarksideBlockHash is the height of the selected block and its hash,
+// hex-encoded in display (big-endian) order as in block explorers.
+type DarksideBlockHash struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Height int32 `protobuf:"varint,1,opt,name=height,proto3" json:"height,omitempty"`
-	Nonce  int32 `protobuf:"varint,2,opt,name=nonce,proto3" json:"nonce,omitempty"`
-	Count  int32 `protobuf:"varint,3,opt,name=count,proto3" json:"count,omitempty"`
+	Height int32  `protobuf:"varint,1,opt,name=height,proto3" json:"height,omitempty"`
+	Hash   string `protobuf:"bytes,2,opt,name=hash,proto3" json:"hash,omitempty"`
 }
 
-func (x *DarksideEmptyBlocks) Reset() {
-	*x = DarksideEmptyBlocks{}
+func (x *DarksideBlockHash) Reset() {
+	*x = DarksideBlockHash{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_darkside_proto_msgTypes[5]
+		mi := &file_darkside_proto_msgTypes[17]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *DarksideEmptyBlocks) String() string {
+func (x *DarksideBlockHash) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*DarksideEmptyBlocks) ProtoMessage() {}
+func (*DarksideBlockHash) ProtoMessage() {}
 
-func (x *DarksideEmptyBlocks) ProtoReflect() protoreflect.Message {
-	mi := &file_darkside_proto_msgTypes[5]
+func (x *DarksideBlockHash) ProtoReflect() protoreflect.Message {
+	mi := &file_darkside_proto_msgTypes[17]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -326,30 +1019,23 @@ func (x *DarksideEmptyBlocks) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use DarksideEmptyBlocks.ProtoReflect.Descriptor instead.
-func (*DarksideEmptyBlocks) Descriptor() ([]byte, []int) {
-	return file_darkside_proto_rawDescGZIP(), []int{5}
+// Deprecated: Use DarksideBlockHash.ProtoReflect.Descriptor instead.
+func (*DarksideBlockHash) Descriptor() ([]byte, []int) {
+	return file_darkside_proto_rawDescGZIP(), []int{17}
 }
 
-func (x *DarksideEmptyBlocks) GetHeight() int32 {
+func (x *DarksideBlockHash) GetHeight() int32 {
 	if x != nil {
 		return x.Height
 	}
 	return 0
 }
 
-func (x *DarksideEmptyBlocks) GetNonce() int32 {
-	if x != nil {
-		return x.Nonce
-	}
-	return 0
-}
-
-func (x *DarksideEmptyBlocks) GetCount() int32 {
+func (x *DarksideBlockHash) GetHash() string {
 	if x != nil {
-		return x.Count
+		return x.Hash
 	}
-	return 0
+	return ""
 }
 
 var File_darkside_proto protoreflect.FileDescriptor
@@ -358,32 +1044,96 @@ var file_darkside_proto_rawDesc = []byte{
 	0x0a, 0x0e, 0x64, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
 	0x12, 0x15, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e,
 	0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x1a, 0x0d, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65,
-	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x7b, 0x0a, 0x11, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69,
-	0x64, 0x65, 0x4d, 0x65, 0x74, 0x61, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x2c, 0x0a, 0x11, 0x73,
-	0x61, 0x70, 0x6c, 0x69, 0x6e, 0x67, 0x41, 0x63, 0x74, 0x69, 0x76, 0x61, 0x74, 0x69, 0x6f, 0x6e,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x11, 0x73, 0x61, 0x70, 0x6c, 0x69, 0x6e, 0x67, 0x41,
-	0x63, 0x74, 0x69, 0x76, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x62, 0x72, 0x61,
-	0x6e, 0x63, 0x68, 0x49, 0x44, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x62, 0x72, 0x61,
-	0x6e, 0x63, 0x68, 0x49, 0x44, 0x12, 0x1c, 0x0a, 0x09, 0x63, 0x68, 0x61, 0x69, 0x6e, 0x4e, 0x61,
-	0x6d, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x63, 0x68, 0x61, 0x69, 0x6e, 0x4e,
-	0x61, 0x6d, 0x65, 0x22, 0x25, 0x0a, 0x0d, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x42,
-	0x6c, 0x6f, 0x63, 0x6b, 0x12, 0x14, 0x0a, 0x05, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x18, 0x01, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x05, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x22, 0x25, 0x0a, 0x11, 0x44, 0x61,
-	0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x73, 0x55, 0x52, 0x4c, 0x12,
-	0x10, 0x0a, 0x03, 0x75, 0x72, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x75, 0x72,
-	0x6c, 0x22, 0x43, 0x0a, 0x17, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x54, 0x72, 0x61,
-	0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x55, 0x52, 0x4c, 0x12, 0x16, 0x0a, 0x06,
-	0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x68, 0x65,
-	0x69, 0x67, 0x68, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x75, 0x72, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x03, 0x75, 0x72, 0x6c, 0x22, 0x28, 0x0a, 0x0e, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69,
-	0x64, 0x65, 0x48, 0x65, 0x69, 0x67, 0x68, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x68, 0x65, 0x69, 0x67,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xdb, 0x01, 0x0a, 0x11, 0x44, 0x61, 0x72, 0x6b, 0x73,
+	0x69, 0x64, 0x65, 0x4d, 0x65, 0x74, 0x61, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x2c, 0x0a, 0x11,
+	0x73, 0x61, 0x70, 0x6c, 0x69, 0x6e, 0x67, 0x41, 0x63, 0x74, 0x69, 0x76, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x11, 0x73, 0x61, 0x70, 0x6c, 0x69, 0x6e, 0x67,
+	0x41, 0x63, 0x74, 0x69, 0x76, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x62, 0x72,
+	0x61, 0x6e, 0x63, 0x68, 0x49, 0x44, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x62, 0x72,
+	0x61, 0x6e, 0x63, 0x68, 0x49, 0x44, 0x12, 0x1c, 0x0a, 0x09, 0x63, 0x68, 0x61, 0x69, 0x6e, 0x4e,
+	0x61, 0x6d, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x63, 0x68, 0x61, 0x69, 0x6e,
+	0x4e, 0x61, 0x6d, 0x65, 0x12, 0x30, 0x0a, 0x13, 0x73, 0x74, 0x72, 0x69, 0x63, 0x74, 0x53, 0x74,
+	0x61, 0x67, 0x65, 0x64, 0x48, 0x65, 0x69, 0x67, 0x68, 0x74, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x08, 0x52, 0x13, 0x73, 0x74, 0x72, 0x69, 0x63, 0x74, 0x53, 0x74, 0x61, 0x67, 0x65, 0x64, 0x48,
+	0x65, 0x69, 0x67, 0x68, 0x74, 0x73, 0x12, 0x2c, 0x0a, 0x11, 0x6f, 0x72, 0x63, 0x68, 0x61, 0x72,
+	0x64, 0x41, 0x63, 0x74, 0x69, 0x76, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28,
+	0x05, 0x52, 0x11, 0x6f, 0x72, 0x63, 0x68, 0x61, 0x72, 0x64, 0x41, 0x63, 0x74, 0x69, 0x76, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x22, 0x25, 0x0a, 0x0d, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65,
+	0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x12, 0x14, 0x0a, 0x05, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x22, 0x49, 0x0a, 0x15, 0x44,
+	0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x50, 0x72, 0x65, 0x76,
+	0x68, 0x61, 0x73, 0x68, 0x12, 0x14, 0x0a, 0x05, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x05, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x72,
+	0x65, 0x76, 0x48, 0x61, 0x73, 0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x70, 0x72,
+	0x65, 0x76, 0x48, 0x61, 0x73, 0x68, 0x22, 0x25, 0x0a, 0x11, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69,
+	0x64, 0x65, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x73, 0x55, 0x52, 0x4c, 0x12, 0x10, 0x0a, 0x03, 0x75,
+	0x72, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x75, 0x72, 0x6c, 0x22, 0x43, 0x0a,
+	0x17, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63,
+	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x55, 0x52, 0x4c, 0x12, 0x16, 0x0a, 0x06, 0x68, 0x65, 0x69, 0x67,
 	0x68, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74,
-	0x22, 0x59, 0x0a, 0x13, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x45, 0x6d, 0x70, 0x74,
-	0x79, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x68, 0x65, 0x69, 0x67, 0x68,
-	0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x12,
-	0x14, 0x0a, 0x05, 0x6e, 0x6f, 0x6e, 0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05,
-	0x6e, 0x6f, 0x6e, 0x63, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x03,
-	0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x32, 0xda, 0x06, 0x0a, 0x10,
+	0x12, 0x10, 0x0a, 0x03, 0x75, 0x72, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x75,
+	0x72, 0x6c, 0x22, 0x28, 0x0a, 0x0e, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x48, 0x65,
+	0x69, 0x67, 0x68, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x22, 0x59, 0x0a, 0x13,
+	0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x42, 0x6c, 0x6f,
+	0x63, 0x6b, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x05, 0x52, 0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x6e,
+	0x6f, 0x6e, 0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x6e, 0x6f, 0x6e, 0x63,
+	0x65, 0x12, 0x14, 0x0a, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05,
+	0x52, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x22, 0x47, 0x0a, 0x13, 0x44, 0x61, 0x72, 0x6b, 0x73,
+	0x69, 0x64, 0x65, 0x50, 0x72, 0x6f, 0x6f, 0x66, 0x4f, 0x66, 0x57, 0x6f, 0x72, 0x6b, 0x12, 0x14,
+	0x0a, 0x05, 0x6e, 0x42, 0x69, 0x74, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x6e,
+	0x42, 0x69, 0x74, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x73, 0x6f, 0x6c, 0x75, 0x74, 0x69, 0x6f, 0x6e,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x73, 0x6f, 0x6c, 0x75, 0x74, 0x69, 0x6f, 0x6e,
+	0x22, 0x47, 0x0a, 0x11, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x43, 0x68, 0x61, 0x69,
+	0x6e, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x12, 0x1e, 0x0a, 0x0a, 0x6d, 0x65, 0x64,
+	0x69, 0x61, 0x6e, 0x54, 0x69, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0a, 0x6d,
+	0x65, 0x64, 0x69, 0x61, 0x6e, 0x54, 0x69, 0x6d, 0x65, 0x22, 0x46, 0x0a, 0x10, 0x44, 0x61, 0x72,
+	0x6b, 0x73, 0x69, 0x64, 0x65, 0x42, 0x72, 0x61, 0x6e, 0x63, 0x68, 0x49, 0x44, 0x12, 0x16, 0x0a,
+	0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x68,
+	0x65, 0x69, 0x67, 0x68, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x62, 0x72, 0x61, 0x6e, 0x63, 0x68, 0x49,
+	0x44, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x62, 0x72, 0x61, 0x6e, 0x63, 0x68, 0x49,
+	0x44, 0x22, 0x5a, 0x0a, 0x11, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x42, 0x72, 0x61,
+	0x6e, 0x63, 0x68, 0x49, 0x44, 0x73, 0x12, 0x45, 0x0a, 0x09, 0x62, 0x72, 0x61, 0x6e, 0x63, 0x68,
+	0x49, 0x44, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x27, 0x2e, 0x63, 0x61, 0x73, 0x68,
+	0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70,
+	0x63, 0x2e, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x42, 0x72, 0x61, 0x6e, 0x63, 0x68,
+	0x49, 0x44, 0x52, 0x09, 0x62, 0x72, 0x61, 0x6e, 0x63, 0x68, 0x49, 0x44, 0x73, 0x22, 0x43, 0x0a,
+	0x13, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x42, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64,
+	0x44, 0x6f, 0x77, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x6f, 0x77, 0x6e, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x08, 0x52, 0x04, 0x64, 0x6f, 0x77, 0x6e, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x74, 0x68,
+	0x6f, 0x64, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x74, 0x68, 0x6f,
+	0x64, 0x73, 0x22, 0x2e, 0x0a, 0x16, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x49, 0x6e,
+	0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x43, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x12, 0x14, 0x0a, 0x05,
+	0x73, 0x69, 0x6e, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x73, 0x69, 0x6e,
+	0x63, 0x65, 0x22, 0x81, 0x01, 0x0a, 0x1c, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x49,
+	0x6e, 0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69,
+	0x6f, 0x6e, 0x73, 0x12, 0x49, 0x0a, 0x0c, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69,
+	0x6f, 0x6e, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x25, 0x2e, 0x63, 0x61, 0x73, 0x68,
+	0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70,
+	0x63, 0x2e, 0x52, 0x61, 0x77, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e,
+	0x52, 0x0c, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x16,
+	0x0a, 0x06, 0x63, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06,
+	0x63, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x22, 0x3e, 0x0a, 0x18, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69,
+	0x64, 0x65, 0x49, 0x6e, 0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x41,
+	0x72, 0x67, 0x12, 0x22, 0x0a, 0x0c, 0x69, 0x6e, 0x63, 0x6c, 0x75, 0x64, 0x65, 0x54, 0x78, 0x69,
+	0x64, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0c, 0x69, 0x6e, 0x63, 0x6c, 0x75, 0x64,
+	0x65, 0x54, 0x78, 0x69, 0x64, 0x73, 0x22, 0x43, 0x0a, 0x15, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69,
+	0x64, 0x65, 0x49, 0x6e, 0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12,
+	0x14, 0x0a, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05,
+	0x63, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x74, 0x78, 0x69, 0x64, 0x73, 0x18, 0x02,
+	0x20, 0x03, 0x28, 0x0c, 0x52, 0x05, 0x74, 0x78, 0x69, 0x64, 0x73, 0x22, 0x5d, 0x0a, 0x15, 0x44,
+	0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x53, 0x65, 0x6c, 0x65,
+	0x63, 0x74, 0x6f, 0x72, 0x12, 0x16, 0x0a, 0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x12, 0x16, 0x0a, 0x06,
+	0x73, 0x74, 0x61, 0x67, 0x65, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x73, 0x74,
+	0x61, 0x67, 0x65, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x05, 0x52, 0x05, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x22, 0x3f, 0x0a, 0x11, 0x44, 0x61,
+	0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x48, 0x61, 0x73, 0x68, 0x12,
+	0x16, 0x0a, 0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52,
+	0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x61, 0x73, 0x68, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x68, 0x61, 0x73, 0x68, 0x32, 0x95, 0x0f, 0x0a, 0x10,
 	0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x65, 0x72,
 	0x12, 0x51, 0x0a, 0x05, 0x52, 0x65, 0x73, 0x65, 0x74, 0x12, 0x28, 0x2e, 0x63, 0x61, 0x73, 0x68,
 	0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70,
@@ -407,39 +1157,107 @@ var file_darkside_proto_rawDesc = []byte{
 	0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x45,
 	0x6d, 0x70, 0x74, 0x79, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x73, 0x1a, 0x1c, 0x2e, 0x63, 0x61, 0x73,
 	0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72,
-	0x70, 0x63, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x62, 0x0a, 0x17, 0x53, 0x74,
-	0x61, 0x67, 0x65, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x53,
-	0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x25, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77,
-	0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x61,
-	0x77, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x1a, 0x1c, 0x2e, 0x63,
-	0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b,
-	0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x28, 0x01, 0x12, 0x63,
-	0x0a, 0x11, 0x53, 0x74, 0x61, 0x67, 0x65, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69,
-	0x6f, 0x6e, 0x73, 0x12, 0x2e, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c,
-	0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x61, 0x72, 0x6b,
-	0x73, 0x69, 0x64, 0x65, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73,
-	0x55, 0x52, 0x4c, 0x1a, 0x1c, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c,
-	0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x6d, 0x70, 0x74,
-	0x79, 0x22, 0x00, 0x12, 0x54, 0x0a, 0x0b, 0x41, 0x70, 0x70, 0x6c, 0x79, 0x53, 0x74, 0x61, 0x67,
-	0x65, 0x64, 0x12, 0x25, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c,
-	0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x61, 0x72, 0x6b, 0x73,
-	0x69, 0x64, 0x65, 0x48, 0x65, 0x69, 0x67, 0x68, 0x74, 0x1a, 0x1c, 0x2e, 0x63, 0x61, 0x73, 0x68,
-	0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70,
-	0x63, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x62, 0x0a, 0x17, 0x47, 0x65, 0x74,
-	0x49, 0x6e, 0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74,
-	0x69, 0x6f, 0x6e, 0x73, 0x12, 0x1c, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61,
+	0x70, 0x63, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x66, 0x0a, 0x16, 0x53, 0x74,
+	0x61, 0x67, 0x65, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x57, 0x69, 0x74, 0x68, 0x50, 0x72, 0x65, 0x76,
+	0x68, 0x61, 0x73, 0x68, 0x12, 0x2c, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61,
+	0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x61, 0x72,
+	0x6b, 0x73, 0x69, 0x64, 0x65, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x50, 0x72, 0x65, 0x76, 0x68, 0x61,
+	0x73, 0x68, 0x1a, 0x1c, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c,
+	0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79,
+	0x22, 0x00, 0x12, 0x5c, 0x0a, 0x0e, 0x53, 0x65, 0x74, 0x50, 0x72, 0x6f, 0x6f, 0x66, 0x4f, 0x66,
+	0x57, 0x6f, 0x72, 0x6b, 0x12, 0x2a, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61,
+	0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x61, 0x72,
+	0x6b, 0x73, 0x69, 0x64, 0x65, 0x50, 0x72, 0x6f, 0x6f, 0x66, 0x4f, 0x66, 0x57, 0x6f, 0x72, 0x6b,
+	0x1a, 0x1c, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74,
+	0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00,
+	0x12, 0x58, 0x0a, 0x0c, 0x53, 0x65, 0x74, 0x43, 0x68, 0x61, 0x69, 0x6e, 0x54, 0x69, 0x6d, 0x65,
+	0x12, 0x28, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74,
+	0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64,
+	0x65, 0x43, 0x68, 0x61, 0x69, 0x6e, 0x54, 0x69, 0x6d, 0x65, 0x1a, 0x1c, 0x2e, 0x63, 0x61, 0x73,
+	0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72,
+	0x70, 0x63, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x58, 0x0a, 0x0c, 0x53, 0x65,
+	0x74, 0x42, 0x72, 0x61, 0x6e, 0x63, 0x68, 0x49, 0x44, 0x73, 0x12, 0x28, 0x2e, 0x63, 0x61, 0x73,
+	0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72,
+	0x70, 0x63, 0x2e, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x42, 0x72, 0x61, 0x6e, 0x63,
+	0x68, 0x49, 0x44, 0x73, 0x1a, 0x1c, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61,
 	0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x6d, 0x70,
-	0x74, 0x79, 0x1a, 0x25, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c,
-	0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x61, 0x77, 0x54, 0x72,
-	0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x00, 0x30, 0x01, 0x12, 0x59, 0x0a,
-	0x19, 0x43, 0x6c, 0x65, 0x61, 0x72, 0x49, 0x6e, 0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x54, 0x72,
-	0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x1c, 0x2e, 0x63, 0x61, 0x73,
+	0x74, 0x79, 0x22, 0x00, 0x12, 0x50, 0x0a, 0x0c, 0x41, 0x64, 0x64, 0x54, 0x72, 0x65, 0x65, 0x53,
+	0x74, 0x61, 0x74, 0x65, 0x12, 0x20, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61,
+	0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x54, 0x72, 0x65,
+	0x65, 0x53, 0x74, 0x61, 0x74, 0x65, 0x1a, 0x1c, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e,
+	0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45,
+	0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x52, 0x0a, 0x12, 0x43, 0x6c, 0x65, 0x61, 0x72, 0x41,
+	0x6c, 0x6c, 0x54, 0x72, 0x65, 0x65, 0x53, 0x74, 0x61, 0x74, 0x65, 0x73, 0x12, 0x1c, 0x2e, 0x63,
+	0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b,
+	0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x1c, 0x2e, 0x63, 0x61, 0x73,
 	0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72,
-	0x70, 0x63, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x1c, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e,
+	0x70, 0x63, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x5c, 0x0a, 0x0e, 0x53, 0x65,
+	0x74, 0x42, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x44, 0x6f, 0x77, 0x6e, 0x12, 0x2a, 0x2e, 0x63,
+	0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b,
+	0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x42, 0x61, 0x63,
+	0x6b, 0x65, 0x6e, 0x64, 0x44, 0x6f, 0x77, 0x6e, 0x1a, 0x1c, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e,
 	0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63,
-	0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x42, 0x1b, 0x5a, 0x16, 0x6c, 0x69, 0x67, 0x68,
-	0x74, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x64, 0x2f, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x72,
-	0x70, 0x63, 0xba, 0x02, 0x00, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x62, 0x0a, 0x17, 0x53, 0x74, 0x61, 0x67,
+	0x65, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x53, 0x74, 0x72,
+	0x65, 0x61, 0x6d, 0x12, 0x25, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c,
+	0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x61, 0x77, 0x54,
+	0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x1a, 0x1c, 0x2e, 0x63, 0x61, 0x73,
+	0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72,
+	0x70, 0x63, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x28, 0x01, 0x12, 0x63, 0x0a, 0x11,
+	0x53, 0x74, 0x61, 0x67, 0x65, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e,
+	0x73, 0x12, 0x2e, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65,
+	0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69,
+	0x64, 0x65, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x55, 0x52,
+	0x4c, 0x1a, 0x1c, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65,
+	0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22,
+	0x00, 0x12, 0x54, 0x0a, 0x0b, 0x41, 0x70, 0x70, 0x6c, 0x79, 0x53, 0x74, 0x61, 0x67, 0x65, 0x64,
+	0x12, 0x25, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74,
+	0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64,
+	0x65, 0x48, 0x65, 0x69, 0x67, 0x68, 0x74, 0x1a, 0x1c, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a,
+	0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e,
+	0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x62, 0x0a, 0x17, 0x47, 0x65, 0x74, 0x49, 0x6e,
+	0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f,
+	0x6e, 0x73, 0x12, 0x1c, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c,
+	0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79,
+	0x1a, 0x25, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74,
+	0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x61, 0x77, 0x54, 0x72, 0x61, 0x6e,
+	0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x00, 0x30, 0x01, 0x12, 0x84, 0x01, 0x0a, 0x1c,
+	0x47, 0x65, 0x74, 0x49, 0x6e, 0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x54, 0x72, 0x61, 0x6e, 0x73,
+	0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x53, 0x69, 0x6e, 0x63, 0x65, 0x12, 0x2d, 0x2e, 0x63,
+	0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b,
+	0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x49, 0x6e, 0x63,
+	0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x43, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x1a, 0x33, 0x2e, 0x63, 0x61,
+	0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e,
+	0x72, 0x70, 0x63, 0x2e, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x49, 0x6e, 0x63, 0x6f,
+	0x6d, 0x69, 0x6e, 0x67, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73,
+	0x22, 0x00, 0x12, 0x7e, 0x0a, 0x1b, 0x47, 0x65, 0x74, 0x49, 0x6e, 0x63, 0x6f, 0x6d, 0x69, 0x6e,
+	0x67, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x75, 0x6e,
+	0x74, 0x12, 0x2f, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65,
+	0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69,
+	0x64, 0x65, 0x49, 0x6e, 0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x41,
+	0x72, 0x67, 0x1a, 0x2c, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c,
+	0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x61, 0x72, 0x6b, 0x73,
+	0x69, 0x64, 0x65, 0x49, 0x6e, 0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x43, 0x6f, 0x75, 0x6e, 0x74,
+	0x22, 0x00, 0x12, 0x59, 0x0a, 0x19, 0x43, 0x6c, 0x65, 0x61, 0x72, 0x49, 0x6e, 0x63, 0x6f, 0x6d,
+	0x69, 0x6e, 0x67, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12,
+	0x1c, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e,
+	0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x1c, 0x2e,
+	0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64,
+	0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x4a, 0x0a,
+	0x0a, 0x45, 0x6e, 0x64, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x1c, 0x2e, 0x63, 0x61,
+	0x73, 0x68, 0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e,
+	0x72, 0x70, 0x63, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x1c, 0x2e, 0x63, 0x61, 0x73, 0x68,
+	0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70,
+	0x63, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x68, 0x0a, 0x0c, 0x47, 0x65, 0x74,
+	0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x48, 0x61, 0x73, 0x68, 0x12, 0x2c, 0x2e, 0x63, 0x61, 0x73, 0x68,
+	0x2e, 0x7a, 0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70,
+	0x63, 0x2e, 0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x53,
+	0x65, 0x6c, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x1a, 0x28, 0x2e, 0x63, 0x61, 0x73, 0x68, 0x2e, 0x7a,
+	0x2e, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x2e, 0x73, 0x64, 0x6b, 0x2e, 0x72, 0x70, 0x63, 0x2e,
+	0x44, 0x61, 0x72, 0x6b, 0x73, 0x69, 0x64, 0x65, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x48, 0x61, 0x73,
+	0x68, 0x22, 0x00, 0x42, 0x1b, 0x5a, 0x16, 0x6c, 0x69, 0x67, 0x68, 0x74, 0x77, 0x61, 0x6c, 0x6c,
+	0x65, 0x74, 0x64, 0x2f, 0x77, 0x61, 0x6c, 0x6c, 0x65, 0x74, 0x72, 0x70, 0x63, 0xba, 0x02, 0x00,
+	0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -454,41 +1272,78 @@ func file_darkside_proto_rawDescGZIP() []byte {
 	return file_darkside_proto_rawDescData
 }
 
-var file_darkside_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_darkside_proto_msgTypes = make([]protoimpl.MessageInfo, 18)
 var file_darkside_proto_goTypes = []interface{}{
-	(*DarksideMetaState)(nil),       // 0: cash.z.wallet.sdk.rpc.DarksideMetaState
-	(*DarksideBlock)(nil),           // 1: cash.z.wallet.sdk.rpc.DarksideBlock
-	(*DarksideBlocksURL)(nil),       // 2: cash.z.wallet.sdk.rpc.DarksideBlocksURL
-	(*DarksideTransactionsURL)(nil), // 3: cash.z.wallet.sdk.rpc.DarksideTransactionsURL
-	(*DarksideHeight)(nil),          // 4: cash.z.wallet.sdk.rpc.DarksideHeight
-	(*DarksideEmptyBlocks)(nil),     // 5: cash.z.wallet.sdk.rpc.DarksideEmptyBlocks
-	(*RawTransaction)(nil),          // 6: cash.z.wallet.sdk.rpc.RawTransaction
-	(*Empty)(nil),                   // 7: cash.z.wallet.sdk.rpc.Empty
+	(*DarksideMetaState)(nil),            // 0: cash.z.wallet.sdk.rpc.DarksideMetaState
+	(*DarksideBlock)(nil),                // 1: cash.z.wallet.sdk.rpc.DarksideBlock
+	(*DarksideBlockPrevhash)(nil),        // 2: cash.z.wallet.sdk.rpc.DarksideBlockPrevhash
+	(*DarksideBlocksURL)(nil),            // 3: cash.z.wallet.sdk.rpc.DarksideBlocksURL
+	(*DarksideTransactionsURL)(nil),      // 4: cash.z.wallet.sdk.rpc.DarksideTransactionsURL
+	(*DarksideHeight)(nil),               // 5: cash.z.wallet.sdk.rpc.DarksideHeight
+	(*DarksideEmptyBlocks)(nil),          // 6: cash.z.wallet.sdk.rpc.DarksideEmptyBlocks
+	(*DarksideProofOfWork)(nil),          // 7: cash.z.wallet.sdk.rpc.DarksideProofOfWork
+	(*DarksideChainTime)(nil),            // 8: cash.z.wallet.sdk.rpc.DarksideChainTime
+	(*DarksideBranchID)(nil),             // 9: cash.z.wallet.sdk.rpc.DarksideBranchID
+	(*DarksideBranchIDs)(nil),            // 10: cash.z.wallet.sdk.rpc.DarksideBranchIDs
+	(*DarksideBackendDown)(nil),          // 11: cash.z.wallet.sdk.rpc.DarksideBackendDown
+	(*DarksideIncomingCursor)(nil),       // 12: cash.z.wallet.sdk.rpc.DarksideIncomingCursor
+	(*DarksideIncomingTransactions)(nil), // 13: cash.z.wallet.sdk.rpc.DarksideIncomingTransactions
+	(*DarksideIncomingCountArg)(nil),     // 14: cash.z.wallet.sdk.rpc.DarksideIncomingCountArg
+	(*DarksideIncomingCount)(nil),        // 15: cash.z.wallet.sdk.rpc.DarksideIncomingCount
+	(*DarksideBlockSelector)(nil),        // 16: cash.z.wallet.sdk.rpc.DarksideBlockSelector
+	(*DarksideBlockHash)(nil),            // 17: cash.z.wallet.sdk.rpc.DarksideBlockHash
+	(*RawTransaction)(nil),               // 18: cash.z.wallet.sdk.rpc.RawTransaction
+	(*TreeState)(nil),                    // 19: cash.z.wallet.sdk.rpc.TreeState
+	(*Empty)(nil),                        // 20: cash.z.wallet.sdk.rpc.Empty
 }
 var file_darkside_proto_depIdxs = []int32{
-	0, // 0: cash.z.wallet.sdk.rpc.DarksideStreamer.Reset:input_type -> cash.z.wallet.sdk.rpc.DarksideMetaState
-	1, // 1: cash.z.wallet.sdk.rpc.DarksideStreamer.StageBlocksStream:input_type -> cash.z.wallet.sdk.rpc.DarksideBlock
-	2, // 2: cash.z.wallet.sdk.rpc.DarksideStreamer.StageBlocks:input_type -> cash.z.wallet.sdk.rpc.DarksideBlocksURL
-	5, // 3: cash.z.wallet.sdk.rpc.DarksideStreamer.StageBlocksCreate:input_type -> cash.z.wallet.sdk.rpc.DarksideEmptyBlocks
-	6, // 4: cash.z.wallet.sdk.rpc.DarksideStreamer.StageTransactionsStream:input_type -> cash.z.wallet.sdk.rpc.RawTransaction
-	3, // 5: cash.z.wallet.sdk.rpc.DarksideStreamer.StageTransactions:input_type -> cash.z.wallet.sdk.rpc.DarksideTransactionsURL
-	4, // 6: cash.z.wallet.sdk.rpc.DarksideStreamer.ApplyStaged:input_type -> cash.z.wallet.sdk.rpc.DarksideHeight
-	7, // 7: cash.z.wallet.sdk.rpc.DarksideStreamer.GetIncomingTransactions:input_type -> cash.z.wallet.sdk.rpc.Empty
-	7, // 8: cash.z.wallet.sdk.rpc.DarksideStreamer.ClearIncomingTransactions:input_type -> cash.z.wallet.sdk.rpc.Empty
-	7, // 9: cash.z.wallet.sdk.rpc.DarksideStreamer.Reset:output_type -> cash.z.wallet.sdk.rpc.Empty
-	7, // 10: cash.z.wallet.sdk.rpc.DarksideStreamer.StageBlocksStream:output_type -> cash.z.wallet.sdk.rpc.Empty
-	7, // 11: cash.z.wallet.sdk.rpc.DarksideStreamer.StageBlocks:output_type -> cash.z.wallet.sdk.rpc.Empty
-	7, // 12: cash.z.wallet.sdk.rpc.DarksideStreamer.StageBlocksCreate:output_type -> cash.z.wallet.sdk.rpc.Empty
-	7, // 13: cash.z.wallet.sdk.rpc.DarksideStreamer.StageTransactionsStream:output_type -> cash.z.wallet.sdk.rpc.Empty
-	7, // 14: cash.z.wallet.sdk.rpc.DarksideStreamer.StageTransactions:output_type -> cash.z.wallet.sdk.rpc.Empty
-	7, // 15: cash.z.wallet.sdk.rpc.DarksideStreamer.ApplyStaged:output_type -> cash.z.wallet.sdk.rpc.Empty
-	6, // 16: cash.z.wallet.sdk.rpc.DarksideStreamer.GetIncomingTransactions:output_type -> cash.z.wallet.sdk.rpc.RawTransaction
-	7, // 17: cash.z.wallet.sdk.rpc.DarksideStreamer.ClearIncomingTransactions:output_type -> cash.z.wallet.sdk.rpc.Empty
-	9, // [9:18] is the sub-list for method output_type
-	0, // [0:9] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	9,  // 0: cash.z.wallet.sdk.rpc.DarksideBranchIDs.branchIDs:type_name -> cash.z.wallet.sdk.rpc.DarksideBranchID
+	18, // 1: cash.z.wallet.sdk.rpc.DarksideIncomingTransactions.transactions:type_name -> cash.z.wallet.sdk.rpc.RawTransaction
+	0,  // 2: cash.z.wallet.sdk.rpc.DarksideStreamer.Reset:input_type -> cash.z.wallet.sdk.rpc.DarksideMetaState
+	1,  // 3: cash.z.wallet.sdk.rpc.DarksideStreamer.StageBlocksStream:input_type -> cash.z.wallet.sdk.rpc.DarksideBlock
+	3,  // 4: cash.z.wallet.sdk.rpc.DarksideStreamer.StageBlocks:input_type -> cash.z.wallet.sdk.rpc.DarksideBlocksURL
+	6,  // 5: cash.z.wallet.sdk.rpc.DarksideStreamer.StageBlocksCreate:input_type -> cash.z.wallet.sdk.rpc.DarksideEmptyBlocks
+	2,  // 6: cash.z.wallet.sdk.rpc.DarksideStreamer.StageBlockWithPrevhash:input_type -> cash.z.wallet.sdk.rpc.DarksideBlockPrevhash
+	7,  // 7: cash.z.wallet.sdk.rpc.DarksideStreamer.SetProofOfWork:input_type -> cash.z.wallet.sdk.rpc.DarksideProofOfWork
+	8,  // 8: cash.z.wallet.sdk.rpc.DarksideStreamer.SetChainTime:input_type -> cash.z.wallet.sdk.rpc.DarksideChainTime
+	10, // 9: cash.z.wallet.sdk.rpc.DarksideStreamer.SetBranchIDs:input_type -> cash.z.wallet.sdk.rpc.DarksideBranchIDs
+	19, // 10: cash.z.wallet.sdk.rpc.DarksideStreamer.AddTreeState:input_type -> cash.z.wallet.sdk.rpc.TreeState
+	20, // 11: cash.z.wallet.sdk.rpc.DarksideStreamer.ClearAllTreeStates:input_type -> cash.z.wallet.sdk.rpc.Empty
+	11, // 12: cash.z.wallet.sdk.rpc.DarksideStreamer.SetBackendDown:input_type -> cash.z.wallet.sdk.rpc.DarksideBackendDown
+	18, // 13: cash.z.wallet.sdk.rpc.DarksideStreamer.StageTransactionsStream:input_type -> cash.z.wallet.sdk.rpc.RawTransaction
+	4,  // 14: cash.z.wallet.sdk.rpc.DarksideStreamer.StageTransactions:input_type -> cash.z.wallet.sdk.rpc.DarksideTransactionsURL
+	5,  // 15: cash.z.wallet.sdk.rpc.DarksideStreamer.ApplyStaged:input_type -> cash.z.wallet.sdk.rpc.DarksideHeight
+	20, // 16: cash.z.wallet.sdk.rpc.DarksideStreamer.GetIncomingTransactions:input_type -> cash.z.wallet.sdk.rpc.Empty
+	12, // 17: cash.z.wallet.sdk.rpc.DarksideStreamer.GetIncomingTransactionsSince:input_type -> cash.z.wallet.sdk.rpc.DarksideIncomingCursor
+	14, // 18: cash.z.wallet.sdk.rpc.DarksideStreamer.GetIncomingTransactionCount:input_type -> cash.z.wallet.sdk.rpc.DarksideIncomingCountArg
+	20, // 19: cash.z.wallet.sdk.rpc.DarksideStreamer.ClearIncomingTransactions:input_type -> cash.z.wallet.sdk.rpc.Empty
+	20, // 20: cash.z.wallet.sdk.rpc.DarksideStreamer.EndSession:input_type -> cash.z.wallet.sdk.rpc.Empty
+	16, // 21: cash.z.wallet.sdk.rpc.DarksideStreamer.GetBlockHash:input_type -> cash.z.wallet.sdk.rpc.DarksideBlockSelector
+	20, // 22: cash.z.wallet.sdk.rpc.DarksideStreamer.Reset:output_type -> cash.z.wallet.sdk.rpc.Empty
+	20, // 23: cash.z.wallet.sdk.rpc.DarksideStreamer.StageBlocksStream:output_type -> cash.z.wallet.sdk.rpc.Empty
+	20, // 24: cash.z.wallet.sdk.rpc.DarksideStreamer.StageBlocks:output_type -> cash.z.wallet.sdk.rpc.Empty
+	20, // 25: cash.z.wallet.sdk.rpc.DarksideStreamer.StageBlocksCreate:output_type -> cash.z.wallet.sdk.rpc.Empty
+	20, // 26: cash.z.wallet.sdk.rpc.DarksideStreamer.StageBlockWithPrevhash:output_type -> cash.z.wallet.sdk.rpc.Empty
+	20, // 27: cash.z.wallet.sdk.rpc.DarksideStreamer.SetProofOfWork:output_type -> cash.z.wallet.sdk.rpc.Empty
+	20, // 28: cash.z.wallet.sdk.rpc.DarksideStreamer.SetChainTime:output_type -> cash.z.wallet.sdk.rpc.Empty
+	20, // 29: cash.z.wallet.sdk.rpc.DarksideStreamer.SetBranchIDs:output_type -> cash.z.wallet.sdk.rpc.Empty
+	20, // 30: cash.z.wallet.sdk.rpc.DarksideStreamer.AddTreeState:output_type -> cash.z.wallet.sdk.rpc.Empty
+	20, // 31: cash.z.wallet.sdk.rpc.DarksideStreamer.ClearAllTreeStates:output_type -> cash.z.wallet.sdk.rpc.Empty
+	20, // 32: cash.z.wallet.sdk.rpc.DarksideStreamer.SetBackendDown:output_type -> cash.z.wallet.sdk.rpc.Empty
+	20, // 33: cash.z.wallet.sdk.rpc.DarksideStreamer.StageTransactionsStream:output_type -> cash.z.wallet.sdk.rpc.Empty
+	20, // 34: cash.z.wallet.sdk.rpc.DarksideStreamer.StageTransactions:output_type -> cash.z.wallet.sdk.rpc.Empty
+	20, // 35: cash.z.wallet.sdk.rpc.DarksideStreamer.ApplyStaged:output_type -> cash.z.wallet.sdk.rpc.Empty
+	18, // 36: cash.z.wallet.sdk.rpc.DarksideStreamer.GetIncomingTransactions:output_type -> cash.z.wallet.sdk.rpc.RawTransaction
+	13, // 37: cash.z.wallet.sdk.rpc.DarksideStreamer.GetIncomingTransactionsSince:output_type -> cash.z.wallet.sdk.rpc.DarksideIncomingTransactions
+	15, // 38: cash.z.wallet.sdk.rpc.DarksideStreamer.GetIncomingTransactionCount:output_type -> cash.z.wallet.sdk.rpc.DarksideIncomingCount
+	20, // 39: cash.z.wallet.sdk.rpc.DarksideStreamer.ClearIncomingTransactions:output_type -> cash.z.wallet.sdk.rpc.Empty
+	20, // 40: cash.z.wallet.sdk.rpc.DarksideStreamer.EndSession:output_type -> cash.z.wallet.sdk.rpc.Empty
+	17, // 41: cash.z.wallet.sdk.rpc.DarksideStreamer.GetBlockHash:output_type -> cash.z.wallet.sdk.rpc.DarksideBlockHash
+	22, // [22:42] is the sub-list for method output_type
+	2,  // [2:22] is the sub-list for method input_type
+	2,  // [2:2] is the sub-list for extension type_name
+	2,  // [2:2] is the sub-list for extension extendee
+	0,  // [0:2] is the sub-list for field type_name
 }
 
 func init() { file_darkside_proto_init() }
@@ -523,7 +1378,7 @@ func file_darkside_proto_init() {
 			}
 		}
 		file_darkside_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*DarksideBlocksURL); i {
+			switch v := v.(*DarksideBlockPrevhash); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -535,7 +1390,7 @@ func file_darkside_proto_init() {
 			}
 		}
 		file_darkside_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*DarksideTransactionsURL); i {
+			switch v := v.(*DarksideBlocksURL); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -547,7 +1402,7 @@ func file_darkside_proto_init() {
 			}
 		}
 		file_darkside_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*DarksideHeight); i {
+			switch v := v.(*DarksideTransactionsURL); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -559,6 +1414,18 @@ func file_darkside_proto_init() {
 			}
 		}
 		file_darkside_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DarksideHeight); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_darkside_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*DarksideEmptyBlocks); i {
 			case 0:
 				return &v.state
@@ -570,6 +1437,138 @@ func file_darkside_proto_init() {
 				return nil
 			}
 		}
+		file_darkside_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DarksideProofOfWork); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_darkside_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DarksideChainTime); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_darkside_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DarksideBranchID); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_darkside_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DarksideBranchIDs); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_darkside_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DarksideBackendDown); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_darkside_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DarksideIncomingCursor); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_darkside_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DarksideIncomingTransactions); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_darkside_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DarksideIncomingCountArg); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_darkside_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DarksideIncomingCount); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_darkside_proto_msgTypes[16].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DarksideBlockSelector); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_darkside_proto_msgTypes[17].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DarksideBlockHash); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -577,7 +1576,7 @@ func file_darkside_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_darkside_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   6,
+			NumMessages:   18,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
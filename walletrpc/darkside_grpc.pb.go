@@ -39,6 +39,40 @@ type DarksideStreamerClient interface {
 	// lets you create identical blocks (same transactions and height), but with
 	// different hashes.
 	StageBlocksCreate(ctx context.Context, in *DarksideEmptyBlocks, opts ...grpc.CallOption) (*Empty, error)
+	// StageBlockWithPrevhash stages a single block like StageBlocksStream(),
+	// except that ApplyStaged() doesn't link it to the block before it; it
+	// keeps the given prevhash, so the chain is broken there. This is for
+	// testing that wallets reject such a chain. lightwalletd's ingestor
+	// refuses the broken link (it never caches the block or those above
+	// it), so GetBlock serves them from the mock zcashd.
+	StageBlockWithPrevhash(ctx context.Context, in *DarksideBlockPrevhash, opts ...grpc.CallOption) (*Empty, error)
+	// SetProofOfWork sets the nBits and Equihash solution carried by the
+	// headers of blocks that StageBlocksCreate() creates from now until the
+	// next Reset(). The values needn't be valid; this is for testing wallets
+	// that verify proof-of-work against known values.
+	SetProofOfWork(ctx context.Context, in *DarksideProofOfWork, opts ...grpc.CallOption) (*Empty, error)
+	// SetChainTime sets the time of blocks that StageBlocksCreate() creates
+	// and the mediantime reported by getblockchaininfo, until the next
+	// Reset() (which restores time 1 and mediantime 0).
+	SetChainTime(ctx context.Context, in *DarksideChainTime, opts ...grpc.CallOption) (*Empty, error)
+	// SetBranchIDs replaces the consensus branch IDs by height range, so that
+	// clients can be tested across network upgrades: getblockchaininfo reports
+	// those of the tip and next block, and getrawtransaction (verbose) that of
+	// the transaction's block (the next block's, if it isn't mined). Heights
+	// below the first range, or all heights if none are given, have the
+	// branch ID given to Reset(), which clears the ranges.
+	SetBranchIDs(ctx context.Context, in *DarksideBranchIDs, opts ...grpc.CallOption) (*Empty, error)
+	// AddTreeState adds (or replaces) the tree state that the mock zcashd's
+	// z_gettreestate returns for the given height or hash; the mock zcashd
+	// can't compute tree states, so tests supply them. Reset() removes them.
+	AddTreeState(ctx context.Context, in *TreeState, opts ...grpc.CallOption) (*Empty, error)
+	// ClearAllTreeStates removes the tree states added by AddTreeState.
+	ClearAllTreeStates(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error)
+	// SetBackendDown makes the mock zcashd unreachable (as if it weren't
+	// running) for the given rpc methods, or all, until it's called again
+	// with down false, or Reset(). lightwalletd's handlers then fail with
+	// UNAVAILABLE rather than an error from zcashd.
+	SetBackendDown(ctx context.Context, in *DarksideBackendDown, opts ...grpc.CallOption) (*Empty, error)
 	// StageTransactionsStream stores the given transaction-height pairs in the
 	// staging area until ApplyStaged() is called. Note that these transactions
 	// are not returned by the production GetTransaction() gRPC until they
@@ -74,8 +108,19 @@ type DarksideStreamerClient interface {
 	// then, for example, be given to StageTransactions() to get them "mined"
 	// into a specified block on the next ApplyStaged().
 	GetIncomingTransactions(ctx context.Context, in *Empty, opts ...grpc.CallOption) (DarksideStreamer_GetIncomingTransactionsClient, error)
+	// Like GetIncomingTransactions(), but returns only the transactions
+	// received since the given cursor, along with the cursor to use next time.
+	GetIncomingTransactionsSince(ctx context.Context, in *DarksideIncomingCursor, opts ...grpc.CallOption) (*DarksideIncomingTransactions, error)
+	// Return the number of incoming transactions (and optionally their
+	// txids) without streaming them.
+	GetIncomingTransactionCount(ctx context.Context, in *DarksideIncomingCountArg, opts ...grpc.CallOption) (*DarksideIncomingCount, error)
 	// Clear the incoming transaction pool.
 	ClearIncomingTransactions(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error)
+	// Discard the caller's (named) session, freeing its slot.
+	EndSession(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error)
+	// Return the hash of an active or staged block, as lightwalletd's parser
+	// computes it, so tests can check the hashes a reorg should produce.
+	GetBlockHash(ctx context.Context, in *DarksideBlockSelector, opts ...grpc.CallOption) (*DarksideBlockHash, error)
 }
 
 type darksideStreamerClient struct {
@@ -147,6 +192,69 @@ func (c *darksideStreamerClient) StageBlocksCreate(ctx context.Context, in *Dark
 	return out, nil
 }
 
+func (c *darksideStreamerClient) StageBlockWithPrevhash(ctx context.Context, in *DarksideBlockPrevhash, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.DarksideStreamer/StageBlockWithPrevhash", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *darksideStreamerClient) SetProofOfWork(ctx context.Context, in *DarksideProofOfWork, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.DarksideStreamer/SetProofOfWork", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *darksideStreamerClient) SetChainTime(ctx context.Context, in *DarksideChainTime, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.DarksideStreamer/SetChainTime", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *darksideStreamerClient) SetBranchIDs(ctx context.Context, in *DarksideBranchIDs, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.DarksideStreamer/SetBranchIDs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *darksideStreamerClient) AddTreeState(ctx context.Context, in *TreeState, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.DarksideStreamer/AddTreeState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *darksideStreamerClient) ClearAllTreeStates(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.DarksideStreamer/ClearAllTreeStates", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *darksideStreamerClient) SetBackendDown(ctx context.Context, in *DarksideBackendDown, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.DarksideStreamer/SetBackendDown", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *darksideStreamerClient) StageTransactionsStream(ctx context.Context, opts ...grpc.CallOption) (DarksideStreamer_StageTransactionsStreamClient, error) {
 	stream, err := c.cc.NewStream(ctx, &DarksideStreamer_ServiceDesc.Streams[1], "/cash.z.wallet.sdk.rpc.DarksideStreamer/StageTransactionsStream", opts...)
 	if err != nil {
@@ -231,6 +339,24 @@ func (x *darksideStreamerGetIncomingTransactionsClient) Recv() (*RawTransaction,
 	return m, nil
 }
 
+func (c *darksideStreamerClient) GetIncomingTransactionsSince(ctx context.Context, in *DarksideIncomingCursor, opts ...grpc.CallOption) (*DarksideIncomingTransactions, error) {
+	out := new(DarksideIncomingTransactions)
+	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.DarksideStreamer/GetIncomingTransactionsSince", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *darksideStreamerClient) GetIncomingTransactionCount(ctx context.Context, in *DarksideIncomingCountArg, opts ...grpc.CallOption) (*DarksideIncomingCount, error) {
+	out := new(DarksideIncomingCount)
+	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.DarksideStreamer/GetIncomingTransactionCount", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *darksideStreamerClient) ClearIncomingTransactions(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error) {
 	out := new(Empty)
 	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.DarksideStreamer/ClearIncomingTransactions", in, out, opts...)
@@ -240,6 +366,24 @@ func (c *darksideStreamerClient) ClearIncomingTransactions(ctx context.Context,
 	return out, nil
 }
 
+func (c *darksideStreamerClient) EndSession(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.DarksideStreamer/EndSession", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *darksideStreamerClient) GetBlockHash(ctx context.Context, in *DarksideBlockSelector, opts ...grpc.CallOption) (*DarksideBlockHash, error) {
+	out := new(DarksideBlockHash)
+	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.DarksideStreamer/GetBlockHash", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // DarksideStreamerServer is the server API for DarksideStreamer service.
 // All implementations must embed UnimplementedDarksideStreamerServer
 // for forward compatibility
@@ -265,6 +409,40 @@ type DarksideStreamerServer interface {
 	// lets you create identical blocks (same transactions and height), but with
 	// different hashes.
 	StageBlocksCreate(context.Context, *DarksideEmptyBlocks) (*Empty, error)
+	// StageBlockWithPrevhash stages a single block like StageBlocksStream(),
+	// except that ApplyStaged() doesn't link it to the block before it; it
+	// keeps the given prevhash, so the chain is broken there. This is for
+	// testing that wallets reject such a chain. lightwalletd's ingestor
+	// refuses the broken link (it never caches the block or those above
+	// it), so GetBlock serves them from the mock zcashd.
+	StageBlockWithPrevhash(context.Context, *DarksideBlockPrevhash) (*Empty, error)
+	// SetProofOfWork sets the nBits and Equihash solution carried by the
+	// headers of blocks that StageBlocksCreate() creates from now until the
+	// next Reset(). The values needn't be valid; this is for testing wallets
+	// that verify proof-of-work against known values.
+	SetProofOfWork(context.Context, *DarksideProofOfWork) (*Empty, error)
+	// SetChainTime sets the time of blocks that StageBlocksCreate() creates
+	// and the mediantime reported by getblockchaininfo, until the next
+	// Reset() (which restores time 1 and mediantime 0).
+	SetChainTime(context.Context, *DarksideChainTime) (*Empty, error)
+	// SetBranchIDs replaces the consensus branch IDs by height range, so that
+	// clients can be tested across network upgrades: getblockchaininfo reports
+	// those of the tip and next block, and getrawtransaction (verbose) that of
+	// the transaction's block (the next block's, if it isn't mined). Heights
+	// below the first range, or all heights if none are given, have the
+	// branch ID given to Reset(), which clears the ranges.
+	SetBranchIDs(context.Context, *DarksideBranchIDs) (*Empty, error)
+	// AddTreeState adds (or replaces) the tree state that the mock zcashd's
+	// z_gettreestate returns for the given height or hash; the mock zcashd
+	// can't compute tree states, so tests supply them. Reset() removes them.
+	AddTreeState(context.Context, *TreeState) (*Empty, error)
+	// ClearAllTreeStates removes the tree states added by AddTreeState.
+	ClearAllTreeStates(context.Context, *Empty) (*Empty, error)
+	// SetBackendDown makes the mock zcashd unreachable (as if it weren't
+	// running) for the given rpc methods, or all, until it's called again
+	// with down false, or Reset(). lightwalletd's handlers then fail with
+	// UNAVAILABLE rather than an error from zcashd.
+	SetBackendDown(context.Context, *DarksideBackendDown) (*Empty, error)
 	// StageTransactionsStream stores the given transaction-height pairs in the
 	// staging area until ApplyStaged() is called. Note that these transactions
 	// are not returned by the production GetTransaction() gRPC until they
@@ -300,8 +478,19 @@ type DarksideStreamerServer interface {
 	// then, for example, be given to StageTransactions() to get them "mined"
 	// into a specified block on the next ApplyStaged().
 	GetIncomingTransactions(*Empty, DarksideStreamer_GetIncomingTransactionsServer) error
+	// Like GetIncomingTransactions(), but returns only the transactions
+	// received since the given cursor, along with the cursor to use next time.
+	GetIncomingTransactionsSince(context.Context, *DarksideIncomingCursor) (*DarksideIncomingTransactions, error)
+	// Return the number of incoming transactions (and optionally their
+	// txids) without streaming them.
+	GetIncomingTransactionCount(context.Context, *DarksideIncomingCountArg) (*DarksideIncomingCount, error)
 	// Clear the incoming transaction pool.
 	ClearIncomingTransactions(context.Context, *Empty) (*Empty, error)
+	// Discard the caller's (named) session, freeing its slot.
+	EndSession(context.Context, *Empty) (*Empty, error)
+	// Return the hash of an active or staged block, as lightwalletd's parser
+	// computes it, so tests can check the hashes a reorg should produce.
+	GetBlockHash(context.Context, *DarksideBlockSelector) (*DarksideBlockHash, error)
 	mustEmbedUnimplementedDarksideStreamerServer()
 }
 
@@ -321,6 +510,27 @@ func (UnimplementedDarksideStreamerServer) StageBlocks(context.Context, *Darksid
 func (UnimplementedDarksideStreamerServer) StageBlocksCreate(context.Context, *DarksideEmptyBlocks) (*Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method StageBlocksCreate not implemented")
 }
+func (UnimplementedDarksideStreamerServer) StageBlockWithPrevhash(context.Context, *DarksideBlockPrevhash) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StageBlockWithPrevhash not implemented")
+}
+func (UnimplementedDarksideStreamerServer) SetProofOfWork(context.Context, *DarksideProofOfWork) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetProofOfWork not implemented")
+}
+func (UnimplementedDarksideStreamerServer) SetChainTime(context.Context, *DarksideChainTime) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetChainTime not implemented")
+}
+func (UnimplementedDarksideStreamerServer) SetBranchIDs(context.Context, *DarksideBranchIDs) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetBranchIDs not implemented")
+}
+func (UnimplementedDarksideStreamerServer) AddTreeState(context.Context, *TreeState) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddTreeState not implemented")
+}
+func (UnimplementedDarksideStreamerServer) ClearAllTreeStates(context.Context, *Empty) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ClearAllTreeStates not implemented")
+}
+func (UnimplementedDarksideStreamerServer) SetBackendDown(context.Context, *DarksideBackendDown) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetBackendDown not implemented")
+}
 func (UnimplementedDarksideStreamerServer) StageTransactionsStream(DarksideStreamer_StageTransactionsStreamServer) error {
 	return status.Errorf(codes.Unimplemented, "method StageTransactionsStream not implemented")
 }
@@ -333,9 +543,21 @@ func (UnimplementedDarksideStreamerServer) ApplyStaged(context.Context, *Darksid
 func (UnimplementedDarksideStreamerServer) GetIncomingTransactions(*Empty, DarksideStreamer_GetIncomingTransactionsServer) error {
 	return status.Errorf(codes.Unimplemented, "method GetIncomingTransactions not implemented")
 }
+func (UnimplementedDarksideStreamerServer) GetIncomingTransactionsSince(context.Context, *DarksideIncomingCursor) (*DarksideIncomingTransactions, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetIncomingTransactionsSince not implemented")
+}
+func (UnimplementedDarksideStreamerServer) GetIncomingTransactionCount(context.Context, *DarksideIncomingCountArg) (*DarksideIncomingCount, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetIncomingTransactionCount not implemented")
+}
 func (UnimplementedDarksideStreamerServer) ClearIncomingTransactions(context.Context, *Empty) (*Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ClearIncomingTransactions not implemented")
 }
+func (UnimplementedDarksideStreamerServer) EndSession(context.Context, *Empty) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EndSession not implemented")
+}
+func (UnimplementedDarksideStreamerServer) GetBlockHash(context.Context, *DarksideBlockSelector) (*DarksideBlockHash, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBlockHash not implemented")
+}
 func (UnimplementedDarksideStreamerServer) mustEmbedUnimplementedDarksideStreamerServer() {}
 
 // UnsafeDarksideStreamerServer may be embedded to opt out of forward compatibility for this service.
@@ -429,6 +651,132 @@ func _DarksideStreamer_StageBlocksCreate_Handler(srv interface{}, ctx context.Co
 	return interceptor(ctx, in, info, handler)
 }
 
+func _DarksideStreamer_StageBlockWithPrevhash_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DarksideBlockPrevhash)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DarksideStreamerServer).StageBlockWithPrevhash(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.z.wallet.sdk.rpc.DarksideStreamer/StageBlockWithPrevhash",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DarksideStreamerServer).StageBlockWithPrevhash(ctx, req.(*DarksideBlockPrevhash))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DarksideStreamer_SetProofOfWork_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DarksideProofOfWork)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DarksideStreamerServer).SetProofOfWork(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.z.wallet.sdk.rpc.DarksideStreamer/SetProofOfWork",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DarksideStreamerServer).SetProofOfWork(ctx, req.(*DarksideProofOfWork))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DarksideStreamer_SetChainTime_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DarksideChainTime)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DarksideStreamerServer).SetChainTime(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.z.wallet.sdk.rpc.DarksideStreamer/SetChainTime",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DarksideStreamerServer).SetChainTime(ctx, req.(*DarksideChainTime))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DarksideStreamer_SetBranchIDs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DarksideBranchIDs)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DarksideStreamerServer).SetBranchIDs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.z.wallet.sdk.rpc.DarksideStreamer/SetBranchIDs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DarksideStreamerServer).SetBranchIDs(ctx, req.(*DarksideBranchIDs))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DarksideStreamer_AddTreeState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TreeState)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DarksideStreamerServer).AddTreeState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.z.wallet.sdk.rpc.DarksideStreamer/AddTreeState",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DarksideStreamerServer).AddTreeState(ctx, req.(*TreeState))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DarksideStreamer_ClearAllTreeStates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DarksideStreamerServer).ClearAllTreeStates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.z.wallet.sdk.rpc.DarksideStreamer/ClearAllTreeStates",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DarksideStreamerServer).ClearAllTreeStates(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DarksideStreamer_SetBackendDown_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DarksideBackendDown)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DarksideStreamerServer).SetBackendDown(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.z.wallet.sdk.rpc.DarksideStreamer/SetBackendDown",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DarksideStreamerServer).SetBackendDown(ctx, req.(*DarksideBackendDown))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _DarksideStreamer_StageTransactionsStream_Handler(srv interface{}, stream grpc.ServerStream) error {
 	return srv.(DarksideStreamerServer).StageTransactionsStream(&darksideStreamerStageTransactionsStreamServer{stream})
 }
@@ -512,6 +860,42 @@ func (x *darksideStreamerGetIncomingTransactionsServer) Send(m *RawTransaction)
 	return x.ServerStream.SendMsg(m)
 }
 
+func _DarksideStreamer_GetIncomingTransactionsSince_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DarksideIncomingCursor)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DarksideStreamerServer).GetIncomingTransactionsSince(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.z.wallet.sdk.rpc.DarksideStreamer/GetIncomingTransactionsSince",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DarksideStreamerServer).GetIncomingTransactionsSince(ctx, req.(*DarksideIncomingCursor))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DarksideStreamer_GetIncomingTransactionCount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DarksideIncomingCountArg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DarksideStreamerServer).GetIncomingTransactionCount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.z.wallet.sdk.rpc.DarksideStreamer/GetIncomingTransactionCount",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DarksideStreamerServer).GetIncomingTransactionCount(ctx, req.(*DarksideIncomingCountArg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _DarksideStreamer_ClearIncomingTransactions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(Empty)
 	if err := dec(in); err != nil {
@@ -530,6 +914,42 @@ func _DarksideStreamer_ClearIncomingTransactions_Handler(srv interface{}, ctx co
 	return interceptor(ctx, in, info, handler)
 }
 
+func _DarksideStreamer_EndSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DarksideStreamerServer).EndSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.z.wallet.sdk.rpc.DarksideStreamer/EndSession",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DarksideStreamerServer).EndSession(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DarksideStreamer_GetBlockHash_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DarksideBlockSelector)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DarksideStreamerServer).GetBlockHash(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.z.wallet.sdk.rpc.DarksideStreamer/GetBlockHash",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DarksideStreamerServer).GetBlockHash(ctx, req.(*DarksideBlockSelector))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // DarksideStreamer_ServiceDesc is the grpc.ServiceDesc for DarksideStreamer service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -549,6 +969,34 @@ var DarksideStreamer_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "StageBlocksCreate",
 			Handler:    _DarksideStreamer_StageBlocksCreate_Handler,
 		},
+		{
+			MethodName: "StageBlockWithPrevhash",
+			Handler:    _DarksideStreamer_StageBlockWithPrevhash_Handler,
+		},
+		{
+			MethodName: "SetProofOfWork",
+			Handler:    _DarksideStreamer_SetProofOfWork_Handler,
+		},
+		{
+			MethodName: "SetChainTime",
+			Handler:    _DarksideStreamer_SetChainTime_Handler,
+		},
+		{
+			MethodName: "SetBranchIDs",
+			Handler:    _DarksideStreamer_SetBranchIDs_Handler,
+		},
+		{
+			MethodName: "AddTreeState",
+			Handler:    _DarksideStreamer_AddTreeState_Handler,
+		},
+		{
+			MethodName: "ClearAllTreeStates",
+			Handler:    _DarksideStreamer_ClearAllTreeStates_Handler,
+		},
+		{
+			MethodName: "SetBackendDown",
+			Handler:    _DarksideStreamer_SetBackendDown_Handler,
+		},
 		{
 			MethodName: "StageTransactions",
 			Handler:    _DarksideStreamer_StageTransactions_Handler,
@@ -557,10 +1005,26 @@ var DarksideStreamer_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ApplyStaged",
 			Handler:    _DarksideStreamer_ApplyStaged_Handler,
 		},
+		{
+			MethodName: "GetIncomingTransactionsSince",
+			Handler:    _DarksideStreamer_GetIncomingTransactionsSince_Handler,
+		},
+		{
+			MethodName: "GetIncomingTransactionCount",
+			Handler:    _DarksideStreamer_GetIncomingTransactionCount_Handler,
+		},
 		{
 			MethodName: "ClearIncomingTransactions",
 			Handler:    _DarksideStreamer_ClearIncomingTransactions_Handler,
 		},
+		{
+			MethodName: "EndSession",
+			Handler:    _DarksideStreamer_EndSession_Handler,
+		},
+		{
+			MethodName: "GetBlockHash",
+			Handler:    _DarksideStreamer_GetBlockHash_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
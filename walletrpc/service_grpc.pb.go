@@ -20,20 +20,63 @@ const _ = grpc.SupportPackageIsVersion7
 type CompactTxStreamerClient interface {
 	// Return the height of the tip of the best chain
 	GetLatestBlock(ctx context.Context, in *ChainSpec, opts ...grpc.CallOption) (*BlockID, error)
-	// Return the compact block corresponding to the given block identifier
+	// Wait until the tip advances beyond the given height, then return it
+	GetLatestBlockLongPoll(ctx context.Context, in *LatestBlockWait, opts ...grpc.CallOption) (*BlockID, error)
+	// Send the cached tip, then the new tip each time it changes (a block
+	// is added, or blocks are rolled back in a reorg), until the client
+	// cancels; a slow client is sent only the latest tip, not each block
+	SubscribeNewBlocks(ctx context.Context, in *Empty, opts ...grpc.CallOption) (CompactTxStreamer_SubscribeNewBlocksClient, error)
+	// Return the IDs of the most recent blocks, ending with the tip, so a
+	// wallet can find its common ancestor with the best chain after a reorg
+	GetLatestBlocks(ctx context.Context, in *LatestBlocksRequest, opts ...grpc.CallOption) (*BlockIDList, error)
+	// Return the compact block corresponding to the given block identifier;
+	// a hash that zcashd doesn't know gives NotFound
 	GetBlock(ctx context.Context, in *BlockID, opts ...grpc.CallOption) (*CompactBlock, error)
-	// Return a list of consecutive compact blocks
+	// Return the compact block at the given height and the anchors (the
+	// same as GetTreeState would return) as of that block
+	GetBlockWithAnchors(ctx context.Context, in *BlockID, opts ...grpc.CallOption) (*BlockWithAnchors, error)
+	// Return the coinbase transaction's outputs, and the height it encodes,
+	// of the block at the given height
+	GetBlockCoinbase(ctx context.Context, in *BlockID, opts ...grpc.CallOption) (*CoinbaseInfo, error)
+	// Return a list of consecutive compact blocks; heights below Sapling
+	// activation are rejected with InvalidArgument
 	GetBlockRange(ctx context.Context, in *BlockRange, opts ...grpc.CallOption) (CompactTxStreamer_GetBlockRangeClient, error)
+	// Like GetBlockRange, but sends only each block's nullifiers, for
+	// wallets that need only to detect spends; the range's fields that
+	// change the compact format or how blocks are sent are ignored
+	GetBlockNullifiers(ctx context.Context, in *BlockRange, opts ...grpc.CallOption) (CompactTxStreamer_GetBlockNullifiersClient, error)
+	// Export a range of compact blocks (start no higher than end, spanning
+	// at most the server's maximum), for backup or re-import (see
+	// BlockExport); the range's fields that change the compact format or
+	// how blocks are sent are ignored
+	ExportBlocks(ctx context.Context, in *BlockRange, opts ...grpc.CallOption) (CompactTxStreamer_ExportBlocksClient, error)
+	// Like GetBlockRange, but from the higher height down to the lower,
+	// whichever order start and end are given in
+	GetBlockRangeReverse(ctx context.Context, in *BlockRange, opts ...grpc.CallOption) (CompactTxStreamer_GetBlockRangeReverseClient, error)
+	// GetBlockRange with flow control: the server sends no more than the
+	// window's worth of blocks beyond those the client has acknowledged
+	// (see BlockRangeAck)
+	GetBlockRangeAcked(ctx context.Context, opts ...grpc.CallOption) (CompactTxStreamer_GetBlockRangeAckedClient, error)
+	// Return a list of consecutive full blocks, as zcashd serializes them
+	GetFullBlockRange(ctx context.Context, in *FullBlockRange, opts ...grpc.CallOption) (CompactTxStreamer_GetFullBlockRangeClient, error)
 	// Get the historical and current prices
 	GetZECPrice(ctx context.Context, in *PriceRequest, opts ...grpc.CallOption) (*PriceResponse, error)
 	GetCurrentZECPrice(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*PriceResponse, error)
-	// Return the requested full (not compact) transaction (as from zcashd)
+	// Return the requested full (not compact) transaction (as from zcashd);
+	// the server may be configured (--orphaned-tx-mode) to report one that
+	// zcashd says is mined in a block since reorged out as not mined
 	GetTransaction(ctx context.Context, in *TxFilter, opts ...grpc.CallOption) (*RawTransaction, error)
+	// Return a summary of the requested transaction (which pools it uses)
+	GetTransactionSummary(ctx context.Context, in *TxFilter, opts ...grpc.CallOption) (*TransactionSummary, error)
 	// Submit the given transaction to the Zcash network
 	SendTransaction(ctx context.Context, in *RawTransaction, opts ...grpc.CallOption) (*SendResponse, error)
 	// Return the txids corresponding to the given t-address within the given block range
 	GetTaddressTxids(ctx context.Context, in *TransparentAddressBlockFilter, opts ...grpc.CallOption) (CompactTxStreamer_GetTaddressTxidsClient, error)
+	// Same, for a stream of t-addresses (the range is taken from the first); each
+	// transaction is returned once, in block height order
+	GetTaddressesTxids(ctx context.Context, opts ...grpc.CallOption) (CompactTxStreamer_GetTaddressesTxidsClient, error)
 	GetTaddressBalance(ctx context.Context, in *AddressList, opts ...grpc.CallOption) (*Balance, error)
+	// Same, without a minimum number of confirmations
 	GetTaddressBalanceStream(ctx context.Context, opts ...grpc.CallOption) (CompactTxStreamer_GetTaddressBalanceStreamClient, error)
 	// Return the compact transactions currently in the mempool; the results
 	// can be a few seconds out of date. If the Exclude list is empty, return
@@ -43,18 +86,45 @@ type CompactTxStreamerClient interface {
 	// Exclude list can be shortened to any number of bytes to make the request
 	// more bandwidth-efficient; if two or more transactions in the mempool
 	// match a shortened txid, they are all sent (none is excluded). Transactions
-	// in the exclude list that don't exist in the mempool are ignored.
+	// in the exclude list that don't exist in the mempool are ignored. If the
+	// Exclude strict flag is set, shortened txids are rejected and each entry
+	// excludes only the transaction with exactly that txid.
 	GetMempoolTx(ctx context.Context, in *Exclude, opts ...grpc.CallOption) (CompactTxStreamer_GetMempoolTxClient, error)
+	// Return the mempool transactions that pay the given transparent address,
+	// or spend from it (as far as can be told from their inputs alone, which
+	// is so for P2PKH and P2SH), including their transparent outputs.
+	GetMempoolTxForAddress(ctx context.Context, in *Address, opts ...grpc.CallOption) (CompactTxStreamer_GetMempoolTxForAddressClient, error)
+	// Send each mempool transaction (as GetMempoolTx would) and then each
+	// new one as it appears, until the client cancels. A transaction is sent
+	// once while it stays in the mempool; if it leaves and returns, it's
+	// sent again.
+	SubscribeMempool(ctx context.Context, in *Empty, opts ...grpc.CallOption) (CompactTxStreamer_SubscribeMempoolClient, error)
+	// Return a stream of current Mempool transactions. This will keep the output stream open while
+	// there are mempool transactions. It will close the returned stream when a new block is mined.
 	GetMempoolStream(ctx context.Context, in *Empty, opts ...grpc.CallOption) (CompactTxStreamer_GetMempoolStreamClient, error)
 	// GetTreeState returns the note commitment tree state corresponding to the given block.
 	// See section 3.7 of the Zcash protocol specification. It returns several other useful
 	// values also (even though they can be obtained using GetBlock).
-	// The block can be specified by either height or hash.
+	// The block can be specified by either height or hash; blocks below Sapling
+	// activation are rejected with InvalidArgument. Unlike other BlockIDs, a hash
+	// here is in display (big-endian) order, as zcashd reports it. If zcashd
+	// reports no tree state back to before Sapling activation, the error is
+	// OutOfRange; if it otherwise fails to produce one, Internal.
 	GetTreeState(ctx context.Context, in *BlockID, opts ...grpc.CallOption) (*TreeState, error)
+	// Check that the Sapling tree state at the given height follows from the
+	// one at the height before and the block's note commitments (its size
+	// and last leaves; the hashes aren't recomputed), failing with DATA_LOSS
+	// if not. For detecting backend or cache corruption.
+	CheckBlockTreeState(ctx context.Context, in *BlockID, opts ...grpc.CallOption) (*Empty, error)
 	GetAddressUtxos(ctx context.Context, in *GetAddressUtxosArg, opts ...grpc.CallOption) (*GetAddressUtxosReplyList, error)
 	GetAddressUtxosStream(ctx context.Context, in *GetAddressUtxosArg, opts ...grpc.CallOption) (CompactTxStreamer_GetAddressUtxosStreamClient, error)
 	// Return information about this lightwalletd instance and the blockchain
 	GetLightdInfo(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*LightdInfo, error)
+	// For load balancer health checks: succeed if zcashd has answered recently
+	// (the server asks it at most every so often, however often this is called),
+	// it isn't in initial block download, and the block cache is keeping up with
+	// it; otherwise fail with UNAVAILABLE, saying why.
+	GetServerHealth(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ServerHealth, error)
 	// Testing-only, requires lightwalletd --ping-very-insecure (do not enable in production)
 	Ping(ctx context.Context, in *Duration, opts ...grpc.CallOption) (*PingResponse, error)
 }
@@ -76,6 +146,56 @@ func (c *compactTxStreamerClient) GetLatestBlock(ctx context.Context, in *ChainS
 	return out, nil
 }
 
+func (c *compactTxStreamerClient) GetLatestBlockLongPoll(ctx context.Context, in *LatestBlockWait, opts ...grpc.CallOption) (*BlockID, error) {
+	out := new(BlockID)
+	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetLatestBlockLongPoll", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *compactTxStreamerClient) SubscribeNewBlocks(ctx context.Context, in *Empty, opts ...grpc.CallOption) (CompactTxStreamer_SubscribeNewBlocksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[0], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/SubscribeNewBlocks", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &compactTxStreamerSubscribeNewBlocksClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CompactTxStreamer_SubscribeNewBlocksClient interface {
+	Recv() (*BlockID, error)
+	grpc.ClientStream
+}
+
+type compactTxStreamerSubscribeNewBlocksClient struct {
+	grpc.ClientStream
+}
+
+func (x *compactTxStreamerSubscribeNewBlocksClient) Recv() (*BlockID, error) {
+	m := new(BlockID)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *compactTxStreamerClient) GetLatestBlocks(ctx context.Context, in *LatestBlocksRequest, opts ...grpc.CallOption) (*BlockIDList, error) {
+	out := new(BlockIDList)
+	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetLatestBlocks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *compactTxStreamerClient) GetBlock(ctx context.Context, in *BlockID, opts ...grpc.CallOption) (*CompactBlock, error) {
 	out := new(CompactBlock)
 	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetBlock", in, out, opts...)
@@ -85,8 +205,26 @@ func (c *compactTxStreamerClient) GetBlock(ctx context.Context, in *BlockID, opt
 	return out, nil
 }
 
+func (c *compactTxStreamerClient) GetBlockWithAnchors(ctx context.Context, in *BlockID, opts ...grpc.CallOption) (*BlockWithAnchors, error) {
+	out := new(BlockWithAnchors)
+	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetBlockWithAnchors", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *compactTxStreamerClient) GetBlockCoinbase(ctx context.Context, in *BlockID, opts ...grpc.CallOption) (*CoinbaseInfo, error) {
+	out := new(CoinbaseInfo)
+	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetBlockCoinbase", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *compactTxStreamerClient) GetBlockRange(ctx context.Context, in *BlockRange, opts ...grpc.CallOption) (CompactTxStreamer_GetBlockRangeClient, error) {
-	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[0], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetBlockRange", opts...)
+	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[1], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetBlockRange", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -117,6 +255,165 @@ func (x *compactTxStreamerGetBlockRangeClient) Recv() (*CompactBlock, error) {
 	return m, nil
 }
 
+func (c *compactTxStreamerClient) GetBlockNullifiers(ctx context.Context, in *BlockRange, opts ...grpc.CallOption) (CompactTxStreamer_GetBlockNullifiersClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[2], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetBlockNullifiers", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &compactTxStreamerGetBlockNullifiersClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CompactTxStreamer_GetBlockNullifiersClient interface {
+	Recv() (*BlockNullifiers, error)
+	grpc.ClientStream
+}
+
+type compactTxStreamerGetBlockNullifiersClient struct {
+	grpc.ClientStream
+}
+
+func (x *compactTxStreamerGetBlockNullifiersClient) Recv() (*BlockNullifiers, error) {
+	m := new(BlockNullifiers)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *compactTxStreamerClient) ExportBlocks(ctx context.Context, in *BlockRange, opts ...grpc.CallOption) (CompactTxStreamer_ExportBlocksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[3], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/ExportBlocks", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &compactTxStreamerExportBlocksClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CompactTxStreamer_ExportBlocksClient interface {
+	Recv() (*BlockExport, error)
+	grpc.ClientStream
+}
+
+type compactTxStreamerExportBlocksClient struct {
+	grpc.ClientStream
+}
+
+func (x *compactTxStreamerExportBlocksClient) Recv() (*BlockExport, error) {
+	m := new(BlockExport)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *compactTxStreamerClient) GetBlockRangeReverse(ctx context.Context, in *BlockRange, opts ...grpc.CallOption) (CompactTxStreamer_GetBlockRangeReverseClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[4], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetBlockRangeReverse", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &compactTxStreamerGetBlockRangeReverseClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CompactTxStreamer_GetBlockRangeReverseClient interface {
+	Recv() (*CompactBlock, error)
+	grpc.ClientStream
+}
+
+type compactTxStreamerGetBlockRangeReverseClient struct {
+	grpc.ClientStream
+}
+
+func (x *compactTxStreamerGetBlockRangeReverseClient) Recv() (*CompactBlock, error) {
+	m := new(CompactBlock)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *compactTxStreamerClient) GetBlockRangeAcked(ctx context.Context, opts ...grpc.CallOption) (CompactTxStreamer_GetBlockRangeAckedClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[5], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetBlockRangeAcked", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &compactTxStreamerGetBlockRangeAckedClient{stream}
+	return x, nil
+}
+
+type CompactTxStreamer_GetBlockRangeAckedClient interface {
+	Send(*BlockRangeAck) error
+	Recv() (*CompactBlock, error)
+	grpc.ClientStream
+}
+
+type compactTxStreamerGetBlockRangeAckedClient struct {
+	grpc.ClientStream
+}
+
+func (x *compactTxStreamerGetBlockRangeAckedClient) Send(m *BlockRangeAck) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *compactTxStreamerGetBlockRangeAckedClient) Recv() (*CompactBlock, error) {
+	m := new(CompactBlock)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *compactTxStreamerClient) GetFullBlockRange(ctx context.Context, in *FullBlockRange, opts ...grpc.CallOption) (CompactTxStreamer_GetFullBlockRangeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[6], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetFullBlockRange", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &compactTxStreamerGetFullBlockRangeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CompactTxStreamer_GetFullBlockRangeClient interface {
+	Recv() (*FullBlock, error)
+	grpc.ClientStream
+}
+
+type compactTxStreamerGetFullBlockRangeClient struct {
+	grpc.ClientStream
+}
+
+func (x *compactTxStreamerGetFullBlockRangeClient) Recv() (*FullBlock, error) {
+	m := new(FullBlock)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *compactTxStreamerClient) GetZECPrice(ctx context.Context, in *PriceRequest, opts ...grpc.CallOption) (*PriceResponse, error) {
 	out := new(PriceResponse)
 	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetZECPrice", in, out, opts...)
@@ -144,6 +441,15 @@ func (c *compactTxStreamerClient) GetTransaction(ctx context.Context, in *TxFilt
 	return out, nil
 }
 
+func (c *compactTxStreamerClient) GetTransactionSummary(ctx context.Context, in *TxFilter, opts ...grpc.CallOption) (*TransactionSummary, error) {
+	out := new(TransactionSummary)
+	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetTransactionSummary", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *compactTxStreamerClient) SendTransaction(ctx context.Context, in *RawTransaction, opts ...grpc.CallOption) (*SendResponse, error) {
 	out := new(SendResponse)
 	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.CompactTxStreamer/SendTransaction", in, out, opts...)
@@ -154,7 +460,7 @@ func (c *compactTxStreamerClient) SendTransaction(ctx context.Context, in *RawTr
 }
 
 func (c *compactTxStreamerClient) GetTaddressTxids(ctx context.Context, in *TransparentAddressBlockFilter, opts ...grpc.CallOption) (CompactTxStreamer_GetTaddressTxidsClient, error) {
-	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[1], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetTaddressTxids", opts...)
+	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[7], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetTaddressTxids", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -185,6 +491,37 @@ func (x *compactTxStreamerGetTaddressTxidsClient) Recv() (*RawTransaction, error
 	return m, nil
 }
 
+func (c *compactTxStreamerClient) GetTaddressesTxids(ctx context.Context, opts ...grpc.CallOption) (CompactTxStreamer_GetTaddressesTxidsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[8], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetTaddressesTxids", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &compactTxStreamerGetTaddressesTxidsClient{stream}
+	return x, nil
+}
+
+type CompactTxStreamer_GetTaddressesTxidsClient interface {
+	Send(*TransparentAddressBlockFilter) error
+	Recv() (*RawTransaction, error)
+	grpc.ClientStream
+}
+
+type compactTxStreamerGetTaddressesTxidsClient struct {
+	grpc.ClientStream
+}
+
+func (x *compactTxStreamerGetTaddressesTxidsClient) Send(m *TransparentAddressBlockFilter) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *compactTxStreamerGetTaddressesTxidsClient) Recv() (*RawTransaction, error) {
+	m := new(RawTransaction)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *compactTxStreamerClient) GetTaddressBalance(ctx context.Context, in *AddressList, opts ...grpc.CallOption) (*Balance, error) {
 	out := new(Balance)
 	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetTaddressBalance", in, out, opts...)
@@ -195,7 +532,7 @@ func (c *compactTxStreamerClient) GetTaddressBalance(ctx context.Context, in *Ad
 }
 
 func (c *compactTxStreamerClient) GetTaddressBalanceStream(ctx context.Context, opts ...grpc.CallOption) (CompactTxStreamer_GetTaddressBalanceStreamClient, error) {
-	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[2], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetTaddressBalanceStream", opts...)
+	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[9], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetTaddressBalanceStream", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -229,7 +566,7 @@ func (x *compactTxStreamerGetTaddressBalanceStreamClient) CloseAndRecv() (*Balan
 }
 
 func (c *compactTxStreamerClient) GetMempoolTx(ctx context.Context, in *Exclude, opts ...grpc.CallOption) (CompactTxStreamer_GetMempoolTxClient, error) {
-	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[3], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetMempoolTx", opts...)
+	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[10], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetMempoolTx", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -260,8 +597,72 @@ func (x *compactTxStreamerGetMempoolTxClient) Recv() (*CompactTx, error) {
 	return m, nil
 }
 
+func (c *compactTxStreamerClient) GetMempoolTxForAddress(ctx context.Context, in *Address, opts ...grpc.CallOption) (CompactTxStreamer_GetMempoolTxForAddressClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[11], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetMempoolTxForAddress", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &compactTxStreamerGetMempoolTxForAddressClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CompactTxStreamer_GetMempoolTxForAddressClient interface {
+	Recv() (*CompactTx, error)
+	grpc.ClientStream
+}
+
+type compactTxStreamerGetMempoolTxForAddressClient struct {
+	grpc.ClientStream
+}
+
+func (x *compactTxStreamerGetMempoolTxForAddressClient) Recv() (*CompactTx, error) {
+	m := new(CompactTx)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *compactTxStreamerClient) SubscribeMempool(ctx context.Context, in *Empty, opts ...grpc.CallOption) (CompactTxStreamer_SubscribeMempoolClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[12], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/SubscribeMempool", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &compactTxStreamerSubscribeMempoolClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CompactTxStreamer_SubscribeMempoolClient interface {
+	Recv() (*CompactTx, error)
+	grpc.ClientStream
+}
+
+type compactTxStreamerSubscribeMempoolClient struct {
+	grpc.ClientStream
+}
+
+func (x *compactTxStreamerSubscribeMempoolClient) Recv() (*CompactTx, error) {
+	m := new(CompactTx)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *compactTxStreamerClient) GetMempoolStream(ctx context.Context, in *Empty, opts ...grpc.CallOption) (CompactTxStreamer_GetMempoolStreamClient, error) {
-	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[4], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetMempoolStream", opts...)
+	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[13], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetMempoolStream", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -301,6 +702,15 @@ func (c *compactTxStreamerClient) GetTreeState(ctx context.Context, in *BlockID,
 	return out, nil
 }
 
+func (c *compactTxStreamerClient) CheckBlockTreeState(ctx context.Context, in *BlockID, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.CompactTxStreamer/CheckBlockTreeState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *compactTxStreamerClient) GetAddressUtxos(ctx context.Context, in *GetAddressUtxosArg, opts ...grpc.CallOption) (*GetAddressUtxosReplyList, error) {
 	out := new(GetAddressUtxosReplyList)
 	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetAddressUtxos", in, out, opts...)
@@ -311,7 +721,7 @@ func (c *compactTxStreamerClient) GetAddressUtxos(ctx context.Context, in *GetAd
 }
 
 func (c *compactTxStreamerClient) GetAddressUtxosStream(ctx context.Context, in *GetAddressUtxosArg, opts ...grpc.CallOption) (CompactTxStreamer_GetAddressUtxosStreamClient, error) {
-	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[5], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetAddressUtxosStream", opts...)
+	stream, err := c.cc.NewStream(ctx, &CompactTxStreamer_ServiceDesc.Streams[14], "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetAddressUtxosStream", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -351,6 +761,15 @@ func (c *compactTxStreamerClient) GetLightdInfo(ctx context.Context, in *Empty,
 	return out, nil
 }
 
+func (c *compactTxStreamerClient) GetServerHealth(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ServerHealth, error) {
+	out := new(ServerHealth)
+	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetServerHealth", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *compactTxStreamerClient) Ping(ctx context.Context, in *Duration, opts ...grpc.CallOption) (*PingResponse, error) {
 	out := new(PingResponse)
 	err := c.cc.Invoke(ctx, "/cash.z.wallet.sdk.rpc.CompactTxStreamer/Ping", in, out, opts...)
@@ -366,20 +785,63 @@ func (c *compactTxStreamerClient) Ping(ctx context.Context, in *Duration, opts .
 type CompactTxStreamerServer interface {
 	// Return the height of the tip of the best chain
 	GetLatestBlock(context.Context, *ChainSpec) (*BlockID, error)
-	// Return the compact block corresponding to the given block identifier
+	// Wait until the tip advances beyond the given height, then return it
+	GetLatestBlockLongPoll(context.Context, *LatestBlockWait) (*BlockID, error)
+	// Send the cached tip, then the new tip each time it changes (a block
+	// is added, or blocks are rolled back in a reorg), until the client
+	// cancels; a slow client is sent only the latest tip, not each block
+	SubscribeNewBlocks(*Empty, CompactTxStreamer_SubscribeNewBlocksServer) error
+	// Return the IDs of the most recent blocks, ending with the tip, so a
+	// wallet can find its common ancestor with the best chain after a reorg
+	GetLatestBlocks(context.Context, *LatestBlocksRequest) (*BlockIDList, error)
+	// Return the compact block corresponding to the given block identifier;
+	// a hash that zcashd doesn't know gives NotFound
 	GetBlock(context.Context, *BlockID) (*CompactBlock, error)
-	// Return a list of consecutive compact blocks
+	// Return the compact block at the given height and the anchors (the
+	// same as GetTreeState would return) as of that block
+	GetBlockWithAnchors(context.Context, *BlockID) (*BlockWithAnchors, error)
+	// Return the coinbase transaction's outputs, and the height it encodes,
+	// of the block at the given height
+	GetBlockCoinbase(context.Context, *BlockID) (*CoinbaseInfo, error)
+	// Return a list of consecutive compact blocks; heights below Sapling
+	// activation are rejected with InvalidArgument
 	GetBlockRange(*BlockRange, CompactTxStreamer_GetBlockRangeServer) error
+	// Like GetBlockRange, but sends only each block's nullifiers, for
+	// wallets that need only to detect spends; the range's fields that
+	// change the compact format or how blocks are sent are ignored
+	GetBlockNullifiers(*BlockRange, CompactTxStreamer_GetBlockNullifiersServer) error
+	// Export a range of compact blocks (start no higher than end, spanning
+	// at most the server's maximum), for backup or re-import (see
+	// BlockExport); the range's fields that change the compact format or
+	// how blocks are sent are ignored
+	ExportBlocks(*BlockRange, CompactTxStreamer_ExportBlocksServer) error
+	// Like GetBlockRange, but from the higher height down to the lower,
+	// whichever order start and end are given in
+	GetBlockRangeReverse(*BlockRange, CompactTxStreamer_GetBlockRangeReverseServer) error
+	// GetBlockRange with flow control: the server sends no more than the
+	// window's worth of blocks beyond those the client has acknowledged
+	// (see BlockRangeAck)
+	GetBlockRangeAcked(CompactTxStreamer_GetBlockRangeAckedServer) error
+	// Return a list of consecutive full blocks, as zcashd serializes them
+	GetFullBlockRange(*FullBlockRange, CompactTxStreamer_GetFullBlockRangeServer) error
 	// Get the historical and current prices
 	GetZECPrice(context.Context, *PriceRequest) (*PriceResponse, error)
 	GetCurrentZECPrice(context.Context, *Empty) (*PriceResponse, error)
-	// Return the requested full (not compact) transaction (as from zcashd)
+	// Return the requested full (not compact) transaction (as from zcashd);
+	// the server may be configured (--orphaned-tx-mode) to report one that
+	// zcashd says is mined in a block since reorged out as not mined
 	GetTransaction(context.Context, *TxFilter) (*RawTransaction, error)
+	// Return a summary of the requested transaction (which pools it uses)
+	GetTransactionSummary(context.Context, *TxFilter) (*TransactionSummary, error)
 	// Submit the given transaction to the Zcash network
 	SendTransaction(context.Context, *RawTransaction) (*SendResponse, error)
 	// Return the txids corresponding to the given t-address within the given block range
 	GetTaddressTxids(*TransparentAddressBlockFilter, CompactTxStreamer_GetTaddressTxidsServer) error
+	// Same, for a stream of t-addresses (the range is taken from the first); each
+	// transaction is returned once, in block height order
+	GetTaddressesTxids(CompactTxStreamer_GetTaddressesTxidsServer) error
 	GetTaddressBalance(context.Context, *AddressList) (*Balance, error)
+	// Same, without a minimum number of confirmations
 	GetTaddressBalanceStream(CompactTxStreamer_GetTaddressBalanceStreamServer) error
 	// Return the compact transactions currently in the mempool; the results
 	// can be a few seconds out of date. If the Exclude list is empty, return
@@ -389,18 +851,45 @@ type CompactTxStreamerServer interface {
 	// Exclude list can be shortened to any number of bytes to make the request
 	// more bandwidth-efficient; if two or more transactions in the mempool
 	// match a shortened txid, they are all sent (none is excluded). Transactions
-	// in the exclude list that don't exist in the mempool are ignored.
+	// in the exclude list that don't exist in the mempool are ignored. If the
+	// Exclude strict flag is set, shortened txids are rejected and each entry
+	// excludes only the transaction with exactly that txid.
 	GetMempoolTx(*Exclude, CompactTxStreamer_GetMempoolTxServer) error
+	// Return the mempool transactions that pay the given transparent address,
+	// or spend from it (as far as can be told from their inputs alone, which
+	// is so for P2PKH and P2SH), including their transparent outputs.
+	GetMempoolTxForAddress(*Address, CompactTxStreamer_GetMempoolTxForAddressServer) error
+	// Send each mempool transaction (as GetMempoolTx would) and then each
+	// new one as it appears, until the client cancels. A transaction is sent
+	// once while it stays in the mempool; if it leaves and returns, it's
+	// sent again.
+	SubscribeMempool(*Empty, CompactTxStreamer_SubscribeMempoolServer) error
+	// Return a stream of current Mempool transactions. This will keep the output stream open while
+	// there are mempool transactions. It will close the returned stream when a new block is mined.
 	GetMempoolStream(*Empty, CompactTxStreamer_GetMempoolStreamServer) error
 	// GetTreeState returns the note commitment tree state corresponding to the given block.
 	// See section 3.7 of the Zcash protocol specification. It returns several other useful
 	// values also (even though they can be obtained using GetBlock).
-	// The block can be specified by either height or hash.
+	// The block can be specified by either height or hash; blocks below Sapling
+	// activation are rejected with InvalidArgument. Unlike other BlockIDs, a hash
+	// here is in display (big-endian) order, as zcashd reports it. If zcashd
+	// reports no tree state back to before Sapling activation, the error is
+	// OutOfRange; if it otherwise fails to produce one, Internal.
 	GetTreeState(context.Context, *BlockID) (*TreeState, error)
+	// Check that the Sapling tree state at the given height follows from the
+	// one at the height before and the block's note commitments (its size
+	// and last leaves; the hashes aren't recomputed), failing with DATA_LOSS
+	// if not. For detecting backend or cache corruption.
+	CheckBlockTreeState(context.Context, *BlockID) (*Empty, error)
 	GetAddressUtxos(context.Context, *GetAddressUtxosArg) (*GetAddressUtxosReplyList, error)
 	GetAddressUtxosStream(*GetAddressUtxosArg, CompactTxStreamer_GetAddressUtxosStreamServer) error
 	// Return information about this lightwalletd instance and the blockchain
 	GetLightdInfo(context.Context, *Empty) (*LightdInfo, error)
+	// For load balancer health checks: succeed if zcashd has answered recently
+	// (the server asks it at most every so often, however often this is called),
+	// it isn't in initial block download, and the block cache is keeping up with
+	// it; otherwise fail with UNAVAILABLE, saying why.
+	GetServerHealth(context.Context, *Empty) (*ServerHealth, error)
 	// Testing-only, requires lightwalletd --ping-very-insecure (do not enable in production)
 	Ping(context.Context, *Duration) (*PingResponse, error)
 	mustEmbedUnimplementedCompactTxStreamerServer()
@@ -413,12 +902,42 @@ type UnimplementedCompactTxStreamerServer struct {
 func (UnimplementedCompactTxStreamerServer) GetLatestBlock(context.Context, *ChainSpec) (*BlockID, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetLatestBlock not implemented")
 }
+func (UnimplementedCompactTxStreamerServer) GetLatestBlockLongPoll(context.Context, *LatestBlockWait) (*BlockID, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLatestBlockLongPoll not implemented")
+}
+func (UnimplementedCompactTxStreamerServer) SubscribeNewBlocks(*Empty, CompactTxStreamer_SubscribeNewBlocksServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeNewBlocks not implemented")
+}
+func (UnimplementedCompactTxStreamerServer) GetLatestBlocks(context.Context, *LatestBlocksRequest) (*BlockIDList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLatestBlocks not implemented")
+}
 func (UnimplementedCompactTxStreamerServer) GetBlock(context.Context, *BlockID) (*CompactBlock, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetBlock not implemented")
 }
+func (UnimplementedCompactTxStreamerServer) GetBlockWithAnchors(context.Context, *BlockID) (*BlockWithAnchors, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBlockWithAnchors not implemented")
+}
+func (UnimplementedCompactTxStreamerServer) GetBlockCoinbase(context.Context, *BlockID) (*CoinbaseInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBlockCoinbase not implemented")
+}
 func (UnimplementedCompactTxStreamerServer) GetBlockRange(*BlockRange, CompactTxStreamer_GetBlockRangeServer) error {
 	return status.Errorf(codes.Unimplemented, "method GetBlockRange not implemented")
 }
+func (UnimplementedCompactTxStreamerServer) GetBlockNullifiers(*BlockRange, CompactTxStreamer_GetBlockNullifiersServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetBlockNullifiers not implemented")
+}
+func (UnimplementedCompactTxStreamerServer) ExportBlocks(*BlockRange, CompactTxStreamer_ExportBlocksServer) error {
+	return status.Errorf(codes.Unimplemented, "method ExportBlocks not implemented")
+}
+func (UnimplementedCompactTxStreamerServer) GetBlockRangeReverse(*BlockRange, CompactTxStreamer_GetBlockRangeReverseServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetBlockRangeReverse not implemented")
+}
+func (UnimplementedCompactTxStreamerServer) GetBlockRangeAcked(CompactTxStreamer_GetBlockRangeAckedServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetBlockRangeAcked not implemented")
+}
+func (UnimplementedCompactTxStreamerServer) GetFullBlockRange(*FullBlockRange, CompactTxStreamer_GetFullBlockRangeServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetFullBlockRange not implemented")
+}
 func (UnimplementedCompactTxStreamerServer) GetZECPrice(context.Context, *PriceRequest) (*PriceResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetZECPrice not implemented")
 }
@@ -428,12 +947,18 @@ func (UnimplementedCompactTxStreamerServer) GetCurrentZECPrice(context.Context,
 func (UnimplementedCompactTxStreamerServer) GetTransaction(context.Context, *TxFilter) (*RawTransaction, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetTransaction not implemented")
 }
+func (UnimplementedCompactTxStreamerServer) GetTransactionSummary(context.Context, *TxFilter) (*TransactionSummary, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTransactionSummary not implemented")
+}
 func (UnimplementedCompactTxStreamerServer) SendTransaction(context.Context, *RawTransaction) (*SendResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SendTransaction not implemented")
 }
 func (UnimplementedCompactTxStreamerServer) GetTaddressTxids(*TransparentAddressBlockFilter, CompactTxStreamer_GetTaddressTxidsServer) error {
 	return status.Errorf(codes.Unimplemented, "method GetTaddressTxids not implemented")
 }
+func (UnimplementedCompactTxStreamerServer) GetTaddressesTxids(CompactTxStreamer_GetTaddressesTxidsServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetTaddressesTxids not implemented")
+}
 func (UnimplementedCompactTxStreamerServer) GetTaddressBalance(context.Context, *AddressList) (*Balance, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetTaddressBalance not implemented")
 }
@@ -443,12 +968,21 @@ func (UnimplementedCompactTxStreamerServer) GetTaddressBalanceStream(CompactTxSt
 func (UnimplementedCompactTxStreamerServer) GetMempoolTx(*Exclude, CompactTxStreamer_GetMempoolTxServer) error {
 	return status.Errorf(codes.Unimplemented, "method GetMempoolTx not implemented")
 }
+func (UnimplementedCompactTxStreamerServer) GetMempoolTxForAddress(*Address, CompactTxStreamer_GetMempoolTxForAddressServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetMempoolTxForAddress not implemented")
+}
+func (UnimplementedCompactTxStreamerServer) SubscribeMempool(*Empty, CompactTxStreamer_SubscribeMempoolServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeMempool not implemented")
+}
 func (UnimplementedCompactTxStreamerServer) GetMempoolStream(*Empty, CompactTxStreamer_GetMempoolStreamServer) error {
 	return status.Errorf(codes.Unimplemented, "method GetMempoolStream not implemented")
 }
 func (UnimplementedCompactTxStreamerServer) GetTreeState(context.Context, *BlockID) (*TreeState, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetTreeState not implemented")
 }
+func (UnimplementedCompactTxStreamerServer) CheckBlockTreeState(context.Context, *BlockID) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckBlockTreeState not implemented")
+}
 func (UnimplementedCompactTxStreamerServer) GetAddressUtxos(context.Context, *GetAddressUtxosArg) (*GetAddressUtxosReplyList, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetAddressUtxos not implemented")
 }
@@ -458,36 +992,96 @@ func (UnimplementedCompactTxStreamerServer) GetAddressUtxosStream(*GetAddressUtx
 func (UnimplementedCompactTxStreamerServer) GetLightdInfo(context.Context, *Empty) (*LightdInfo, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetLightdInfo not implemented")
 }
+func (UnimplementedCompactTxStreamerServer) GetServerHealth(context.Context, *Empty) (*ServerHealth, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetServerHealth not implemented")
+}
 func (UnimplementedCompactTxStreamerServer) Ping(context.Context, *Duration) (*PingResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
 }
 func (UnimplementedCompactTxStreamerServer) mustEmbedUnimplementedCompactTxStreamerServer() {}
 
-// UnsafeCompactTxStreamerServer may be embedded to opt out of forward compatibility for this service.
-// Use of this interface is not recommended, as added methods to CompactTxStreamerServer will
-// result in compilation errors.
-type UnsafeCompactTxStreamerServer interface {
-	mustEmbedUnimplementedCompactTxStreamerServer()
+// UnsafeCompactTxStreamerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CompactTxStreamerServer will
+// result in compilation errors.
+type UnsafeCompactTxStreamerServer interface {
+	mustEmbedUnimplementedCompactTxStreamerServer()
+}
+
+func RegisterCompactTxStreamerServer(s grpc.ServiceRegistrar, srv CompactTxStreamerServer) {
+	s.RegisterService(&CompactTxStreamer_ServiceDesc, srv)
+}
+
+func _CompactTxStreamer_GetLatestBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChainSpec)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CompactTxStreamerServer).GetLatestBlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetLatestBlock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CompactTxStreamerServer).GetLatestBlock(ctx, req.(*ChainSpec))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CompactTxStreamer_GetLatestBlockLongPoll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LatestBlockWait)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CompactTxStreamerServer).GetLatestBlockLongPoll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetLatestBlockLongPoll",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CompactTxStreamerServer).GetLatestBlockLongPoll(ctx, req.(*LatestBlockWait))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CompactTxStreamer_SubscribeNewBlocks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Empty)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CompactTxStreamerServer).SubscribeNewBlocks(m, &compactTxStreamerSubscribeNewBlocksServer{stream})
+}
+
+type CompactTxStreamer_SubscribeNewBlocksServer interface {
+	Send(*BlockID) error
+	grpc.ServerStream
+}
+
+type compactTxStreamerSubscribeNewBlocksServer struct {
+	grpc.ServerStream
 }
 
-func RegisterCompactTxStreamerServer(s grpc.ServiceRegistrar, srv CompactTxStreamerServer) {
-	s.RegisterService(&CompactTxStreamer_ServiceDesc, srv)
+func (x *compactTxStreamerSubscribeNewBlocksServer) Send(m *BlockID) error {
+	return x.ServerStream.SendMsg(m)
 }
 
-func _CompactTxStreamer_GetLatestBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(ChainSpec)
+func _CompactTxStreamer_GetLatestBlocks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LatestBlocksRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(CompactTxStreamerServer).GetLatestBlock(ctx, in)
+		return srv.(CompactTxStreamerServer).GetLatestBlocks(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetLatestBlock",
+		FullMethod: "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetLatestBlocks",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(CompactTxStreamerServer).GetLatestBlock(ctx, req.(*ChainSpec))
+		return srv.(CompactTxStreamerServer).GetLatestBlocks(ctx, req.(*LatestBlocksRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
@@ -510,6 +1104,42 @@ func _CompactTxStreamer_GetBlock_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _CompactTxStreamer_GetBlockWithAnchors_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BlockID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CompactTxStreamerServer).GetBlockWithAnchors(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetBlockWithAnchors",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CompactTxStreamerServer).GetBlockWithAnchors(ctx, req.(*BlockID))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CompactTxStreamer_GetBlockCoinbase_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BlockID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CompactTxStreamerServer).GetBlockCoinbase(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetBlockCoinbase",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CompactTxStreamerServer).GetBlockCoinbase(ctx, req.(*BlockID))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _CompactTxStreamer_GetBlockRange_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(BlockRange)
 	if err := stream.RecvMsg(m); err != nil {
@@ -531,6 +1161,116 @@ func (x *compactTxStreamerGetBlockRangeServer) Send(m *CompactBlock) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _CompactTxStreamer_GetBlockNullifiers_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BlockRange)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CompactTxStreamerServer).GetBlockNullifiers(m, &compactTxStreamerGetBlockNullifiersServer{stream})
+}
+
+type CompactTxStreamer_GetBlockNullifiersServer interface {
+	Send(*BlockNullifiers) error
+	grpc.ServerStream
+}
+
+type compactTxStreamerGetBlockNullifiersServer struct {
+	grpc.ServerStream
+}
+
+func (x *compactTxStreamerGetBlockNullifiersServer) Send(m *BlockNullifiers) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _CompactTxStreamer_ExportBlocks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BlockRange)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CompactTxStreamerServer).ExportBlocks(m, &compactTxStreamerExportBlocksServer{stream})
+}
+
+type CompactTxStreamer_ExportBlocksServer interface {
+	Send(*BlockExport) error
+	grpc.ServerStream
+}
+
+type compactTxStreamerExportBlocksServer struct {
+	grpc.ServerStream
+}
+
+func (x *compactTxStreamerExportBlocksServer) Send(m *BlockExport) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _CompactTxStreamer_GetBlockRangeReverse_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BlockRange)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CompactTxStreamerServer).GetBlockRangeReverse(m, &compactTxStreamerGetBlockRangeReverseServer{stream})
+}
+
+type CompactTxStreamer_GetBlockRangeReverseServer interface {
+	Send(*CompactBlock) error
+	grpc.ServerStream
+}
+
+type compactTxStreamerGetBlockRangeReverseServer struct {
+	grpc.ServerStream
+}
+
+func (x *compactTxStreamerGetBlockRangeReverseServer) Send(m *CompactBlock) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _CompactTxStreamer_GetBlockRangeAcked_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CompactTxStreamerServer).GetBlockRangeAcked(&compactTxStreamerGetBlockRangeAckedServer{stream})
+}
+
+type CompactTxStreamer_GetBlockRangeAckedServer interface {
+	Send(*CompactBlock) error
+	Recv() (*BlockRangeAck, error)
+	grpc.ServerStream
+}
+
+type compactTxStreamerGetBlockRangeAckedServer struct {
+	grpc.ServerStream
+}
+
+func (x *compactTxStreamerGetBlockRangeAckedServer) Send(m *CompactBlock) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *compactTxStreamerGetBlockRangeAckedServer) Recv() (*BlockRangeAck, error) {
+	m := new(BlockRangeAck)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _CompactTxStreamer_GetFullBlockRange_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(FullBlockRange)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CompactTxStreamerServer).GetFullBlockRange(m, &compactTxStreamerGetFullBlockRangeServer{stream})
+}
+
+type CompactTxStreamer_GetFullBlockRangeServer interface {
+	Send(*FullBlock) error
+	grpc.ServerStream
+}
+
+type compactTxStreamerGetFullBlockRangeServer struct {
+	grpc.ServerStream
+}
+
+func (x *compactTxStreamerGetFullBlockRangeServer) Send(m *FullBlock) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _CompactTxStreamer_GetZECPrice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(PriceRequest)
 	if err := dec(in); err != nil {
@@ -585,6 +1325,24 @@ func _CompactTxStreamer_GetTransaction_Handler(srv interface{}, ctx context.Cont
 	return interceptor(ctx, in, info, handler)
 }
 
+func _CompactTxStreamer_GetTransactionSummary_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TxFilter)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CompactTxStreamerServer).GetTransactionSummary(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetTransactionSummary",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CompactTxStreamerServer).GetTransactionSummary(ctx, req.(*TxFilter))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _CompactTxStreamer_SendTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(RawTransaction)
 	if err := dec(in); err != nil {
@@ -624,6 +1382,32 @@ func (x *compactTxStreamerGetTaddressTxidsServer) Send(m *RawTransaction) error
 	return x.ServerStream.SendMsg(m)
 }
 
+func _CompactTxStreamer_GetTaddressesTxids_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CompactTxStreamerServer).GetTaddressesTxids(&compactTxStreamerGetTaddressesTxidsServer{stream})
+}
+
+type CompactTxStreamer_GetTaddressesTxidsServer interface {
+	Send(*RawTransaction) error
+	Recv() (*TransparentAddressBlockFilter, error)
+	grpc.ServerStream
+}
+
+type compactTxStreamerGetTaddressesTxidsServer struct {
+	grpc.ServerStream
+}
+
+func (x *compactTxStreamerGetTaddressesTxidsServer) Send(m *RawTransaction) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *compactTxStreamerGetTaddressesTxidsServer) Recv() (*TransparentAddressBlockFilter, error) {
+	m := new(TransparentAddressBlockFilter)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func _CompactTxStreamer_GetTaddressBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(AddressList)
 	if err := dec(in); err != nil {
@@ -689,6 +1473,48 @@ func (x *compactTxStreamerGetMempoolTxServer) Send(m *CompactTx) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _CompactTxStreamer_GetMempoolTxForAddress_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Address)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CompactTxStreamerServer).GetMempoolTxForAddress(m, &compactTxStreamerGetMempoolTxForAddressServer{stream})
+}
+
+type CompactTxStreamer_GetMempoolTxForAddressServer interface {
+	Send(*CompactTx) error
+	grpc.ServerStream
+}
+
+type compactTxStreamerGetMempoolTxForAddressServer struct {
+	grpc.ServerStream
+}
+
+func (x *compactTxStreamerGetMempoolTxForAddressServer) Send(m *CompactTx) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _CompactTxStreamer_SubscribeMempool_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Empty)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CompactTxStreamerServer).SubscribeMempool(m, &compactTxStreamerSubscribeMempoolServer{stream})
+}
+
+type CompactTxStreamer_SubscribeMempoolServer interface {
+	Send(*CompactTx) error
+	grpc.ServerStream
+}
+
+type compactTxStreamerSubscribeMempoolServer struct {
+	grpc.ServerStream
+}
+
+func (x *compactTxStreamerSubscribeMempoolServer) Send(m *CompactTx) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _CompactTxStreamer_GetMempoolStream_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(Empty)
 	if err := stream.RecvMsg(m); err != nil {
@@ -728,6 +1554,24 @@ func _CompactTxStreamer_GetTreeState_Handler(srv interface{}, ctx context.Contex
 	return interceptor(ctx, in, info, handler)
 }
 
+func _CompactTxStreamer_CheckBlockTreeState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BlockID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CompactTxStreamerServer).CheckBlockTreeState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.z.wallet.sdk.rpc.CompactTxStreamer/CheckBlockTreeState",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CompactTxStreamerServer).CheckBlockTreeState(ctx, req.(*BlockID))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _CompactTxStreamer_GetAddressUtxos_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(GetAddressUtxosArg)
 	if err := dec(in); err != nil {
@@ -785,6 +1629,24 @@ func _CompactTxStreamer_GetLightdInfo_Handler(srv interface{}, ctx context.Conte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _CompactTxStreamer_GetServerHealth_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CompactTxStreamerServer).GetServerHealth(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cash.z.wallet.sdk.rpc.CompactTxStreamer/GetServerHealth",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CompactTxStreamerServer).GetServerHealth(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _CompactTxStreamer_Ping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(Duration)
 	if err := dec(in); err != nil {
@@ -814,10 +1676,26 @@ var CompactTxStreamer_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetLatestBlock",
 			Handler:    _CompactTxStreamer_GetLatestBlock_Handler,
 		},
+		{
+			MethodName: "GetLatestBlockLongPoll",
+			Handler:    _CompactTxStreamer_GetLatestBlockLongPoll_Handler,
+		},
+		{
+			MethodName: "GetLatestBlocks",
+			Handler:    _CompactTxStreamer_GetLatestBlocks_Handler,
+		},
 		{
 			MethodName: "GetBlock",
 			Handler:    _CompactTxStreamer_GetBlock_Handler,
 		},
+		{
+			MethodName: "GetBlockWithAnchors",
+			Handler:    _CompactTxStreamer_GetBlockWithAnchors_Handler,
+		},
+		{
+			MethodName: "GetBlockCoinbase",
+			Handler:    _CompactTxStreamer_GetBlockCoinbase_Handler,
+		},
 		{
 			MethodName: "GetZECPrice",
 			Handler:    _CompactTxStreamer_GetZECPrice_Handler,
@@ -830,6 +1708,10 @@ var CompactTxStreamer_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetTransaction",
 			Handler:    _CompactTxStreamer_GetTransaction_Handler,
 		},
+		{
+			MethodName: "GetTransactionSummary",
+			Handler:    _CompactTxStreamer_GetTransactionSummary_Handler,
+		},
 		{
 			MethodName: "SendTransaction",
 			Handler:    _CompactTxStreamer_SendTransaction_Handler,
@@ -842,6 +1724,10 @@ var CompactTxStreamer_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetTreeState",
 			Handler:    _CompactTxStreamer_GetTreeState_Handler,
 		},
+		{
+			MethodName: "CheckBlockTreeState",
+			Handler:    _CompactTxStreamer_CheckBlockTreeState_Handler,
+		},
 		{
 			MethodName: "GetAddressUtxos",
 			Handler:    _CompactTxStreamer_GetAddressUtxos_Handler,
@@ -850,22 +1736,63 @@ var CompactTxStreamer_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetLightdInfo",
 			Handler:    _CompactTxStreamer_GetLightdInfo_Handler,
 		},
+		{
+			MethodName: "GetServerHealth",
+			Handler:    _CompactTxStreamer_GetServerHealth_Handler,
+		},
 		{
 			MethodName: "Ping",
 			Handler:    _CompactTxStreamer_Ping_Handler,
 		},
 	},
 	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubscribeNewBlocks",
+			Handler:       _CompactTxStreamer_SubscribeNewBlocks_Handler,
+			ServerStreams: true,
+		},
 		{
 			StreamName:    "GetBlockRange",
 			Handler:       _CompactTxStreamer_GetBlockRange_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "GetBlockNullifiers",
+			Handler:       _CompactTxStreamer_GetBlockNullifiers_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ExportBlocks",
+			Handler:       _CompactTxStreamer_ExportBlocks_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "GetBlockRangeReverse",
+			Handler:       _CompactTxStreamer_GetBlockRangeReverse_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "GetBlockRangeAcked",
+			Handler:       _CompactTxStreamer_GetBlockRangeAcked_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "GetFullBlockRange",
+			Handler:       _CompactTxStreamer_GetFullBlockRange_Handler,
+			ServerStreams: true,
+		},
 		{
 			StreamName:    "GetTaddressTxids",
 			Handler:       _CompactTxStreamer_GetTaddressTxids_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "GetTaddressesTxids",
+			Handler:       _CompactTxStreamer_GetTaddressesTxids_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 		{
 			StreamName:    "GetTaddressBalanceStream",
 			Handler:       _CompactTxStreamer_GetTaddressBalanceStream_Handler,
@@ -876,6 +1803,16 @@ var CompactTxStreamer_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _CompactTxStreamer_GetMempoolTx_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "GetMempoolTxForAddress",
+			Handler:       _CompactTxStreamer_GetMempoolTxForAddress_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "SubscribeMempool",
+			Handler:       _CompactTxStreamer_SubscribeMempool_Handler,
+			ServerStreams: true,
+		},
 		{
 			StreamName:    "GetMempoolStream",
 			Handler:       _CompactTxStreamer_GetMempoolStream_Handler,